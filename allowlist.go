@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// allowlist is the set of driver versions a --allowlist file permits. Each
+// entry is a full version or a leading part of one, such as a major.
+type allowlist struct {
+	Versions []string `json:"versions"`
+}
+
+// loadAllowlist reads the allowlist at path, refusing entries that are no
+// version or part of one.
+func loadAllowlist(path string) (*allowlist, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading allowlist: %w", err)
+	}
+	var a allowlist
+	if err := json.Unmarshal(b, &a); err != nil {
+		return nil, fmt.Errorf("parsing allowlist %s: %w", path, err)
+	}
+	for _, v := range a.Versions {
+		if !isVersionPrefix(v) {
+			return nil, fmt.Errorf("allowlist %s: invalid version %q", path, v)
+		}
+	}
+	return &a, nil
+}
+
+func isVersionPrefix(s string) bool {
+	for _, part := range strings.Split(s, ".") {
+		if !isMajor(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// allows reports whether version matches an entry of the list.
+func (a *allowlist) allows(version string) bool {
+	for _, v := range a.Versions {
+		if version == v || strings.HasPrefix(version, v+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAllowlist refuses release when an --allowlist is loaded and does not
+// permit its version.
+func (c *cli) checkAllowlist(release *Release) error {
+	if c.permitted == nil || c.permitted.allows(release.Version) {
+		return nil
+	}
+	return fmt.Errorf("version %s not permitted by allowlist", release.Version)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAllowlist(t *testing.T) {
+	s := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "allowlist.json")
+	if err := os.WriteFile(path, []byte(`{"versions": ["115.0.5790.98", "116"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	install := func(spec string) error {
+		_, _, err := runCLI(t, s.args(t, t.TempDir(), "--allowlist", path, "-v", spec)...)
+		return err
+	}
+	for _, spec := range []string{"115.0.5790.98", "116", testStable} {
+		if err := install(spec); err != nil {
+			t.Errorf("allowlisted %s: %v", spec, err)
+		}
+	}
+	// 115 resolves to 115.0.5790.102, which only shares the major.
+	if err := install("115"); err == nil || !strings.Contains(err.Error(), "version 115.0.5790.102 not permitted by allowlist") {
+		t.Errorf("got %v, want 115.0.5790.102 refused", err)
+	}
+	if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"); n != 0 {
+		t.Errorf("downloaded the refused driver %d times", n)
+	}
+
+	// Without an allowlist anything goes.
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "-v", "115")...); err != nil {
+		t.Errorf("without an allowlist: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"versions": ["115.x"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := install("115.0.5790.98"); err == nil || !strings.Contains(err.Error(), `invalid version "115.x"`) {
+		t.Errorf("got %v, want the bad entry refused", err)
+	}
+}
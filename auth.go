@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHosts are the public hosts the tool talks to on its own.
+// Credentials are never sent to them.
+var defaultHosts = []string{
+	"chromedriver.storage.googleapis.com",
+	"storage.googleapis.com",
+	"googlechromelabs.github.io",
+	"chromedriver.chromium.org",
+}
+
+// authTransport adds credentials to requests for the configured mirror
+// hosts only.
+type authTransport struct {
+	base  http.RoundTripper
+	hosts map[string]bool
+	// header is a raw "Name: value" header; token is sent as a bearer
+	// Authorization header. When neither is set, ~/.netrc is consulted.
+	header string
+	token  string
+	netrc  map[string][2]string
+}
+
+// mirrorHosts returns the hosts of mirrorURLs, leaving out the default
+// hosts and URLs that name none.
+func mirrorHosts(mirrorURLs []string) map[string]bool {
+	hosts := make(map[string]bool)
+	for _, raw := range mirrorURLs {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" || isDefaultHost(u.Hostname()) {
+			continue
+		}
+		hosts[u.Host] = true
+	}
+	return hosts
+}
+
+// newAuthTransport wraps base so that requests to the hosts of mirrorURLs
+// carry credentials.
+func newAuthTransport(base http.RoundTripper, token, header string, mirrorURLs ...string) *authTransport {
+	t := &authTransport{
+		base:   base,
+		hosts:  mirrorHosts(mirrorURLs),
+		header: header,
+		token:  token,
+	}
+	if token == "" && header == "" {
+		t.netrc = readNetrc()
+	}
+	return t
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.hosts[req.URL.Host] {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	switch {
+	case t.header != "":
+		if parts := strings.SplitN(t.header, ":", 2); len(parts) == 2 {
+			req.Header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		}
+	case t.token != "":
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	default:
+		if cred, ok := t.netrc[req.URL.Hostname()]; ok {
+			req.SetBasicAuth(cred[0], cred[1])
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// maxRedirects is how many redirects a request follows, as http.Client
+// does by default.
+const maxRedirects = 10
+
+// redirectPolicy is an http.Client CheckRedirect that drops credentials
+// from a redirect to another host than the request first went to: the
+// Authorization header and, with --auth-header, the named header. The
+// transport adds credentials only for mirror hosts, but a caller setting
+// them on the request itself would otherwise send them along.
+func redirectPolicy(header string) func(req *http.Request, via []*http.Request) error {
+	name := ""
+	if parts := strings.SplitN(header, ":", 2); len(parts) == 2 {
+		name = strings.TrimSpace(parts[0])
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+			req.Header.Del("Authorization")
+			if name != "" {
+				req.Header.Del(name)
+			}
+		}
+		return nil
+	}
+}
+
+func isDefaultHost(host string) bool {
+	for _, h := range defaultHosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// readNetrc returns the login and password of each machine in ~/.netrc.
+// A missing or unreadable file yields no credentials.
+func readNetrc() map[string][2]string {
+	creds := make(map[string][2]string)
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return creds
+	}
+	f, err := os.Open(filepath.Join(home, ".netrc"))
+	if err != nil {
+		return creds
+	}
+	defer f.Close()
+
+	var machine, login, password string
+	flush := func() {
+		if machine != "" {
+			creds[machine] = [2]string{login, password}
+		}
+		machine, login, password = "", "", ""
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Split(bufio.ScanWords)
+	for sc.Scan() {
+		switch sc.Text() {
+		case "machine":
+			flush()
+			if sc.Scan() {
+				machine = sc.Text()
+			}
+		case "default":
+			flush()
+		case "login":
+			if sc.Scan() {
+				login = sc.Text()
+			}
+		case "password":
+			if sc.Scan() {
+				password = sc.Text()
+			}
+		}
+	}
+	flush()
+	return creds
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sentHeaders sends a GET for each url through the auth transport of token
+// and header and returns the header each request reached the network with.
+func sentHeaders(t *testing.T, token, header string, mirrorURLs []string, urls ...string) []http.Header {
+	var sent []http.Header
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, req.Header)
+		return stubResponse(req, http.StatusOK, nil), nil
+	})
+	client := &http.Client{Transport: newAuthTransport(base, token, header, mirrorURLs...)}
+	for _, url := range urls {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	return sent
+}
+
+func TestAuthOnlyForMirrorHosts(t *testing.T) {
+	mirror := "https://mirror.example/cft/115.0.5790.102/linux64/chromedriver-linux64.zip"
+	upstream := "https://storage.googleapis.com/chrome-for-testing-public/115.0.5790.102/linux64/chromedriver-linux64.zip"
+	// The default host is never a mirror host, even when named as one.
+	mirrors := []string{"https://mirror.example/cft", "https://storage.googleapis.com/chrome-for-testing-public"}
+
+	sent := sentHeaders(t, "secret", "", mirrors, mirror, upstream)
+	if got := sent[0].Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("mirror got Authorization %q, want the bearer token", got)
+	}
+	if got := sent[1].Get("Authorization"); got != "" {
+		t.Errorf("default host got Authorization %q", got)
+	}
+
+	sent = sentHeaders(t, "", "X-Api-Key: secret", mirrors, mirror, upstream)
+	if got := sent[0].Get("X-Api-Key"); got != "secret" {
+		t.Errorf("mirror got X-Api-Key %q, want the --auth-header value", got)
+	}
+	if got := sent[1].Get("X-Api-Key"); got != "" {
+		t.Errorf("default host got X-Api-Key %q", got)
+	}
+}
+
+func TestAuthNetrc(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	netrc := "machine mirror.example login ci password hunter2\nmachine storage.googleapis.com login me password leaked\n"
+	if err := os.WriteFile(filepath.Join(home, ".netrc"), []byte(netrc), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := sentHeaders(t, "", "", []string{"https://mirror.example/cft"},
+		"https://mirror.example/cft/LATEST_RELEASE", "https://storage.googleapis.com/LATEST_RELEASE")
+	req := &http.Request{Header: sent[0]}
+	if user, pass, ok := req.BasicAuth(); !ok || user != "ci" || pass != "hunter2" {
+		t.Errorf("mirror got basic auth %q:%q, want the .netrc login", user, pass)
+	}
+	if got := sent[1].Get("Authorization"); got != "" {
+		t.Errorf("default host got Authorization %q", got)
+	}
+}
+
+func TestRedirectDropsCredentials(t *testing.T) {
+	// mirror.example sends its archives on to a CDN on another host, and
+	// has moved /old to /cft on its own host.
+	var sent []*http.Request
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		sent = append(sent, req)
+		target := ""
+		if req.URL.Host == "mirror.example" && strings.HasSuffix(req.URL.Path, ".zip") {
+			target = "https://cdn.example" + req.URL.Path
+		} else if req.URL.Host == "mirror.example" && strings.HasPrefix(req.URL.Path, "/old/") {
+			target = "https://mirror.example/cft/" + strings.TrimPrefix(req.URL.Path, "/old/")
+		}
+		if target != "" {
+			resp := stubResponse(req, http.StatusFound, nil)
+			resp.Header = http.Header{"Location": {target}}
+			return resp, nil
+		}
+		return stubResponse(req, http.StatusOK, nil), nil
+	})
+	client := &http.Client{Transport: base, CheckRedirect: redirectPolicy("X-Api-Key: secret")}
+	get := func(url string) {
+		t.Helper()
+		sent = nil
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Api-Key", "secret")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	get("https://mirror.example/cft/chromedriver-linux64.zip")
+	if len(sent) != 2 || sent[1].URL.Host != "cdn.example" {
+		t.Fatalf("sent %d requests, want the mirror's and the CDN's", len(sent))
+	}
+	if sent[0].Header.Get("Authorization") == "" {
+		t.Error("the mirror did not get the credentials")
+	}
+	if h := sent[1].Header; h.Get("Authorization") != "" || h.Get("X-Api-Key") != "" {
+		t.Errorf("the redirect to another host sent %v", h)
+	}
+
+	// A redirect within the host keeps them.
+	get("https://mirror.example/old/LICENSE")
+	if len(sent) != 2 || sent[1].Header.Get("Authorization") != "Bearer secret" || sent[1].Header.Get("X-Api-Key") != "secret" {
+		t.Errorf("the redirect within the host sent %v", sent[len(sent)-1].Header)
+	}
+
+	if d, _ := flagDownloader(t, "--auth-token", "secret"); d.Client.CheckRedirect == nil {
+		t.Error("the command line's client follows redirects with the default policy")
+	}
+}
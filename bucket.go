@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// bucketListURL enumerates the version prefixes of the legacy storage
+// bucket through its XML listing API.
+const bucketListURL = "https://chromedriver.storage.googleapis.com/?delimiter=/&prefix="
+
+var bucketVersionPattern = regexp.MustCompile(`^\d+(\.\d+)+$`)
+
+type bucketListing struct {
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// listBucket reads the versions published in the legacy storage bucket.
+func (d *Downloader) listBucket() (map[string][]string, error) {
+	resp, err := d.get(d.BucketURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", d.BucketURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", d.BucketURL, resp.Status)
+	}
+
+	versionMap, err := parseBucketListing(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", d.BucketURL, err)
+	}
+	return versionMap, nil
+}
+
+func parseBucketListing(r io.Reader) (map[string][]string, error) {
+	var listing bucketListing
+	if err := xml.NewDecoder(r).Decode(&listing); err != nil {
+		return nil, err
+	}
+
+	versionMap := make(map[string][]string)
+	for _, p := range listing.CommonPrefixes {
+		version := strings.TrimSuffix(p.Prefix, "/")
+		if !bucketVersionPattern.MatchString(version) {
+			continue
+		}
+		major := strings.SplitN(version, ".", 2)[0]
+		versionMap[major] = append(versionMap[major], version)
+	}
+	return versionMap, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sampleBucketListing = `<?xml version='1.0' encoding='UTF-8'?>
+<ListBucketResult xmlns="http://doc.s3.amazonaws.com/2006-03-01">
+  <Name>chromedriver</Name>
+  <Prefix></Prefix>
+  <Marker></Marker>
+  <Delimiter>/</Delimiter>
+  <IsTruncated>false</IsTruncated>
+  <Contents>
+    <Key>LATEST_RELEASE</Key>
+    <Size>13</Size>
+  </Contents>
+  <CommonPrefixes><Prefix>113.0.5672.63/</Prefix></CommonPrefixes>
+  <CommonPrefixes><Prefix>114.0.5735.16/</Prefix></CommonPrefixes>
+  <CommonPrefixes><Prefix>114.0.5735.90/</Prefix></CommonPrefixes>
+  <CommonPrefixes><Prefix>icons/</Prefix></CommonPrefixes>
+</ListBucketResult>`
+
+func TestParseBucketListing(t *testing.T) {
+	versions, err := parseBucketListing(strings.NewReader(sampleBucketListing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"113": {"113.0.5672.63"},
+		"114": {"114.0.5735.16", "114.0.5735.90"},
+	}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("parsed %v, want %v", versions, want)
+	}
+}
+
+func TestListFallsBackToBucket(t *testing.T) {
+	s := newTestServer(t)
+	s.mux.HandleFunc("/bucket", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sampleBucketListing))
+	})
+	d := s.downloader()
+	d.Sources = nil
+	d.FeedURL = s.URL + "/missing.json"
+	d.PageURL = s.URL + "/missing.html"
+	d.BucketURL = s.URL + "/bucket"
+	d.Retries = 0
+	release, err := d.Resolve("114")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Version != "114.0.5735.90" {
+		t.Errorf("resolved %s from the bucket listing, want 114.0.5735.90", release.Version)
+	}
+}
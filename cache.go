@@ -0,0 +1,308 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultCacheDir is where archives are cached when --cache-dir is not
+// given.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(".", ".getchromedriver-cache")
+	}
+	return filepath.Join(dir, "getchromedriver")
+}
+
+// cachePath is where the archive of release is kept in the cache.
+func (d *Downloader) cachePath(release *Release) string {
+	return filepath.Join(d.CacheDir, release.Version, release.Platform, filepath.Base(release.URL))
+}
+
+// cacheSumSuffix names the file next to a cached archive that holds its
+// SHA-256, recorded when the archive was downloaded.
+const cacheSumSuffix = ".sha256"
+
+// cacheLockSuffix names the file next to a cached archive that is locked
+// while the archive is downloaded, so that parallel runs fetch it once.
+const cacheLockSuffix = ".lock"
+
+// downloadCached returns the cached archive of release, found through the
+// cache index, downloading it into the cache first when it is missing or
+// fails verification. A hit refreshes the entry's mtime so pruning keeps
+// archives that are still in use.
+//
+// Downloads hold a lock on the entry and write to a temporary file of their
+// own that is renamed into place, so readers never see a partial archive and
+// a second run waiting on the lock picks up the first one's download.
+func (d *Downloader) downloadCached(release *Release) (string, error) {
+	path := d.cachePath(release)
+	var indexed string
+	if cached, entry, ok := d.lookupCached(release); ok {
+		path, indexed = cached, entry.SHA256
+	}
+	ok, err := d.useCached(release, path, indexed)
+	if ok {
+		return path, nil
+	}
+	if err != nil {
+		if err := d.warnf("cached %s is invalid (%v), downloading it again", path, err); err != nil {
+			return "", err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("creating cache dir: %w", err)
+	}
+	unlock, err := tryLock(path+cacheLockSuffix, true)
+	if err != nil {
+		d.verbosef("not locking %s: %v\n", path, err)
+	} else {
+		defer unlock()
+		if ok, _ := d.useCached(release, path, ""); ok {
+			return path, nil
+		}
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("creating %s: %w", path, err)
+	}
+	tmp := f.Name()
+	if err := d.DownloadTo(release, f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("writing %s: %w", tmp, err)
+	}
+	// The checksum goes first: a reader checking the old archive against
+	// the new checksum downloads again, where the other way round a good
+	// archive would be rejected.
+	if err := writeCacheSum(path, release.SHA256); err != nil {
+		d.verbosef("recording checksum of %s: %v\n", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("writing %s: %w", path, err)
+	}
+	d.indexCached(release, path, release.SHA256)
+	return path, nil
+}
+
+// useCached reports whether the cached archive at path can be used for
+// release, filling in its checksum when it can. indexed is the SHA-256
+// the cache index holds for it, if any; an archive verified without one
+// has its sum indexed for the next hit. The error says why an archive
+// that is there cannot be used.
+func (d *Downloader) useCached(release *Release, path, indexed string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		return false, nil
+	}
+	sum, err := d.verifyCached(path, indexed)
+	if err != nil {
+		return false, err
+	}
+	release.SHA256 = sum
+	if indexed == "" {
+		d.indexCached(release, path, sum)
+	}
+	d.Stats.addCacheHit(release.URL)
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	os.Chtimes(path+cacheSumSuffix, now, now)
+	d.verbosef("using cached %s\n", path)
+	return true, nil
+}
+
+// writeCacheSum records sum next to the cached archive at path through a
+// temporary file, so that a concurrent reader sees the old or new checksum
+// but never half of one.
+func writeCacheSum(path, sum string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+cacheSumSuffix+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.WriteString(sum + "\n"); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+cacheSumSuffix); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// verifyCached checks the cached archive at path against --checksum or the
+// SHA-256 recorded with it, or failing both, that it opens as an archive.
+// indexed, when set, is the SHA-256 the cache index holds for an archive
+// of the indexed size, and is taken for its sum without hashing it again.
+// It returns the archive's SHA-256.
+func (d *Downloader) verifyCached(path, indexed string) (string, error) {
+	sum := indexed
+	if sum == "" {
+		var err error
+		if sum, err = fileSHA256(path); err != nil {
+			return "", err
+		}
+	}
+	if d.Checksum != "" && d.checksumAlgo() != "sha256" {
+		got, err := fileChecksum(path, d.checksumAlgo())
+		if err != nil {
+			return "", err
+		}
+		if !strings.EqualFold(d.Checksum, got) {
+			return "", fmt.Errorf("%s checksum %s does not match %s", d.checksumAlgo(), got, d.Checksum)
+		}
+		return sum, nil
+	}
+	want := d.Checksum
+	if want == "" && indexed != "" {
+		return sum, nil
+	}
+	if want == "" {
+		if b, err := ioutil.ReadFile(path + cacheSumSuffix); err == nil {
+			want = strings.TrimSpace(string(b))
+		}
+	}
+	if want != "" {
+		if !strings.EqualFold(want, sum) {
+			return "", fmt.Errorf("checksum %s does not match %s", sum, want)
+		}
+		return sum, nil
+	}
+	if err := checkArchive(path); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// checkArchive does a quick structural check of the archive at path: a zip
+// must have a readable central directory and a tar.gz a valid gzip stream.
+func checkArchive(path string) error {
+	if strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz") {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(ioutil.Discard, gz)
+		return err
+	}
+	zipped, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	return zipped.Close()
+}
+
+// pruneCache removes cached archives last used before olderThan ago,
+// along with the directories left empty, and returns the bytes freed. Lock
+// files are kept, and with them their directories, as a run may hold them.
+func pruneCache(dir string, olderThan time.Duration) (int64, int, error) {
+	cutoff := time.Now().Add(-olderThan)
+	var (
+		freed   int64
+		removed int
+		dirs    []string
+	)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != dir {
+				dirs = append(dirs, path)
+			}
+			return nil
+		}
+		// A lock file may be held by a run downloading right now, and
+		// removing it would let the next run lock a new file alongside.
+		if strings.HasSuffix(path, cacheLockSuffix) {
+			return nil
+		}
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			freed += info.Size()
+			if isCachedArchive(path) {
+				removed++
+			}
+		}
+		return nil
+	})
+	// Deepest directories come last in walk order; remove them first so
+	// their parents can empty out too. Non-empty ones fail and are kept.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	// The index is rebuilt by the next lookup rather than patched here.
+	if removed > 0 {
+		os.Remove(filepath.Join(dir, cacheIndexName))
+	}
+	return freed, removed, err
+}
+
+// isCachedArchive reports whether path in the cache is an archive rather
+// than a checksum, lock or leftover temporary file kept alongside one, or
+// the index or version list kept at the top.
+func isCachedArchive(path string) bool {
+	if base := filepath.Base(path); base == cacheIndexName || base == listCacheName {
+		return false
+	}
+	for _, suffix := range []string{cacheSumSuffix, cacheLockSuffix, ".tmp"} {
+		if strings.HasSuffix(path, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseAge parses a duration that may also use d (days) and w (weeks)
+// units, such as 30d or 2w.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return age, nil
+}
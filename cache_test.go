@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// seedCache writes a file of size bytes at rel under dir, last used age
+// ago.
+func seedCache(t testing.TB, dir, rel string, size int, age time.Duration) string {
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatal(err)
+	}
+	used := time.Now().Add(-age)
+	if err := os.Chtimes(path, used, used); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCachePrune(t *testing.T) {
+	dir := t.TempDir()
+	const day = 24 * time.Hour
+	oldArchive := seedCache(t, dir, "115.0.5790.98/linux64/chromedriver-linux64.zip", 1000, 40*day)
+	oldSum := seedCache(t, dir, "115.0.5790.98/linux64/chromedriver-linux64.zip"+cacheSumSuffix, 64, 40*day)
+	oldLock := seedCache(t, dir, "115.0.5790.102/linux64/chromedriver-linux64.zip"+cacheLockSuffix, 0, 40*day)
+	newArchive := seedCache(t, dir, "116.0.5845.96/linux64/chromedriver-linux64.zip", 2000, day)
+
+	stdout, _, err := runCLI(t, "cache", "prune", "--older-than", "30d", "--cache-dir", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("removed 1 archives, freed %d bytes\n", 1000+64); stdout != want {
+		t.Errorf("printed %q, want %q", stdout, want)
+	}
+	for _, path := range []string{oldArchive, oldSum, filepath.Dir(oldArchive)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was kept: %v", path, err)
+		}
+	}
+	for _, path := range []string{oldLock, newArchive} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed: %v", path, err)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+		"1.5d": 36 * time.Hour,
+		"90m":  90 * time.Minute,
+	} {
+		if got, err := parseAge(in); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %s, %v; want %s", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "d", "-1d", "30 days", "-5m"} {
+		if _, err := parseAge(in); err == nil {
+			t.Errorf("parseAge(%q) succeeded", in)
+		}
+	}
+}
+
+func TestCorruptCacheRefetched(t *testing.T) {
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	for name, seed := range map[string]func(path string){
+		"truncated": func(path string) {
+			os.WriteFile(path, archive[:len(archive)/2], 0644)
+		},
+		"checksum mismatch": func(path string) {
+			damaged := append([]byte(nil), archive...)
+			damaged[len(damaged)/2] ^= 0xff
+			os.WriteFile(path, damaged, 0644)
+			writeCacheSum(path, sha256Hex(archive))
+		},
+	} {
+		s := newTestServer(t)
+		d := s.downloader()
+		d.CacheDir = t.TempDir()
+		var log bytes.Buffer
+		d.Log = &log
+		release, err := d.Resolve("115")
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := d.cachePath(release)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		seed(path)
+
+		got, _, err := d.Download(release)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if b, _ := os.ReadFile(got); !bytes.Equal(b, archive) {
+			t.Errorf("%s: the cache holds %d bytes, not the served archive", name, len(b))
+		}
+		if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"); n != 1 {
+			t.Errorf("%s: downloaded %d times, want once", name, n)
+		}
+		if !strings.Contains(log.String(), "is invalid") || !strings.Contains(log.String(), "downloading it again") {
+			t.Errorf("%s: logged %q, want the refetch explained", name, log.String())
+		}
+
+		// The fresh entry is used as it is.
+		if _, _, err := d.Download(release); err != nil {
+			t.Fatal(err)
+		}
+		if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"); n != 1 {
+			t.Errorf("%s: downloaded the refetched entry again", name)
+		}
+	}
+}
+
+func TestCacheWarm(t *testing.T) {
+	s := newTestServer(t)
+	dir := t.TempDir()
+	stdout, _, err := runCLI(t, append([]string{"cache", "warm"}, s.args(t, t.TempDir(), "--cache-dir", dir, "-v", "115", "-v", "116")...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, listCacheName)); err != nil {
+		t.Errorf("the version list was not cached: %v", err)
+	}
+	for _, version := range []string{"115.0.5790.102", testStable} {
+		if !strings.Contains(stdout, "cached "+version+" for linux64 in "+dir) {
+			t.Errorf("printed %q, want %s cached", stdout, version)
+		}
+		if n := s.hitCount("/dl/" + version + "/linux64/chromedriver-linux64.zip"); n != 1 {
+			t.Errorf("fetched %s %d times, want once", version, n)
+		}
+	}
+
+	// A later run needs no network for the warmed drivers.
+	for _, spec := range []string{"115", "116"} {
+		out := t.TempDir()
+		if _, _, err := runCLI(t, s.args(t, out, "--cache", "--cache-dir", dir, "--no-network", "-v", spec)...); err != nil {
+			t.Errorf("installing %s offline: %v", spec, err)
+		}
+	}
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--cache", "--cache-dir", dir, "--no-network", "-v", "115.0.5790.98")...); !errors.Is(err, ErrNetworkDisabled) {
+		t.Errorf("got %v for a driver not warmed, want the network refused", err)
+	}
+}
+
+func TestCacheConcurrentWrites(t *testing.T) {
+	s := newTestServer(t)
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		// Slow enough that the downloads overlap.
+		time.Sleep(50 * time.Millisecond)
+		w.Write(archive)
+	})
+	dir := t.TempDir()
+
+	// Each download has a Downloader of its own, as separate runs would.
+	const downloads = 8
+	var wg sync.WaitGroup
+	paths := make([]string, downloads)
+	errs := make([]error, downloads)
+	for i := 0; i < downloads; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d := s.downloader()
+			d.CacheDir = dir
+			release, err := d.Resolve("115.0.5790.102")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			var cleanup func() error
+			paths[i], cleanup, errs[i] = d.Download(release)
+			if cleanup != nil {
+				defer cleanup()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("download %d: %v", i, err)
+		}
+		if paths[i] != paths[0] {
+			t.Errorf("download %d got %s, want the one entry %s", i, paths[i], paths[0])
+		}
+	}
+	if b, err := os.ReadFile(paths[0]); err != nil || !bytes.Equal(b, archive) {
+		t.Errorf("the cached archive is not the download: %v", err)
+	}
+	if b, err := os.ReadFile(paths[0] + cacheSumSuffix); err != nil || string(b) != sha256Hex(archive)+"\n" {
+		t.Errorf("recorded checksum %q, %v, want the archive's", b, err)
+	}
+	if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"); n != 1 {
+		t.Errorf("fetched the archive %d times, want the others to wait for the first", n)
+	}
+	entries, err := os.ReadDir(filepath.Dir(paths[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			t.Errorf("left %s in the cache", e.Name())
+		}
+	}
+}
+
+func TestNoNetwork(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	dir := t.TempDir()
+	if _, _, err := runCLI(t, append([]string{"cache", "warm"}, s.args(t, t.TempDir(), "--cache-dir", dir, "-v", "115")...)...); err != nil {
+		t.Fatal(err)
+	}
+	requests := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		n := 0
+		for _, hits := range s.hits {
+			n += hits
+		}
+		return n
+	}
+	warmed := requests()
+
+	out := t.TempDir()
+	args := s.args(t, out, "--no-network", "--cache", "--cache-dir", dir, "--list-cache-ttl", "0s", "-v", "115")
+	_, stderr, err := runCLI(t, args...)
+	if err != nil {
+		t.Fatalf("a run served by a warmed cache: %v", err)
+	}
+	if !isInstalledIn(out, "115.0.5790.102") {
+		t.Error("the cached driver was not installed")
+	}
+	if n := requests() - warmed; n != 0 {
+		t.Errorf("made %d requests under --no-network", n)
+	}
+	if strings.Contains(stderr, "using the cached version list") {
+		t.Errorf("warned %q about not fetching", stderr)
+	}
+
+	// 116 was never cached, and would have to be downloaded.
+	args = s.args(t, t.TempDir(), "--no-network", "--cache", "--cache-dir", dir, "-v", "116")
+	if _, _, err := runCLI(t, args...); !errors.Is(err, ErrNetworkDisabled) {
+		t.Errorf("got %v, want the request refused", err)
+	}
+	if n := requests() - warmed; n != 0 {
+		t.Errorf("made %d requests under --no-network", n)
+	}
+}
+
+func TestCacheIndex(t *testing.T) {
+	s := newTestServer(t)
+	d := s.downloader()
+	d.CacheDir = t.TempDir()
+	var log bytes.Buffer
+	d.Log = &log
+	d.Verbose = true
+	release, err := d.Resolve("115.0.5790.102")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := d.Download(release); err != nil {
+		t.Fatal(err)
+	}
+	idx := d.readCacheIndex()
+	entry, ok := idx.Entries[cacheIndexKey(release)]
+	if !ok || entry.Path != "115.0.5790.102/linux64/chromedriver-linux64.zip" || entry.SHA256 != release.SHA256 {
+		t.Fatalf("indexed %+v, want the downloaded archive", idx.Entries)
+	}
+
+	// A hit takes the indexed sum, reading neither the recorded checksum
+	// nor the archive to hash it.
+	sum := release.SHA256
+	if err := writeCacheSum(d.cachePath(release), strings.Repeat("0", 64)); err != nil {
+		t.Fatal(err)
+	}
+	release.SHA256 = ""
+	if _, _, err := d.Download(release); err != nil {
+		t.Fatalf("a hit checked the recorded checksum rather than the index: %v", err)
+	}
+	if release.SHA256 != sum {
+		t.Errorf("a hit gave the sum %s, want the indexed %s", release.SHA256, sum)
+	}
+	if err := writeCacheSum(d.cachePath(release), sum); err != nil {
+		t.Fatal(err)
+	}
+
+	// An archive the index places elsewhere is found there, which takes
+	// the index: a scan would not look for it under another name.
+	moved := filepath.Join(d.CacheDir, "moved", "here", "archive.zip")
+	if err := os.MkdirAll(filepath.Dir(moved), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(d.cachePath(release), moved); err != nil {
+		t.Fatal(err)
+	}
+	entry.Path = "moved/here/archive.zip"
+	idx.Entries[cacheIndexKey(release)] = entry
+	d.writeCacheIndex(idx)
+	log.Reset()
+	if path, entry, ok := d.lookupCached(release); !ok || path != moved || entry.SHA256 != release.SHA256 {
+		t.Errorf("looked up %s, %+v, %v, want the indexed %s", path, entry, ok, moved)
+	}
+	if strings.Contains(log.String(), "indexed") {
+		t.Errorf("scanned the cache for an indexed archive: %q", log.String())
+	}
+
+	// A missing index is rebuilt from the cache.
+	if err := os.Rename(moved, d.cachePath(release)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(d.cacheIndexPath()); err != nil {
+		t.Fatal(err)
+	}
+	if path, _, ok := d.lookupCached(release); !ok || path != d.cachePath(release) {
+		t.Errorf("without an index, looked up %s, %v", path, ok)
+	}
+	if _, err := os.Stat(d.cacheIndexPath()); err != nil {
+		t.Errorf("the index was not rebuilt: %v", err)
+	}
+	// A rebuilt entry is verified on its first hit, which indexes its sum.
+	if entry := d.readCacheIndex().Entries[cacheIndexKey(release)]; entry.SHA256 != "" {
+		t.Errorf("the rebuilt index took the sum %s unverified", entry.SHA256)
+	}
+	if _, _, err := d.Download(release); err != nil {
+		t.Fatal(err)
+	}
+	if entry := d.readCacheIndex().Entries[cacheIndexKey(release)]; entry.SHA256 != sum {
+		t.Errorf("a verified hit indexed the sum %q, want %s", entry.SHA256, sum)
+	}
+	// So is a stale one, whose entry no longer matches the file.
+	if err := os.WriteFile(d.cachePath(release), []byte("truncated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	log.Reset()
+	d.lookupCached(release)
+	if !strings.Contains(log.String(), "indexed 1 cached archives") {
+		t.Errorf("logged %q, want the stale index rebuilt", log.String())
+	}
+	if entry := d.readCacheIndex().Entries[cacheIndexKey(release)]; entry.Size != int64(len("truncated")) {
+		t.Errorf("the rebuilt index has a size of %d, want the file's", entry.Size)
+	}
+}
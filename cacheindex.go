@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// cacheIndexName is the file in CacheDir indexing the cached archives, so
+// that finding one does not take a walk of the cache.
+const cacheIndexName = "index.json"
+
+// cacheIndex maps the key of each cached archive, its version, platform
+// and name, to where it is kept.
+type cacheIndex struct {
+	SchemaVersion int                        `json:"schemaVersion"`
+	Entries       map[string]cacheIndexEntry `json:"entries"`
+}
+
+// cacheIndexEntry is one cached archive. Path is relative to CacheDir and
+// slash-separated. SHA256 is the sum of the archive as downloaded or last
+// verified, and empty for one the index found on disk but has not checked.
+type cacheIndexEntry struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size"`
+}
+
+func cacheIndexKey(release *Release) string {
+	return release.Version + "/" + release.Platform + "/" + filepath.Base(release.URL)
+}
+
+func (d *Downloader) cacheIndexPath() string {
+	return filepath.Join(d.CacheDir, cacheIndexName)
+}
+
+// readCacheIndex returns the index in CacheDir, rebuilding it from the
+// cache when it is missing or unreadable.
+func (d *Downloader) readCacheIndex() *cacheIndex {
+	b, err := os.ReadFile(d.cacheIndexPath())
+	if err == nil {
+		var idx cacheIndex
+		if err := json.Unmarshal(b, &idx); err == nil && idx.SchemaVersion == schemaVersion && idx.Entries != nil {
+			return &idx
+		}
+	}
+	return d.rebuildCacheIndex()
+}
+
+// rebuildCacheIndex indexes the archives found in CacheDir, which keeps
+// them as <version>/<platform>/<name>, and writes the index out. Their
+// sums are left for the first lookup of each to verify.
+func (d *Downloader) rebuildCacheIndex() *cacheIndex {
+	idx := &cacheIndex{SchemaVersion: schemaVersion, Entries: make(map[string]cacheIndexEntry)}
+	archives, _ := filepath.Glob(filepath.Join(d.CacheDir, "*", "*", "*"))
+	for _, path := range archives {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || !isCachedArchive(path) {
+			continue
+		}
+		rel, err := filepath.Rel(d.CacheDir, path)
+		if err != nil {
+			continue
+		}
+		entry := cacheIndexEntry{Path: filepath.ToSlash(rel), Size: info.Size()}
+		idx.Entries[entry.Path] = entry
+	}
+	d.verbosef("indexed %d cached archives\n", len(idx.Entries))
+	d.writeCacheIndex(idx)
+	return idx
+}
+
+// writeCacheIndex saves idx. The index only speeds lookups up, so failing
+// to save it is not an error.
+func (d *Downloader) writeCacheIndex(idx *cacheIndex) {
+	if err := writeJSONAtomic(d.cacheIndexPath(), idx); err != nil {
+		d.verbosef("not saving the cache index: %v\n", err)
+	}
+}
+
+// lockCacheIndex locks the index against other runs updating it and
+// returns the func unlocking it. Failing to lock only risks an entry being
+// lost, which a later lookup restores, so it is not an error.
+func (d *Downloader) lockCacheIndex() func() {
+	unlock, err := tryLock(d.cacheIndexPath()+cacheLockSuffix, true)
+	if err != nil {
+		d.verbosef("not locking the cache index: %v\n", err)
+		return func() {}
+	}
+	return unlock
+}
+
+// indexCached records the archive of release, kept at path with the
+// SHA-256 sum, in the index.
+func (d *Downloader) indexCached(release *Release, path, sum string) {
+	unlock := d.lockCacheIndex()
+	defer unlock()
+	d.addCacheIndexEntry(d.readCacheIndex(), release, path, sum)
+}
+
+// addCacheIndexEntry adds the archive of release at path to idx and saves
+// it. The caller holds the index lock.
+func (d *Downloader) addCacheIndexEntry(idx *cacheIndex, release *Release, path, sum string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	idx.Entries[cacheIndexKey(release)] = cacheIndexEntry{
+		Path:   filepath.ToSlash(filepath.Join(release.Version, release.Platform, filepath.Base(release.URL))),
+		SHA256: sum,
+		Size:   info.Size(),
+	}
+	d.writeCacheIndex(idx)
+}
+
+// lookupCached returns the path of the cached archive of release and its
+// index entry, whose SHA256 spares a hit hashing the archive again. An
+// index whose entry no longer matches the file, as after a prune, is
+// rebuilt; an archive the index misses is added to it.
+func (d *Downloader) lookupCached(release *Release) (string, cacheIndexEntry, bool) {
+	if d.CacheDir == "" {
+		return "", cacheIndexEntry{}, false
+	}
+	unlock := d.lockCacheIndex()
+	defer unlock()
+	idx := d.readCacheIndex()
+	key := cacheIndexKey(release)
+	if entry, ok := idx.Entries[key]; ok {
+		path := filepath.Join(d.CacheDir, filepath.FromSlash(entry.Path))
+		if info, err := os.Stat(path); err == nil && info.Size() == entry.Size {
+			return path, entry, true
+		}
+		idx = d.rebuildCacheIndex()
+		if entry, ok := idx.Entries[key]; ok {
+			return filepath.Join(d.CacheDir, filepath.FromSlash(entry.Path)), entry, true
+		}
+		return "", cacheIndexEntry{}, false
+	}
+	path := d.cachePath(release)
+	if _, err := os.Stat(path); err != nil {
+		return "", cacheIndexEntry{}, false
+	}
+	d.addCacheIndexEntry(idx, release, path, "")
+	return path, idx.Entries[key], true
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// lastKnownGoodURL is the Chrome for Testing feed of the current version of
+// each release channel.
+const lastKnownGoodURL = "https://googlechromelabs.github.io/chrome-for-testing/last-known-good-versions-with-downloads.json"
+
+// channels lists the release channels of the feed, most stable first.
+var channels = []string{"Stable", "Beta", "Dev", "Canary"}
+
+type lastKnownGoodVersions struct {
+	Channels map[string]struct {
+		Version   string `json:"version"`
+		Revision  string `json:"revision"`
+		Downloads struct {
+			Chromedriver []feedAsset `json:"chromedriver"`
+		} `json:"downloads"`
+	} `json:"channels"`
+}
+
+// ChannelVersion is the driver currently published on a release channel.
+type ChannelVersion struct {
+	Channel   string
+	Version   string
+	Revision  string
+	Downloads map[string]string
+}
+
+// Channels reads the current driver of every release channel.
+func (d *Downloader) Channels() (map[string]*ChannelVersion, error) {
+	resp, err := d.get(d.ChannelsURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", d.ChannelsURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", d.ChannelsURL, resp.Status)
+	}
+
+	var feed lastKnownGoodVersions
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", d.ChannelsURL, err)
+	}
+
+	result := make(map[string]*ChannelVersion)
+	for name, c := range feed.Channels {
+		result[name] = &ChannelVersion{Channel: name, Version: c.Version, Revision: c.Revision, Downloads: assetURLs(c.Downloads.Chromedriver)}
+	}
+	return result, nil
+}
+
+// ResolveChannel picks the driver currently on channel. A non-empty major
+// must match the channel's major version, since channel data only exists
+// for the Chrome for Testing releases.
+func (d *Downloader) ResolveChannel(channel, major string) (*Release, error) {
+	name := canonicalChannel(channel)
+	if name == "" {
+		return nil, fmt.Errorf("unknown channel %q, expected one of %s", channel, strings.Join(channels, ", "))
+	}
+
+	all, err := d.Channels()
+	if err != nil {
+		return nil, fmt.Errorf("resolving channel %s: %w", name, err)
+	}
+	cv, ok := all[name]
+	if !ok || len(cv.Downloads) == 0 {
+		return nil, fmt.Errorf("%w: channel %s lists no driver", ErrVersionNotFound, name)
+	}
+	if major != "" && !strings.HasPrefix(cv.Version, major+".") {
+		return nil, fmt.Errorf("%w: channel %s is at %s, not major %s; legacy versions carry no channel data", ErrVersionNotFound, name, cv.Version, major)
+	}
+
+	list := &VersionList{Downloads: map[string]map[string]string{cv.Version: cv.Downloads}}
+	return d.release(cv.Version, list)
+}
+
+func canonicalChannel(channel string) string {
+	for _, c := range channels {
+		if strings.EqualFold(c, channel) {
+			return c
+		}
+	}
+	return ""
+}
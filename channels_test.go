@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sampleChannels is a last-known-good-versions feed with a driver of version
+// on each channel for linux64.
+func sampleChannels(base string, versions map[string]string) string {
+	var entries []string
+	for _, name := range channels {
+		v := versions[name]
+		entries = append(entries, fmt.Sprintf(`%q: {"channel": %q, "version": %q, "revision": "1", "downloads": {"chromedriver": [{"platform": "linux64", "url": "%s/%s/linux64/chromedriver-linux64.zip"}]}}`, name, name, v, base, v))
+	}
+	return `{"timestamp": "2023-08-01T00:00:00.000Z", "channels": {` + strings.Join(entries, ", ") + `}}`
+}
+
+func TestResolveChannel(t *testing.T) {
+	want := map[string]string{
+		"Stable": "116.0.5845.96",
+		"Beta":   "117.0.5938.22",
+		"Dev":    "118.0.5949.0",
+		"Canary": "118.0.5951.1",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sampleChannels("https://dl.invalid", want)))
+	}))
+	defer srv.Close()
+	d := NewDownloader()
+	d.ChannelsURL = srv.URL
+	d.Platform = "linux64"
+
+	for _, name := range channels {
+		for _, spelled := range []string{name, strings.ToLower(name)} {
+			release, err := d.ResolveChannel(spelled, "")
+			if err != nil {
+				t.Fatalf("%s: %v", spelled, err)
+			}
+			if release.Version != want[name] || release.URL != "https://dl.invalid/"+want[name]+"/linux64/chromedriver-linux64.zip" {
+				t.Errorf("%s resolved to %s at %s, want %s", spelled, release.Version, release.URL, want[name])
+			}
+		}
+	}
+
+	if release, err := d.ResolveChannel("Beta", "117"); err != nil || release.Version != want["Beta"] {
+		t.Errorf("Beta of major 117: got %v, %v", release, err)
+	}
+	if _, err := d.ResolveChannel("Stable", "114"); !errors.Is(err, ErrVersionNotFound) || !strings.Contains(err.Error(), "legacy versions carry no channel data") {
+		t.Errorf("Stable of legacy major 114: got %v, want a clear error", err)
+	}
+	if _, err := d.ResolveChannel("Nightly", ""); err == nil || !strings.Contains(err.Error(), "unknown channel") {
+		t.Errorf("got %v, want an unknown channel", err)
+	}
+}
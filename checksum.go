@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// checksumAlgos are the hashes --checksum-algo accepts, with the length of
+// their digests in hex.
+var checksumAlgos = map[string]int{
+	"sha256": 64,
+	"sha1":   40,
+	"md5":    32,
+}
+
+func newChecksumHash(algo string) hash.Hash {
+	switch algo {
+	case "sha1":
+		return sha1.New()
+	case "md5":
+		return md5.New()
+	}
+	return sha256.New()
+}
+
+// validateChecksum checks that sum can be a hex digest of algo.
+func validateChecksum(algo, sum string) error {
+	n, ok := checksumAlgos[algo]
+	if !ok {
+		return fmt.Errorf("unknown checksum algorithm %q: want sha256, sha1 or md5", algo)
+	}
+	if len(sum) != n {
+		return fmt.Errorf("invalid %s checksum %q: want %d hex digits, got %d", algo, sum, n, len(sum))
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return fmt.Errorf("invalid %s checksum %q: not hex", algo, sum)
+	}
+	return nil
+}
+
+// checksumAlgo is the algorithm Checksum is a digest of.
+func (d *Downloader) checksumAlgo() string {
+	if d.ChecksumAlgo == "" {
+		return "sha256"
+	}
+	return d.ChecksumAlgo
+}
+
+// fileChecksum returns the hex digest of the file at path under algo.
+func fileChecksum(path, algo string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := newChecksumHash(algo)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
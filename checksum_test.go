@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestChecksumAlgo(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	sha1Sum, md5Sum := sha1.Sum(archive), md5.Sum(archive)
+	sums := map[string]string{
+		"sha256": sha256Hex(archive),
+		"sha1":   hex.EncodeToString(sha1Sum[:]),
+		"md5":    hex.EncodeToString(md5Sum[:]),
+	}
+	for algo, sum := range sums {
+		out := t.TempDir()
+		if _, _, err := runCLI(t, s.args(t, out, "--checksum", sum, "--checksum-algo", algo, "-v", "115")...); err != nil {
+			t.Errorf("%s: %v", algo, err)
+		} else if !isInstalledIn(out, "115.0.5790.102") {
+			t.Errorf("%s: the verified driver was not installed", algo)
+		}
+
+		// A digest of the right length that is not the archive's.
+		wrong := strings.Repeat("0", len(sum))
+		if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--checksum", wrong, "--checksum-algo", algo, "-v", "115")...); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Errorf("%s: a wrong checksum got %v, want a mismatch", algo, err)
+		}
+	}
+
+	// The sha256 sum is the wrong length for the others, and is refused
+	// before anything is downloaded.
+	before := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip")
+	for _, algo := range []string{"sha1", "md5"} {
+		_, _, err := runCLI(t, s.args(t, t.TempDir(), "--checksum", sums["sha256"], "--checksum-algo", algo, "-v", "115")...)
+		if err == nil || !strings.Contains(err.Error(), "invalid "+algo+" checksum") {
+			t.Errorf("%s with a sha256 sum: got %v, want it refused", algo, err)
+		}
+	}
+	if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"); n != before {
+		t.Errorf("downloaded the driver for a checksum of the wrong length")
+	}
+	if _, err := newCLI(s.args(t, t.TempDir(), "--checksum", sums["md5"], "--checksum-algo", "crc32", "-v", "115"), &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("accepted --checksum-algo=crc32")
+	}
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--sha256", sums["sha256"], "--checksum-algo", "md5", "-v", "115")...); err == nil || !strings.Contains(err.Error(), "--sha256 is always a SHA-256 checksum") {
+		t.Errorf("--sha256 with --checksum-algo=md5: got %v", err)
+	}
+}
+
+func TestValidateChecksum(t *testing.T) {
+	for _, test := range []struct {
+		algo, sum string
+		ok        bool
+	}{
+		{"sha256", strings.Repeat("a", 64), true},
+		{"sha1", strings.Repeat("A", 40), true},
+		{"md5", strings.Repeat("0", 32), true},
+		{"sha256", strings.Repeat("a", 63), false},
+		{"md5", strings.Repeat("a", 40), false},
+		{"sha1", strings.Repeat("g", 40), false},
+		{"crc32", "00000000", false},
+	} {
+		if err := validateChecksum(test.algo, test.sum); (err == nil) != test.ok {
+			t.Errorf("validateChecksum(%s, %q) = %v", test.algo, test.sum, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// checksumDB is a local record of known-good archive checksums, keyed by
+// version and platform. It grows as downloads succeed and is consulted to
+// verify later ones, cached archives included, so a team can build up a
+// trusted set without a network round trip.
+type checksumDB struct {
+	path string
+
+	SchemaVersion int               `json:"schemaVersion"`
+	Checksums     map[string]string `json:"checksums"`
+}
+
+// loadChecksumDB reads the database at path. A missing file is an empty
+// database that record creates.
+func loadChecksumDB(path string) (*checksumDB, error) {
+	db := &checksumDB{path: path, SchemaVersion: schemaVersion, Checksums: make(map[string]string)}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading checksum database: %w", err)
+	}
+	if err := json.Unmarshal(b, db); err != nil {
+		return nil, fmt.Errorf("parsing checksum database %s: %w", path, err)
+	}
+	if db.Checksums == nil {
+		db.Checksums = make(map[string]string)
+	}
+	return db, nil
+}
+
+func checksumKey(release *Release) string {
+	return release.Version + "/" + release.Platform
+}
+
+// lookup returns the recorded checksum of release's archive.
+func (db *checksumDB) lookup(release *Release) (string, bool) {
+	sum, ok := db.Checksums[checksumKey(release)]
+	return sum, ok
+}
+
+// record adds the checksum of release's archive, set once it was
+// downloaded, and saves the database.
+func (db *checksumDB) record(release *Release) error {
+	if release.SHA256 == "" {
+		return nil
+	}
+	db.Checksums[checksumKey(release)] = release.SHA256
+	if err := writeJSONAtomic(db.path, db); err != nil {
+		return fmt.Errorf("writing checksum database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChecksumDB(t *testing.T) {
+	s := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "checksums.json")
+	install := func() error {
+		_, _, err := runCLI(t, s.args(t, t.TempDir(), "--checksum-db", path, "-v", "115.0.5790.102")...)
+		return err
+	}
+	if err := install(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := loadChecksumDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	if sum := db.Checksums["115.0.5790.102/linux64"]; sum != sha256Hex(archive) {
+		t.Fatalf("recorded %q, want the archive's sha256 %s", sum, sha256Hex(archive))
+	}
+
+	// The same archive again verifies; another one under its name does not.
+	if err := install(); err != nil {
+		t.Errorf("reinstalling the recorded archive: %v", err)
+	}
+	tampered := testZip(t, map[string]string{"chromedriver-linux64/chromedriver": "#!/bin/sh\necho pwned\n"})
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(tampered)
+	})
+	err = install()
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") || !strings.Contains(err.Error(), "expected "+sha256Hex(archive)) {
+		t.Errorf("got %v, want the tampered archive refused", err)
+	}
+	if db, _ := loadChecksumDB(path); db.Checksums["115.0.5790.102/linux64"] != sha256Hex(archive) {
+		t.Error("the refused archive replaced the recorded checksum")
+	}
+}
+
+func TestRequireChecksum(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	const archive = "/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"
+	install := func(extra ...string) (string, error) {
+		out := t.TempDir()
+		_, _, err := runCLI(t, s.args(t, out, append(extra, "-v", "115.0.5790.102")...)...)
+		return out, err
+	}
+
+	// The feed gives no checksum, so nothing is known for the version.
+	if _, err := install("--require-checksum"); !errors.Is(err, ErrChecksumRequired) {
+		t.Errorf("got %v, want ErrChecksumRequired", err)
+	}
+	if n := s.hitCount(archive); n != 0 {
+		t.Errorf("downloaded the unverifiable archive %d times", n)
+	}
+	if out, err := install(); err != nil || !isInstalledIn(out, "115.0.5790.102") {
+		t.Errorf("without --require-checksum: %v", err)
+	}
+
+	// A checksum from --checksum or the checksum DB lets it through.
+	sum := sha256Hex(testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64"))
+	if out, err := install("--require-checksum", "--checksum", sum); err != nil || !isInstalledIn(out, "115.0.5790.102") {
+		t.Errorf("with --checksum: %v", err)
+	}
+	db := filepath.Join(t.TempDir(), "checksums.json")
+	if _, err := install("--checksum-db", db); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := install("--require-checksum", "--checksum-db", db); err != nil || !isInstalledIn(out, "115.0.5790.102") {
+		t.Errorf("with the checksum recorded: %v", err)
+	}
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--require-checksum", "--checksum-db", db, "-v", "116")...); !errors.Is(err, ErrChecksumRequired) {
+		t.Errorf("a version the DB has no checksum for: got %v, want ErrChecksumRequired", err)
+	}
+}
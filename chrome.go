@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ResolveChrome picks the newest Chrome for Testing browser of major built
+// for plat.
+func (d *Downloader) ResolveChrome(major, plat string) (*Release, error) {
+	list, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []string
+	for version := range list.ChromeDownloads {
+		if majorOf(version) == major {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: no chrome for testing build of major %s", ErrVersionNotFound, major)
+	}
+	sortVersions(versions)
+
+	version := versions[0]
+	url, ok := list.ChromeDownloads[version][plat]
+	if !ok {
+		return nil, fmt.Errorf("%w: chrome %s has no %s build", ErrAssetNotFound, version, plat)
+	}
+	if d.Mirror != "" {
+		if url, err = mirrorURL(d.Mirror, version, url); err != nil {
+			return nil, err
+		}
+	}
+	return &Release{Version: version, Platform: plat, URL: url}, nil
+}
+
+// headlessShell is the companion type of chrome-headless-shell, the
+// old-headless-mode browser shipped from major 120 onwards.
+const headlessShell = "chrome-headless-shell"
+
+// companionTypes are the assets --driver-type installs next to the driver.
+var companionTypes = []string{headlessShell}
+
+// ResolveCompanion picks the kind build, one of companionTypes, of exactly
+// version for plat.
+func (d *Downloader) ResolveCompanion(kind, version, plat string) (*Release, error) {
+	if !containsString(companionTypes, kind) {
+		return nil, fmt.Errorf("unsupported driver type %q", kind)
+	}
+	list, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+	assets, ok := list.CompanionDownloads[kind][version]
+	if !ok {
+		return nil, fmt.Errorf("%w: no %s build of %s", ErrAssetNotFound, kind, version)
+	}
+	url, ok := assets[plat]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s has no %s build", ErrAssetNotFound, kind, version, plat)
+	}
+	if d.Mirror != "" {
+		if url, err = mirrorURL(d.Mirror, version, url); err != nil {
+			return nil, err
+		}
+	}
+	return &Release{Version: version, Platform: plat, URL: url}, nil
+}
+
+// checkPair refuses a driver and browser whose full versions differ, which
+// would mean the feed paired builds that are not meant to run together.
+func checkPair(driver, chrome *Release) error {
+	if driver.Version != chrome.Version {
+		return fmt.Errorf("%w: driver %s and chrome %s differ; refusing to install a mismatched pair", ErrIncompatiblePair, driver.Version, chrome.Version)
+	}
+	return nil
+}
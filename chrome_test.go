@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithChrome(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out := t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out, "--with-chrome", "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.hitCount("/dl/115.0.5790.102/linux64/chrome-linux64.zip"); n != 1 {
+		t.Errorf("downloaded chrome %d times, want once", n)
+	}
+	if version, err := InstalledVersion(out); err != nil || version != "115.0.5790.102" {
+		t.Errorf("installed driver %s, %v", version, err)
+	}
+}
+
+func TestWithChromeMismatch(t *testing.T) {
+	s := newTestServer(t)
+	// The feed's newest 117 driver has no browser, whose newest build is an
+	// older patch: the newest of each does not make a pair.
+	s.mux.HandleFunc("/mismatched.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"versions": [
+			{"version": "117.0.5938.22", "downloads": {
+				"chrome": [{"platform": "linux64", "url": "%[1]s"}],
+				"chromedriver": [{"platform": "linux64", "url": "%[2]s"}]}},
+			{"version": "117.0.5938.62", "downloads": {
+				"chromedriver": [{"platform": "linux64", "url": "%[3]s"}]}}
+		]}`, s.URL+"/dl/117.0.5938.22/linux64/chrome-linux64.zip",
+			s.archiveURL("117.0.5938.22", "linux64"), s.archiveURL("117.0.5938.62", "linux64"))
+	})
+	out := t.TempDir()
+	_, _, err := runCLI(t, setFlag(s.args(t, out, "--with-chrome", "-v", "117"), "list-url", s.URL+"/mismatched.json")...)
+	if !errors.Is(err, ErrIncompatiblePair) {
+		t.Fatalf("got %v, want the pair refused", err)
+	}
+	if n := s.hitCount("/dl/117.0.5938.62/linux64/chromedriver-linux64.zip"); n != 0 {
+		t.Errorf("downloaded the driver of the refused pair")
+	}
+	if _, err := InstalledVersion(out); !errors.Is(err, ErrNotInstalled) {
+		t.Errorf("installed a driver of the refused pair: %v", err)
+	}
+}
+
+func TestChromeBinary(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	fakeChrome := func(output string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "portable chrome", "chrome")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("#!/bin/sh\necho '"+output+"'\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	chrome := fakeChrome("Google Chrome 115.0.5790.102 ")
+
+	out := t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out, "--chrome-binary", chrome)...); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := InstalledVersion(out); err != nil || version != "115.0.5790.102" {
+		t.Errorf("installed %s, %v, want the driver for the Chrome at --chrome-binary", version, err)
+	}
+
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--chrome-binary", chrome, "-v", "116")...); err == nil || !strings.Contains(err.Error(), "cannot be combined with --version") {
+		t.Errorf("with --version too: got %v", err)
+	}
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--chrome-binary", fakeChrome("not chrome"))...); err == nil || !strings.Contains(err.Error(), `unexpected version output "not chrome"`) {
+		t.Errorf("with a binary reporting no version: got %v", err)
+	}
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--chrome-binary", filepath.Join(t.TempDir(), "missing"))...); err == nil || !strings.Contains(err.Error(), "--chrome-binary: running ") {
+		t.Errorf("with a missing binary: got %v", err)
+	}
+}
+
+func TestDriverType(t *testing.T) {
+	s := newTestServer(t)
+	for _, test := range []struct {
+		driverType string
+		want       []string
+	}{
+		{"chromedriver", []string{s.archiveURL("115.0.5790.102", "linux64")}},
+		{headlessShell, []string{
+			s.archiveURL("115.0.5790.102", "linux64"),
+			s.URL + "/dl/115.0.5790.102/linux64/chrome-headless-shell-linux64.zip",
+		}},
+	} {
+		stdout, _, err := runCLI(t, s.args(t, t.TempDir(), "--print-urls", "--driver-type", test.driverType, "-v", "115")...)
+		if err != nil {
+			t.Fatalf("%s: %v", test.driverType, err)
+		}
+		if got := strings.Fields(stdout); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("--driver-type=%s printed %q, want %q", test.driverType, got, test.want)
+		}
+	}
+
+	d := s.downloader()
+	if _, err := d.ResolveCompanion(headlessShell, "116.0.5845.96", "win32"); !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("116 for win32: got %v, want the asset not found", err)
+	}
+	if _, err := d.ResolveCompanion("chrome-remote-desktop", "115.0.5790.102", "linux64"); err == nil || !strings.Contains(err.Error(), "unsupported driver type") {
+		t.Errorf("an unknown type: got %v", err)
+	}
+	if _, err := newCLI([]string{"--driver-type", "chrome-remote-desktop"}, &bytes.Buffer{}, &bytes.Buffer{}); err == nil {
+		t.Error("the command line took an unknown --driver-type")
+	}
+}
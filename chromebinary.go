@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var chromeVersionPattern = regexp.MustCompile(`\b(\d+\.\d+\.\d+\.\d+)\b`)
+
+// chromeBinaryVersion runs the Chrome or Chromium binary at path with
+// --version and parses the version it reports, as in "Google Chrome
+// 115.0.5790.170".
+func chromeBinaryVersion(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("running %s --version: %w", path, err)
+	}
+	m := chromeVersionPattern.FindStringSubmatch(string(out))
+	if m == nil {
+		return "", fmt.Errorf("%s: unexpected version output %q", path, strings.TrimSpace(string(out)))
+	}
+	return m[1], nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxClockSkew is how far the local clock may be from a server's before a
+// certificate validity failure is blamed on the clock.
+const maxClockSkew = 10 * time.Minute
+
+// explainCertTime adds a hint to err when it is a certificate validity
+// failure and the local clock is more than maxClockSkew away from the time
+// the server at rawURL reports, which makes valid certificates look expired
+// or not yet valid. Other errors are returned unchanged.
+func (d *Downloader) explainCertTime(rawURL string, err error) error {
+	var invalid x509.CertificateInvalidError
+	if !errors.As(err, &invalid) || invalid.Reason != x509.Expired {
+		return err
+	}
+	server, ok := d.serverTime(rawURL)
+	if !ok {
+		return err
+	}
+	local := time.Now()
+	skew := local.Sub(server)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew <= maxClockSkew {
+		return err
+	}
+	return fmt.Errorf("TLS failed; your system clock may be wrong (server time: %s, local time: %s): %w",
+		server.UTC().Format(time.RFC1123), local.UTC().Format(time.RFC1123), err)
+}
+
+// serverTime reads the Date header of the host serving rawURL. The probe
+// skips certificate verification because the certificate is what failed;
+// nothing but the header is used.
+func (d *Downloader) serverTime(rawURL string) (time.Time, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+	req, err := http.NewRequestWithContext(d.context(), http.MethodHead, u.Scheme+"://"+u.Host+"/", nil)
+	if err != nil {
+		return time.Time{}, false
+	}
+	probe := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := probe.Do(req)
+	if err != nil {
+		return time.Time{}, false
+	}
+	resp.Body.Close()
+	server, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return server, true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainCertTime(t *testing.T) {
+	var serverTime time.Time
+	srv := newTLSTestServer(t)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+	})
+	d := NewDownloader()
+	expired := fmt.Errorf("Get %q: %w", srv.URL, x509.CertificateInvalidError{Reason: x509.Expired})
+
+	// The server is a year ahead, so the local clock is behind it.
+	serverTime = time.Now().AddDate(1, 0, 0)
+	err := d.explainCertTime(srv.URL+"/feed.json", expired)
+	if !strings.HasPrefix(err.Error(), "TLS failed; your system clock may be wrong (server time: "+serverTime.UTC().Format(time.RFC1123)) {
+		t.Errorf("got %v, want the clock blamed", err)
+	}
+	var invalid x509.CertificateInvalidError
+	if !errors.As(err, &invalid) {
+		t.Errorf("the hint lost the certificate error: %v", err)
+	}
+
+	// With the clocks agreeing, the certificate really is expired.
+	serverTime = time.Now()
+	if err := d.explainCertTime(srv.URL, expired); err != expired {
+		t.Errorf("got %v with the clocks agreeing, want the error unchanged", err)
+	}
+
+	// Other failures take no probe.
+	serverTime = time.Now().AddDate(1, 0, 0)
+	unknown := fmt.Errorf("Get %q: %w", srv.URL, x509.UnknownAuthorityError{})
+	if err := d.explainCertTime(srv.URL, unknown); err != unknown {
+		t.Errorf("got %v for an unknown authority, want it unchanged", err)
+	}
+}
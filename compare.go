@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// staleness is how far the installed driver is behind the version list,
+// as --compare-remote reports it.
+type staleness struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Installed     string `json:"installed"`
+	Path          string `json:"path"`
+	NewerPatches  int    `json:"newerPatches"`
+	NewerMajors   int    `json:"newerMajors"`
+	Latest        string `json:"latest"`
+}
+
+// compareRemote reports how many newer patches of its major and newer
+// majors are published beyond the newest driver installed under dir, or
+// installed as dir when it names the binary.
+func compareRemote(d *Downloader, w io.Writer, dir, format string) error {
+	installed, err := newestInstalled(dir)
+	if err != nil {
+		return err
+	}
+	list, err := d.List()
+	if err != nil {
+		return err
+	}
+
+	s := staleness{SchemaVersion: schemaVersion, Installed: installed.Version, Path: installed.Path}
+	major := majorOf(installed.Version)
+	for _, version := range list.Versions[major] {
+		if compareVersions(version, installed.Version) > 0 {
+			s.NewerPatches++
+		}
+	}
+	for _, m := range list.Majors {
+		if compareVersions(m, major) > 0 {
+			s.NewerMajors++
+		}
+	}
+	if len(list.Majors) > 0 {
+		s.Latest = list.Versions[list.Majors[0]][0]
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	if s.NewerPatches == 0 && s.NewerMajors == 0 {
+		fmt.Fprintf(w, "installed %s; it is the newest available\n", s.Installed)
+		return nil
+	}
+	fmt.Fprintf(w, "installed %s; %s and %s available (latest %s)\n", s.Installed,
+		plural(s.NewerPatches, "newer patch", "newer patches"), plural(s.NewerMajors, "newer major", "newer majors"), s.Latest)
+	return nil
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCompareRemote(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	compare := func(installed string, extra ...string) string {
+		t.Helper()
+		out := t.TempDir()
+		if _, _, err := runCLI(t, s.args(t, out, "-v", installed)...); err != nil {
+			t.Fatal(err)
+		}
+		stdout, _, err := runCLI(t, s.args(t, out, append([]string{"--compare-remote"}, extra...)...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stdout
+	}
+	// The feed has 115.0.5790.98 and .102, 116 and, as a prerelease, 120.
+	for installed, want := range map[string]string{
+		"115.0.5790.98":  "installed 115.0.5790.98; 1 newer patch and 2 newer majors available (latest " + testPrerelease + ")\n",
+		"115.0.5790.102": "installed 115.0.5790.102; 0 newer patches and 2 newer majors available (latest " + testPrerelease + ")\n",
+		testStable:       "installed " + testStable + "; 0 newer patches and 1 newer major available (latest " + testPrerelease + ")\n",
+		testPrerelease:   "installed " + testPrerelease + "; it is the newest available\n",
+	} {
+		if got := compare(installed); got != want {
+			t.Errorf("printed %q, want %q", got, want)
+		}
+	}
+
+	var got staleness
+	if err := json.Unmarshal([]byte(compare("115.0.5790.98", "--format", "json")), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Installed != "115.0.5790.98" || got.NewerPatches != 1 || got.NewerMajors != 2 || got.Latest != testPrerelease {
+		t.Errorf("reported %+v, want 1 newer patch and 2 newer majors", got)
+	}
+
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--compare-remote")...); err == nil {
+		t.Error("compared an empty --out")
+	}
+}
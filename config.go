@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+)
+
+// effectiveConfig is what --print-config shows: the settings a run would
+// use once flags, environment variables and defaults are combined and the
+// platform is resolved.
+type effectiveConfig struct {
+	Platform       string   `json:"platform"`
+	Arch           string   `json:"arch"`
+	AutoPlatform   bool     `json:"autoPlatform"`
+	Versions       []string `json:"versions,omitempty"`
+	Out            string   `json:"out"`
+	OutputLayout   string   `json:"outputLayout"`
+	Cache          bool     `json:"cache"`
+	CacheDir       string   `json:"cacheDir"`
+	TempDir        string   `json:"tempDir"`
+	Mirrors        []string `json:"mirrors,omitempty"`
+	FeedURL        string   `json:"feedUrl"`
+	Timeout        string   `json:"timeout"`
+	Retries        int      `json:"retries"`
+	MaxRate        int64    `json:"maxRate,omitempty"`
+	MaxConnections int      `json:"maxConnections"`
+	ExtractWorkers string   `json:"extractWorkers"`
+	Checksum       string   `json:"checksum,omitempty"`
+	ChecksumAlgo   string   `json:"checksumAlgo"`
+	OnlyBinary     bool     `json:"onlyBinary"`
+	Exclude        []string `json:"exclude,omitempty"`
+	Strict         bool     `json:"strict"`
+}
+
+// printConfig writes the effective configuration of d and the command line
+// to w as JSON.
+func (c *cli) printConfig(w io.Writer, d *Downloader) error {
+	var mirrorList []string
+	if d.Mirror != "" {
+		mirrorList = append([]string{d.Mirror}, d.Mirrors...)
+	}
+	cfg := effectiveConfig{
+		Platform:       d.Platform,
+		Arch:           platformArch[d.Platform],
+		AutoPlatform:   d.AutoPlatform,
+		Versions:       c.specVersions,
+		Out:            absOr(c.outputPath),
+		OutputLayout:   c.effectiveLayout(len(c.specVersions)),
+		Cache:          c.useCache,
+		CacheDir:       absOr(c.cacheDir),
+		TempDir:        absOr(d.TempDir),
+		Mirrors:        mirrorList,
+		FeedURL:        d.FeedURL,
+		Timeout:        d.Client.Timeout.String(),
+		Retries:        d.Retries,
+		MaxRate:        d.MaxRate,
+		MaxConnections: c.maxConnections,
+		ExtractWorkers: c.extractWorkers,
+		Checksum:       d.Checksum,
+		ChecksumAlgo:   d.checksumAlgo(),
+		OnlyBinary:     d.OnlyBinary,
+		Exclude:        d.Exclude,
+		Strict:         d.Strict,
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(cfg)
+}
+
+// absOr returns path made absolute, or as is when that fails or path is
+// "-".
+func absOr(path string) string {
+	if path == "-" {
+		return path
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
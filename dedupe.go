@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// dedupeFiles replaces each of files whose content and mode match a file
+// installed earlier in the run with a hard link to that file, and returns
+// how many bytes that saved. Where hard links are not supported, such as
+// across filesystems, the file is left as the copy it already is.
+func (c *cli) dedupeFiles(d *Downloader, files []string) (int64, error) {
+	var saved int64
+	for _, f := range files {
+		info, err := os.Lstat(f)
+		if err != nil {
+			return saved, err
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		sum, err := fileSHA256(f)
+		if err != nil {
+			return saved, err
+		}
+		key := fmt.Sprintf("%s %o", sum, info.Mode().Perm())
+		first, ok := c.dedupeStore[key]
+		if !ok {
+			c.dedupeStore[key] = f
+			continue
+		}
+		if firstInfo, err := os.Stat(first); err != nil || os.SameFile(info, firstInfo) {
+			continue
+		}
+		if err := replaceWithLink(first, f); err != nil {
+			d.verbosef("keeping a copy of %s: %v\n", f, err)
+			continue
+		}
+		saved += info.Size()
+	}
+	return saved, nil
+}
+
+// replaceWithLink swaps path for a hard link to target, so path is never
+// missing: the link is made beside it and renamed over it.
+func replaceWithLink(target, path string) error {
+	tmp := path + ".link"
+	os.Remove(tmp)
+	if err := os.Link(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
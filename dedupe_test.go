@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupeStorage(t *testing.T) {
+	s := newTestServer(t)
+	versions := []string{"115.0.5790.98", "115.0.5790.102"}
+	stat := func(out, version, name string) os.FileInfo {
+		t.Helper()
+		info, err := os.Stat(filepath.Join(out, version, "chromedriver-linux64", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+	for _, dedupe := range []bool{true, false} {
+		out := t.TempDir()
+		args := s.args(t, out, "-v", versions[0], "-v", versions[1])
+		if dedupe {
+			args = append(args, "--dedupe-storage")
+		}
+		if _, _, err := runCLI(t, args...); err != nil {
+			t.Fatal(err)
+		}
+		// The licenses are the same in both archives, the drivers not.
+		licenses := os.SameFile(stat(out, versions[0], "LICENSE.chromedriver"), stat(out, versions[1], "LICENSE.chromedriver"))
+		if licenses != dedupe {
+			t.Errorf("--dedupe-storage=%v: the identical licenses share an inode: %v", dedupe, licenses)
+		}
+		if os.SameFile(stat(out, versions[0], "chromedriver"), stat(out, versions[1], "chromedriver")) {
+			t.Errorf("--dedupe-storage=%v: different drivers share an inode", dedupe)
+		}
+		for _, version := range versions {
+			if b, _ := os.ReadFile(filepath.Join(out, version, "chromedriver-linux64", "chromedriver")); string(b) != testDriver(version) {
+				t.Errorf("--dedupe-storage=%v: %s holds the wrong driver", dedupe, version)
+			}
+		}
+	}
+}
@@ -0,0 +1,776 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	targetTemplate = "https://chromedriver.storage.googleapis.com/%s/chromedriver_%s.zip"
+	tempPattern    = "getchromedriver-*"
+)
+
+// platforms lists the accepted --platform values, named as in the Chrome for
+// Testing feed.
+var platforms = []string{"win32", "win64", "linux64", "mac-x64", "mac-arm64"}
+
+// legacyPlatforms maps a platform to its asset suffix on the legacy storage
+// host, which only serves drivers up to major 114.
+var legacyPlatforms = map[string]string{
+	"win32":     "win32",
+	"linux64":   "linux64",
+	"mac-x64":   "mac64",
+	"mac-arm64": "mac_arm64",
+}
+
+// hostPlatform returns the platform matching the running OS and CPU, if
+// drivers are built for it.
+func hostPlatform() (string, bool) {
+	for p, arch := range platformArch {
+		if arch == runtime.GOARCH && platformOS[p] == runtime.GOOS {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// defaultPlatform is the platform used when none is given: win64 on 64-bit
+// Windows and win32, the long-standing default, everywhere else.
+func defaultPlatform(goos, goarch string) string {
+	if goos == "windows" && goarch != "386" {
+		return "win64"
+	}
+	return "win32"
+}
+
+// windowsAlternate pairs each Windows platform with the other build
+// AutoPlatform may substitute for it.
+var windowsAlternate = map[string]string{
+	"win32": "win64",
+	"win64": "win32",
+}
+
+// platformOS is the GOOS each platform's driver runs on.
+var platformOS = map[string]string{
+	"win32":     "windows",
+	"win64":     "windows",
+	"linux64":   "linux",
+	"mac-x64":   "darwin",
+	"mac-arm64": "darwin",
+}
+
+// platformArch is the CPU architecture each platform's driver is built for,
+// named as GOARCH.
+var platformArch = map[string]string{
+	"win32":     "386",
+	"win64":     "amd64",
+	"linux64":   "amd64",
+	"mac-x64":   "amd64",
+	"mac-arm64": "arm64",
+}
+
+// Downloader resolves, downloads and extracts chromedriver releases. The zero
+// value is not usable; create one with NewDownloader and adjust its fields.
+type Downloader struct {
+	// Client performs every HTTP request, including the version lookups.
+	Client *http.Client
+	// Context, when set, cancels requests, retries and extraction once
+	// done, for example on SIGTERM.
+	Context context.Context
+	// FeedURL and PageURL locate the Chrome for Testing feed and the legacy
+	// downloads page. BucketURL is the legacy bucket listing consulted when
+	// neither can be read.
+	FeedURL     string
+	PageURL     string
+	BucketURL   string
+	ChannelsURL string
+	// MilestonesURL, when set, is the feed of each major's latest version
+	// that Resolve tries before reading the full list.
+	MilestonesURL string
+	// Sources are where List reads versions from, most trusted first. Empty
+	// means the Chrome for Testing feed and the legacy downloads page.
+	Sources []VersionSource
+	// Mirror, when set, replaces the upstream host of driver downloads.
+	Mirror string
+	// Mirrors are further hosts an archive download falls back to when the
+	// server refuses it or cannot be reached.
+	Mirrors []string
+	// Platform selects the driver build, one of platforms.
+	Platform string
+	// AutoPlatform substitutes the other Windows build when a version has
+	// no driver for the requested one.
+	AutoPlatform bool
+	// TempDir is where downloads are staged before extraction.
+	TempDir string
+	// Retries is how many times a failed request is repeated, and Backoff
+	// the delay before the first repeat.
+	Retries int
+	Backoff time.Duration
+	// RetryStatuses, when set, are the HTTP statuses worth repeating a
+	// request for, in place of 429 and 5xx.
+	RetryStatuses []int
+	// Budget, when set, caps the retries and time of everything the
+	// Downloader and its copies do.
+	Budget *retryBudget
+	// Stats, when set, counts the archives the Downloader and its copies
+	// download or find in CacheDir.
+	Stats *TransferStats
+	// MaxRate caps the download speed in bytes per second. Zero means no
+	// limit.
+	MaxRate int64
+	// Trace logs the connection timings and response headers of every
+	// request to Log.
+	Trace bool
+	// Log receives warnings, the summary of each extraction and, with
+	// Verbose, diagnostic messages. NewDownloader points it at os.Stderr.
+	Log io.Writer
+	// Progress, when set, receives a line per download and extraction kept
+	// up to date with carriage returns, as on a terminal. DownloadProgress
+	// and ExtractProgress, when set, are called instead.
+	Progress io.Writer
+	// bars draws the lines on Progress, made on first use.
+	bars *progressBars
+	// batch, while a batch downloads ahead, sums its concurrent downloads
+	// into one line in place of the bars and heartbeats of each.
+	batch   *batchProgress
+	Verbose bool
+	// CacheDir, when set, keeps downloaded archives for reuse by later runs.
+	CacheDir string
+	// ListCacheTTL is how long the version list cached in CacheDir is used
+	// without fetching it again. Zero always fetches, falling back to the
+	// cached list only when fetching fails.
+	ListCacheTTL time.Duration
+	// StageDir, when set, is where archives are extracted before their
+	// files are moved into the destination, e.g. a memory-backed tmpfs.
+	StageDir string
+	// ExtractWorkers caps how many zip entries are written at once. Zero
+	// writes them all at once, and AutoWorkers measures the destination's
+	// filesystem to choose.
+	ExtractWorkers int
+	// Checksum is the expected digest of the archive in hex, under
+	// ChecksumAlgo. Empty skips verification.
+	Checksum string
+	// ChecksumAlgo names the hash Checksum is of: sha256, the default when
+	// empty, sha1 or md5.
+	ChecksumAlgo string
+	// AllowPrerelease keeps Beta, Dev and Canary versions, those newer than
+	// the Stable channel, in List and everything resolved from it.
+	AllowPrerelease bool
+	// Strict turns every warning, and the situations otherwise only noted
+	// with Verbose, into errors.
+	Strict bool
+	// OnlyBinary extracts just the driver binary, skipping licenses and
+	// other files of the archive.
+	OnlyBinary bool
+	// Exclude holds glob patterns of archive entries not to extract,
+	// matched against both the base name and the full entry name.
+	Exclude []string
+	// Heartbeat, when positive, is how often a long download logs how much
+	// it has read, to keep non-interactive logs from going quiet.
+	Heartbeat time.Duration
+	// Mode, when non-zero, is applied exactly to the extracted driver binary,
+	// or to every extracted file with ModeAllFiles.
+	Mode         os.FileMode
+	ModeAllFiles bool
+	// PreserveTimes keeps the modification times recorded in the archive
+	// on the extracted files.
+	PreserveTimes bool
+	// DownloadProgress, when set, is called as archive bytes arrive with the
+	// archive's name and the bytes so far out of the total, which is -1 when
+	// the server does not say. Each attempt at an archive starts with a call
+	// where done is 0. Archives declared smaller than ProgressMinSize are
+	// not reported.
+	DownloadProgress func(name string, done, total int64)
+	ProgressMinSize  int64
+	// MaxUncompressedSize and MaxCompressionRatio refuse archives that
+	// unpack to more bytes, or that many times their compressed size, with
+	// ErrArchiveLimits. Zero disables either check.
+	MaxUncompressedSize int64
+	MaxCompressionRatio float64
+	// ExtractProgress, when set, is called as archive entries are written.
+	ExtractProgress func(done, total int)
+	// ListTTL is how long List reuses the version list it last fetched.
+	// Zero fetches it on every call.
+	ListTTL time.Duration
+
+	memo *listMemo
+}
+
+// Release is a driver version resolved to a concrete download.
+type Release struct {
+	Version  string
+	Platform string
+	URL      string
+	// SHA256 is the hex digest of the archive, set once it is downloaded.
+	SHA256 string
+	// Size is the archive size the feed declares, or 0 when it declares none.
+	Size int64
+	// ArchiveName is the file name the archive was served under, set once
+	// it is downloaded.
+	ArchiveName string
+}
+
+func NewDownloader() *Downloader {
+	return &Downloader{
+		Client:        &http.Client{},
+		FeedURL:       knownGoodVersionsURL,
+		PageURL:       downloadsPageURL,
+		BucketURL:     bucketListURL,
+		ChannelsURL:   lastKnownGoodURL,
+		MilestonesURL: milestonesURL,
+		Platform:      defaultPlatform(runtime.GOOS, runtime.GOARCH),
+		Log:           os.Stderr,
+		TempDir:       ".",
+		Retries:       3,
+		Backoff:       time.Second,
+		ListTTL:       time.Minute,
+		memo:          &listMemo{},
+
+		MaxUncompressedSize: 2 << 30,
+		MaxCompressionRatio: 100,
+		PreserveTimes:       true,
+	}
+}
+
+// Resolve picks the newest driver of the major version spec, or exactly
+// spec when it is a full version. "latest" selects the newest driver
+// overall and "<major>.latest" is the same as "<major>".
+func (d *Downloader) Resolve(spec string) (*Release, error) {
+	if major, ok := latestSpec(spec); ok {
+		if major == "" {
+			return d.ResolveLatest()
+		}
+		spec = major
+	}
+	if d.MilestonesURL != "" && isMajor(spec) {
+		if release, ok := d.resolveMilestone(spec); ok {
+			return release, nil
+		}
+	}
+
+	list, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+
+	versions, ok := list.Versions[spec]
+	if !ok {
+		if containsString(list.Versions[majorOf(spec)], spec) {
+			return d.release(spec, list)
+		}
+		if isMajor(spec) {
+			return nil, errMajorNotFound(spec, list)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrVersionNotFound, spec)
+	}
+
+	return d.release(versions[0], list)
+}
+
+// ResolveURL returns the download URL of the driver for version on the
+// given platform, honouring Mirror. version is anything Resolve accepts.
+// platform is either one of platforms, with arch left empty, or an OS as
+// named by GOOS together with a GOARCH arch, such as "linux" and "amd64".
+func (d *Downloader) ResolveURL(version, platform, arch string) (string, error) {
+	plat, err := platformFor(platform, arch)
+	if err != nil {
+		return "", err
+	}
+	pd := *d
+	pd.Platform = plat
+	pd.AutoPlatform = false
+	release, err := pd.Resolve(version)
+	if err != nil {
+		return "", err
+	}
+	return release.URL, nil
+}
+
+// archAliases maps the names users give a CPU architecture to its GOARCH.
+var archAliases = map[string]string{
+	"amd64":   "amd64",
+	"x64":     "amd64",
+	"x86_64":  "amd64",
+	"386":     "386",
+	"x86":     "386",
+	"i386":    "386",
+	"i686":    "386",
+	"arm64":   "arm64",
+	"aarch64": "arm64",
+}
+
+// normalizeArch returns the GOARCH named by arch or one of its aliases.
+func normalizeArch(arch string) (string, error) {
+	if goarch, ok := archAliases[strings.ToLower(arch)]; ok {
+		return goarch, nil
+	}
+	names := make([]string, 0, len(archAliases))
+	for name := range archAliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("unknown arch %q, expected one of %s", arch, strings.Join(names, ", "))
+}
+
+// platformFor maps a platform name, or a GOOS and GOARCH pair, to one of
+// platforms. arch may be any of archAliases.
+func platformFor(platform, arch string) (string, error) {
+	if arch != "" {
+		goarch, err := normalizeArch(arch)
+		if err != nil {
+			return "", err
+		}
+		arch = goarch
+	}
+	if _, ok := platformArch[platform]; ok {
+		if arch != "" && arch != platformArch[platform] {
+			return "", fmt.Errorf("platform %s is built for %s, not %s", platform, platformArch[platform], arch)
+		}
+		return platform, nil
+	}
+	for _, p := range platforms {
+		if platformOS[p] == platform && platformArch[p] == arch {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no driver is built for %s/%s", platform, arch)
+}
+
+// ResolveLatest picks the newest driver of all majors.
+func (d *Downloader) ResolveLatest() (*Release, error) {
+	list, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Majors) == 0 {
+		return nil, fmt.Errorf("%w: no versions are published", ErrVersionNotFound)
+	}
+	return d.release(list.Versions[list.Majors[0]][0], list)
+}
+
+// isMajor reports whether spec is a bare major version such as "115".
+func isMajor(spec string) bool {
+	_, err := strconv.Atoi(spec)
+	return err == nil
+}
+
+// latestSpec recognises the "latest" and "<major>.latest" version specs,
+// returning the major they name, empty for plain "latest".
+func latestSpec(spec string) (string, bool) {
+	if strings.EqualFold(spec, "latest") {
+		return "", true
+	}
+	if i := strings.LastIndex(spec, "."); i > 0 && strings.EqualFold(spec[i+1:], "latest") {
+		return spec[:i], true
+	}
+	return "", false
+}
+
+// release resolves version from list to its download for d.Platform.
+func (d *Downloader) release(version string, list *VersionList) (*Release, error) {
+	url, plat, err := d.resolveURL(version, list.Downloads)
+	if err != nil {
+		return nil, err
+	}
+	size := list.Sizes[url]
+	if d.Mirror != "" {
+		if url, err = mirrorURL(d.Mirror, version, url); err != nil {
+			return nil, err
+		}
+	}
+	return &Release{Version: version, Platform: plat, URL: url, Size: size}, nil
+}
+
+// AssetSize asks the server for the size of the release archive without
+// downloading it.
+func (d *Downloader) AssetSize(release *Release) (int64, error) {
+	resp, err := d.head(release.URL)
+	if err != nil {
+		return 0, fmt.Errorf("checking %s: %w", release.URL, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, fmt.Errorf("checking %s: %w", release.URL, ErrAssetNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("checking %s: %s", release.URL, resp.Status)
+	}
+	return resp.ContentLength, nil
+}
+
+// resolveURL returns the driver download URL of version and the platform
+// it was built for, which differs from d.Platform only when AutoPlatform
+// falls back to the other Windows build. Versions found in the Chrome for
+// Testing feed use its URLs; older ones are built from the legacy storage
+// host.
+func (d *Downloader) resolveURL(version string, downloads map[string]map[string]string) (string, string, error) {
+	if url, ok := assetURL(version, d.Platform, downloads); ok {
+		return url, d.Platform, nil
+	}
+	alt, ok := windowsAlternate[d.Platform]
+	if !ok {
+		return "", "", fmt.Errorf("%w: version %s has no %s driver", ErrAssetNotFound, version, d.Platform)
+	}
+	url, ok := assetURL(version, alt, downloads)
+	if !ok {
+		return "", "", fmt.Errorf("%w: version %s has no %s driver", ErrAssetNotFound, version, d.Platform)
+	}
+	if !d.AutoPlatform {
+		return "", "", fmt.Errorf("%w: version %s has no %s driver; use --platform=%s or --auto-platform", ErrAssetNotFound, version, d.Platform, alt)
+	}
+	if err := d.warnf("version %s has no %s driver, downloading %s instead", version, d.Platform, alt); err != nil {
+		return "", "", err
+	}
+	return url, alt, nil
+}
+
+// assetURL looks up the driver URL of version for plat in the feed's
+// downloads, or on the legacy storage host for versions the feed lacks.
+func assetURL(version, plat string, downloads map[string]map[string]string) (string, bool) {
+	assets, ok := downloads[version]
+	if !ok {
+		suffix, ok := legacyPlatforms[plat]
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf(targetTemplate, version, suffix), true
+	}
+	url, ok := assets[plat]
+	return url, ok
+}
+
+// Download saves the release archive into a fresh temp directory and returns
+// its path along with a func that removes the directory. A download that
+// breaks off part way is started over, up to Retries times. With a CacheDir
+// the archive is served from, or saved to, the cache instead and the func
+// does nothing.
+func (d *Downloader) Download(release *Release) (string, func() error, error) {
+	if d.CacheDir != "" {
+		path, err := d.downloadCached(release)
+		return path, func() error { return nil }, err
+	}
+
+	tempPath, finFunc, err := createTemp(d.TempDir, tempPattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("creating temp dir: %w", err)
+	}
+
+	// The name is only known from the response, so the archive is renamed
+	// once it is in.
+	partPath := filepath.Join(tempPath, filepath.Base(release.URL)+".part")
+	z, err := os.Create(partPath)
+	if err != nil {
+		return "", finFunc, fmt.Errorf("creating %s: %w", partPath, err)
+	}
+	err = d.retry(func() (bool, error) {
+		if _, err := z.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		if err := z.Truncate(0); err != nil {
+			return false, err
+		}
+		err := d.DownloadTo(release, z)
+		// request has already retried failed requests and error statuses;
+		// only a body that broke off is worth another go.
+		return errors.As(err, new(*bodyError)) && retryableError(err), err
+	})
+	if err != nil {
+		z.Close()
+		return "", finFunc, err
+	}
+	if err := z.Close(); err != nil {
+		return "", finFunc, fmt.Errorf("writing %s: %w", partPath, err)
+	}
+
+	zipFilePath := filepath.Join(tempPath, release.ArchiveName)
+	if err := os.Rename(partPath, zipFilePath); err != nil {
+		return "", finFunc, err
+	}
+	return zipFilePath, finFunc, nil
+}
+
+// DownloadTo streams the release archive into w as it arrives. The SHA-256
+// is computed on the same pass and recorded in release.SHA256.
+func (d *Downloader) DownloadTo(release *Release, w io.Writer) error {
+	resp, url, err := d.getArchive(release)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	start := time.Now()
+	release.ArchiveName = archiveName(resp, release.URL)
+
+	src := &brokenBody{r: resp.Body}
+	var body io.Reader = src
+	if d.MaxRate > 0 {
+		body = newRateLimitedReader(body, d.MaxRate)
+	}
+	var progress *progressReader
+	report := d.downloadProgress(release)
+	if report != nil && (d.batch != nil || resp.ContentLength < 0 || resp.ContentLength >= d.ProgressMinSize) {
+		progress = &progressReader{r: body, name: filepath.Base(release.URL), total: resp.ContentLength, progress: report}
+		body = progress
+		report(progress.name, 0, progress.total)
+	}
+	if d.Heartbeat > 0 && d.batch == nil {
+		counter := &countingReader{r: body}
+		body = counter
+		defer d.heartbeat(counter, filepath.Base(release.URL))()
+	}
+
+	// Success is judged by the bytes actually copied: some mirrors send
+	// Content-Length: 0 in front of a chunked body.
+	hash := sha256.New()
+	hashes := io.MultiWriter(w, hash)
+	// The SHA-256 is always wanted, for the cache and manifest; a Checksum
+	// of another kind needs its own hash alongside.
+	verify := hash
+	if d.Checksum != "" && d.checksumAlgo() != "sha256" {
+		verify = newChecksumHash(d.checksumAlgo())
+		hashes = io.MultiWriter(w, hash, verify)
+	}
+	n, err := io.Copy(hashes, body)
+	if src.err != nil {
+		return &bodyError{URL: url, Err: src.err}
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", url, err)
+	}
+	if progress != nil && progress.total < 0 {
+		// Complete the line, which never reached a known total.
+		report(progress.name, n, n)
+	}
+	if n == 0 {
+		return fmt.Errorf("downloading %s: server sent an empty archive", url)
+	}
+	// A size mismatch catches truncated and wrong assets without a checksum.
+	if release.Size > 0 && n != release.Size {
+		return fmt.Errorf("downloading %s: expected %d bytes, got %d", url, release.Size, n)
+	}
+	release.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	d.Stats.addDownload(release.URL, n)
+	d.recordThroughput(url, n, time.Since(start))
+
+	if d.Checksum != "" {
+		if got := hex.EncodeToString(verify.Sum(nil)); !strings.EqualFold(d.Checksum, got) {
+			return errChecksumMismatch(url, d.Checksum, got)
+		}
+	}
+	return nil
+}
+
+func errChecksumMismatch(url, expected, got string) error {
+	return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", url, expected, got)
+}
+
+// getArchive requests the release archive from each of archiveURLs in turn
+// until one answers 200, and returns the response with the URL that gave
+// it. Only the last failure is returned when all fail.
+func (d *Downloader) getArchive(release *Release) (*http.Response, string, error) {
+	urls := d.archiveURLs(release)
+	var err error
+	for i, url := range urls {
+		if i > 0 {
+			d.verbosef("%v; trying %s\n", err, url)
+		}
+		var resp *http.Response
+		resp, err = d.get(url)
+		if err != nil {
+			err = fmt.Errorf("downloading %s: %w", url, err)
+			continue
+		}
+		if resp.StatusCode == http.StatusOK {
+			if page, ok := redirectedToHTML(url, resp); ok {
+				resp.Body.Close()
+				err = fmt.Errorf("downloading %s: redirected to the HTML page %s: %w", url, page, ErrAssetNotFound)
+				continue
+			}
+			return resp, url, nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			err = fmt.Errorf("downloading %s: %w", url, ErrAssetNotFound)
+		} else {
+			err = fmt.Errorf("downloading %s: %s", url, resp.Status)
+		}
+	}
+	return nil, "", err
+}
+
+// archiveName is the name to save the archive in resp under: the filename
+// its Content-Disposition gives, as mirrors redirecting to opaque URLs
+// send, or else the last element of url. Only the base of either is kept,
+// so the name cannot reach outside the directory it is saved in.
+func archiveName(resp *http.Response, url string) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		name := path.Base(strings.ReplaceAll(params["filename"], "\\", "/"))
+		if name != "." && name != ".." && name != "/" && !strings.ContainsAny(name, "\x00:") {
+			return name
+		}
+	}
+	return filepath.Base(url)
+}
+
+// redirectedToHTML reports whether the request for url was redirected to
+// an HTML page, which is how some hosts answer for retired versions, and
+// returns where it landed.
+func redirectedToHTML(url string, resp *http.Response) (string, bool) {
+	if resp.Request == nil || resp.Request.URL.String() == url {
+		return "", false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", false
+	}
+	return resp.Request.URL.String(), true
+}
+
+// Extract unpacks the zip or tar.gz archive at src into dest and returns
+// the paths of the files it wrote.
+func (d *Downloader) Extract(src, dest string) ([]string, error) {
+	files, err := d.extract(dest, func(dir string, opts *extractOptions) ([]string, error) {
+		return extractArchive(src, dir, opts)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("extracting %s: %w", filepath.Base(src), err)
+	}
+	return files, nil
+}
+
+// DownloadExtract downloads the release archive into memory and unpacks it
+// into dest without writing the archive to disk. It suits archives small
+// enough to buffer whole, which zip's random access requires.
+func (d *Downloader) DownloadExtract(release *Release, dest string) ([]string, error) {
+	var buf bytes.Buffer
+	if err := d.DownloadTo(release, &buf); err != nil {
+		return nil, inPhase("download", release.Version, err)
+	}
+	files, err := d.extract(dest, func(dir string, opts *extractOptions) ([]string, error) {
+		return extractBytes(buf.Bytes(), dir, opts)
+	})
+	if err != nil {
+		return nil, inPhase("extract", release.Version, fmt.Errorf("extracting %s: %w", filepath.Base(release.URL), err))
+	}
+	return files, nil
+}
+
+// keepEntry applies OnlyBinary and Exclude to the archive entry name.
+func (d *Downloader) keepEntry(name string) bool {
+	base := path.Base(name)
+	if d.OnlyBinary && !isDriverName(base) {
+		return false
+	}
+	for _, pattern := range d.Exclude {
+		if ok, _ := path.Match(pattern, base); ok {
+			return false
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// entryMode gives the driver binary, or with ModeAllFiles every file, the
+// permissions Mode.
+func (d *Downloader) entryMode(name string, archived os.FileMode) os.FileMode {
+	if d.ModeAllFiles || isDriverName(path.Base(name)) {
+		return d.Mode
+	}
+	return archived
+}
+
+// extract runs unpack on dest, or on a temp dir under d.StageDir whose
+// files are then moved into dest, and logs how many files it wrote.
+func (d *Downloader) extract(dest string, unpack func(dir string, opts *extractOptions) ([]string, error)) ([]string, error) {
+	opts := &extractOptions{
+		Context:  d.context(),
+		Progress: d.extractProgress(),
+		MaxSize:  d.MaxUncompressedSize,
+		MaxRatio: d.MaxCompressionRatio,
+
+		PreserveTimes: d.PreserveTimes,
+	}
+	if d.OnlyBinary || len(d.Exclude) > 0 {
+		opts.Keep = d.keepEntry
+	}
+	if d.Mode != 0 {
+		opts.Mode = d.entryMode
+	}
+	defer func() {
+		fmt.Fprintf(d.Log, "extracted %d files, skipped %d (filtered), failed %d\n", opts.Extracted, opts.Skipped, opts.Failed)
+		if opts.Unchanged > 0 {
+			d.verbosef("%d of them were already in place and left untouched\n", opts.Unchanged)
+		}
+	}()
+
+	// Entries are contained and moved against the real directory, so a
+	// symlinked --out neither trips the traversal guard nor sends the final
+	// rename across filesystems; callers still see paths under dest.
+	real, err := realPath(dest)
+	if err != nil {
+		return nil, err
+	}
+	if d.StageDir == "" {
+		opts.Workers = d.extractWorkers(real)
+		files, err := unpack(real, opts)
+		return rebasePaths(files, real, dest), err
+	}
+
+	stage, cleanup, err := createTemp(d.StageDir, tempPattern)
+	if err != nil {
+		return nil, fmt.Errorf("creating staging dir: %w", err)
+	}
+	defer cleanup()
+
+	opts.Workers = d.extractWorkers(stage)
+	staged, err := unpack(stage, opts)
+	if err != nil {
+		return nil, err
+	}
+	files, err := moveFiles(stage, real, staged)
+	if err != nil {
+		return nil, fmt.Errorf("moving into %s: %w", dest, err)
+	}
+	return rebasePaths(files, real, dest), nil
+}
+
+// driverBinary picks the chromedriver executable out of extracted files.
+func driverBinary(files []string) (string, bool) {
+	for _, f := range files {
+		if isDriverName(filepath.Base(f)) {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// createTemp creates a uniquely named directory under dir. The "*" in pattern
+// is replaced by MkdirTemp's random suffix, so concurrent runs never share a
+// directory.
+func createTemp(dir, pattern string) (string, func() error, error) {
+	tmp, err := os.MkdirTemp(dir, pattern)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tmp, func() error {
+		return os.RemoveAll(tmp)
+	}, nil
+}
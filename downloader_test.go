@@ -0,0 +1,579 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCreateTempConcurrent(t *testing.T) {
+	parent := t.TempDir()
+	dirs := make([]string, 2)
+	var wg sync.WaitGroup
+	for i := range dirs {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dir, _, err := createTemp(parent, tempPattern)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			dirs[i] = dir
+		}()
+	}
+	wg.Wait()
+	if dirs[0] == "" || dirs[0] == dirs[1] {
+		t.Fatalf("createTemp made %q and %q, want two distinct directories", dirs[0], dirs[1])
+	}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.Errorf("%s is not a directory: %v", dir, err)
+		}
+	}
+}
+
+func TestCreateTempCleanup(t *testing.T) {
+	dir, cleanup, err := createTemp(t.TempDir(), tempPattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after cleanup: %v", dir, err)
+	}
+}
+
+func TestDefaultPlatform(t *testing.T) {
+	for _, test := range []struct{ goos, goarch, want string }{
+		{"windows", "amd64", "win64"},
+		{"windows", "arm64", "win64"},
+		{"windows", "386", "win32"},
+		{"linux", "amd64", "win32"},
+		{"darwin", "arm64", "win32"},
+	} {
+		if got := defaultPlatform(test.goos, test.goarch); got != test.want {
+			t.Errorf("defaultPlatform(%s, %s) = %s, want %s", test.goos, test.goarch, got, test.want)
+		}
+	}
+	// An explicit Windows build is kept whatever the host.
+	for _, platform := range []string{"win32", "win64"} {
+		if d, _ := flagDownloader(t, "--platform", platform); d.Platform != platform {
+			t.Errorf("--platform=%s gave %s", platform, d.Platform)
+		}
+	}
+}
+
+func TestWin32FallsBackToWin64(t *testing.T) {
+	s := newTestServer(t)
+	d := s.downloader()
+	d.Platform = "win32"
+	_, err := d.Resolve("116")
+	if !errors.Is(err, ErrAssetNotFound) || !strings.Contains(err.Error(), "--platform=win64") {
+		t.Fatalf("resolving 116 for win32: got %v, want a missing asset suggesting --platform=win64", err)
+	}
+
+	var log bytes.Buffer
+	d.AutoPlatform = true
+	d.Log = &log
+	release, err := d.Resolve("116")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Platform != "win64" || release.URL != s.archiveURL(testStable, "win64") {
+		t.Errorf("resolved %s for %s, want the win64 driver", release.URL, release.Platform)
+	}
+	if !strings.Contains(log.String(), "downloading win64 instead") {
+		t.Errorf("logged %q, want the substitution explained", log.String())
+	}
+
+	release, err = d.Resolve("115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Platform != "win32" {
+		t.Errorf("resolved 115 for %s, want win32 kept where it exists", release.Platform)
+	}
+}
+
+func TestDownloaderStubClient(t *testing.T) {
+	const (
+		feedURL    = "https://feed.invalid/known-good-versions.json"
+		archiveURL = "https://dl.invalid/115.0.5790.102/linux64/chromedriver-linux64.zip"
+	)
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	feed := `{"versions": [{"version": "115.0.5790.102", "downloads": {"chromedriver": [{"platform": "linux64", "url": "` + archiveURL + `"}]}}]}`
+	var requested []string
+	d := NewDownloader()
+	d.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		switch req.URL.String() {
+		case feedURL:
+			return stubResponse(req, http.StatusOK, []byte(feed)), nil
+		case archiveURL:
+			return stubResponse(req, http.StatusOK, archive), nil
+		}
+		return stubResponse(req, http.StatusNotFound, nil), nil
+	})}
+	d.FeedURL = feedURL
+	d.MilestonesURL = ""
+	d.Sources = []VersionSource{feedSource{d}}
+	d.AllowPrerelease = true
+	d.Platform = "linux64"
+	d.TempDir = t.TempDir()
+	d.Log = ioutil.Discard
+
+	release, err := d.Resolve("115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Version != "115.0.5790.102" || release.URL != archiveURL {
+		t.Fatalf("resolved %s at %s", release.Version, release.URL)
+	}
+	path, cleanup, err := d.Download(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	dest := t.TempDir()
+	files, err := d.Extract(path, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("extracted %q, want the driver, license and notices", files)
+	}
+	b, err := os.ReadFile(filepath.Join(dest, "chromedriver-linux64", "chromedriver"))
+	if err != nil || string(b) != testDriver("115.0.5790.102") {
+		t.Errorf("extracted driver %q, %v", b, err)
+	}
+	if len(requested) != 2 {
+		t.Errorf("requested %q, want the feed and the archive only", requested)
+	}
+}
+
+// stubDownloader returns a Downloader whose client answers every request
+// with body.
+func stubDownloader(t testing.TB, body []byte) *Downloader {
+	d := NewDownloader()
+	d.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return stubResponse(req, http.StatusOK, body), nil
+	})}
+	d.TempDir = t.TempDir()
+	d.Log = ioutil.Discard
+	return d
+}
+
+func TestDownloadHash(t *testing.T) {
+	// sha256sum of the body.
+	const want = "ca1262cd11858d180835a10000b7a2eaf54d1c51aa8a4f542b00fb7eb31ea8af"
+	d := stubDownloader(t, []byte("ChromeDriver archive fixture\n"))
+	release := &Release{Version: "115.0.5790.102", Platform: "linux64", URL: "https://dl.invalid/chromedriver-linux64.zip"}
+	_, cleanup, err := d.Download(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if release.SHA256 != want {
+		t.Errorf("hashed %s, want %s", release.SHA256, want)
+	}
+
+	d.Checksum = want
+	if _, _, err := d.Download(release); err != nil {
+		t.Errorf("verifying the known sum: %v", err)
+	}
+	d.Checksum = strings.Repeat("0", 64)
+	if _, _, err := d.Download(release); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("verifying a wrong sum: got %v, want a mismatch", err)
+	}
+}
+
+var benchArchive = bytes.Repeat([]byte("chromedriver"), 1<<20)
+
+// BenchmarkDownloadHash hashes the archive as Download writes it.
+func BenchmarkDownloadHash(b *testing.B) {
+	d := stubDownloader(b, benchArchive)
+	b.SetBytes(int64(len(benchArchive)))
+	for i := 0; i < b.N; i++ {
+		release := &Release{URL: "https://dl.invalid/chromedriver-linux64.zip"}
+		_, cleanup, err := d.Download(release)
+		if err != nil {
+			b.Fatal(err)
+		}
+		cleanup()
+	}
+}
+
+// BenchmarkDownloadHashReread hashes the archive by reading it back once
+// written, as Download did before hashing inline.
+func BenchmarkDownloadHashReread(b *testing.B) {
+	d := stubDownloader(b, benchArchive)
+	b.SetBytes(int64(len(benchArchive)))
+	for i := 0; i < b.N; i++ {
+		resp, err := d.get("https://dl.invalid/chromedriver-linux64.zip")
+		if err != nil {
+			b.Fatal(err)
+		}
+		path := filepath.Join(d.TempDir, "chromedriver-linux64.zip")
+		f, err := os.Create(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = io.Copy(f, resp.Body)
+		resp.Body.Close()
+		f.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+		f, err = os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		hash := sha256.New()
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+		_ = hex.EncodeToString(hash.Sum(nil))
+		os.Remove(path)
+	}
+}
+
+func TestDownloadExtractInMemory(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	d := s.downloader()
+	// No temp file can be made under a regular file.
+	blocker := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(blocker, nil, 0644)
+	d.TempDir = filepath.Join(blocker, "tmp")
+	release, err := d.Resolve("115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	files, err := d.DownloadExtract(release, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Errorf("extracted %q, want the driver, license and notices", files)
+	}
+	if version, err := InstalledVersion(dest); err != nil || version != "115.0.5790.102" {
+		t.Errorf("installed %s, %v", version, err)
+	}
+	if _, _, err := d.Download(release); err == nil {
+		t.Error("the temp dir was usable after all")
+	}
+
+	// The command line does the same for --no-temp.
+	out := t.TempDir()
+	if _, _, err := runCLI(t, setFlag(s.args(t, out, "--no-temp", "-v", "115"), "temp-dir", d.TempDir)...); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := InstalledVersion(out); err != nil || version != "115.0.5790.102" {
+		t.Errorf("--no-temp installed %s, %v", version, err)
+	}
+}
+
+func TestResolveLatestKeyword(t *testing.T) {
+	s := newTestServer(t)
+	d := s.downloader()
+	for spec, want := range map[string]string{
+		"latest":     testStable,
+		"LATEST":     testStable,
+		"115.latest": "115.0.5790.102",
+		"116.latest": testStable,
+	} {
+		release, err := d.Resolve(spec)
+		if err != nil {
+			t.Errorf("%s: %v", spec, err)
+		} else if release.Version != want {
+			t.Errorf("%s resolved to %s, want %s", spec, release.Version, want)
+		}
+	}
+	if _, err := d.Resolve("999.latest"); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("999.latest: got %v, want ErrVersionNotFound", err)
+	}
+
+	// With --channel, the keyword picks the version on the channel.
+	for _, test := range []struct{ channel, spec, want string }{
+		{"Stable", "latest", testStable},
+		{"Beta", "latest", testPrerelease},
+		{"Stable", "116.latest", testStable},
+	} {
+		c, err := newCLI([]string{"--channel", test.channel}, &bytes.Buffer{}, &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		release, err := c.resolve(d, test.spec)
+		if err != nil {
+			t.Errorf("--channel %s %s: %v", test.channel, test.spec, err)
+		} else if release.Version != test.want {
+			t.Errorf("--channel %s %s resolved to %s, want %s", test.channel, test.spec, release.Version, test.want)
+		}
+	}
+}
+
+func TestZeroContentLength(t *testing.T) {
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	release := &Release{Version: "115.0.5790.102", Platform: "linux64", URL: "https://dl.invalid/chromedriver-linux64.zip"}
+	for _, body := range [][]byte{archive, nil} {
+		d := stubDownloader(t, nil)
+		// The mirror claims an empty body, then sends it chunked.
+		d.Client.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp := stubResponse(req, http.StatusOK, body)
+			resp.ContentLength = 0
+			resp.Header.Set("Content-Length", "0")
+			resp.TransferEncoding = []string{"chunked"}
+			return resp, nil
+		})
+		var reported int64
+		d.DownloadProgress = func(name string, done, total int64) { reported = done }
+		d.ProgressMinSize = 0
+
+		path, cleanup, err := d.Download(release)
+		if body == nil {
+			if err == nil || !strings.Contains(err.Error(), "server sent an empty archive") {
+				t.Errorf("an empty body: got %v, want it refused", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cleanup()
+		if b, _ := os.ReadFile(path); !bytes.Equal(b, archive) {
+			t.Errorf("saved %d bytes, want the %d sent", len(b), len(archive))
+		}
+		if reported != int64(len(archive)) {
+			t.Errorf("reported %d bytes of progress, want %d", reported, len(archive))
+		}
+		if _, err := d.Extract(path, t.TempDir()); err != nil {
+			t.Errorf("extracting the download: %v", err)
+		}
+	}
+}
+
+func TestResolveURL(t *testing.T) {
+	const cft = "https://storage.googleapis.com/chrome-for-testing-public/115.0.5790.102/"
+	source := stubSource{name: "stub", list: &VersionList{
+		Versions: map[string][]string{
+			"114": {"114.0.5735.90"},
+			"115": {"115.0.5790.102"},
+		},
+		Downloads: map[string]map[string]string{"115.0.5790.102": {
+			"linux64":   cft + "linux64/chromedriver-linux64.zip",
+			"win64":     cft + "win64/chromedriver-win64.zip",
+			"mac-arm64": cft + "mac-arm64/chromedriver-mac-arm64.zip",
+		}},
+	}}
+	d := NewDownloader()
+	d.Sources = []VersionSource{source}
+	d.MilestonesURL = ""
+	d.AllowPrerelease = true
+	d.Log = ioutil.Discard
+	for _, test := range []struct{ version, platform, arch, mirror, want string }{
+		// 114 and older are on the legacy storage host, named after it.
+		{"114", "linux64", "", "", "https://chromedriver.storage.googleapis.com/114.0.5735.90/chromedriver_linux64.zip"},
+		{"114.0.5735.90", "darwin", "arm64", "", "https://chromedriver.storage.googleapis.com/114.0.5735.90/chromedriver_mac_arm64.zip"},
+		{"115", "linux64", "", "", cft + "linux64/chromedriver-linux64.zip"},
+		{"115.0.5790.102", "windows", "amd64", "", cft + "win64/chromedriver-win64.zip"},
+		{"latest", "mac-arm64", "arm64", "", cft + "mac-arm64/chromedriver-mac-arm64.zip"},
+		{"115", "linux", "amd64", "https://mirror.example/cft", "https://mirror.example/cft/115.0.5790.102/linux64/chromedriver-linux64.zip"},
+		{"114", "linux64", "", "https://mirror.example", "https://mirror.example/114.0.5735.90/chromedriver_linux64.zip"},
+	} {
+		d.Mirror = test.mirror
+		got, err := d.ResolveURL(test.version, test.platform, test.arch)
+		if err != nil {
+			t.Errorf("%s %s/%s: %v", test.version, test.platform, test.arch, err)
+		} else if got != test.want {
+			t.Errorf("%s %s/%s: got %s, want %s", test.version, test.platform, test.arch, got, test.want)
+		}
+	}
+	d.Mirror = ""
+	for _, test := range []struct{ version, platform, arch, want string }{
+		{"115", "linux64", "arm64", "platform linux64 is built for amd64, not arm64"},
+		{"115", "linux", "arm64", "no driver is built for linux/arm64"},
+		{"115", "mac-x64", "", "has no mac-x64 driver"},
+	} {
+		if _, err := d.ResolveURL(test.version, test.platform, test.arch); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s %s/%s: got %v, want %q", test.version, test.platform, test.arch, err, test.want)
+		}
+	}
+}
+
+func TestDeclaredSizeMismatch(t *testing.T) {
+	s := newTestServer(t)
+	s.declareSizes = true
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	short := len(archive) - 100
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive[:short])
+	})
+	d := s.downloader()
+	d.TempDir = t.TempDir()
+	release, err := d.Resolve("115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Size != int64(len(archive)) {
+		t.Fatalf("resolved a declared size of %d, want %d", release.Size, len(archive))
+	}
+	_, _, err = d.Download(release)
+	if want := fmt.Sprintf("expected %d bytes, got %d", len(archive), short); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+
+	// An archive of the declared size downloads as usual.
+	release, err = d.Resolve("115.0.5790.98")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, cleanup, err := d.Download(release); err != nil {
+		t.Errorf("downloading an archive of the declared size: %v", err)
+	} else {
+		cleanup()
+	}
+}
+
+func TestArchAliases(t *testing.T) {
+	for alias, want := range map[string]string{
+		"amd64":   "amd64",
+		"x64":     "amd64",
+		"X86_64":  "amd64",
+		"386":     "386",
+		"x86":     "386",
+		"i386":    "386",
+		"i686":    "386",
+		"arm64":   "arm64",
+		"aarch64": "arm64",
+	} {
+		if got, err := normalizeArch(alias); err != nil || got != want {
+			t.Errorf("normalizeArch(%s) = %s, %v, want %s", alias, got, err, want)
+		}
+	}
+	_, err := normalizeArch("sparc")
+	if err == nil || !strings.Contains(err.Error(), `unknown arch "sparc", expected one of 386, aarch64, amd64, arm64, i386, i686, x64, x86, x86_64`) {
+		t.Errorf("got %v, want the accepted aliases listed", err)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--platform", "mac-arm64", "--arch", "aarch64"}, "mac-arm64"},
+		{[]string{"--platform", "win32", "--arch", "x86"}, "win32"},
+		{[]string{"--platform", "win64", "--arch", "x64"}, "win64"},
+	} {
+		if d, _ := flagDownloader(t, test.args...); d.Platform != test.want {
+			t.Errorf("%q picked %s, want %s", test.args, d.Platform, test.want)
+		}
+	}
+	c, err := newCLI([]string{"--platform", "win64", "--arch", "x86"}, &bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.newDownloaderFromFlags(); err == nil || !strings.Contains(err.Error(), "does not match --platform win64") {
+		t.Errorf("got %v, want --arch x86 refused for win64", err)
+	}
+}
+
+func TestRedirectToHTML(t *testing.T) {
+	s := newTestServer(t)
+	// 115.0.5790.98 is retired, its archive sent on to a page saying so;
+	// 115.0.5790.102 has moved, and is still an archive where it went.
+	s.mux.HandleFunc("/dl/115.0.5790.98/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/retired", http.StatusFound)
+	})
+	s.mux.HandleFunc("/retired", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><body>This version is no longer available.</body></html>")
+	})
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved/chromedriver-linux64.zip", http.StatusFound)
+	})
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	s.mux.HandleFunc("/moved/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(archive)
+	})
+	d := s.downloader()
+	download := func(version string) ([]byte, error) {
+		t.Helper()
+		release, err := d.Resolve(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = d.DownloadTo(release, &buf)
+		return buf.Bytes(), err
+	}
+
+	got, err := download("115.0.5790.98")
+	if !errors.Is(err, ErrAssetNotFound) || !strings.Contains(err.Error(), "redirected to the HTML page "+s.URL+"/retired") {
+		t.Errorf("got %v, want the asset not found", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("wrote %q of the page as the archive", got)
+	}
+	if got, err = download("115.0.5790.102"); err != nil || !bytes.Equal(got, archive) {
+		t.Errorf("a redirect to the archive: %v", err)
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	s := newTestServer(t)
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	var disposition string
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		if disposition != "" {
+			w.Header().Set("Content-Disposition", disposition)
+		}
+		w.Write(archive)
+	})
+	d := s.downloader()
+	for _, test := range []struct{ disposition, want string }{
+		{`attachment; filename="chromedriver-mirror.zip"`, "chromedriver-mirror.zip"},
+		// Only the base of the name is kept, whichever separator it uses.
+		{`attachment; filename="../../evil.zip"`, "evil.zip"},
+		{`attachment; filename="..\\..\\evil.zip"`, "evil.zip"},
+		// Without a usable filename, the URL names the archive.
+		{"", "chromedriver-linux64.zip"},
+		{"attachment", "chromedriver-linux64.zip"},
+		{`attachment; filename=".."`, "chromedriver-linux64.zip"},
+	} {
+		disposition = test.disposition
+		d.TempDir = t.TempDir()
+		release, err := d.Resolve("115.0.5790.102")
+		if err != nil {
+			t.Fatal(err)
+		}
+		path, cleanup, err := d.Download(release)
+		if err != nil {
+			t.Errorf("%q: %v", test.disposition, err)
+			continue
+		}
+		if filepath.Base(path) != test.want || filepath.Dir(filepath.Dir(path)) != d.TempDir {
+			t.Errorf("%q: saved to %s, want %s in a temp dir under %s", test.disposition, path, test.want, d.TempDir)
+		}
+		if b, _ := ioutil.ReadFile(path); !bytes.Equal(b, archive) {
+			t.Errorf("%q: the saved file is not the archive", test.disposition)
+		}
+		cleanup()
+	}
+}
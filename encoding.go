@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is sent with every request. Setting it by hand turns off
+// the transport's own gzip handling, so decodeBody takes care of both.
+const acceptEncoding = "gzip, deflate"
+
+// decodeBody replaces a gzip or deflate encoded resp.Body with a reader of
+// the decoded bytes, so sizes and checksums are taken over the asset
+// itself rather than its transfer encoding.
+func decodeBody(resp *http.Response) error {
+	var (
+		decoded io.Reader
+		err     error
+	)
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		decoded, err = gzip.NewReader(resp.Body)
+	case "deflate":
+		decoded, err = newDeflateReader(resp.Body)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	resp.Body = &decodedBody{Reader: decoded, raw: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// newDeflateReader accepts both zlib-wrapped streams, which is what the
+// "deflate" coding means, and the raw deflate some servers send instead.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(2)
+	if err == nil && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+type decodedBody struct {
+	io.Reader
+	raw io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	if c, ok := b.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return b.raw.Close()
+}
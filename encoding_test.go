@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// encodeBody compresses b as the Content-Encoding encoding.
+func encodeBody(t testing.TB, encoding string, b []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	w.Write(b)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodedResponses(t *testing.T) {
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate"} {
+		header := encoding
+		if encoding == "raw-deflate" {
+			header = "deflate"
+		}
+		s := newTestServer(t)
+		archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+		var accepted []string
+		s.mux.HandleFunc("/encoded/feed.json", func(w http.ResponseWriter, r *http.Request) {
+			accepted = append(accepted, r.Header.Get("Accept-Encoding"))
+			body := bytes.Replace(s.feed(), []byte(s.archiveURL("115.0.5790.102", "linux64")), []byte(s.URL+"/encoded/chromedriver-linux64.zip"), 1)
+			w.Header().Set("Content-Encoding", header)
+			w.Write(encodeBody(t, encoding, body))
+		})
+		s.mux.HandleFunc("/encoded/chromedriver-linux64.zip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", header)
+			w.Write(encodeBody(t, encoding, archive))
+		})
+		d := s.downloader()
+		d.FeedURL = s.URL + "/encoded/feed.json"
+		d.AllowPrerelease = true
+
+		release, err := d.Resolve("115")
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if release.URL != s.URL+"/encoded/chromedriver-linux64.zip" {
+			t.Fatalf("%s: resolved %s, want the encoded archive", encoding, release.URL)
+		}
+		var out bytes.Buffer
+		if err := d.DownloadTo(release, &out); err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		sum := sha256.Sum256(archive)
+		if !bytes.Equal(out.Bytes(), archive) || release.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: downloaded %d bytes hashing to %s, want the decoded archive", encoding, out.Len(), release.SHA256)
+		}
+		if len(accepted) == 0 || !strings.Contains(accepted[0], "gzip") {
+			t.Errorf("%s: sent Accept-Encoding %q", encoding, accepted)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrVersionNotFound reports that no published driver matches the
+	// requested version.
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrMajorNotFound reports that no version at all is published for the
+	// requested major. Errors matching it also match ErrVersionNotFound.
+	ErrMajorNotFound = errors.New("major not found")
+	// ErrAssetNotFound reports that a version exists but has no driver for
+	// the requested platform.
+	ErrAssetNotFound = errors.New("driver asset not found")
+	// ErrIncompatiblePair reports that the driver and Chrome resolved for
+	// --with-chrome are not the same build.
+	ErrIncompatiblePair = errors.New("incompatible driver and chrome")
+	// ErrDrift reports that the installed driver differs from the one
+	// pinned in the lockfile.
+	ErrDrift = errors.New("installed driver does not match lockfile")
+	// ErrBudgetExhausted reports that the run used up --max-total-retries
+	// or ran past --deadline.
+	ErrBudgetExhausted = errors.New("retry budget exhausted")
+	// ErrArchiveLimits reports an archive that would unpack to more than
+	// the configured size or compression ratio, as a zip bomb does.
+	ErrArchiveLimits = errors.New("archive exceeds safety limits")
+	// ErrStrict reports a warning that --strict turned into a failure.
+	ErrStrict = errors.New("strict mode")
+	// ErrNetworkDisabled reports a request made while --no-network
+	// forbids them.
+	ErrNetworkDisabled = errors.New("network access is disabled by --no-network")
+	// ErrNotInstalled reports that a directory holds no chromedriver
+	// binary that runs.
+	ErrNotInstalled = errors.New("no chromedriver is installed")
+	// ErrChecksumRequired reports a download refused by --require-checksum
+	// for want of a checksum to verify it against.
+	ErrChecksumRequired = errors.New("checksum required")
+	// ErrUsage reports a command line that does not say what to do.
+	ErrUsage = errors.New("nothing to do")
+)
+
+// Exit codes of the command, so scripts can tell failures apart.
+const (
+	exitFailure         = 1
+	exitUsage           = 2
+	exitVersionNotFound = 3
+	exitAssetNotFound   = 4
+	exitDrift           = 5
+)
+
+// exitCode maps err to the exit status the command ends with.
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, ErrUsage):
+		return exitUsage
+	case errors.Is(err, ErrVersionNotFound):
+		return exitVersionNotFound
+	case errors.Is(err, ErrAssetNotFound):
+		return exitAssetNotFound
+	case errors.Is(err, ErrDrift):
+		return exitDrift
+	}
+	return exitFailure
+}
+
+// majorNotFoundError is ErrMajorNotFound for a particular major, naming the
+// newest one published so a typo stands out.
+type majorNotFoundError struct {
+	Major  string
+	Newest string
+}
+
+func (e *majorNotFoundError) Error() string {
+	if e.Newest == "" {
+		return fmt.Sprintf("%v: %s (no versions of major %s are published)", ErrVersionNotFound, e.Major, e.Major)
+	}
+	return fmt.Sprintf("%v: %s (no versions of major %s are published; the newest major is %s)", ErrVersionNotFound, e.Major, e.Major, e.Newest)
+}
+
+func (e *majorNotFoundError) Is(target error) bool {
+	return target == ErrMajorNotFound || target == ErrVersionNotFound
+}
+
+// errMajorNotFound returns the error for major missing from list.
+func errMajorNotFound(major string, list *VersionList) error {
+	e := &majorNotFoundError{Major: major}
+	if len(list.Majors) > 0 {
+		e.Newest = list.Majors[0]
+	}
+	return e
+}
+
+// phaseError records which step of installing version failed, for
+// --error-format=json. Its message is that of the wrapped error.
+type phaseError struct {
+	Phase   string
+	Version string
+	Err     error
+}
+
+func (e *phaseError) Error() string { return e.Err.Error() }
+
+func (e *phaseError) Unwrap() error { return e.Err }
+
+// inPhase wraps a non-nil err with the phase and version it failed in,
+// keeping the innermost phase when err already has one.
+func inPhase(phase, version string, err error) error {
+	var pe *phaseError
+	if err == nil || errors.As(err, &pe) {
+		return err
+	}
+	return &phaseError{Phase: phase, Version: version, Err: err}
+}
+
+// jsonError is the --error-format=json rendering of a failure.
+type jsonError struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Code          int    `json:"code"`
+	Message       string `json:"message"`
+	Version       string `json:"version,omitempty"`
+	Phase         string `json:"phase,omitempty"`
+}
+
+// writeJSONError writes err to w as a single-line JSON object.
+func writeJSONError(w io.Writer, err error) error {
+	je := jsonError{SchemaVersion: schemaVersion, Code: exitCode(err), Message: err.Error()}
+	var pe *phaseError
+	if errors.As(err, &pe) {
+		je.Version, je.Phase = pe.Version, pe.Phase
+	}
+	return json.NewEncoder(w).Encode(je)
+}
+
+// warnf prints a warning to d.Log, or under Strict returns it as an
+// ErrStrict error instead, in which case the caller must stop.
+func (d *Downloader) warnf(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if d.Strict {
+		return fmt.Errorf("%w: %s", ErrStrict, msg)
+	}
+	fmt.Fprintf(d.Log, "warning: %s.\n", msg)
+	return nil
+}
+
+// notef is warnf for situations that are only worth mentioning with
+// Verbose, but still fail under Strict.
+func (d *Downloader) notef(format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if d.Strict {
+		return fmt.Errorf("%w: %s", ErrStrict, msg)
+	}
+	d.verbosef("note: %s.\n", msg)
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	s := newTestServer(t)
+	resolve := func(platform, spec string) func() error {
+		return func() error {
+			d := s.downloader()
+			d.Platform = platform
+			_, err := d.Resolve(spec)
+			return err
+		}
+	}
+	for _, test := range []struct {
+		name string
+		fn   func() error
+		want error
+		code int
+	}{
+		{"unknown major", resolve("linux64", "999"), ErrVersionNotFound, exitVersionNotFound},
+		{"unknown version", resolve("linux64", "115.0.5790.1"), ErrVersionNotFound, exitVersionNotFound},
+		{"no win32 driver", resolve("win32", "116"), ErrAssetNotFound, exitAssetNotFound},
+		{"archive 404", func() error {
+			return s.downloader().DownloadTo(&Release{URL: s.URL + "/dl/missing.zip"}, ioutil.Discard)
+		}, ErrAssetNotFound, exitAssetNotFound},
+		{"nothing installed", func() error {
+			_, err := InstalledVersion(t.TempDir())
+			return err
+		}, ErrNotInstalled, exitFailure},
+	} {
+		err := test.fn()
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.want)
+		}
+		if code := exitCode(err); code != test.code {
+			t.Errorf("%s: exit code %d, want %d", test.name, code, test.code)
+		}
+	}
+}
+
+func TestMajorNotFoundIs(t *testing.T) {
+	_, err := newTestServer(t).downloader().Resolve("999")
+	var e *majorNotFoundError
+	if !errors.As(err, &e) || !errors.Is(err, ErrMajorNotFound) {
+		t.Fatalf("got %v, want a majorNotFoundError", err)
+	}
+	if e.Major != "999" || e.Newest != "116" {
+		t.Errorf("got major %s, newest %s; want 999 and 116, the newest stable", e.Major, e.Newest)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	s := newTestServer(t)
+	host, ok := hostPlatform()
+	if !ok {
+		t.Skip("no driver platform matches this host")
+	}
+	other := "mac-arm64"
+	if host == other {
+		other = "linux64"
+	}
+	checksum := sha256Hex(testArchive(t, "chromedriver-"+other+".zip", "115.0.5790.102", other))
+	args := func(out string, extra ...string) []string {
+		return setFlag(s.args(t, out, append([]string{"--checksum", checksum, "-v", "115"}, extra...)...), "platform", other)
+	}
+
+	// A driver for another platform is only noted normally...
+	out := t.TempDir()
+	if _, _, err := runCLI(t, args(out)...); err != nil {
+		t.Fatalf("installing the %s driver on a %s host: %v", other, host, err)
+	}
+
+	// ...but refused under --strict, before anything is installed.
+	out = t.TempDir()
+	_, stderr, code := runMain(t, args(out, "--strict")...)
+	if code != exitFailure {
+		t.Errorf("exit code %d, want %d", code, exitFailure)
+	}
+	if !strings.Contains(stderr, "strict mode: downloading the "+other+" driver on a "+host+" host") {
+		t.Errorf("printed %q, want the cross-platform download refused", stderr)
+	}
+	if entries, _ := os.ReadDir(out); len(entries) > 1 {
+		t.Errorf("a refused run left %d entries in --out", len(entries))
+	}
+
+	// A warning, such as falling back from win32, is refused too.
+	_, _, err := runCLI(t, setFlag(s.args(t, t.TempDir(), "--strict", "--auto-platform", "-v", "116"), "platform", "win32")...)
+	if !errors.Is(err, ErrStrict) || !strings.Contains(err.Error(), "has no win32 driver") {
+		t.Errorf("got %v, want the win32 fallback refused", err)
+	}
+}
+
+func TestMajorOrPlatformMissing(t *testing.T) {
+	s := newTestServer(t)
+	resolve := func(platform, spec string) error {
+		d := s.downloader()
+		d.Platform = platform
+		_, err := d.Resolve(spec)
+		return err
+	}
+
+	// A major the feed does not have: the version is wrong.
+	err := resolve("linux64", "999")
+	if !errors.Is(err, ErrMajorNotFound) || errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("999: got %v, want only the major not found", err)
+	}
+	if want := "version not found: 999 (no versions of major 999 are published; the newest major is 116)"; err == nil || err.Error() != want {
+		t.Errorf("999: got %q, want %q", err, want)
+	}
+
+	// A major the feed has, without a build for the platform: the platform
+	// is wrong.
+	err = resolve("win32", "116")
+	if !errors.Is(err, ErrAssetNotFound) || errors.Is(err, ErrMajorNotFound) || errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("116 for win32: got %v, want only the asset not found", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "win32") {
+		t.Errorf("116 for win32: got %v, want the platform named", err)
+	}
+
+	// An unpublished patch of a published major is neither.
+	err = resolve("linux64", "115.0.5790.1")
+	if !errors.Is(err, ErrVersionNotFound) || errors.Is(err, ErrMajorNotFound) || errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("115.0.5790.1: got %v, want only the version not found", err)
+	}
+}
@@ -0,0 +1,646 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// progressFunc is told after each archive entry how many of total entries
+// are done. total is 0 when the archive does not say up front, as with
+// tar.
+type progressFunc func(done, total int)
+
+// extractOptions tunes an extraction and collects its counts. The zero
+// value extracts everything silently.
+type extractOptions struct {
+	// Context, when set, stops the extraction between entries once done.
+	Context context.Context
+	// Progress, when set, is called after each entry.
+	Progress progressFunc
+	// Keep, when set, selects the regular files to extract by entry name;
+	// directories are then only created as needed by kept files.
+	Keep func(name string) bool
+	// Mode, when set, returns the permissions to give the regular file
+	// name in place of those recorded in the archive. They are applied
+	// exactly, regardless of the umask.
+	Mode func(name string, archived os.FileMode) os.FileMode
+	// MaxSize caps the bytes the archive may unpack to and MaxRatio how
+	// many times larger than compressed they may be. Zero disables either.
+	MaxSize  int64
+	MaxRatio float64
+	// Workers, when set, caps how many zip entries are written at once.
+	Workers int
+	// PreserveTimes gives written files the modification time their
+	// archive entry records, instead of the time of extraction.
+	PreserveTimes bool
+
+	// Extracted, Skipped and Failed count the regular files written, left
+	// out by Keep and failed to write.
+	Extracted, Skipped, Failed int
+	// Unchanged counts the extracted files that were already in place with
+	// the same content and so were not rewritten. It is updated atomically.
+	Unchanged int64
+}
+
+func (o *extractOptions) report(done, total int) {
+	if o.Progress != nil {
+		o.Progress(done, total)
+	}
+}
+
+// cancelled returns the context's error once the extraction should stop.
+func (o *extractOptions) cancelled() error {
+	if o.Context == nil {
+		return nil
+	}
+	return o.Context.Err()
+}
+
+func (o *extractOptions) keep(name string) bool {
+	return o.Keep == nil || o.Keep(name)
+}
+
+// ratioFloor is the unpacked size below which the compression ratio is not
+// checked: small archives of repetitive files compress well but are harmless.
+const ratioFloor = 1 << 20
+
+// checkLimits fails with ErrArchiveLimits once unpacked bytes, from
+// compressed bytes of archive, break MaxSize or MaxRatio.
+func (o *extractOptions) checkLimits(unpacked, compressed int64) error {
+	if o.MaxSize > 0 && unpacked > o.MaxSize {
+		return fmt.Errorf("%w: unpacks to more than %d bytes", ErrArchiveLimits, o.MaxSize)
+	}
+	if o.MaxRatio > 0 && unpacked > ratioFloor && (compressed <= 0 || float64(unpacked)/float64(compressed) > o.MaxRatio) {
+		return fmt.Errorf("%w: %d bytes unpacked from %d compressed, over a ratio of %g", ErrArchiveLimits, unpacked, compressed, o.MaxRatio)
+	}
+	return nil
+}
+
+// limitedEntry reads an entry of a tar stream, adding the bytes read to
+// unpacked and failing with ErrArchiveLimits once they break the limits of
+// opts. A tar stream only declares each entry's size as it comes, ahead of
+// the entry's compressed bytes, so the ratio is checked against the bytes
+// read so far rather than the declared size.
+type limitedEntry struct {
+	r          io.Reader
+	opts       *extractOptions
+	unpacked   *int64
+	compressed *countingReader
+}
+
+func (l *limitedEntry) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	*l.unpacked += int64(n)
+	if lerr := l.opts.checkLimits(*l.unpacked, l.compressed.count()); lerr != nil {
+		return n, lerr
+	}
+	return n, err
+}
+
+// writeEntry writes the regular file name of the archive, of size bytes,
+// to path through writeFileIfChanged, with the permissions Mode picks and,
+// with PreserveTimes, the entry's modification time. A file already
+// holding the entry is left as it is, bar its permissions.
+func (o *extractOptions) writeEntry(name, path string, r io.Reader, size int64, archived os.FileMode, modified time.Time) error {
+	mode := archived
+	if o.Mode != nil {
+		mode = o.Mode(name, archived)
+	}
+	written, err := writeFileIfChanged(path, r, size, mode)
+	if err != nil {
+		return err
+	}
+	if !written {
+		atomic.AddInt64(&o.Unchanged, 1)
+	} else if o.PreserveTimes && !modified.IsZero() {
+		if err := os.Chtimes(longPath(path), modified, modified); err != nil {
+			return describeWriteError(path, err)
+		}
+	}
+	if o.Mode == nil {
+		return nil
+	}
+	if info, err := os.Stat(longPath(path)); err == nil && !written && info.Mode().Perm() == mode.Perm() {
+		return nil
+	}
+	return describeWriteError(path, os.Chmod(longPath(path), mode.Perm()))
+}
+
+// extractArchive unpacks src into dest, telling zip and gzip-compressed tar
+// archives apart by their leading bytes and falling back to the extension.
+// It returns the paths of the regular files written.
+func extractArchive(src, dest string, opts *extractOptions) ([]string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(f, head)
+	f.Close()
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, zipMagic):
+		return unzip(src, dest, opts)
+	case bytes.HasPrefix(head, gzipMagic):
+		return untarGz(src, dest, opts)
+	case strings.HasSuffix(src, ".tar.gz"), strings.HasSuffix(src, ".tgz"):
+		return untarGz(src, dest, opts)
+	}
+	return unzip(src, dest, opts)
+}
+
+// extractBytes unpacks an archive held in memory into dest, telling the
+// formats apart by their leading bytes like extractArchive.
+func extractBytes(data []byte, dest string, opts *extractOptions) ([]string, error) {
+	if bytes.HasPrefix(data, gzipMagic) {
+		return untarGzReader(bytes.NewReader(data), dest, opts)
+	}
+	zipped, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return unzipReader(zipped, dest, opts)
+}
+
+// safeJoin joins an archive entry name onto dest, refusing names that would
+// land outside dest.
+func safeJoin(dest, name string) (string, error) {
+	path := filepath.Join(dest, name)
+	rel, err := filepath.Rel(dest, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal file path in archive: %s", name)
+	}
+	return path, nil
+}
+
+// realPath resolves the symlinks in path. Only the part that exists is
+// resolved; the missing rest, which extraction creates, is joined back on.
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			return "", fmt.Errorf("resolving %s: %w", path, err)
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+	}
+}
+
+// rebasePaths moves files, which live under from, onto the same relative
+// paths under to.
+func rebasePaths(files []string, from, to string) []string {
+	if from == to {
+		return files
+	}
+	rebased := make([]string, 0, len(files))
+	for _, f := range files {
+		if rel, err := filepath.Rel(from, f); err == nil {
+			f = filepath.Join(to, rel)
+		}
+		rebased = append(rebased, f)
+	}
+	return rebased
+}
+
+func unzip(src, dest string, opts *extractOptions) ([]string, error) {
+	zipped, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer zipped.Close()
+	return unzipReader(&zipped.Reader, dest, opts)
+}
+
+func unzipReader(zipped *zip.Reader, dest string, opts *extractOptions) ([]string, error) {
+	var (
+		wg       = &sync.WaitGroup{}
+		mu       sync.Mutex
+		firstErr error
+		written  []string
+		done     int
+		slots    chan struct{}
+	)
+	if opts.Workers > 0 {
+		slots = make(chan struct{}, opts.Workers)
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// The sizes come from the central directory, which the zip reader holds
+	// each entry to, so the limits are checked before anything is written.
+	var unpacked, compressed int64
+	for _, f := range zipped.File {
+		unpacked += int64(f.UncompressedSize64)
+		compressed += int64(f.CompressedSize64)
+	}
+	if err := opts.checkLimits(unpacked, compressed); err != nil {
+		return nil, err
+	}
+
+	for _, zippedFile := range zipped.File {
+		if failed() {
+			break
+		}
+
+		zippedFile := zippedFile
+		wg.Add(1)
+		if slots != nil {
+			slots <- struct{}{}
+		}
+
+		go func() {
+			defer wg.Done()
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+			// Once one entry has failed the rest are skipped, so a full
+			// or read-only disk is not hammered with further writes.
+			if failed() {
+				return
+			}
+			if err := opts.cancelled(); err != nil {
+				fail(err)
+				return
+			}
+			isDir := zippedFile.FileInfo().IsDir()
+			kept := !isDir && opts.keep(zippedFile.Name) || isDir && opts.Keep == nil
+			var (
+				path string
+				err  error
+			)
+			if kept {
+				path, err = extractFile(zippedFile, dest, opts)
+			}
+			if err != nil {
+				mu.Lock()
+				opts.Failed++
+				mu.Unlock()
+				fail(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case path != "":
+				written = append(written, path)
+				opts.Extracted++
+			case !isDir:
+				opts.Skipped++
+			}
+			done++
+			opts.report(done, len(zipped.File))
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	sort.Strings(written)
+	return written, nil
+}
+
+// zipEntryTime is the modification time recorded for a zip entry, or zero
+// when the entry records none: a zero MS-DOS date, which would otherwise
+// read as November 1979.
+func zipEntryTime(f *zip.File) time.Time {
+	if f.Modified.IsZero() || f.ModifiedDate == 0 && f.ModifiedTime == 0 && f.Modified.Year() < 1980 {
+		return time.Time{}
+	}
+	return f.Modified
+}
+
+// extractFile writes one zip entry under dest and returns the path of the
+// file it wrote, or "" for a directory.
+func extractFile(zippedFile *zip.File, dest string, opts *extractOptions) (string, error) {
+	path, err := safeJoin(dest, zippedFile.Name)
+	if err != nil {
+		return "", err
+	}
+	if zippedFile.FileInfo().IsDir() {
+		return "", describeWriteError(path, os.MkdirAll(longPath(path), zippedFile.Mode()))
+	}
+
+	f, err := zippedFile.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return path, opts.writeEntry(zippedFile.Name, path, f, int64(zippedFile.UncompressedSize64), zippedFile.Mode(), zipEntryTime(zippedFile))
+}
+
+func untarGz(src, dest string, opts *extractOptions) ([]string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return untarGzReader(f, dest, opts)
+}
+
+func untarGzReader(r io.Reader, dest string, opts *extractOptions) ([]string, error) {
+	compressed := &countingReader{r: r}
+	gz, err := gzip.NewReader(compressed)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var (
+		written  []string
+		unpacked int64
+	)
+	tr := tar.NewReader(gz)
+	for done := 1; ; done++ {
+		if err := opts.cancelled(); err != nil {
+			return nil, err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		path, err := safeJoin(dest, hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case hdr.Typeflag == tar.TypeDir && opts.Keep == nil:
+			if err := os.MkdirAll(longPath(path), 0755); err != nil {
+				return nil, describeWriteError(path, err)
+			}
+		case hdr.Typeflag == tar.TypeReg && !opts.keep(hdr.Name):
+			opts.Skipped++
+		case hdr.Typeflag == tar.TypeReg:
+			entry := &limitedEntry{r: tr, opts: opts, unpacked: &unpacked, compressed: compressed}
+			if err := opts.writeEntry(hdr.Name, path, entry, hdr.Size, hdr.FileInfo().Mode(), hdr.ModTime); err != nil {
+				opts.Failed++
+				return nil, err
+			}
+			written = append(written, path)
+			opts.Extracted++
+		}
+		opts.report(done, 0)
+	}
+}
+
+// writeFileIfChanged writes the size bytes of r to path through
+// writeFileAtomic unless path already holds exactly them, and reports
+// whether it wrote. The existing file is compared as r is read, so an
+// unchanged file costs a read of each and no writes; on the first
+// difference the bytes already found equal are taken from the old file.
+// An r ending short of size is an io.ErrUnexpectedEOF, and path is left
+// as it was.
+func writeFileIfChanged(path string, r io.Reader, size int64, mode os.FileMode) (bool, error) {
+	info, err := os.Stat(longPath(path))
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return true, writeFileAtomic(path, r, mode)
+	}
+	old, err := os.Open(longPath(path))
+	if err != nil {
+		return true, writeFileAtomic(path, r, mode)
+	}
+	defer old.Close()
+
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	chunk := *buf
+	have := make([]byte, len(chunk))
+	var equal int64
+	for {
+		n, rerr := readChunk(r, chunk)
+		if rerr != nil && rerr != io.EOF {
+			return false, rerr
+		}
+		m, _ := io.ReadFull(old, have[:n])
+		if m != n || !bytes.Equal(chunk[:n], have[:n]) {
+			if _, err := old.Seek(0, io.SeekStart); err != nil {
+				return true, describeWriteError(path, err)
+			}
+			read := bytes.NewReader(append([]byte(nil), chunk[:n]...))
+			return true, writeFileAtomic(path, io.MultiReader(io.LimitReader(old, equal), read, r), mode)
+		}
+		equal += int64(n)
+		if rerr != nil {
+			break
+		}
+	}
+	if equal < size {
+		return false, io.ErrUnexpectedEOF
+	}
+	return false, nil
+}
+
+// readChunk fills buf from r, stopping early only at an error. Unlike
+// io.ReadFull it passes on the error as r gave it, so that the io.EOF of
+// an entry read to its end tells apart from the io.ErrUnexpectedEOF of a
+// truncated one.
+func readChunk(r io.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// sameContent reports whether the files at a and b hold the same bytes.
+func sameContent(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil || !bi.Mode().IsRegular() || ai.Size() != bi.Size() || ai.Mode().Perm() != bi.Mode().Perm() {
+		return false
+	}
+	fa, err := os.Open(a)
+	if err != nil {
+		return false
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false
+	}
+	defer fb.Close()
+	bufA, bufB := make([]byte, 32<<10), make([]byte, 32<<10)
+	for {
+		n, errA := io.ReadFull(fa, bufA)
+		m, errB := io.ReadFull(fb, bufB)
+		if n != m || !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false
+		}
+		if errA != nil || errB != nil {
+			return isEOF(errA) && isEOF(errB)
+		}
+	}
+}
+
+func isEOF(err error) bool {
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// copyBuffers holds the buffers writeFileAtomic streams through, so that
+// extracting many entries at once does not allocate one per file.
+var copyBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 32<<10)
+		return &buf
+	},
+}
+
+// writeFileAtomic writes r to a temporary file of its own next to path and
+// renames it to path only once the whole content is on disk, so an
+// interrupted extraction never leaves a truncated file under the final
+// name and concurrent writers of path never share a temporary file. Paths
+// too long for Windows are written through their long form.
+func writeFileAtomic(path string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(longPath(filepath.Dir(path)), 0755); err != nil {
+		return describeWriteError(path, err)
+	}
+
+	out, err := os.CreateTemp(longPath(filepath.Dir(path)), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return describeWriteError(path, err)
+	}
+	tmp := filepath.Join(filepath.Dir(path), filepath.Base(out.Name()))
+	buf := copyBuffers.Get().(*[]byte)
+	_, err = io.CopyBuffer(out, r, *buf)
+	copyBuffers.Put(buf)
+	if err != nil {
+		out.Close()
+		os.Remove(longPath(tmp))
+		return describeWriteError(tmp, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(longPath(tmp))
+		return describeWriteError(tmp, err)
+	}
+	// The temporary file is created private; it gets mode as creating
+	// the file with it would have given it, that is less the umask.
+	if err := os.Chmod(longPath(tmp), mode.Perm()&^umask); err != nil {
+		os.Remove(longPath(tmp))
+		return describeWriteError(tmp, err)
+	}
+	if err := os.Rename(longPath(tmp), longPath(path)); err != nil {
+		os.Remove(longPath(tmp))
+		return describeWriteError(path, err)
+	}
+	return nil
+}
+
+// moveFiles moves files, which live under src, to the same relative paths
+// under dest and returns their new paths. Files are renamed when src and
+// dest share a filesystem and copied through writeFileAtomic otherwise.
+//
+// The move merges into dest file by file: only the paths in files are
+// replaced, so whatever else dest holds, such as other tools sharing
+// --out, is left alone. A directory in the way of a file is an error
+// rather than something to replace.
+func moveFiles(src, dest string, files []string) ([]string, error) {
+	var moved []string
+	for _, f := range files {
+		rel, err := filepath.Rel(src, f)
+		if err != nil {
+			return nil, err
+		}
+		target := filepath.Join(dest, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, describeWriteError(target, err)
+		}
+		if info, err := os.Lstat(target); err == nil && info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory, not replacing it with %s", target, rel)
+		}
+
+		if sameContent(f, target) {
+			// Left in place so a reinstall keeps its mtime.
+			os.Remove(f)
+		} else if err := os.Rename(f, target); err != nil {
+			if err := copyFile(f, target); err != nil {
+				return nil, err
+			}
+		}
+		moved = append(moved, target)
+	}
+	return moved, nil
+}
+
+// copyFile copies src to dest with its permissions and modification time,
+// as a rename would have kept them.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dest, in, info.Mode()); err != nil {
+		return err
+	}
+	return os.Chtimes(longPath(dest), info.ModTime(), info.ModTime())
+}
+
+// describeWriteError turns the filesystem errors users can act on into a
+// plain message naming the path.
+func describeWriteError(path string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("permission denied writing to %s: %w", path, err)
+	case errors.Is(err, syscall.EDQUOT):
+		return fmt.Errorf("disk quota exceeded writing to %s: %w", path, err)
+	case errors.Is(err, syscall.ENOSPC):
+		return fmt.Errorf("no space left on device writing to %s: %w", path, err)
+	}
+	return err
+}
@@ -0,0 +1,747 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// writeTestArchive saves the driver archive of version for linux64 into a
+// temp directory and returns its path.
+func writeTestArchive(t testing.TB, version string) string {
+	path := filepath.Join(t.TempDir(), "chromedriver-linux64.zip")
+	if err := os.WriteFile(path, testArchive(t, "chromedriver-linux64.zip", version, "linux64"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExtractReadOnlyDir(t *testing.T) {
+	skipOnWindows(t)
+	if os.Geteuid() == 0 {
+		t.Skip("root writes to read-only directories")
+	}
+	dest := t.TempDir()
+	if err := os.Chmod(dest, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dest, 0755)
+
+	d := NewDownloader()
+	d.Log = ioutil.Discard
+	_, err := d.Extract(writeTestArchive(t, "115.0.5790.102"), dest)
+	if !errors.Is(err, os.ErrPermission) || !strings.Contains(err.Error(), "permission denied writing to "+dest) {
+		t.Fatalf("got %v, want permission denied writing to %s", err, dest)
+	}
+	if entries, _ := os.ReadDir(dest); len(entries) != 0 {
+		t.Errorf("left %d entries in %s", len(entries), dest)
+	}
+}
+
+func TestDescribeWriteError(t *testing.T) {
+	for _, test := range []struct {
+		errno syscall.Errno
+		want  string
+	}{
+		{syscall.EACCES, "permission denied writing to /out/chromedriver"},
+		{syscall.EDQUOT, "disk quota exceeded writing to /out/chromedriver"},
+		{syscall.ENOSPC, "no space left on device writing to /out/chromedriver"},
+	} {
+		cause := &os.PathError{Op: "write", Path: "/out/chromedriver", Err: test.errno}
+		err := describeWriteError("/out/chromedriver", cause)
+		if !strings.HasPrefix(err.Error(), test.want) || !errors.Is(err, test.errno) {
+			t.Errorf("%v: got %v, want %q wrapping it", test.errno, err, test.want)
+		}
+	}
+}
+
+func TestExtractTarGz(t *testing.T) {
+	archive := testTarGz(t, map[string]string{
+		"chromedriver-linux64/chromedriver":         testDriver("115.0.5790.102"),
+		"chromedriver-linux64/LICENSE.chromedriver": "license\n",
+	})
+	// Mirrors may name the archive either way; the gzip magic decides.
+	for _, name := range []string{"chromedriver-linux64.tar.gz", "chromedriver-linux64.zip"} {
+		src := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(src, archive, 0644); err != nil {
+			t.Fatal(err)
+		}
+		dest := t.TempDir()
+		d := NewDownloader()
+		d.Log = ioutil.Discard
+		files, err := d.Extract(src, dest)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(files) != 2 {
+			t.Errorf("%s: extracted %q, want the driver and license", name, files)
+		}
+		driver := filepath.Join(dest, "chromedriver-linux64", "chromedriver")
+		b, err := os.ReadFile(driver)
+		if err != nil || string(b) != testDriver("115.0.5790.102") {
+			t.Errorf("%s: extracted driver %q, %v", name, b, err)
+		}
+		if info, err := os.Stat(driver); err != nil {
+			t.Error(err)
+		} else if runtime.GOOS != "windows" && info.Mode().Perm()&0100 == 0 {
+			t.Errorf("%s: driver is not executable: %v", name, info.Mode())
+		}
+	}
+}
+
+func TestExtractTarGzSlip(t *testing.T) {
+	archive := testTarGz(t, map[string]string{
+		"chromedriver-linux64/chromedriver": testDriver("115.0.5790.102"),
+		"../evil":                           "escaped\n",
+	})
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "out")
+	_, err := extractBytes(archive, dest, &extractOptions{})
+	if err == nil || !strings.Contains(err.Error(), "illegal file path") {
+		t.Fatalf("got %v, want the entry refused", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); err == nil {
+		t.Error("an entry was written outside the destination")
+	}
+}
+
+// failingReader returns data, then err in place of the rest.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestWriteFileAtomicAborted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "chromedriver")
+	cut := errors.New("connection reset")
+	err := writeFileAtomic(path, &failingReader{data: []byte("#!/bin/sh\n"), err: cut}, 0755)
+	if !errors.Is(err, cut) {
+		t.Fatalf("got %v, want the read error", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("an aborted write left %s behind", entries[0].Name())
+	}
+
+	// A driver already in place is kept whole.
+	old := testDriver("115.0.5790.98")
+	if err := os.WriteFile(path, []byte(old), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFileAtomic(path, &failingReader{data: []byte("#!/bin/sh\n"), err: cut}, 0755)
+	if b, err := os.ReadFile(path); err != nil || string(b) != old {
+		t.Errorf("an aborted write left %q, %v in place of the old driver", b, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("an aborted write left %d files, want the old driver alone", len(entries))
+	}
+}
+
+func TestExtractStaged(t *testing.T) {
+	stage := t.TempDir()
+	dest := t.TempDir()
+	d := NewDownloader()
+	d.Log = ioutil.Discard
+	d.StageDir = stage
+	staged := false
+	d.ExtractProgress = func(done, total int) {
+		if entries, _ := os.ReadDir(stage); len(entries) > 0 {
+			staged = true
+		}
+	}
+	files, err := d.Extract(writeTestArchive(t, "115.0.5790.102"), dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !staged {
+		t.Error("nothing was extracted into the staging directory")
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file, dest+string(os.PathSeparator)) {
+			t.Errorf("extracted %s outside --out", file)
+		}
+		if _, err := os.Stat(file); err != nil {
+			t.Error(err)
+		}
+	}
+	if len(files) != 3 {
+		t.Errorf("extracted %q, want the driver, license and notices", files)
+	}
+	if entries, _ := os.ReadDir(stage); len(entries) != 0 {
+		t.Errorf("left %s in the staging directory", entries[0].Name())
+	}
+}
+
+func TestTmpfsFallback(t *testing.T) {
+	temp := t.TempDir()
+	d, _ := flagDownloader(t, "--tmpfs", "--tmpfs-dir", filepath.Join(temp, "missing"), "--temp-dir", temp)
+	if d.StageDir != temp {
+		t.Errorf("staging in %s, want the temp dir %s", d.StageDir, temp)
+	}
+	shm := t.TempDir()
+	d, _ = flagDownloader(t, "--tmpfs", "--tmpfs-dir", shm)
+	if d.StageDir != shm {
+		t.Errorf("staging in %s, want %s", d.StageDir, shm)
+	}
+}
+
+func TestExtractProgress(t *testing.T) {
+	// A browser-sized archive of many files, written by several workers.
+	files := map[string]string{}
+	for i := 0; i < 200; i++ {
+		files[fmt.Sprintf("chrome-linux64/locales/%03d.pak", i)] = "pak\n"
+	}
+	src := filepath.Join(t.TempDir(), "chrome-linux64.zip")
+	if err := os.WriteFile(src, testZip(t, files), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDownloader()
+	d.Log = ioutil.Discard
+	var mu sync.Mutex
+	seen := map[int]int{}
+	d.ExtractProgress = func(done, total int) {
+		mu.Lock()
+		defer mu.Unlock()
+		if total != len(files) {
+			t.Errorf("reported a total of %d, want %d", total, len(files))
+		}
+		seen[done]++
+	}
+	if _, err := d.Extract(src, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(files) {
+		t.Errorf("reported progress %d times, want once per file", len(seen))
+	}
+	for done := 1; done <= len(files); done++ {
+		if seen[done] != 1 {
+			t.Errorf("reported %d/%d %d times, want once", done, len(files), seen[done])
+		}
+	}
+
+	var line bytes.Buffer
+	report := extractionProgress(&line)
+	report(1, 2)
+	report(2, 2)
+	if got := line.String(); got != "\rextracted 1/2 files\rextracted 2/2 files\n" {
+		t.Errorf("drew %q", got)
+	}
+}
+
+func TestExtractSummary(t *testing.T) {
+	src := writeTestArchive(t, "115.0.5790.102")
+	for _, test := range []struct {
+		onlyBinary bool
+		want       string
+	}{
+		{false, "extracted 3 files, skipped 0 (filtered), failed 0\n"},
+		{true, "extracted 1 files, skipped 2 (filtered), failed 0\n"},
+	} {
+		var log bytes.Buffer
+		d := NewDownloader()
+		d.Log = &log
+		d.OnlyBinary = test.onlyBinary
+		files, err := d.Extract(src, t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if log.String() != test.want {
+			t.Errorf("only binary %v: logged %q, want %q", test.onlyBinary, log.String(), test.want)
+		}
+		if test.onlyBinary && (len(files) != 1 || filepath.Base(files[0]) != "chromedriver") {
+			t.Errorf("--only-binary extracted %q, want the driver alone", files)
+		}
+	}
+}
+
+func TestExtractDeepPaths(t *testing.T) {
+	// Deeper than MAX_PATH, as some browser archives are once unpacked
+	// under a long --out.
+	name := "chrome-win64/" + strings.Repeat("nested-resources/", 20) + "resource.pak"
+	src := filepath.Join(t.TempDir(), "chrome-win64.zip")
+	if err := os.WriteFile(src, testZip(t, map[string]string{name: "pak\n"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dest := t.TempDir()
+	d := NewDownloader()
+	d.Log = ioutil.Discard
+	files, err := d.Extract(src, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || len(files[0]) < 260 {
+		t.Fatalf("extracted %q, want the deep entry", files)
+	}
+	if b, err := os.ReadFile(longPath(files[0])); err != nil || string(b) != "pak\n" {
+		t.Errorf("deep entry holds %q, %v", b, err)
+	}
+}
+
+func TestExtractExclude(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "chromedriver-linux64.zip")
+	archive := testZip(t, map[string]string{
+		"chromedriver-linux64/chromedriver":         testDriver("115.0.5790.102"),
+		"chromedriver-linux64/LICENSE.txt":          "license\n",
+		"chromedriver-linux64/docs/README.txt":      "readme\n",
+		"chromedriver-linux64/notices.html":         "notices\n",
+		"chromedriver-linux64/lib/libsupport.so":    "lib\n",
+		"chromedriver-linux64/lib/nested/extra.bin": "extra\n",
+	})
+	if err := os.WriteFile(src, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The flag is repeatable; a pattern matches the base name or, with a
+	// slash, the full entry name.
+	d, _ := flagDownloader(t, "--exclude", "*.txt", "--exclude", "chromedriver-linux64/lib/*")
+	d.Log = ioutil.Discard
+	dest := t.TempDir()
+	files, err := d.Extract(src, dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dest, f)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	want := []string{
+		"chromedriver-linux64/chromedriver",
+		"chromedriver-linux64/lib/nested/extra.bin",
+		"chromedriver-linux64/notices.html",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("extracted %q, want %q", got, want)
+	}
+	for _, name := range []string{"LICENSE.txt", "docs/README.txt", "lib/libsupport.so"} {
+		if _, err := os.Stat(filepath.Join(dest, "chromedriver-linux64", filepath.FromSlash(name))); err == nil {
+			t.Errorf("excluded %s was extracted", name)
+		}
+	}
+}
+
+func TestExtractMode(t *testing.T) {
+	skipOnWindows(t)
+	src := writeTestArchive(t, "115.0.5790.102")
+	modes := func(args ...string) (os.FileMode, os.FileMode) {
+		t.Helper()
+		d, _ := flagDownloader(t, args...)
+		d.Log = ioutil.Discard
+		dest := t.TempDir()
+		if _, err := d.Extract(src, dest); err != nil {
+			t.Fatal(err)
+		}
+		dir := filepath.Join(dest, "chromedriver-linux64")
+		binary, err := os.Stat(filepath.Join(dir, "chromedriver"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		license, err := os.Stat(filepath.Join(dir, "LICENSE.chromedriver"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return binary.Mode().Perm(), license.Mode().Perm()
+	}
+
+	if binary, license := modes("--mode", "0750"); binary != 0750 || license != 0644 {
+		t.Errorf("--mode=0750 gave the driver %o and the license %o, want 750 and the archive's 644", binary, license)
+	}
+	if binary, license := modes("--mode", "640", "--mode-all-files"); binary != 0640 || license != 0640 {
+		t.Errorf("--mode=640 --mode-all-files gave %o and %o, want 640 for both", binary, license)
+	}
+
+	for _, bad := range []string{"0", "rwxr-x---", "0800", "1777"} {
+		c, err := newCLI([]string{"--mode", bad}, &bytes.Buffer{}, &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.newDownloaderFromFlags(); err == nil || !strings.Contains(err.Error(), "invalid --mode") {
+			t.Errorf("--mode=%s: got %v, want it refused", bad, err)
+		}
+	}
+}
+
+func TestExtractArchiveLimits(t *testing.T) {
+	// 16MB of zeros deflates to a few KB, far over the default ratio.
+	bomb := map[string]string{
+		"chromedriver-linux64/chromedriver": testDriver("115.0.5790.102"),
+		"chromedriver-linux64/padding.bin":  strings.Repeat("\x00", 16<<20),
+	}
+	for _, archive := range []struct {
+		name string
+		data []byte
+	}{
+		{"chromedriver-linux64.zip", testZip(t, bomb)},
+		{"chromedriver-linux64.tar.gz", testTarGz(t, bomb)},
+	} {
+		src := filepath.Join(t.TempDir(), archive.name)
+		if err := os.WriteFile(src, archive.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		extract := func(maxSize int64, maxRatio float64) error {
+			d := NewDownloader()
+			d.Log = ioutil.Discard
+			d.MaxUncompressedSize, d.MaxCompressionRatio = maxSize, maxRatio
+			dest := t.TempDir()
+			_, err := d.Extract(src, dest)
+			if err != nil {
+				if _, serr := os.Stat(filepath.Join(dest, "chromedriver-linux64", "padding.bin")); serr == nil {
+					t.Errorf("%s: a refused archive left its entries", archive.name)
+				}
+			}
+			return err
+		}
+		defaults := NewDownloader()
+		err := extract(defaults.MaxUncompressedSize, defaults.MaxCompressionRatio)
+		if !errors.Is(err, ErrArchiveLimits) || !strings.Contains(err.Error(), "archive exceeds safety limits") || !strings.Contains(err.Error(), "over a ratio of 100") {
+			t.Errorf("%s: got %v, want the ratio refused", archive.name, err)
+		}
+		if err := extract(8<<20, 0); !errors.Is(err, ErrArchiveLimits) || !strings.Contains(err.Error(), "unpacks to more than 8388608 bytes") {
+			t.Errorf("%s: got %v, want the size refused", archive.name, err)
+		}
+		if err := extract(0, 0); err != nil {
+			t.Errorf("%s: with the limits off: %v", archive.name, err)
+		}
+
+		_, err = retar(archive.data, ioutil.Discard, func(string) bool { return true }, &extractOptions{MaxRatio: 100})
+		if !errors.Is(err, ErrArchiveLimits) {
+			t.Errorf("%s: re-streaming got %v, want the ratio refused", archive.name, err)
+		}
+	}
+}
+
+// largeArchive is a driver archive whose binary is size bytes of random,
+// incompressible content, returned with that content.
+func largeArchive(t testing.TB, size int) (string, []byte) {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(content)
+	src := filepath.Join(t.TempDir(), "chromedriver-linux64.zip")
+	archive := testZip(t, map[string]string{
+		"chromedriver-linux64/chromedriver":         string(content),
+		"chromedriver-linux64/LICENSE.chromedriver": "license\n",
+	})
+	if err := os.WriteFile(src, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return src, content
+}
+
+func TestExtractLargeEntry(t *testing.T) {
+	src, content := largeArchive(t, 48<<20+123)
+	d := NewDownloader()
+	d.Log = ioutil.Discard
+	dest := t.TempDir()
+	if _, err := d.Extract(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dest, "chromedriver-linux64", "chromedriver"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("extracted %d bytes that differ from the archived %d", len(got), len(content))
+	}
+}
+
+// BenchmarkExtractLargeEntry extracts an archive with a 16MB binary, which
+// streams to disk through pooled buffers.
+func BenchmarkExtractLargeEntry(b *testing.B) {
+	src, content := largeArchive(b, 16<<20)
+	d := NewDownloader()
+	d.Log = ioutil.Discard
+	b.SetBytes(int64(len(content)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Extract(src, b.TempDir()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkExtractLargeEntryWholeBuffer extracts the same archive reading
+// each entry into a buffer of its uncompressed size, as unzip did before
+// streaming.
+func BenchmarkExtractLargeEntryWholeBuffer(b *testing.B) {
+	src, content := largeArchive(b, 16<<20)
+	b.SetBytes(int64(len(content)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		zr, err := zip.OpenReader(src)
+		if err != nil {
+			b.Fatal(err)
+		}
+		dest := b.TempDir()
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf := make([]byte, f.UncompressedSize64)
+			if _, err := io.ReadFull(rc, buf); err != nil {
+				b.Fatal(err)
+			}
+			rc.Close()
+			path := filepath.Join(dest, filepath.FromSlash(f.Name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				b.Fatal(err)
+			}
+			if err := os.WriteFile(path, buf, f.Mode()); err != nil {
+				b.Fatal(err)
+			}
+		}
+		zr.Close()
+	}
+}
+
+func TestExtractSymlinkedDest(t *testing.T) {
+	skipOnWindows(t)
+	dir := t.TempDir()
+	real := filepath.Join(dir, "real")
+	link := filepath.Join(dir, "link")
+	if err := os.Mkdir(real, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+	src := writeTestArchive(t, "115.0.5790.102")
+	for _, stage := range []string{"", t.TempDir()} {
+		d := NewDownloader()
+		d.Log = ioutil.Discard
+		d.StageDir = stage
+		// Below the link, and not there yet.
+		dest := filepath.Join(link, "drivers")
+		files, err := d.Extract(src, dest)
+		if err != nil {
+			t.Fatalf("staged in %q: %v", stage, err)
+		}
+		binary := filepath.Join(dest, "chromedriver-linux64", "chromedriver")
+		if len(files) != 3 || !containsString(files, binary) {
+			t.Errorf("staged in %q: extracted %q, want paths under %s", stage, files, dest)
+		}
+		if b, err := os.ReadFile(filepath.Join(real, "drivers", "chromedriver-linux64", "chromedriver")); err != nil || string(b) != testDriver("115.0.5790.102") {
+			t.Errorf("staged in %q: the driver did not land in the link's target: %v", stage, err)
+		}
+	}
+
+	// The traversal guard still holds through the link.
+	evil := filepath.Join(t.TempDir(), "evil.zip")
+	if err := os.WriteFile(evil, testZip(t, map[string]string{"../escaped": "escaped\n"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDownloader()
+	d.Log = ioutil.Discard
+	if _, err := d.Extract(evil, link); err == nil || !strings.Contains(err.Error(), "illegal file path") {
+		t.Errorf("got %v, want the entry refused", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped")); err == nil {
+		t.Error("an entry was written outside the link's target")
+	}
+}
+
+func TestInstallKeepsSiblings(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	siblings := map[string]string{
+		"geckodriver":                    "another tool\n",
+		"tools/msedgedriver":             "yet another\n",
+		"chromedriver-linux64/notes.txt": "kept by hand\n",
+	}
+	for _, extra := range [][]string{
+		nil,
+		{"--output-layout", "nested"},
+		{"--tmpfs", "--tmpfs-dir", t.TempDir()},
+		{"--tmpfs", "--tmpfs-dir", t.TempDir(), "--output-layout", "nested"},
+	} {
+		out := t.TempDir()
+		for name, content := range siblings {
+			path := filepath.Join(out, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, _, err := runCLI(t, s.args(t, out, append(extra, "-v", "115")...)...); err != nil {
+			t.Fatalf("%v: %v", extra, err)
+		}
+		if !isInstalledIn(out, "115.0.5790.102") {
+			t.Errorf("%v: the driver was not installed", extra)
+		}
+		for name, content := range siblings {
+			if b, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name))); err != nil || string(b) != content {
+				t.Errorf("%v: %s did not survive the install: %v", extra, name, err)
+			}
+		}
+	}
+
+	// A directory where the driver goes is not swapped out for it.
+	out := t.TempDir()
+	keep := filepath.Join(out, "chromedriver", "keep")
+	if err := os.MkdirAll(filepath.Dir(keep), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keep, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCLI(t, s.args(t, out, "--tmpfs", "--tmpfs-dir", t.TempDir(), "-v", "115")...); err == nil || !strings.Contains(err.Error(), "is a directory") {
+		t.Errorf("got %v, want the directory in the way reported", err)
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Errorf("the directory in the way was touched: %v", err)
+	}
+}
+
+func TestReinstallLeavesUnchangedFiles(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out := t.TempDir()
+	install := func() {
+		t.Helper()
+		if _, _, err := runCLI(t, s.args(t, out, "--force", "-v", "115.0.5790.102")...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	install()
+	files := []string{"chromedriver", "LICENSE.chromedriver", "THIRD_PARTY_NOTICES.chromedriver"}
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range files {
+		if err := os.Chtimes(filepath.Join(out, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// One file changed by hand, and one gone, since the first install.
+	if err := os.WriteFile(filepath.Join(out, "LICENSE.chromedriver"), []byte("LICENSE\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(out, "THIRD_PARTY_NOTICES.chromedriver")); err != nil {
+		t.Fatal(err)
+	}
+	install()
+
+	info, err := os.Stat(filepath.Join(out, "chromedriver"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("the unchanged driver was rewritten: mtime %s, want %s", info.ModTime(), old)
+	}
+	if info.Mode().Perm() != 0755 {
+		t.Errorf("the unchanged driver has mode %s", info.Mode())
+	}
+	for name, content := range map[string]string{"LICENSE.chromedriver": "license\n", "THIRD_PARTY_NOTICES.chromedriver": "notices\n"} {
+		if b, err := os.ReadFile(filepath.Join(out, name)); err != nil || string(b) != content {
+			t.Errorf("%s holds %q, %v, want it written again", name, b, err)
+		}
+	}
+}
+
+func TestWriteFileIfChangedTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chromedriver")
+	const content = "#!/bin/sh\necho chromedriver\n"
+	for name, r := range map[string]io.Reader{
+		// As a truncated flate stream or zip entry ends.
+		"unexpected EOF": io.MultiReader(strings.NewReader(content[:10]), iotest.ErrReader(io.ErrUnexpectedEOF)),
+		// And a reader ending cleanly, but short of the size.
+		"short": strings.NewReader(content[:10]),
+	} {
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writeFileIfChanged(path, r, int64(len(content)), 0755); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%s: got %v, want io.ErrUnexpectedEOF", name, err)
+		}
+		if b, _ := os.ReadFile(path); string(b) != content {
+			t.Errorf("%s: left %q, want the file as it was", name, b)
+		}
+	}
+	if written, err := writeFileIfChanged(path, strings.NewReader(content), int64(len(content)), 0755); err != nil || written {
+		t.Errorf("the same content: written %v, %v", written, err)
+	}
+}
+
+func TestPreserveTimes(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	// Zip's MS-DOS times only go to the two seconds.
+	near := func(got, want time.Time, within time.Duration) bool {
+		d := got.Sub(want)
+		return d > -within && d < within
+	}
+	files := []string{"chromedriver", "LICENSE.chromedriver", "THIRD_PARTY_NOTICES.chromedriver"}
+
+	out := t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out, "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		info, err := os.Stat(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !near(info.ModTime(), testEntryTime, 2*time.Second) {
+			t.Errorf("%s has mtime %s, want the archive's %s", name, info.ModTime(), testEntryTime)
+		}
+	}
+
+	before := time.Now()
+	out = t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out, "--no-preserve-times", "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range files {
+		info, err := os.Stat(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.ModTime().Before(before.Add(-time.Second)) {
+			t.Errorf("%s has mtime %s under --no-preserve-times, want the time of extraction", name, info.ModTime())
+		}
+	}
+
+	// A tarball records them too.
+	src := filepath.Join(t.TempDir(), "chromedriver-linux64.tar.gz")
+	if err := os.WriteFile(src, testTarGz(t, map[string]string{"chromedriver-linux64/chromedriver": testDriver("115.0.5790.102")}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDownloader()
+	d.Log = ioutil.Discard
+	extracted, err := d.Extract(src, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(extracted[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(testEntryTime) {
+		t.Errorf("the tarball's file has mtime %s, want %s", info.ModTime(), testEntryTime)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// knownGoodVersionsURL is the Chrome for Testing feed, which lists every
+// driver published from major 115 onwards together with its download URLs.
+const knownGoodVersionsURL = "https://googlechromelabs.github.io/chrome-for-testing/known-good-versions-with-downloads.json"
+
+type knownGoodVersions struct {
+	Versions []struct {
+		Version   string `json:"version"`
+		Revision  string `json:"revision"`
+		Downloads struct {
+			Chrome        []feedAsset `json:"chrome"`
+			Chromedriver  []feedAsset `json:"chromedriver"`
+			HeadlessShell []feedAsset `json:"chrome-headless-shell"`
+		} `json:"downloads"`
+	} `json:"versions"`
+}
+
+type feedAsset struct {
+	Platform string `json:"platform"`
+	URL      string `json:"url"`
+	// Size is the archive size in bytes, when the feed declares it.
+	Size int64 `json:"size,omitempty"`
+}
+
+// assetURLs keys the URLs of assets by platform.
+func assetURLs(assets []feedAsset) map[string]string {
+	urls := make(map[string]string)
+	for _, a := range assets {
+		urls[a.Platform] = a.URL
+	}
+	return urls
+}
+
+// assetSizes keys the declared sizes of assets by URL, leaving out assets
+// without one.
+func assetSizes(assets []feedAsset, sizes map[string]int64) {
+	for _, a := range assets {
+		if a.Size > 0 {
+			sizes[a.URL] = a.Size
+		}
+	}
+}
+
+// fetchKnownGoodVersions returns the feed's versions grouped by major,
+// with the driver URL of each version keyed by platform and its Chromium
+// revision. Majors is left empty.
+func (d *Downloader) fetchKnownGoodVersions() (*VersionList, error) {
+	resp, err := d.get(d.FeedURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", d.FeedURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", d.FeedURL, resp.Status)
+	}
+
+	var feed knownGoodVersions
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", d.FeedURL, err)
+	}
+
+	list := &VersionList{
+		Versions:        make(map[string][]string),
+		Downloads:       make(map[string]map[string]string),
+		ChromeDownloads: make(map[string]map[string]string),
+		CompanionDownloads: map[string]map[string]map[string]string{
+			headlessShell: make(map[string]map[string]string),
+		},
+		Revisions: make(map[string]string),
+		Sizes:     make(map[string]int64),
+	}
+	for _, v := range feed.Versions {
+		if len(v.Downloads.Chrome) > 0 {
+			list.ChromeDownloads[v.Version] = assetURLs(v.Downloads.Chrome)
+		}
+		if len(v.Downloads.HeadlessShell) > 0 {
+			list.CompanionDownloads[headlessShell][v.Version] = assetURLs(v.Downloads.HeadlessShell)
+		}
+		// Versions before 115 were published without drivers in the feed.
+		if len(v.Downloads.Chromedriver) == 0 {
+			continue
+		}
+
+		list.Downloads[v.Version] = assetURLs(v.Downloads.Chromedriver)
+		list.Revisions[v.Version] = v.Revision
+		assetSizes(v.Downloads.Chromedriver, list.Sizes)
+
+		major := strings.SplitN(v.Version, ".", 2)[0]
+		list.Versions[major] = append(list.Versions[major], v.Version)
+	}
+	return list, nil
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testVersions are the drivers the test server publishes, oldest first as
+// the Chrome for Testing feed lists them, with the platforms each has a
+// driver for. 116 has no win32 build, as some recent versions lack one.
+var testVersions = []struct {
+	version   string
+	platforms []string
+}{
+	{"115.0.5790.98", platforms},
+	{"115.0.5790.102", platforms},
+	{"116.0.5845.96", []string{"win64", "linux64", "mac-x64", "mac-arm64"}},
+	{"120.0.6099.109", platforms},
+}
+
+// testStable is the Stable channel of the test server: 120 is a
+// prerelease, on Beta, Dev and Canary.
+const (
+	testStable     = "116.0.5845.96"
+	testPrerelease = "120.0.6099.109"
+)
+
+// testEntryTime is the modification time of every entry of the test
+// archives, so that they are the same bytes on every run.
+var testEntryTime = time.Date(2023, 7, 18, 12, 0, 0, 0, time.UTC)
+
+// testServer serves a Chrome for Testing feed of testVersions, its channel
+// and milestone feeds, and the driver, Chrome and headless shell archives
+// it lists, counting the requests for each path.
+type testServer struct {
+	*httptest.Server
+	t   testing.TB
+	mux *http.ServeMux
+	// declareSizes has the feed declare the size of each archive.
+	declareSizes bool
+
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+func newTestServer(t testing.TB) *testServer {
+	s := &testServer{t: t, mux: http.NewServeMux(), hits: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits[r.URL.Path]++
+		s.mu.Unlock()
+		s.mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	s.mux.HandleFunc("/feed.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(s.feed())
+	})
+	s.mux.HandleFunc("/channels.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(s.channels())
+	})
+	s.mux.HandleFunc("/dl/", func(w http.ResponseWriter, r *http.Request) {
+		// /dl/<version>/<platform>/<name>.zip
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/dl/"), "/")
+		if len(parts) != 3 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(testArchive(t, parts[2], parts[0], parts[1]))
+	})
+	return s
+}
+
+// hitCount returns how many requests the server has had for path.
+func (s *testServer) hitCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+// archiveURL is the URL of the driver archive of version for platform.
+func (s *testServer) archiveURL(version, platform string) string {
+	return fmt.Sprintf("%s/dl/%s/%s/chromedriver-%s.zip", s.URL, version, platform, platform)
+}
+
+func (s *testServer) assets(name, version string, plats []string) []feedAsset {
+	var assets []feedAsset
+	for _, p := range plats {
+		asset := feedAsset{Platform: p, URL: fmt.Sprintf("%s/dl/%s/%s/%s-%s.zip", s.URL, version, p, name, p)}
+		if s.declareSizes {
+			asset.Size = int64(len(testArchive(s.t, name+"-"+p+".zip", version, p)))
+		}
+		assets = append(assets, asset)
+	}
+	return assets
+}
+
+func (s *testServer) feed() []byte {
+	type downloads struct {
+		Chrome        []feedAsset `json:"chrome"`
+		Chromedriver  []feedAsset `json:"chromedriver"`
+		HeadlessShell []feedAsset `json:"chrome-headless-shell"`
+	}
+	type version struct {
+		Version   string    `json:"version"`
+		Revision  string    `json:"revision"`
+		Downloads downloads `json:"downloads"`
+	}
+	var feed struct {
+		Versions []version `json:"versions"`
+	}
+	for _, v := range testVersions {
+		feed.Versions = append(feed.Versions, version{
+			Version:  v.version,
+			Revision: testRevision(v.version),
+			Downloads: downloads{
+				Chrome:        s.assets("chrome", v.version, v.platforms),
+				Chromedriver:  s.assets("chromedriver", v.version, v.platforms),
+				HeadlessShell: s.assets("chrome-headless-shell", v.version, v.platforms),
+			},
+		})
+	}
+	b, _ := json.Marshal(feed)
+	return b
+}
+
+func (s *testServer) channels() []byte {
+	type channel struct {
+		Version   string `json:"version"`
+		Revision  string `json:"revision"`
+		Downloads struct {
+			Chromedriver []feedAsset `json:"chromedriver"`
+		} `json:"downloads"`
+	}
+	feed := struct {
+		Channels map[string]channel `json:"channels"`
+	}{Channels: make(map[string]channel)}
+	for _, name := range channels {
+		version := testPrerelease
+		if name == "Stable" {
+			version = testStable
+		}
+		c := channel{Version: version, Revision: testRevision(version)}
+		c.Downloads.Chromedriver = s.assets("chromedriver", version, []string{"linux64", "win64"})
+		feed.Channels[name] = c
+	}
+	b, _ := json.Marshal(feed)
+	return b
+}
+
+// roundTripFunc is an http.RoundTripper answering every request itself,
+// standing in for the network.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// stubResponse is a response of status carrying body.
+func stubResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// testRevision makes up the Chromium revision of version.
+func testRevision(version string) string {
+	return strings.Replace(version[strings.Index(version, ".")+1:], ".", "", -1)
+}
+
+// downloader returns a Downloader reading versions from s alone, with
+// retries left quick and its log kept out of the test output.
+func (s *testServer) downloader() *Downloader {
+	d := NewDownloader()
+	d.FeedURL = s.URL + "/feed.json"
+	d.ChannelsURL = s.URL + "/channels.json"
+	d.MilestonesURL = ""
+	d.Sources = []VersionSource{feedSource{d}}
+	d.Platform = "linux64"
+	d.Backoff = time.Millisecond
+	d.Log = ioutil.Discard
+	d.ListTTL = 0
+	// Downloads are staged under the test's own directory, never the
+	// working one.
+	d.TempDir = s.t.TempDir()
+	return d
+}
+
+// args returns the command line installing from s into out, followed by
+// extra. Prereleases are allowed, as the command line has no way to point
+// at the test channel feed.
+func (s *testServer) args(t testing.TB, out string, extra ...string) []string {
+	args := []string{
+		"--list-url", s.URL + "/feed.json",
+		"--source", "json",
+		"--allow-prerelease",
+		"--platform", "linux64",
+		"--retries", "0",
+		"--temp-dir", t.TempDir(),
+		"--out", out,
+	}
+	return append(args, extra...)
+}
+
+// setFlag replaces the value args give --name.
+func setFlag(args []string, name, value string) []string {
+	for i := range args[:len(args)-1] {
+		if args[i] == "--"+name {
+			args[i+1] = value
+		}
+	}
+	return args
+}
+
+// runCLI runs the command line args, returning what it printed to stdout
+// and stderr.
+func runCLI(t testing.TB, args ...string) (string, string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	c, err := newCLI(args, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("parsing %q: %v", args, err)
+	}
+	_, err = c.run(context.Background())
+	return stdout.String(), stderr.String(), err
+}
+
+// mainArgsEnv, when set in the environment of the test binary, has it run
+// main with the newline-separated arguments it holds instead of the tests.
+const mainArgsEnv = "GET_CHROMEDRIVER_TEST_MAIN_ARGS"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(mainArgsEnv); ok {
+		os.Args = []string{"get-chromeDriver"}
+		if args != "" {
+			os.Args = append(os.Args, strings.Split(args, "\n")...)
+		}
+		main()
+		os.Exit(0)
+	}
+	code := m.Run()
+	// Every download stages under a test's own directory; anything left in
+	// the working one is a test that forgot to.
+	left, _ := filepath.Glob(tempPattern)
+	parts, _ := filepath.Glob("*.part")
+	if left = append(left, parts...); len(left) != 0 {
+		fmt.Fprintf(os.Stderr, "tests left %s in the working directory\n", strings.Join(left, ", "))
+		if code == 0 {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// runMain runs main with args in a child process, for what only main does:
+// holding output back, printing the final error and choosing the exit
+// code. It returns what the child printed and its exit code.
+func runMain(t testing.TB, args ...string) (string, string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), mainArgsEnv+"="+strings.Join(args, "\n"))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if err != nil && !errors.As(err, &exit) {
+		t.Fatal(err)
+	}
+	return stdout.String(), stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+// testDriverName is the name of the driver binary of platform.
+func testDriverName(platform string) string {
+	if strings.HasPrefix(platform, "win") {
+		return "chromedriver.exe"
+	}
+	return "chromedriver"
+}
+
+// testDriver is a driver binary, a script reporting version as chromedriver
+// does.
+func testDriver(version string) string {
+	return fmt.Sprintf("#!/bin/sh\necho 'ChromeDriver %s (0123456789abcdef-refs/branch-heads/5790@{#1})'\n", version)
+}
+
+// testArchive is the archive name of version for platform: the driver and
+// its license in a <name> directory, where name is chromedriver, chrome or
+// chrome-headless-shell and the archive name is <name>.zip.
+func testArchive(t testing.TB, archive, version, platform string) []byte {
+	name := strings.TrimSuffix(strings.TrimSuffix(archive, ".zip"), "-"+platform)
+	dir := name + "-" + platform + "/"
+	binary := name
+	if name == "chromedriver" {
+		binary = testDriverName(platform)
+	}
+	return testZip(t, map[string]string{
+		dir + binary:                        testDriver(version),
+		dir + "LICENSE." + name:             "license\n",
+		dir + "THIRD_PARTY_NOTICES." + name: "notices\n",
+	})
+}
+
+// testZip builds a zip of files, the driver binaries among them executable.
+func testZip(t testing.TB, files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range sortedNames(files) {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: testEntryTime}
+		hdr.SetMode(testEntryMode(name))
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(files[name]))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testTarGz builds a gzip-compressed tarball of files like testZip.
+func testTarGz(t testing.TB, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedNames(files) {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     int64(testEntryMode(name)),
+			Size:     int64(len(files[name])),
+			ModTime:  testEntryTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(files[name]))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testEntryMode(name string) os.FileMode {
+	if isDriverName(path.Base(name)) {
+		return 0755
+	}
+	return 0644
+}
+
+func sortedNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// skipOnWindows skips tests that run the shell scripts standing in for
+// drivers.
+func skipOnWindows(t testing.TB) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test drivers are shell scripts")
+	}
+}
@@ -0,0 +1,978 @@
+package main
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxInMemoryArchive is the largest archive --no-temp extracts from memory.
+const maxInMemoryArchive = 32 << 20
+
+// get is the default command: it resolves, downloads and extracts a driver,
+// or each of several drivers when --version is repeated.
+func (c *cli) get(d *Downloader) (err error) {
+	if c.report != "" {
+		path, err := parseReport(c.report)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if werr := writeJUnitReport(path, c.record.cases); werr != nil && err == nil {
+				err = werr
+			}
+		}()
+	}
+	if err := c.loadPolicies(); err != nil {
+		return err
+	}
+	if c.summaryJSON != "" {
+		start := time.Now()
+		defer func() {
+			if werr := writeSummary(c.summaryJSON, c.record.cases, time.Since(start)); werr != nil && err == nil {
+				err = werr
+			}
+		}()
+	}
+	if c.versionsFile != "" {
+		specs, err := readVersionsFile(c.versionsFile)
+		if err != nil {
+			return err
+		}
+		c.specVersions = append(c.specVersions, specs...)
+	}
+	if c.chromeBinary != "" {
+		if len(c.specVersions) > 0 || c.isLatest || c.channel != "" {
+			return errors.New("--chrome-binary picks the version and cannot be combined with --version, --latest or --channel")
+		}
+		version, err := chromeBinaryVersion(c.chromeBinary)
+		if err != nil {
+			return fmt.Errorf("--chrome-binary: %w", err)
+		}
+		d.verbosef("%s is Chrome %s\n", c.chromeBinary, version)
+		c.specVersions = []string{majorOf(version)}
+		if c.expectChrome == "" {
+			c.expectChrome = version
+		}
+	}
+	if c.sinceVersion != "" {
+		if len(c.specVersions) > 0 || c.isLatest || c.channel != "" || c.chromeBinary != "" || c.platformList != "" {
+			return errors.New("--since-version picks the versions and cannot be combined with --version, --versions-file, --latest, --channel, --chrome-binary or --platforms")
+		}
+		newer, err := versionsSince(d, c.sinceVersion)
+		if err != nil {
+			return err
+		}
+		if len(newer) == 0 {
+			fmt.Fprintf(c.stdout, "no drivers newer than %s are published\n", c.sinceVersion)
+			return nil
+		}
+		// Each version goes into its own directory, and one already there
+		// is kept, so rerunning only adds what was published since.
+		c.specVersions = newer
+		c.nest = true
+		c.resumeBatch = true
+	}
+	if c.listFormat == "shell" && (c.channelAll || c.isShowList || c.compareRemoteFlag) {
+		return errors.New("--format=shell only applies to installing a driver")
+	}
+	if c.compareRemoteFlag {
+		return compareRemote(d, c.stdout, c.outputPath, c.listFormat)
+	}
+	if c.channelAll {
+		return showChannels(d, c.stdout, c.listFormat)
+	}
+	if c.listMajorsOnly {
+		if c.detailed || c.listFormat != "text" {
+			return errors.New("--list-majors-only prints bare majors and cannot be combined with --detailed or --format")
+		}
+		return showMajors(d, c.stdout, c.listSort == "asc")
+	}
+	if c.isShowList && c.isInstalled {
+		return c.showInstalled(c.outputPath)
+	}
+	if c.isShowList && len(c.specVersions) == 0 {
+		return showList(d, c.stdout, c.listFormat, c.detailed, c.listSort == "asc")
+	}
+
+	specs := c.specVersions
+	// The prompt goes to the terminal on stderr, not c.stdout, which
+	// --quiet-on-success holds back until the run ends.
+	if len(specs) == 0 && !c.isLatest && c.channel == "" {
+		picked, asked, err := promptVersion(d)
+		if err != nil {
+			return err
+		}
+		if asked {
+			specs = []string{picked}
+		}
+	}
+	if len(specs) == 0 && !c.isLatest && c.channel == "" {
+		c.printUsageHint(c.stderr)
+		return fmt.Errorf("%w: no version given", ErrUsage)
+	}
+
+	if c.toStdout && c.tarStdout {
+		return errors.New("--stdout cannot be combined with --tar-stdout")
+	}
+	if c.printURLs && (c.toStdout || c.tarStdout) {
+		return errors.New("--print-urls cannot be combined with --stdout or --tar-stdout")
+	}
+	if c.printDriverVersion && (c.toStdout || c.tarStdout || c.printURLs || c.dryRun) {
+		return errors.New("--print-driver-version cannot be combined with --stdout, --tar-stdout, --print-urls or --dry-run")
+	}
+	if c.outputPath == "-" && (len(c.specVersions) > 1 || c.platformList != "" || c.toStdout || c.tarStdout) {
+		return errors.New("--out=- installs a single driver and cannot be combined with several versions, --platforms, --stdout or --tar-stdout")
+	}
+	if c.toStdout && (len(c.specVersions) > 1 || c.platformList != "") {
+		return errors.New("--stdout writes a single archive and cannot be combined with several versions or --platforms")
+	}
+	c.outputFile = isOutputFile(c.outputPath)
+	if c.scanCmd != "" && (c.toStdout || c.tarStdout || c.outputPath == "-" || c.outputFile) {
+		return errors.New("--scan-cmd needs the archive on disk and cannot be combined with --stdout, --tar-stdout, --out=- or --out naming a file")
+	}
+	if c.outputFile && (len(c.specVersions) > 1 || c.platformList != "" || c.toStdout || c.tarStdout || c.withChrome || c.driverType != "chromedriver") {
+		return fmt.Errorf("--out=%s names the driver binary, which holds a single driver and cannot be combined with several versions, --platforms, --stdout, --tar-stdout, --with-chrome or --driver-type", c.outputPath)
+	}
+	if !c.toStdout && !c.tarStdout && !c.dryRun && !c.printURLs && !c.printDriverVersion && c.outputPath != "-" {
+		lockTarget := c.outputPath
+		if c.outputFile {
+			lockTarget = filepath.Dir(c.outputPath)
+		}
+		unlock, err := lockDir(lockTarget, c.waitLock)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	if len(specs) > 1 {
+		if layout := c.effectiveLayout(len(specs)); layout != "per-version" {
+			return fmt.Errorf("--output-layout=%s cannot hold several versions; use per-version", layout)
+		}
+		return c.getBatch(d, specs)
+	}
+
+	spec := ""
+	if len(specs) == 1 {
+		spec = specs[0]
+	}
+	return c.getSpec(d, spec, c.effectiveLayout(1) == "per-version")
+}
+
+// companion is an archive installed alongside the driver, such as the
+// browser of --with-chrome.
+type companion struct {
+	name    string
+	release *Release
+}
+
+// isOutputFile reports whether --out is a file path: an existing file, or
+// a path that does not exist yet and is named like a driver binary, as in
+// --out=./chromedriver.exe.
+func isOutputFile(path string) bool {
+	if path == "-" {
+		return false
+	}
+	if info, err := os.Stat(path); err == nil {
+		return !info.IsDir()
+	}
+	return isDriverName(filepath.Base(path))
+}
+
+// installFile writes the single file of the release archive to path, as an
+// executable. Like --out=-, it fails on an archive with several files.
+func (c *cli) installFile(d *Downloader, release *Release, path string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(d.DownloadSingle(release, pw))
+	}()
+	err := writeFileAtomic(path, pr, 0755)
+	pr.Close()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "installed %s as %s\n", release.Version, path)
+	binary, _ := filepath.Abs(path)
+	c.record.noteInstall(release, filepath.Dir(path), binary)
+	return c.exportShell(path)
+}
+
+// loadPolicies reads the --allowlist and --pins files, when given, that
+// limit and steer what resolves.
+func (c *cli) loadPolicies() error {
+	var err error
+	if c.allowlistPath != "" {
+		if c.permitted, err = loadAllowlist(c.allowlistPath); err != nil {
+			return err
+		}
+	}
+	if c.pinsPath != "" {
+		if c.pins, err = loadPins(c.pinsPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// effectiveLayout is --output-layout, defaulting to flat for a single
+// driver and to per-version for several. --nest is per-version.
+func (c *cli) effectiveLayout(versions int) string {
+	switch {
+	case c.outputLayout != "":
+		return c.outputLayout
+	case c.nest || versions > 1:
+		return "per-version"
+	}
+	return "flat"
+}
+
+// flattenFiles moves files, freshly extracted into dir, up out of the one
+// top-level directory they share, as archives of major 115 onwards wrap
+// the driver in a chromedriver-<platform> directory. Files already at the
+// top, or spread over several directories, are left where they are.
+func flattenFiles(dir string, files []string) ([]string, error) {
+	top := ""
+	for _, f := range files {
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.SplitN(rel, string(filepath.Separator), 2)
+		if len(parts) == 1 || top != "" && parts[0] != top {
+			return files, nil
+		}
+		top = parts[0]
+	}
+	if top == "" {
+		return files, nil
+	}
+	moved, err := moveFiles(filepath.Join(dir, top), dir, files)
+	if err != nil {
+		return nil, err
+	}
+	// Only succeeds once nothing is left, so files kept from an earlier
+	// install survive.
+	os.Remove(filepath.Join(dir, top))
+	return moved, nil
+}
+
+// getSpec installs spec for --platform, or for each of --platforms.
+func (c *cli) getSpec(d *Downloader, spec string, nested bool) error {
+	if c.platformList == "" {
+		start := c.record.startCase()
+		_, err := c.getOne(d, spec, nested, false)
+		c.record.recordCase(d.Stats, spec, d.Platform, start, err, false)
+		return err
+	}
+	plats, err := parsePlatforms(c.platformList)
+	if err != nil {
+		return err
+	}
+	if c.toStdout || c.tarStdout {
+		return errors.New("--platforms cannot be combined with --stdout or --tar-stdout")
+	}
+
+	// The combined manifest lists the platforms in the order given and is
+	// only written once all of them are installed; a failure part way
+	// removes the one an earlier run left, since it would no longer
+	// describe the directory.
+	installed := 0
+	var manifests []*Manifest
+	for _, p := range plats {
+		pd := *d
+		pd.Platform = p
+		pd.AutoPlatform = false
+		start := c.record.startCase()
+		m, err := c.getOne(&pd, spec, nested, true)
+		c.record.recordCase(d.Stats, spec, p, start, err, errors.Is(err, ErrAssetNotFound))
+		if errors.Is(err, ErrAssetNotFound) {
+			fmt.Fprintf(c.stderr, "skipping %s: %v\n", p, err)
+			continue
+		}
+		if err != nil {
+			if len(manifests) > 0 {
+				os.Remove(filepath.Join(c.platformsDir(manifests[0], nested), manifestName))
+			}
+			return err
+		}
+		installed++
+		if m != nil {
+			manifests = append(manifests, m)
+		}
+	}
+	if installed == 0 {
+		return fmt.Errorf("%w: no platform has a driver for %s", ErrAssetNotFound, spec)
+	}
+	if len(manifests) > 0 {
+		if err := writePlatformsManifest(c.platformsDir(manifests[0], nested), manifests); err != nil {
+			return inPhase("manifest", manifests[0].Version, err)
+		}
+	}
+	return nil
+}
+
+// platformsDir is the directory holding the <platform> directories of a
+// --platforms run that installed the driver described by m.
+func (c *cli) platformsDir(m *Manifest, nested bool) string {
+	if nested {
+		return filepath.Join(c.outputPath, m.Version)
+	}
+	return c.outputPath
+}
+
+// parsePlatforms expands --platforms, which is "all" or a comma-separated
+// list of platforms.
+func parsePlatforms(s string) ([]string, error) {
+	if s == "all" {
+		return platforms, nil
+	}
+	var plats []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if _, ok := platformArch[p]; !ok {
+			return nil, fmt.Errorf("unknown platform %q in --platforms", p)
+		}
+		plats = append(plats, p)
+	}
+	return plats, nil
+}
+
+// getBatch installs every spec into its own --out/<version> directory,
+// stopping at the first failure so that --resume-batch can pick up from
+// there on the next run.
+//
+// All downloads share one staging directory under TempDir, removed once the
+// batch ends however it ends; each download stages in its own directory
+// within it.
+func (c *cli) getBatch(d *Downloader, specs []string) error {
+	if d.CacheDir == "" && !c.dryRun && !c.printURLs && !c.printDriverVersion {
+		parent, cleanup, err := createTemp(d.TempDir, tempPattern)
+		if err != nil {
+			return fmt.Errorf("creating temp dir: %w", err)
+		}
+		defer cleanup()
+		bd := *d
+		bd.TempDir = parent
+		d = &bd
+	}
+	if c.canPrefetch(d) {
+		bd := *d
+		if d.DownloadProgress == nil && (d.Progress != nil || d.Heartbeat > 0) {
+			interval := d.Heartbeat
+			if d.Progress != nil {
+				interval = 100 * time.Millisecond
+			}
+			w := d.Progress
+			if w == nil {
+				w = d.Log
+			}
+			bd.batch = newBatchProgress(w, d.Progress != nil, interval)
+			defer bd.batch.close()
+			// Extracting draws its own line, which would interleave with
+			// the downloads still running.
+			bd.Progress = nil
+		}
+		d = &bd
+		c.batchPrefetcher = newPrefetcher(d, c.resolve)
+		defer func() {
+			c.batchPrefetcher.wait()
+			c.batchPrefetcher = nil
+		}()
+	}
+	for i, spec := range specs {
+		// Keep up to --max-connections downloads going: this entry's and
+		// those of the entries after it.
+		if c.batchPrefetcher != nil {
+			for j := i + 1; j < len(specs) && j < i+c.maxConnections; j++ {
+				c.batchPrefetcher.start(specs[j])
+			}
+		}
+		if err := c.getSpec(d, spec, true); err != nil {
+			if i > 0 {
+				fmt.Fprintf(c.stderr, "completed %s before the failure\n", strings.Join(specs[:i], ", "))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// getOne installs the driver selected by spec, into --out/<version> when
+// nested is set and below that into a <platform> directory when
+// perPlatform is set.
+func (c *cli) getOne(d *Downloader, spec string, nested, perPlatform bool) (*Manifest, error) {
+	release, err := c.resolve(d, spec)
+	if err != nil {
+		return nil, inPhase("resolve", spec, err)
+	}
+	d.verbosef("%s\n", c.resolvedPlatform(release))
+	var db *checksumDB
+	if c.checksumDBPath != "" {
+		if db, err = loadChecksumDB(c.checksumDBPath); err != nil {
+			return nil, err
+		}
+		if sum, ok := db.lookup(release); ok && d.Checksum == "" && d.checksumAlgo() == "sha256" {
+			d.verbosef("verifying against %s from %s\n", sum, c.checksumDBPath)
+			dd := *d
+			dd.Checksum = sum
+			d = &dd
+		}
+	}
+	if c.requireChecksum && d.Checksum == "" && !c.dryRun && !c.printURLs && !c.printDriverVersion {
+		return nil, inPhase("resolve", release.Version, fmt.Errorf("%w: no checksum is known for %s (%s); pass --checksum or record it with --checksum-db", ErrChecksumRequired, release.Version, release.Platform))
+	}
+	if err := c.checkAllowlist(release); err != nil {
+		return nil, inPhase("resolve", release.Version, err)
+	}
+	if err := c.checkMinMajor(release); err != nil {
+		return nil, inPhase("resolve", release.Version, err)
+	}
+	if err := c.checkExpectedChrome(release); err != nil {
+		return nil, inPhase("resolve", release.Version, err)
+	}
+	if c.printDriverVersion {
+		fmt.Fprintln(c.stdout, release.Version)
+		return nil, nil
+	}
+	if err := c.checkAnomalies(d, release); err != nil {
+		return nil, inPhase("resolve", release.Version, err)
+	}
+
+	if c.toStdout {
+		return nil, inPhase("download", release.Version, d.DownloadTo(release, os.Stdout))
+	}
+	if c.tarStdout {
+		return nil, d.DownloadTar(release, os.Stdout)
+	}
+	if c.outputPath == "-" && !c.dryRun && !c.printURLs {
+		return nil, d.DownloadSingle(release, os.Stdout)
+	}
+
+	dir := c.outputPath
+	if nested {
+		dir = filepath.Join(c.outputPath, release.Version)
+	}
+	if perPlatform {
+		dir = filepath.Join(dir, release.Platform)
+	}
+
+	// companions are installed into dir next to the driver, labelled by
+	// what they are.
+	var companions []companion
+	if c.withChrome {
+		chrome, err := d.ResolveChrome(majorOf(release.Version), release.Platform)
+		if err != nil {
+			return nil, inPhase("resolve", release.Version, err)
+		}
+		if err := checkPair(release, chrome); err != nil {
+			return nil, inPhase("resolve", release.Version, err)
+		}
+		companions = append(companions, companion{"chrome", chrome})
+	}
+	if c.driverType != "chromedriver" {
+		tool, err := d.ResolveCompanion(c.driverType, release.Version, release.Platform)
+		if err != nil {
+			return nil, inPhase("resolve", release.Version, err)
+		}
+		companions = append(companions, companion{c.driverType, tool})
+	}
+
+	if c.printURLs {
+		url, err := d.ResolveURL(release.Version, release.Platform, "")
+		if err != nil {
+			return nil, inPhase("resolve", release.Version, err)
+		}
+		fmt.Fprintln(c.stdout, url)
+		for _, comp := range companions {
+			fmt.Fprintln(c.stdout, comp.release.URL)
+		}
+		return nil, nil
+	}
+	if c.dryRun {
+		url, err := d.ResolveURL(release.Version, release.Platform, "")
+		if err != nil {
+			return nil, inPhase("resolve", release.Version, err)
+		}
+		fmt.Fprintf(c.stdout, "%s\n", c.resolvedPlatform(release))
+		fmt.Fprintf(c.stdout, "would download %s from %s into %s\n", release.Version, url, dir)
+		if err := c.checkAsset(d, release); err != nil {
+			return nil, err
+		}
+		for _, comp := range companions {
+			fmt.Fprintf(c.stdout, "would download %s %s from %s into %s\n", comp.name, comp.release.Version, comp.release.URL, dir)
+			if err := c.checkAsset(d, comp.release); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	if c.outputFile {
+		return nil, c.installFile(d, release, c.outputPath)
+	}
+	if c.resumeBatch && (len(c.specVersions) > 1 || c.sinceVersion != "") && isInstalledIn(dir, release.Version) {
+		fmt.Fprintf(c.stdout, "skipped %s: already installed in %s\n", release.Version, dir)
+		if path, ok := findInstalledVersion(dir, release.Version); ok {
+			c.record.noteInstall(release, dir, path)
+		}
+		return c.existingManifest(dir, release), nil
+	}
+	if c.ensure {
+		if path, ok := findInstalledVersion(dir, release.Version); ok {
+			fmt.Fprintf(c.stdout, "already installed: %s (%s)\n", release.Version, path)
+			c.record.noteInstall(release, dir, path)
+			if err := c.exportShell(path); err != nil {
+				return nil, err
+			}
+			return c.existingManifest(dir, release), nil
+		}
+	}
+	if err := c.checkDowngrade(release, dir); err != nil {
+		return nil, inPhase("check", release.Version, err)
+	}
+	runKey := release.URL + "\x00" + dir
+	if m, ok := c.installedThisRun[runKey]; ok {
+		fmt.Fprintf(c.stdout, "skipped %s: installed in %s earlier in this run\n", release.Version, dir)
+		return m, nil
+	}
+
+	files, err := c.install(d, release, dir)
+	if err != nil {
+		return nil, err
+	}
+	if db != nil {
+		if _, ok := db.lookup(release); !ok {
+			if err := db.record(release); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if c.effectiveLayout(len(c.specVersions)) == "flat" {
+		if files, err = flattenFiles(dir, files); err != nil {
+			return nil, inPhase("extract", release.Version, err)
+		}
+	}
+	if c.normalizeNames {
+		if files, err = normalizeBinary(files, release.Platform); err != nil {
+			return nil, inPhase("extract", release.Version, err)
+		}
+	}
+	if c.dedupeStorage {
+		saved, err := c.dedupeFiles(d, files)
+		if err != nil {
+			return nil, inPhase("extract", release.Version, fmt.Errorf("deduplicating files: %w", err))
+		}
+		if saved > 0 {
+			d.verbosef("hard-linked identical files, saving %d bytes\n", saved)
+		}
+	}
+
+	if c.writeChecksum {
+		if err := writeChecksumFile(files); err != nil {
+			return nil, inPhase("extract", release.Version, err)
+		}
+	}
+	var m *Manifest
+	if c.manifest || c.resumeBatch {
+		if m, err = writeManifest(release, files, dir); err != nil {
+			return nil, inPhase("manifest", release.Version, err)
+		}
+	}
+	if c.writeLock {
+		binary, ok := driverBinary(files)
+		if !ok {
+			return nil, fmt.Errorf("writing %s: no chromedriver binary in %s", lockfileName, filepath.Base(release.URL))
+		}
+		lock, err := newLockfile(release, binary)
+		if err != nil {
+			return nil, fmt.Errorf("writing %s: %w", lockfileName, err)
+		}
+		if err := writeJSONAtomic(c.lockfilePath, lock); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", lockfileName, err)
+		}
+	}
+
+	if binary, ok := driverBinary(files); ok {
+		if err := c.checkGitignore(d, dir, binary, c.addGitignore); err != nil {
+			return nil, err
+		}
+		if err := c.exportShell(binary); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, comp := range companions {
+		if _, err := c.install(d, comp.release, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.postInstall != "" {
+		binary, ok := driverBinary(files)
+		if !ok {
+			return nil, fmt.Errorf("post-install hook: no chromedriver binary in %s", filepath.Base(release.URL))
+		}
+		if err := c.runPostInstall(c.postInstall, binary, release.Version); err != nil {
+			return nil, inPhase("post-install", release.Version, err)
+		}
+	}
+
+	c.installedThisRun[runKey] = m
+	binary, _ := driverBinary(files)
+	c.record.noteInstall(release, dir, binary)
+	if err := writeLatest(c.outputPath, release.Version); err != nil {
+		return nil, err
+	}
+
+	if c.openOut {
+		if err := openDir(dir); err != nil {
+			return m, d.warnf("not opening %s: %v", dir, err)
+		}
+	}
+	return m, nil
+}
+
+// latestName is the file in --out naming the driver version installed
+// there last.
+const latestName = "LATEST"
+
+// writeLatest points the LATEST file in dir at version. It is only called
+// once an install has succeeded, and replaced in one rename, so readers
+// never see a version that is not fully installed.
+func writeLatest(dir, version string) error {
+	path := filepath.Join(dir, latestName)
+	if err := writeFileAtomic(path, strings.NewReader(version+"\n"), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeChecksumFile writes the SHA-256 of the driver binary among files to
+// a .sha256 file next to it, in the "<hash>  <name>" format of sha256sum.
+func writeChecksumFile(files []string) error {
+	binary, ok := driverBinary(files)
+	if !ok {
+		return fmt.Errorf("writing checksum: no chromedriver binary found")
+	}
+	sum, err := fileSHA256(binary)
+	if err != nil {
+		return fmt.Errorf("writing checksum: %w", err)
+	}
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(binary))
+	return writeFileAtomic(binary+".sha256", strings.NewReader(line), 0644)
+}
+
+// writeManifest records the install of release, whose archive unpacked to
+// files, in dir and returns the manifest written.
+func writeManifest(release *Release, files []string, dir string) (*Manifest, error) {
+	binary, ok := driverBinary(files)
+	if !ok {
+		return nil, fmt.Errorf("writing manifest: no chromedriver binary in %s", filepath.Base(release.URL))
+	}
+	m, err := newManifest(release, binary)
+	if err != nil {
+		return nil, fmt.Errorf("writing manifest: %w", err)
+	}
+	if err := writeJSONAtomic(filepath.Join(dir, manifestName), m); err != nil {
+		return nil, fmt.Errorf("writing manifest: %w", err)
+	}
+	return m, nil
+}
+
+// install downloads release and extracts it into dir, returning the files
+// written. An archive that turns out to be corrupt is downloaded once more
+// before giving up.
+func (c *cli) install(d *Downloader, release *Release, dir string) ([]string, error) {
+	files, err := c.installOnce(d, release, dir)
+	if err == nil || !isCorruptArchive(err) {
+		return files, err
+	}
+	if err := d.warnf("%s is corrupt (%v), downloading it again", filepath.Base(release.URL), err); err != nil {
+		return nil, err
+	}
+	if d.CacheDir != "" {
+		os.Remove(d.cachePath(release))
+	}
+	return c.installOnce(d, release, dir)
+}
+
+func (c *cli) installOnce(d *Downloader, release *Release, dir string) ([]string, error) {
+	if c.noTemp && d.CacheDir == "" && c.scanCmd == "" {
+		// A HEAD request tells whether the archive is small enough to
+		// buffer; large ones such as Chrome itself, and those whose size
+		// the server does not state, still go through a temp file.
+		if size, err := d.AssetSize(release); err == nil && size > 0 && size <= maxInMemoryArchive {
+			return d.DownloadExtract(release, dir)
+		}
+		d.verbosef("%s is too large to extract in memory, using a temp file\n", filepath.Base(release.URL))
+	}
+
+	var err error
+	zipFilePath, tempClose, ok := c.batchPrefetcher.take(d, release)
+	if !ok {
+		zipFilePath, tempClose, err = d.Download(release)
+	}
+	if tempClose != nil {
+		defer tempClose()
+	}
+	if err != nil {
+		return nil, inPhase("download", release.Version, err)
+	}
+	if c.scanCmd != "" {
+		if err := runScan(c.scanCmd, zipFilePath, release.Version); err != nil {
+			return nil, inPhase("scan", release.Version, err)
+		}
+	}
+
+	files, err := d.Extract(zipFilePath, dir)
+	return files, inPhase("extract", release.Version, err)
+}
+
+// isCorruptArchive reports whether err is an extraction failure caused by a
+// damaged archive rather than, say, a full disk.
+func isCorruptArchive(err error) bool {
+	var pe *phaseError
+	if !errors.As(err, &pe) || pe.Phase != "extract" {
+		return false
+	}
+	var corrupt flate.CorruptInputError
+	if errors.As(err, &corrupt) {
+		return true
+	}
+	for _, target := range []error{zip.ErrFormat, zip.ErrChecksum, zip.ErrAlgorithm, gzip.ErrHeader, gzip.ErrChecksum, io.ErrUnexpectedEOF} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMinMajor refuses release when it is older than --min-major, a guard
+// against provisioning an ancient driver when version detection misfires.
+func (c *cli) checkMinMajor(release *Release) error {
+	if c.minMajor > 0 && mustAtoi(majorOf(release.Version)) < c.minMajor {
+		return fmt.Errorf("refusing %s: major %s is below --min-major=%d", release.Version, majorOf(release.Version), c.minMajor)
+	}
+	return nil
+}
+
+// checkExpectedChrome refuses release when --expect-chrome names a Chrome
+// of another major, which the driver would refuse to drive.
+func (c *cli) checkExpectedChrome(release *Release) error {
+	if c.expectChrome == "" || majorOf(c.expectChrome) == majorOf(release.Version) {
+		return nil
+	}
+	if _, ok := latestSpec(c.expectChrome); ok || !isVersionSpec(c.expectChrome) {
+		return fmt.Errorf("invalid --expect-chrome %q: want a Chrome version such as 115 or 115.0.5790.102", c.expectChrome)
+	}
+	return fmt.Errorf("%w: driver %s is for Chrome %s, not the expected Chrome %s", ErrIncompatiblePair, release.Version, majorOf(release.Version), c.expectChrome)
+}
+
+// checkAnomalies notes what is unusual about installing release, which
+// --strict refuses: a driver for another platform than the host's, a
+// prerelease channel and a download without --sha256.
+func (c *cli) checkAnomalies(d *Downloader, release *Release) error {
+	if host, ok := hostPlatform(); ok && host != release.Platform {
+		if err := d.notef("downloading the %s driver on a %s host", release.Platform, host); err != nil {
+			return err
+		}
+	}
+	if name := canonicalChannel(c.channel); name != "" && name != "Stable" {
+		if err := d.notef("%s is a %s channel prerelease", release.Version, name); err != nil {
+			return err
+		}
+	}
+	if d.Checksum == "" && !c.dryRun && !c.printURLs {
+		if err := d.notef("no --checksum given, %s is not verified", filepath.Base(release.URL)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAsset confirms with a HEAD request that the archive of release is
+// published when --check is given, reporting its size.
+func (c *cli) checkAsset(d *Downloader, release *Release) error {
+	if !c.checkExists {
+		return nil
+	}
+	size, err := d.AssetSize(release)
+	if err != nil {
+		return inPhase("check", release.Version, err)
+	}
+	if size < 0 {
+		fmt.Fprintf(c.stdout, "  found, size unknown\n")
+	} else {
+		fmt.Fprintf(c.stdout, "  found, %d bytes\n", size)
+	}
+	return nil
+}
+
+// resolvedPlatform describes the platform and arch release was resolved
+// for, noting when it was not asked for explicitly.
+func (c *cli) resolvedPlatform(release *Release) string {
+	line := fmt.Sprintf("resolved platform=%s arch=%s", release.Platform, platformArch[release.Platform])
+	switch {
+	case release.Platform != c.platform:
+		line += " (auto-platform fallback from " + c.platform + ")"
+	case !c.platformSet:
+		line += " (default)"
+	}
+	return line
+}
+
+// checkDowngrade refuses, unless --force, to install release into dir
+// over a newer driver already there, which would quietly undo a pin.
+func (c *cli) checkDowngrade(release *Release, dir string) error {
+	if c.force {
+		return nil
+	}
+	existing, ok := newestInstalledAt(dir)
+	if !ok || compareVersions(existing.Version, release.Version) <= 0 {
+		return nil
+	}
+	return fmt.Errorf("refusing to downgrade %s -> %s (%s); pass --force to install anyway", existing.Version, release.Version, existing.Path)
+}
+
+// isInstalledIn reports whether dir holds version, going by its manifest
+// and otherwise by a driver binary reporting that version.
+func isInstalledIn(dir, version string) bool {
+	if m, err := readManifest(dir); err == nil && m.Version == version {
+		if _, err := os.Stat(m.Binary); err == nil {
+			return true
+		}
+	}
+	_, ok := findInstalledVersion(dir, version)
+	return ok
+}
+
+// existingManifest describes the install of release that a run found
+// already in dir: by the manifest there, or else by the driver binary. It
+// returns nil without --manifest or when nothing describes the install.
+func (c *cli) existingManifest(dir string, release *Release) *Manifest {
+	if !c.manifest {
+		return nil
+	}
+	if m, err := readManifest(dir); err == nil && m.Version == release.Version {
+		return m
+	}
+	if path, ok := findInstalledVersion(dir, release.Version); ok {
+		if m, err := newManifest(release, path); err == nil {
+			return m
+		}
+	}
+	return nil
+}
+
+// resolve picks the release selected by spec, --latest and --channel.
+func (c *cli) resolve(d *Downloader, spec string) (*Release, error) {
+	switch {
+	case c.channel != "":
+		if major, ok := latestSpec(spec); ok {
+			spec = major
+		}
+		return d.ResolveChannel(c.channel, spec)
+	case c.isLatest && spec == "":
+		return d.ResolveLatest()
+	}
+	return d.Resolve(c.pinned(d, spec))
+}
+
+func (c *cli) showInstalled(dir string) error {
+	drivers, err := findInstalled(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stdout, "Installed chrome drivers in %s.\n", dir)
+	fmt.Fprintf(c.stdout, "Version\tPath\n")
+	for _, driver := range drivers {
+		fmt.Fprintf(c.stdout, "%s\t%s\n", driver.Version, driver.Path)
+	}
+	return nil
+}
+
+// prune implements "cache prune".
+func (c *cli) prune(dir, olderThan string) error {
+	age, err := parseAge(olderThan)
+	if err != nil {
+		return fmt.Errorf("--older-than: %w", err)
+	}
+	freed, removed, err := pruneCache(dir, age)
+	if err != nil {
+		return fmt.Errorf("pruning %s: %w", dir, err)
+	}
+	fmt.Fprintf(c.stdout, "removed %d archives, freed %d bytes\n", removed, freed)
+	return nil
+}
+
+// exportShell prints, under --format=shell, the export line pointing
+// CHROMEDRIVER at binary to the real stdout.
+func (c *cli) exportShell(binary string) error {
+	if c.listFormat != "shell" {
+		return nil
+	}
+	abs, err := filepath.Abs(binary)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(os.Stdout, "export CHROMEDRIVER=%s\n", shellQuote(abs))
+	return err
+}
+
+// shellQuote quotes s for a POSIX shell, leaving it bare when it only holds
+// characters the shell never treats specially.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./-_") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// warm fills the cache with a fresh version list and the archive of each
+// --version for --platform, or for each of --platforms.
+func (c *cli) warm(d *Downloader) error {
+	d.CacheDir = c.cacheDir
+	d.ListCacheTTL = 0
+	list, err := d.List()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "cached the version list (%d majors) in %s\n", len(list.Majors), c.cacheDir)
+
+	plats := []string{d.Platform}
+	if c.platformList != "" {
+		if plats, err = parsePlatforms(c.platformList); err != nil {
+			return err
+		}
+	}
+	for _, spec := range c.specVersions {
+		for _, p := range plats {
+			pd := *d
+			pd.Platform = p
+			pd.AutoPlatform = c.platformList == "" && d.AutoPlatform
+			release, err := c.resolve(&pd, spec)
+			if errors.Is(err, ErrAssetNotFound) && c.platformList != "" {
+				fmt.Fprintf(c.stderr, "skipping %s: %v\n", p, err)
+				continue
+			}
+			if err != nil {
+				return inPhase("resolve", spec, err)
+			}
+			path, _, err := pd.Download(release)
+			if err != nil {
+				return inPhase("download", release.Version, err)
+			}
+			fmt.Fprintf(c.stdout, "cached %s for %s in %s\n", release.Version, release.Platform, path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,633 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDownloadToStream(t *testing.T) {
+	s := newTestServer(t)
+	d := s.downloader()
+	release, err := d.Resolve("115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := d.DownloadTo(release, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	if !bytes.Equal(out.Bytes(), want) {
+		t.Errorf("streamed %d bytes, want the %d of the served archive", out.Len(), len(want))
+	}
+}
+
+func TestStdoutRefusesSeveralTargets(t *testing.T) {
+	s := newTestServer(t)
+	for _, extra := range [][]string{
+		{"--stdout", "-v", "115", "-v", "116"},
+		{"--stdout", "-v", "115", "--platforms", "linux64,win64"},
+	} {
+		stdout, _, err := runCLI(t, s.args(t, t.TempDir(), extra...)...)
+		if err == nil || !strings.Contains(err.Error(), "--stdout writes a single archive") {
+			t.Errorf("%v: got %v, want --stdout refused", extra, err)
+		}
+		if stdout != "" {
+			t.Errorf("%v: wrote %q to stdout", extra, stdout)
+		}
+	}
+}
+
+func TestResumeBatch(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out := t.TempDir()
+	// An interrupted run got as far as the first version.
+	batch := []string{"-v", "115.0.5790.98", "-v", "115.0.5790.102", "-v", testStable}
+	if _, _, err := runCLI(t, s.args(t, out, "-v", "115.0.5790.98", "--output-layout", "per-version")...); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _, err := runCLI(t, s.args(t, out, append(batch, "--resume-batch")...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout, "skipped 115.0.5790.98: already installed") {
+		t.Errorf("printed %q, want 115.0.5790.98 skipped", stdout)
+	}
+	for version, want := range map[string]int{"115.0.5790.98": 1, "115.0.5790.102": 1, testStable: 1} {
+		if n := s.hitCount("/dl/" + version + "/linux64/chromedriver-linux64.zip"); n != want {
+			t.Errorf("downloaded %s %d times, want %d", version, n, want)
+		}
+	}
+	for _, version := range []string{"115.0.5790.98", "115.0.5790.102", testStable} {
+		if !isInstalledIn(filepath.Join(out, version), version) {
+			t.Errorf("%s is not installed", version)
+		}
+	}
+}
+
+func TestDryRunResolvedPlatform(t *testing.T) {
+	s := newTestServer(t)
+	out := t.TempDir()
+	stdout, _, err := runCLI(t, s.args(t, out, "--dry-run", "-v", "115")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout, "resolved platform=linux64 arch=amd64\n") {
+		t.Errorf("printed %q, want the resolved platform", stdout)
+	}
+	if _, err := InstalledVersion(out); !errors.Is(err, ErrNotInstalled) {
+		t.Errorf("a dry run installed a driver: %v", err)
+	}
+
+	stdout, _, err = runCLI(t, setFlag(s.args(t, t.TempDir(), "--dry-run", "--auto-platform", "-v", "116"), "platform", "win32")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout, "resolved platform=win64 arch=amd64 (auto-platform fallback from win32)") {
+		t.Errorf("printed %q, want the fallback noted", stdout)
+	}
+}
+
+func TestPlatformsAll(t *testing.T) {
+	s := newTestServer(t)
+	out := t.TempDir()
+	// 116 has no win32 driver.
+	_, stderr, err := runCLI(t, s.args(t, out, "--platforms", "all", "-v", testStable)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr, "skipping win32: ") {
+		t.Errorf("logged %q, want win32 skipped", stderr)
+	}
+	for _, p := range platforms {
+		n := s.hitCount("/dl/" + testStable + "/" + p + "/chromedriver-" + p + ".zip")
+		_, statErr := os.Stat(filepath.Join(out, p, testDriverName(p)))
+		if p == "win32" {
+			if n != 0 || statErr == nil {
+				t.Errorf("fetched or installed a win32 driver that is not published")
+			}
+			continue
+		}
+		if n != 1 {
+			t.Errorf("downloaded the %s driver %d times, want once", p, n)
+		}
+		if statErr != nil {
+			t.Errorf("%s driver not installed: %v", p, statErr)
+		}
+	}
+}
+
+func TestDryRunCheck(t *testing.T) {
+	s := newTestServer(t)
+	// 120 is listed, but its linux64 driver was never uploaded.
+	s.mux.HandleFunc("/dl/"+testPrerelease+"/linux64/", http.NotFound)
+	size := len(testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64"))
+
+	stdout, _, err := runCLI(t, s.args(t, t.TempDir(), "--dry-run", "--check", "-v", "115")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("  found, %d bytes\n", size); !strings.Contains(stdout, want) {
+		t.Errorf("printed %q, want %q", stdout, want)
+	}
+
+	stdout, _, err = runCLI(t, s.args(t, t.TempDir(), "--dry-run", "--check", "-v", "120")...)
+	var pe *phaseError
+	if !errors.As(err, &pe) || pe.Phase != "check" || !errors.Is(err, ErrAssetNotFound) {
+		t.Errorf("got %v, want the unpublished asset reported by the check", err)
+	}
+	if !strings.Contains(stdout, "would download "+testPrerelease) || strings.Contains(stdout, "found") {
+		t.Errorf("printed %q", stdout)
+	}
+	for _, version := range []string{"115.0.5790.102", testPrerelease} {
+		if n := s.hitCount("/dl/" + version + "/linux64/chromedriver-linux64.zip"); n != 1 {
+			t.Errorf("requested %s %d times, want a single HEAD", version, n)
+		}
+	}
+}
+
+// corruptArchive returns archive with a byte of the driver entry's
+// compressed data flipped, so that extracting it fails.
+func corruptArchive(t *testing.T, archive []byte) []byte {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		if isDriverName(path.Base(f.Name)) {
+			offset, err := f.DataOffset()
+			if err != nil {
+				t.Fatal(err)
+			}
+			corrupt := append([]byte(nil), archive...)
+			corrupt[offset+int64(f.CompressedSize64)/2] ^= 0xff
+			return corrupt
+		}
+	}
+	t.Fatal("no driver in the archive")
+	return nil
+}
+
+func TestCorruptDownloadRefetched(t *testing.T) {
+	skipOnWindows(t)
+	const archivePath = "/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"
+	good := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	for _, corruptOnce := range []bool{true, false} {
+		s := newTestServer(t)
+		served := 0
+		s.mux.HandleFunc(archivePath, func(w http.ResponseWriter, r *http.Request) {
+			if served++; served == 1 || !corruptOnce {
+				w.Write(corruptArchive(t, good))
+				return
+			}
+			w.Write(good)
+		})
+		out := t.TempDir()
+		_, stderr, err := runCLI(t, s.args(t, out, "-v", "115")...)
+		if !strings.Contains(stderr, "chromedriver-linux64.zip is corrupt") {
+			t.Errorf("logged %q, want the corrupt download reported", stderr)
+		}
+		if served != 2 {
+			t.Errorf("downloaded %d times, want a single retry", served)
+		}
+		if !corruptOnce {
+			if err == nil {
+				t.Error("an archive corrupt on every download was installed")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isInstalledIn(out, "115.0.5790.102") {
+			t.Error("the good archive was not installed")
+		}
+	}
+}
+
+func TestWriteChecksum(t *testing.T) {
+	s := newTestServer(t)
+	for _, platform := range []string{"linux64", "win64"} {
+		out := t.TempDir()
+		if _, _, err := runCLI(t, setFlag(s.args(t, out, "--write-checksum", "-v", "115"), "platform", platform)...); err != nil {
+			t.Fatal(err)
+		}
+		name := testDriverName(platform)
+		binary, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sidecar, err := os.ReadFile(filepath.Join(out, name+".sha256"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := sha256Hex(binary) + "  " + name + "\n"; string(sidecar) != want {
+			t.Errorf("%s: wrote %q, want %q", platform, sidecar, want)
+		}
+	}
+}
+
+func TestMinMajor(t *testing.T) {
+	s := newTestServer(t)
+	s.mux.HandleFunc("/old-feed.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"versions": [{"version": "70.0.3538.97", "downloads": {"chromedriver": [{"platform": "linux64", "url": %q}]}}]}`,
+			s.archiveURL("70.0.3538.97", "linux64"))
+	})
+	out := t.TempDir()
+	args := setFlag(s.args(t, out, "--min-major", "100", "-v", "70"), "list-url", s.URL+"/old-feed.json")
+	if _, _, err := runCLI(t, args...); err == nil || !strings.Contains(err.Error(), "major 70 is below --min-major=100") {
+		t.Errorf("got %v, want 70 refused", err)
+	}
+	if n := s.hitCount("/dl/70.0.3538.97/linux64/chromedriver-linux64.zip"); n != 0 {
+		t.Errorf("downloaded the refused driver %d times", n)
+	}
+
+	if _, _, err := runCLI(t, s.args(t, out, "--min-major", "100", "-v", "115")...); err != nil {
+		t.Errorf("115 over --min-major=100: %v", err)
+	}
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--min-major", "116", "-v", "115")...); err == nil {
+		t.Error("--min-major=116 let 115 through")
+	}
+}
+
+func TestBatchFetchesDuplicatesOnce(t *testing.T) {
+	s := newTestServer(t)
+	for _, connections := range []string{"1", "4"} {
+		out := t.TempDir()
+		before := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip")
+		stdout, _, err := runCLI(t, s.args(t, out, "--max-connections", connections,
+			"-v", "115", "-v", "115.0.5790.102", "-v", "116", "-v", "115")...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip") - before; n != 1 {
+			t.Errorf("--max-connections=%s: fetched 115.0.5790.102 %d times, want once", connections, n)
+		}
+		if n := strings.Count(stdout, "skipped 115.0.5790.102: installed in "); n != 2 {
+			t.Errorf("--max-connections=%s: printed %q, want both repeats skipped", connections, stdout)
+		}
+		if !isInstalledIn(filepath.Join(out, "115.0.5790.102"), "115.0.5790.102") || !isInstalledIn(filepath.Join(out, testStable), testStable) {
+			t.Errorf("--max-connections=%s: the batch did not install both drivers", connections)
+		}
+	}
+}
+
+func TestBatchSharesTempDir(t *testing.T) {
+	s := newTestServer(t)
+	temp := t.TempDir()
+	var mu sync.Mutex
+	staged := make(map[string]bool)
+	for _, version := range []string{"115.0.5790.98", "115.0.5790.102", testStable} {
+		version := version
+		s.mux.HandleFunc("/dl/"+version+"/linux64/", func(w http.ResponseWriter, r *http.Request) {
+			entries, _ := os.ReadDir(temp)
+			mu.Lock()
+			for _, e := range entries {
+				staged[e.Name()] = true
+			}
+			mu.Unlock()
+			w.Write(testArchive(t, "chromedriver-linux64.zip", version, "linux64"))
+		})
+	}
+	for _, connections := range []string{"1", "3"} {
+		mu.Lock()
+		staged = make(map[string]bool)
+		mu.Unlock()
+		args := setFlag(s.args(t, t.TempDir(), "--max-connections", connections,
+			"-v", "115.0.5790.98", "-v", "115.0.5790.102", "-v", "116"), "temp-dir", temp)
+		if _, _, err := runCLI(t, args...); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		n := len(staged)
+		mu.Unlock()
+		if n != 1 {
+			t.Errorf("--max-connections=%s: the batch staged in %d temp dirs, want one", connections, n)
+		}
+		if entries, _ := os.ReadDir(temp); len(entries) != 0 {
+			t.Errorf("--max-connections=%s: left %s in the temp dir", connections, entries[0].Name())
+		}
+	}
+
+	// A batch failing part way still cleans up.
+	args := setFlag(s.args(t, t.TempDir(), "-v", "115.0.5790.98", "-v", "999"), "temp-dir", temp)
+	if _, _, err := runCLI(t, args...); err == nil {
+		t.Fatal("999 did not fail the batch")
+	}
+	if entries, _ := os.ReadDir(temp); len(entries) != 0 {
+		t.Errorf("a failed batch left %s in the temp dir", entries[0].Name())
+	}
+}
+
+func TestFormatShell(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out := filepath.Join(t.TempDir(), "my drivers", "it's here")
+	stdout, stderr, code := runMain(t, s.args(t, out, "--format", "shell", "-v", "115")...)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	binary := filepath.Join(out, "chromedriver")
+	want := "export CHROMEDRIVER='" + strings.ReplaceAll(binary, "'", `'\''`) + "'\n"
+	if stdout != want {
+		t.Fatalf("printed %q, want only %q", stdout, want)
+	}
+	// The line survives a shell's eval.
+	got, err := exec.Command("sh", "-c", `eval "$1"; printf %s "$CHROMEDRIVER"`, "sh", stdout).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != binary {
+		t.Errorf("eval set CHROMEDRIVER to %q, want %q", got, binary)
+	}
+
+	for raw, want := range map[string]string{
+		"/opt/chromedriver":      "/opt/chromedriver",
+		"/opt/my drivers/driver": "'/opt/my drivers/driver'",
+		"/opt/$HOME/driver":      "'/opt/$HOME/driver'",
+		"/opt/it's/driver":       `'/opt/it'\''s/driver'`,
+		"":                       "''",
+	} {
+		if got := shellQuote(raw); got != want {
+			t.Errorf("shellQuote(%q) = %s, want %s", raw, got, want)
+		}
+	}
+}
+
+func TestPrintURLs(t *testing.T) {
+	s := newTestServer(t)
+	out := t.TempDir()
+	stdout, _, err := runCLI(t, s.args(t, out, "--print-urls", "--platforms", "linux64,win32,mac-arm64", "-v", "115.0.5790.102", "-v", "116")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 116 has no win32 driver, so it is left out.
+	want := strings.Join([]string{
+		s.archiveURL("115.0.5790.102", "linux64"),
+		s.archiveURL("115.0.5790.102", "win32"),
+		s.archiveURL("115.0.5790.102", "mac-arm64"),
+		s.archiveURL(testStable, "linux64"),
+		s.archiveURL(testStable, "mac-arm64"),
+	}, "\n") + "\n"
+	if stdout != want {
+		t.Errorf("printed %q, want %q", stdout, want)
+	}
+	for _, version := range []string{"115.0.5790.102", testStable} {
+		for _, platform := range []string{"linux64", "win32", "mac-arm64"} {
+			if n := s.hitCount("/dl/" + version + "/" + platform + "/chromedriver-" + platform + ".zip"); n != 0 {
+				t.Errorf("downloaded %s for %s", version, platform)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(out); len(entries) != 0 {
+		t.Errorf("wrote %s to --out", entries[0].Name())
+	}
+}
+
+func TestPrintDriverVersion(t *testing.T) {
+	s := newTestServer(t)
+	out := t.TempDir()
+	for spec, want := range map[string]string{"115": "115.0.5790.102", "116": testStable, "115.0.5790.98": "115.0.5790.98"} {
+		stdout, stderr, code := runMain(t, s.args(t, out, "--print-driver-version", "-v", spec)...)
+		if code != 0 {
+			t.Fatalf("%s: exit code %d: %s", spec, code, stderr)
+		}
+		if stdout != want+"\n" || stderr != "" {
+			t.Errorf("%s printed %q and %q, want just %s", spec, stdout, stderr, want)
+		}
+	}
+	if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"); n != 0 {
+		t.Error("downloaded the driver")
+	}
+	if entries, _ := os.ReadDir(out); len(entries) != 0 {
+		t.Errorf("wrote %s to --out", entries[0].Name())
+	}
+	if _, _, code := runMain(t, s.args(t, out, "--print-driver-version", "-v", "999")...); code != exitVersionNotFound {
+		t.Errorf("999: exit code %d, want %d", code, exitVersionNotFound)
+	}
+}
+
+func TestExpectChrome(t *testing.T) {
+	s := newTestServer(t)
+	s.mux.HandleFunc("/114-feed.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"versions": [{"version": "114.0.5735.90", "downloads": {"chromedriver": [{"platform": "linux64", "url": %q}]}}]}`,
+			s.archiveURL("114.0.5735.90", "linux64"))
+	})
+	args := setFlag(s.args(t, t.TempDir(), "--expect-chrome", "115", "-v", "114"), "list-url", s.URL+"/114-feed.json")
+	_, _, err := runCLI(t, args...)
+	if !errors.Is(err, ErrIncompatiblePair) || !strings.Contains(err.Error(), "driver 114.0.5735.90 is for Chrome 114, not the expected Chrome 115") {
+		t.Errorf("got %v, want the 114 driver refused", err)
+	}
+	if n := s.hitCount("/dl/114.0.5735.90/linux64/chromedriver-linux64.zip"); n != 0 {
+		t.Errorf("downloaded the refused driver %d times", n)
+	}
+
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--expect-chrome", "115.0.5790.170", "-v", "115")...); err != nil {
+		t.Errorf("a 115 driver for Chrome 115.0.5790.170: %v", err)
+	}
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--expect-chrome", "latest", "-v", "115")...); err == nil || !strings.Contains(err.Error(), "invalid --expect-chrome") {
+		t.Errorf("got %v, want --expect-chrome=latest refused", err)
+	}
+}
+
+// treeFiles lists the regular files below dir, slash-separated and sorted.
+func treeFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestOutputLayout(t *testing.T) {
+	s := newTestServer(t)
+	driverFiles := []string{"LICENSE.chromedriver", "THIRD_PARTY_NOTICES.chromedriver", "chromedriver"}
+	under := func(dir string) []string {
+		var files []string
+		for _, f := range driverFiles {
+			files = append(files, dir+"/"+f)
+		}
+		return files
+	}
+	for _, test := range []struct {
+		args []string
+		want []string
+	}{
+		{nil, driverFiles},
+		{[]string{"--output-layout", "flat"}, driverFiles},
+		{[]string{"--output-layout", "nested"}, under("chromedriver-linux64")},
+		{[]string{"--output-layout", "per-version"}, under("115.0.5790.102/chromedriver-linux64")},
+	} {
+		out := t.TempDir()
+		if _, _, err := runCLI(t, s.args(t, out, append(test.args, "-v", "115.0.5790.102")...)...); err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		var got []string
+		for _, f := range treeFiles(t, out) {
+			if f != "LATEST" && f != lockName {
+				got = append(got, f)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q laid out %q, want %q", test.args, got, test.want)
+		}
+	}
+
+	// Several versions take a directory each.
+	out := t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out, "-v", "115.0.5790.98", "-v", "115.0.5790.102")...); err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"115.0.5790.98", "115.0.5790.102"} {
+		if !isInstalledIn(filepath.Join(out, version), version) {
+			t.Errorf("%s is not in its own directory", version)
+		}
+	}
+	for _, layout := range []string{"flat", "nested"} {
+		_, _, err := runCLI(t, s.args(t, t.TempDir(), "--output-layout", layout, "-v", "115.0.5790.98", "-v", "115.0.5790.102")...)
+		if err == nil || !strings.Contains(err.Error(), "--output-layout="+layout+" cannot hold several versions") {
+			t.Errorf("--output-layout=%s with two versions: got %v", layout, err)
+		}
+	}
+}
+
+func TestRefuseDowngrade(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out := t.TempDir()
+	install := func(version string, extra ...string) error {
+		_, _, err := runCLI(t, s.args(t, out, append(extra, "-v", version)...)...)
+		return err
+	}
+	if err := install("115.0.5790.102"); err != nil {
+		t.Fatal(err)
+	}
+	err := install("115.0.5790.98")
+	want := "refusing to downgrade 115.0.5790.102 -> 115.0.5790.98 (" + filepath.Join(out, "chromedriver") + "); pass --force"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("got %v, want %q", err, want)
+	}
+	if !isInstalledIn(out, "115.0.5790.102") {
+		t.Error("the refused install replaced the newer driver")
+	}
+	if err := install("115.0.5790.98", "--force"); err != nil || !isInstalledIn(out, "115.0.5790.98") {
+		t.Errorf("--force did not downgrade: %v", err)
+	}
+	// Upgrading needs no --force.
+	if err := install("115.0.5790.102"); err != nil || !isInstalledIn(out, "115.0.5790.102") {
+		t.Errorf("upgrading: %v", err)
+	}
+}
+
+func TestOutFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "my-driver")
+	if err := os.WriteFile(existing, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]bool{
+		filepath.Join(dir, "chromedriver"):     true,
+		filepath.Join(dir, "chromedriver.exe"): true,
+		existing:                               true,
+		dir:                                    false,
+		filepath.Join(dir, "drivers"):          false,
+		"-":                                    false,
+	} {
+		if got := isOutputFile(path); got != want {
+			t.Errorf("isOutputFile(%s) = %t, want %t", path, got, want)
+		}
+	}
+
+	skipOnWindows(t)
+	s := newTestServer(t)
+	install := func(out string, extra ...string) error {
+		t.Helper()
+		args := s.args(t, dir, append([]string{"--only-binary"}, extra...)...)
+		_, _, err := runCLI(t, setFlag(args, "out", out)...)
+		return err
+	}
+	for _, out := range []string{filepath.Join(dir, "bin", "chromedriver"), existing} {
+		if err := install(out, "-v", "115"); err != nil {
+			t.Fatalf("--out=%s: %v", out, err)
+		}
+		if version, err := driverVersion(out); err != nil || version != "115.0.5790.102" {
+			t.Errorf("--out=%s holds %s, %v, want the driver itself", out, version, err)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if name := e.Name(); name != "chromedriver" && name != lockName {
+			t.Errorf("wrote %s beside the binary", name)
+		}
+	}
+
+	// The license files have nowhere to go.
+	args := setFlag(s.args(t, dir, "-v", "115"), "out", filepath.Join(dir, "other", "chromedriver"))
+	if _, _, err := runCLI(t, args...); err == nil || !strings.Contains(err.Error(), "holds 3 files") {
+		t.Errorf("an archive of several files: got %v", err)
+	}
+	if err := install(filepath.Join(dir, "chromedriver"), "-v", "115", "-v", "116"); err == nil || !strings.Contains(err.Error(), "names the driver binary") {
+		t.Errorf("several versions: got %v", err)
+	}
+}
+
+func TestLatestFile(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	s.mux.HandleFunc("/dl/115.0.5790.98/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a zip"))
+	})
+	out := t.TempDir()
+	latest := func() string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(out, latestName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	for _, version := range []string{"115.0.5790.102", testStable} {
+		if _, _, err := runCLI(t, s.args(t, out, "--force", "-v", version)...); err != nil {
+			t.Fatal(err)
+		}
+		if got := latest(); got != version+"\n" {
+			t.Errorf("after installing %s, LATEST holds %q", version, got)
+		}
+	}
+
+	// An install that fails leaves it naming the last good one.
+	if _, _, err := runCLI(t, s.args(t, out, "--force", "-v", "115.0.5790.98")...); err == nil {
+		t.Fatal("a corrupt archive installed")
+	}
+	if got := latest(); got != testStable+"\n" {
+		t.Errorf("after a failed install, LATEST holds %q, want %s", got, testStable)
+	}
+}
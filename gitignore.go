@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitRoot returns the root of the git working tree holding dir, found by
+// walking up to the nearest directory with a .git entry.
+func gitRoot(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// gitignoreEntry is the path, relative to root and slash-separated, that
+// keeps binary out of git: dir itself, or the top directory of the archive
+// when dir is the root.
+func gitignoreEntry(root, dir, binary string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	target := absDir
+	if absDir == root {
+		absBinary, err := filepath.Abs(binary)
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(root, absBinary)
+		if err != nil {
+			return "", err
+		}
+		target = filepath.Join(root, strings.SplitN(rel, string(filepath.Separator), 2)[0])
+	}
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// isGitIgnored asks git whether path in the tree at root is ignored. When
+// git cannot be run it falls back to looking for entry in the root
+// .gitignore.
+func isGitIgnored(root, path, entry string) bool {
+	cmd := exec.Command("git", "-C", root, "check-ignore", "-q", path)
+	err := cmd.Run()
+	if err == nil {
+		return true
+	}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		return false
+	}
+
+	f, err := os.Open(filepath.Join(root, ".gitignore"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.Trim(strings.TrimSpace(scanner.Text()), "/")
+		if line == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGitignore warns when binary, installed into dir, lands in a git
+// working tree without being ignored there. With add it appends the entry
+// to the tree's .gitignore instead.
+func (c *cli) checkGitignore(d *Downloader, dir, binary string, add bool) error {
+	root, ok := gitRoot(dir)
+	if !ok {
+		return nil
+	}
+	entry, err := gitignoreEntry(root, dir, binary)
+	if err != nil || entry == "." || isGitIgnored(root, binary, entry) {
+		return nil
+	}
+	if !add {
+		return d.warnf("%s is inside the git working tree %s and not ignored; add /%s to .gitignore or pass --add-gitignore", binary, root, entry)
+	}
+	return c.appendGitignore(root, "/"+entry)
+}
+
+// appendGitignore adds line to the .gitignore at root, starting it on a
+// line of its own.
+func (c *cli) appendGitignore(root, line string) error {
+	path := filepath.Join(root, ".gitignore")
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("updating %s: %w", path, err)
+	}
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		line = "\n" + line
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("updating %s: %w", path, err)
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return fmt.Errorf("updating %s: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("updating %s: %w", path, err)
+	}
+	fmt.Fprintf(c.stderr, "added %s to %s\n", strings.TrimPrefix(line, "\n"), path)
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitignoreWarning(t *testing.T) {
+	s := newTestServer(t)
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte("node_modules"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(root, "drivers")
+	install := func(extra ...string) string {
+		t.Helper()
+		_, stderr, err := runCLI(t, s.args(t, out, append(extra, "--force", "-v", "115")...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stderr
+	}
+
+	if stderr := install(); !strings.Contains(stderr, "is inside the git working tree "+root+" and not ignored; add /drivers to .gitignore") {
+		t.Errorf("printed %q, want a warning about the git tree", stderr)
+	}
+	if stderr := install("--add-gitignore"); !strings.Contains(stderr, "added /drivers to "+filepath.Join(root, ".gitignore")) {
+		t.Errorf("printed %q, want the entry reported added", stderr)
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, ".gitignore")); string(b) != "node_modules\n/drivers\n" {
+		t.Errorf(".gitignore is %q, want the entry on a line of its own", b)
+	}
+	if stderr := install(); strings.Contains(stderr, "git working tree") {
+		t.Errorf("warned %q with the driver ignored", stderr)
+	}
+
+	// Outside a git tree nothing is said.
+	if _, stderr, err := runCLI(t, s.args(t, t.TempDir(), "-v", "115")...); err != nil || strings.Contains(stderr, "git working tree") {
+		t.Errorf("outside a git tree: printed %q, %v", stderr, err)
+	}
+}
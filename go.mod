@@ -3,10 +3,14 @@ module sandBox
 go 1.17
 
 require (
-	github.com/PuerkitoBio/goquery v1.8.0 // indirect
+	github.com/PuerkitoBio/goquery v1.8.0
+	github.com/alecthomas/units v0.0.0-20211218093645-b94a6e3cc137
+	golang.org/x/sys v0.5.0
+	gopkg.in/alecthomas/kingpin.v2 v2.2.6
+)
+
+require (
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
-	github.com/alecthomas/units v0.0.0-20211218093645-b94a6e3cc137 // indirect
 	github.com/andybalholm/cascadia v1.3.1 // indirect
 	golang.org/x/net v0.0.0-20210916014120-12bc252f5db8 // indirect
-	gopkg.in/alecthomas/kingpin.v2 v2.2.6 // indirect
 )
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// runPostInstall runs the --post-install command through the system shell
+// with CHROMEDRIVER_PATH and CHROMEDRIVER_VERSION set for the installed
+// driver. The command is run as given, with the user's privileges, so it
+// can do anything the user can.
+func (c *cli) runPostInstall(command, binary, version string) error {
+	abs, err := filepath.Abs(binary)
+	if err != nil {
+		return err
+	}
+
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), "CHROMEDRIVER_PATH="+abs, "CHROMEDRIVER_VERSION="+version)
+	cmd.Stdout = c.stdout
+	cmd.Stderr = c.stderr
+
+	err = cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return fmt.Errorf("post-install hook exited with status %d", exit.ExitCode())
+	}
+	if err != nil {
+		return fmt.Errorf("running post-install hook: %w", err)
+	}
+	fmt.Fprintf(c.stdout, "post-install hook succeeded\n")
+	return nil
+}
+
+// runScan runs the --scan-cmd command through the system shell with
+// CHROMEDRIVER_ARCHIVE set to the downloaded archive, before anything is
+// extracted from it. A non-zero exit refuses the archive, and the error
+// carries what the scanner printed.
+func runScan(command, archive, version string) error {
+	abs, err := filepath.Abs(archive)
+	if err != nil {
+		return err
+	}
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(), "CHROMEDRIVER_ARCHIVE="+abs, "CHROMEDRIVER_VERSION="+version)
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		msg := fmt.Sprintf("scan of %s failed with status %d", filepath.Base(archive), exit.ExitCode())
+		if text := strings.TrimSpace(string(out)); text != "" {
+			msg += ":\n" + text
+		}
+		return errors.New(msg)
+	}
+	if err != nil {
+		return fmt.Errorf("running scan command: %w", err)
+	}
+	return nil
+}
+
+// shellCommand runs command through sh, or cmd on Windows.
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
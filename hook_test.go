@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPostInstall(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out := t.TempDir()
+	got := filepath.Join(t.TempDir(), "hook")
+	hook := `echo "$CHROMEDRIVER_PATH $CHROMEDRIVER_VERSION" > '` + got + `'`
+	stdout, _, err := runCLI(t, s.args(t, out, "--post-install", hook, "-v", "115")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatalf("the hook did not run: %v", err)
+	}
+	abs, _ := filepath.Abs(filepath.Join(out, "chromedriver"))
+	if want := abs + " 115.0.5790.102\n"; string(b) != want {
+		t.Errorf("the hook saw %q, want %q", b, want)
+	}
+	if !strings.Contains(stdout, "post-install hook succeeded\n") {
+		t.Errorf("printed %q, want the hook's success reported", stdout)
+	}
+
+	_, _, err = runCLI(t, s.args(t, t.TempDir(), "--post-install", "exit 3", "-v", "115")...)
+	if err == nil || !strings.Contains(err.Error(), "post-install hook exited with status 3") {
+		t.Errorf("got %v, want the hook's exit status", err)
+	}
+}
+
+func TestScanCmd(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	scanned := filepath.Join(t.TempDir(), "scanned")
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+
+	// A scanner that passes sees the archive before anything is extracted.
+	out := t.TempDir()
+	scanner := `cp "$CHROMEDRIVER_ARCHIVE" '` + scanned + `' && test ! -e '` + filepath.Join(out, "chromedriver") + `'`
+	if _, _, err := runCLI(t, s.args(t, out, "--scan-cmd", scanner, "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(scanned); err != nil || !bytes.Equal(b, archive) {
+		t.Errorf("the scanner did not get the archive: %v", err)
+	}
+	if !isInstalledIn(out, "115.0.5790.102") {
+		t.Error("a passing scan did not install the driver")
+	}
+
+	// One that fails stops the install, with what it printed.
+	out = t.TempDir()
+	scanner = `echo "$CHROMEDRIVER_VERSION: Win.Trojan.Test FOUND"; exit 1`
+	_, _, err := runCLI(t, s.args(t, out, "--scan-cmd", scanner, "-v", "115")...)
+	if err == nil || !strings.Contains(err.Error(), "scan of chromedriver-linux64.zip failed with status 1:\n115.0.5790.102: Win.Trojan.Test FOUND") {
+		t.Errorf("got %v, want the scanner's refusal", err)
+	}
+	if _, err := InstalledVersion(out); err == nil {
+		t.Error("a failed scan installed the driver")
+	}
+	entries, _ := os.ReadDir(out)
+	for _, e := range entries {
+		if e.Name() != lockName {
+			t.Errorf("a failed scan left %s in --out", e.Name())
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// executableFormats are the leading bytes of the executable formats driver
+// builds ship in.
+var executableFormats = []struct {
+	magic []byte
+	name  string
+}{
+	{[]byte("\x7fELF"), "ELF executable"},
+	{[]byte("MZ"), "Windows executable"},
+	{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "Mach-O executable"},
+	{[]byte{0xca, 0xfe, 0xba, 0xbe}, "Mach-O universal executable"},
+	{[]byte("#!"), "script"},
+}
+
+func executableFormat(head []byte) string {
+	for _, f := range executableFormats {
+		if bytes.HasPrefix(head, f.magic) {
+			return f.name
+		}
+	}
+	return "unknown format"
+}
+
+// validateZip implements "validate-zip": it lists the entries of the local
+// archive at target, or of the cached archive of the version target names,
+// and checks that it holds a chromedriver binary, all without extracting.
+func (c *cli) validateZip(d *Downloader, w io.Writer, target string) error {
+	path := target
+	if _, err := os.Stat(target); os.IsNotExist(err) && isVersionSpec(target) {
+		release, err := c.resolve(d, target)
+		if err != nil {
+			return inPhase("resolve", target, err)
+		}
+		d.CacheDir = c.cacheDir
+		path = d.cachePath(release)
+		if cached, _, ok := d.lookupCached(release); ok {
+			path = cached
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var (
+		binary string
+		head   []byte
+		size   int64
+		lines  []string
+	)
+	n, err := eachArchiveEntry(data, func(string) bool { return true }, nil, func(e archiveEntry, r io.Reader) error {
+		lines = append(lines, fmt.Sprintf("%s\t%d\t%s", e.Mode.Perm(), e.Size, e.Name))
+		if binary == "" && isDriverName(filepath.Base(filepath.FromSlash(e.Name))) {
+			binary, size = e.Name, e.Size
+			head = make([]byte, 4)
+			k, _ := io.ReadFull(r, head)
+			head = head[:k]
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s is not a valid archive: %w", path, err)
+	}
+	fmt.Fprintf(w, "Mode\tSize\tName\n")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "%d files in %s\n", n, path)
+	if binary == "" {
+		return fmt.Errorf("%s holds no chromedriver binary", path)
+	}
+	if size == 0 {
+		return fmt.Errorf("%s: chromedriver binary %s is empty", path, binary)
+	}
+	fmt.Fprintf(w, "chromedriver binary: %s (%s)\n", binary, executableFormat(head))
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateZip(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "chromedriver-linux64.zip")
+	if err := os.WriteFile(archive, testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, err := runCLI(t, "validate-zip", archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := len(testDriver("115.0.5790.102"))
+	want := "Mode\tSize\tName\n" +
+		"-rw-r--r--\t8\tchromedriver-linux64/LICENSE.chromedriver\n" +
+		"-rw-r--r--\t8\tchromedriver-linux64/THIRD_PARTY_NOTICES.chromedriver\n" +
+		"-rwxr-xr-x\t" + strconv.Itoa(driver) + "\tchromedriver-linux64/chromedriver\n" +
+		"3 files in " + archive + "\n" +
+		"chromedriver binary: chromedriver-linux64/chromedriver (script)\n"
+	if stdout != want {
+		t.Errorf("reported\n%s\nwant\n%s", stdout, want)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("left %d files beside the archive, want it not extracted", len(entries)-1)
+	}
+
+	// The wrong asset: an archive without the driver in it.
+	wrong := filepath.Join(dir, "chrome-linux64.zip")
+	if err := os.WriteFile(wrong, testArchive(t, "chrome-linux64.zip", "115.0.5790.102", "linux64"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCLI(t, "validate-zip", wrong); err == nil || !strings.Contains(err.Error(), "holds no chromedriver binary") {
+		t.Errorf("got %v, want no chromedriver binary", err)
+	}
+	if err := os.WriteFile(wrong, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCLI(t, "validate-zip", wrong); err == nil || !strings.Contains(err.Error(), "is not a valid archive") {
+		t.Errorf("got %v, want an invalid archive", err)
+	}
+}
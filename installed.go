@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var driverVersionPattern = regexp.MustCompile(`ChromeDriver (\d+(?:\.\d+)+)`)
+
+// installedDriver is a chromedriver binary found on disk.
+type installedDriver struct {
+	Path    string
+	Version string
+}
+
+// findInstalled walks dir for files named like a chromedriver binary and
+// keeps those that report a driver version when run.
+func findInstalled(dir string) ([]installedDriver, error) {
+	var drivers []installedDriver
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !isDriverName(info.Name()) {
+			return nil
+		}
+
+		version, err := driverVersion(path)
+		if err != nil {
+			return nil
+		}
+		drivers = append(drivers, installedDriver{Path: path, Version: version})
+		return nil
+	})
+	return drivers, err
+}
+
+// findInstalledVersion returns the path of a driver under dir that reports
+// version, if any.
+func findInstalledVersion(dir, version string) (string, bool) {
+	drivers, err := findInstalled(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, driver := range drivers {
+		if driver.Version == version {
+			return driver.Path, true
+		}
+	}
+	return "", false
+}
+
+// InstalledVersion returns the version the newest chromedriver binary
+// under dir reports when run; dir may also name the binary itself. It
+// returns ErrNotInstalled when there is none.
+func InstalledVersion(dir string) (string, error) {
+	driver, err := newestInstalled(dir)
+	if err != nil {
+		return "", err
+	}
+	return driver.Version, nil
+}
+
+// newestInstalled returns the newest driver found under dir, or dir
+// itself when it is a driver binary.
+func newestInstalled(dir string) (installedDriver, error) {
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		version, err := driverVersion(dir)
+		if err != nil {
+			return installedDriver{}, fmt.Errorf("%w: %v", ErrNotInstalled, err)
+		}
+		return installedDriver{Path: dir, Version: version}, nil
+	}
+	drivers, err := findInstalled(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return installedDriver{}, err
+	}
+	var newest installedDriver
+	for _, driver := range drivers {
+		if newest.Version == "" || compareVersions(driver.Version, newest.Version) > 0 {
+			newest = driver
+		}
+	}
+	if newest.Version == "" {
+		return installedDriver{}, fmt.Errorf("%w in %s", ErrNotInstalled, dir)
+	}
+	return newest, nil
+}
+
+// newestInstalledAt returns the newest driver an install into dir would
+// replace: one in dir itself or in a directory directly below it, where
+// archives put their binary.
+func newestInstalledAt(dir string) (installedDriver, bool) {
+	var newest installedDriver
+	candidates, _ := filepath.Glob(filepath.Join(dir, "*"))
+	nested, _ := filepath.Glob(filepath.Join(dir, "*", "*"))
+	for _, path := range append(candidates, nested...) {
+		if !isDriverName(filepath.Base(path)) {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		version, err := driverVersion(path)
+		if err != nil {
+			continue
+		}
+		if newest.Version == "" || compareVersions(version, newest.Version) > 0 {
+			newest = installedDriver{Path: path, Version: version}
+		}
+	}
+	return newest, newest.Version != ""
+}
+
+func isDriverName(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".exe")
+	if name == "chromedriver" {
+		return true
+	}
+	for p, arch := range platformArch {
+		if name == normalizedBase(p, arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizedBase is the --normalize-names binary name without extension.
+func normalizedBase(platform, arch string) string {
+	return "chromedriver-" + platform + "-" + arch
+}
+
+// normalizeBinary renames the driver binary among files to the
+// platform-qualified name used by --normalize-names and returns files with
+// the new path in its place.
+func normalizeBinary(files []string, platform string) ([]string, error) {
+	binary, ok := driverBinary(files)
+	if !ok {
+		return nil, fmt.Errorf("normalizing names: no chromedriver binary found")
+	}
+	name := normalizedBase(platform, platformArch[platform])
+	if strings.HasSuffix(strings.ToLower(binary), ".exe") {
+		name += ".exe"
+	}
+	target := filepath.Join(filepath.Dir(binary), name)
+	if err := os.Rename(binary, target); err != nil {
+		return nil, fmt.Errorf("normalizing names: %w", err)
+	}
+
+	renamed := make([]string, len(files))
+	for i, f := range files {
+		if f == binary {
+			f = target
+		}
+		renamed[i] = f
+	}
+	return renamed, nil
+}
+
+// driverVersion runs the binary at path with --version and parses the
+// reported version.
+func driverVersion(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("running %s --version: %w", path, err)
+	}
+
+	m := driverVersionPattern.FindStringSubmatch(string(out))
+	if m == nil {
+		return "", fmt.Errorf("%s: unexpected version output %q", path, strings.TrimSpace(string(out)))
+	}
+	return m[1], nil
+}
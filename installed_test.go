@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestDriver installs a fake driver reporting version at path.
+func writeTestDriver(t testing.TB, path, version string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(testDriver(version)), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListInstalled(t *testing.T) {
+	skipOnWindows(t)
+	dir := t.TempDir()
+	writeTestDriver(t, filepath.Join(dir, "115.0.5790.102", "chromedriver"), "115.0.5790.102")
+	writeTestDriver(t, filepath.Join(dir, "116.0.5845.96", "chromedriver"), "116.0.5845.96")
+	// Neither is a driver: one is not named like one, the other reports
+	// no version.
+	os.WriteFile(filepath.Join(dir, "LICENSE.chromedriver"), []byte("license\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "chromedriver"), []byte("#!/bin/sh\necho hello\n"), 0755)
+
+	stdout, _, err := runCLI(t, "--list", "--installed", "--out", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range []string{"115.0.5790.102", "116.0.5845.96"} {
+		if !strings.Contains(stdout, version) {
+			t.Errorf("listed %q, want %s", stdout, version)
+		}
+	}
+	if strings.Contains(stdout, "LICENSE") || strings.Contains(stdout, "\t"+filepath.Join(dir, "chromedriver")+"\n") {
+		t.Errorf("listed %q, want the two drivers alone", stdout)
+	}
+}
+
+func TestInstalledVersion(t *testing.T) {
+	skipOnWindows(t)
+	dir := t.TempDir()
+	writeTestDriver(t, filepath.Join(dir, "chromedriver"), "115.0.5790.102")
+	if version, err := InstalledVersion(dir); err != nil || version != "115.0.5790.102" {
+		t.Errorf("got %q, %v, want 115.0.5790.102", version, err)
+	}
+	// The binary itself, with or without the .exe of Windows builds.
+	exe := filepath.Join(t.TempDir(), "chromedriver.exe")
+	writeTestDriver(t, exe, "116.0.5845.96")
+	for _, path := range []string{filepath.Join(dir, "chromedriver"), exe, filepath.Dir(exe)} {
+		if _, err := InstalledVersion(path); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+	if version, _ := InstalledVersion(exe); version != "116.0.5845.96" {
+		t.Errorf("chromedriver.exe reported %q, want 116.0.5845.96", version)
+	}
+	// The newest of several.
+	writeTestDriver(t, filepath.Join(dir, "116.0.5845.96", "chromedriver"), "116.0.5845.96")
+	if version, err := InstalledVersion(dir); err != nil || version != "116.0.5845.96" {
+		t.Errorf("got %q, %v, want the newer 116.0.5845.96", version, err)
+	}
+
+	// No binary, a missing directory and a binary reporting no version
+	// are all not installed.
+	empty := t.TempDir()
+	os.WriteFile(filepath.Join(empty, "LICENSE.chromedriver"), []byte("license\n"), 0644)
+	broken := filepath.Join(t.TempDir(), "chromedriver")
+	os.WriteFile(broken, []byte("#!/bin/sh\necho hello\n"), 0755)
+	for _, path := range []string{empty, filepath.Join(empty, "missing"), broken} {
+		if _, err := InstalledVersion(path); !errors.Is(err, ErrNotInstalled) {
+			t.Errorf("%s: got %v, want ErrNotInstalled", path, err)
+		}
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	archive := "/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"
+	out := t.TempDir()
+	writeTestDriver(t, filepath.Join(out, "chromedriver-linux64", "chromedriver"), "115.0.5790.102")
+
+	stdout, _, err := runCLI(t, s.args(t, out, "--ensure", "-v", "115")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout, "already installed: 115.0.5790.102") {
+		t.Errorf("printed %q, want already installed", stdout)
+	}
+	if n := s.hitCount(archive); n != 0 {
+		t.Errorf("downloaded the installed driver %d times", n)
+	}
+
+	// A driver of another version is replaced.
+	out = t.TempDir()
+	writeTestDriver(t, filepath.Join(out, "chromedriver-linux64", "chromedriver"), "115.0.5790.98")
+	stdout, _, err = runCLI(t, s.args(t, out, "--ensure", "-v", "115")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stdout, "already installed") || s.hitCount(archive) != 1 {
+		t.Errorf("printed %q after %d downloads, want the driver installed", stdout, s.hitCount(archive))
+	}
+	if version, err := InstalledVersion(out); err != nil || version != "115.0.5790.102" {
+		t.Errorf("installed %s, %v; want 115.0.5790.102", version, err)
+	}
+
+	// Nothing installed at all.
+	out = t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out, "--ensure", "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := InstalledVersion(out); err != nil || version != "115.0.5790.102" {
+		t.Errorf("installed %s, %v; want 115.0.5790.102", version, err)
+	}
+}
+
+func TestNormalizeNames(t *testing.T) {
+	s := newTestServer(t)
+	out := t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out, "--platforms", "win64,mac-arm64", "--normalize-names", "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"win64/chromedriver-win64-amd64.exe",
+		"mac-arm64/chromedriver-mac-arm64-arm64",
+	} {
+		if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(name))); err != nil {
+			t.Errorf("no normalized driver: %v", err)
+		}
+	}
+	for _, name := range []string{"win64/chromedriver.exe", "mac-arm64/chromedriver"} {
+		if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(name))); err == nil {
+			t.Errorf("%s was left under its original name", name)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listEntry is one major version in the --list output. The detailed fields
+// are only filled with --detailed and stay blank when the source has no
+// metadata for the version. As the JSON list is an array, each entry
+// carries the schemaVersion.
+type listEntry struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Major         string   `json:"major"`
+	Latest        string   `json:"latest"`
+	Versions      []string `json:"versions"`
+	Revision      string   `json:"revision,omitempty"`
+	Size          int64    `json:"size,omitempty"`
+	Platforms     []string `json:"platforms,omitempty"`
+}
+
+// channelEntry is one release channel in the --channel-all output.
+type channelEntry struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Channel       string `json:"channel"`
+	Version       string `json:"version"`
+	Revision      string `json:"revision"`
+}
+
+// showChannels prints the current driver of every release channel, most
+// stable first, as a table or as JSON.
+func showChannels(d *Downloader, w io.Writer, format string) error {
+	all, err := d.Channels()
+	if err != nil {
+		return err
+	}
+
+	var entries []channelEntry
+	for _, name := range channels {
+		if c, ok := all[name]; ok {
+			entries = append(entries, channelEntry{SchemaVersion: schemaVersion, Channel: name, Version: c.Version, Revision: c.Revision})
+		}
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	fmt.Fprintf(w, "Channel\tVersion\tRevision\n")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Channel, entry.Version, entry.Revision)
+	}
+	return nil
+}
+
+// showMajors prints the available majors to w, one per line.
+func showMajors(d *Downloader, w io.Writer, ascending bool) error {
+	list, err := d.List()
+	if err != nil {
+		return err
+	}
+	for _, major := range sortedMajors(list, ascending) {
+		fmt.Fprintln(w, major)
+	}
+	return nil
+}
+
+// sortedMajors returns the majors of list newest first, or oldest first
+// when ascending.
+func sortedMajors(list *VersionList, ascending bool) []string {
+	// Majors come sorted newest first.
+	if !ascending {
+		return list.Majors
+	}
+	majors := make([]string, len(list.Majors))
+	for i, major := range list.Majors {
+		majors[len(majors)-1-i] = major
+	}
+	return majors
+}
+
+func showList(d *Downloader, w io.Writer, format string, detailed, ascending bool) error {
+	list, err := d.List()
+	if err != nil {
+		return err
+	}
+
+	var entries []listEntry
+	for _, major := range sortedMajors(list, ascending) {
+		versions := list.Versions[major]
+		entries = append(entries, listEntry{SchemaVersion: schemaVersion, Major: major, Latest: versions[0], Versions: versions})
+	}
+	if detailed {
+		fillAllDetails(d, list, entries)
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+
+	fmt.Fprintln(w, "Specifiable chrome driver versions.")
+	if !detailed {
+		fmt.Fprintf(w, "Major\tLatest\n")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%s\t%s\n", entry.Major, entry.Latest)
+		}
+		return nil
+	}
+
+	fmt.Fprintf(w, "Major\tLatest\tRevision\tSize\tPlatforms\n")
+	for _, entry := range entries {
+		size := ""
+		if entry.Size > 0 {
+			size = strconv.FormatInt(entry.Size, 10)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Major, entry.Latest, entry.Revision, size, strings.Join(entry.Platforms, ","))
+	}
+	return nil
+}
+
+// maxSizeChecks bounds how many archive sizes --detailed asks for at once.
+const maxSizeChecks = 8
+
+// fillAllDetails runs fillDetails on every entry, asking for up to
+// maxSizeChecks archive sizes at once.
+func fillAllDetails(d *Downloader, list *VersionList, entries []listEntry) {
+	var (
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, maxSizeChecks)
+	)
+	for i := range entries {
+		entry := &entries[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			fillDetails(d, list, entry)
+		}()
+	}
+	wg.Wait()
+}
+
+// fillDetails adds the feed metadata of entry's latest version and the
+// archive size of d.Platform, asking the server for it when the feed does
+// not declare it.
+func fillDetails(d *Downloader, list *VersionList, entry *listEntry) {
+	entry.Revision = list.Revisions[entry.Latest]
+	for p := range list.Downloads[entry.Latest] {
+		entry.Platforms = append(entry.Platforms, p)
+	}
+	sort.Strings(entry.Platforms)
+
+	release, err := d.release(entry.Latest, list)
+	if err != nil {
+		return
+	}
+	if release.Size > 0 {
+		entry.Size = release.Size
+		return
+	}
+	if size, err := d.AssetSize(release); err == nil {
+		entry.Size = size
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// listJSON returns the --list --format=json entries d prints.
+func listJSON(t *testing.T, d *Downloader, detailed bool) []listEntry {
+	var out bytes.Buffer
+	if err := showList(d, &out, "json", detailed, false); err != nil {
+		t.Fatal(err)
+	}
+	var entries []listEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("parsing %s: %v", out.Bytes(), err)
+	}
+	return entries
+}
+
+func TestListDetailed(t *testing.T) {
+	for _, declareSizes := range []bool{false, true} {
+		s := newTestServer(t)
+		s.declareSizes = declareSizes
+		d := s.downloader()
+
+		plain := listJSON(t, d, false)
+		if len(plain) != 2 || plain[0].Revision != "" || plain[0].Size != 0 || plain[0].Platforms != nil {
+			t.Errorf("plain list %+v, want 116 and 115 without details", plain)
+		}
+
+		entries := listJSON(t, d, true)
+		if len(entries) != 2 {
+			t.Fatalf("listed %+v, want 116 and 115", entries)
+		}
+		latest := entries[0]
+		if latest.Major != "116" || latest.Revision != testRevision(testStable) {
+			t.Errorf("detailed %+v, want revision %s of %s", latest, testRevision(testStable), testStable)
+		}
+		if want := []string{"linux64", "mac-arm64", "mac-x64", "win64"}; !reflect.DeepEqual(latest.Platforms, want) {
+			t.Errorf("116 platforms %v, want %v", latest.Platforms, want)
+		}
+		if want := int64(len(testArchive(t, "chromedriver-linux64.zip", testStable, "linux64"))); latest.Size != want {
+			t.Errorf("116 size %d, want %d", latest.Size, want)
+		}
+		// Only sizes the feed leaves out take a request.
+		heads := s.hitCount("/dl/" + testStable + "/linux64/chromedriver-linux64.zip")
+		if declareSizes && heads != 0 || !declareSizes && heads != 1 {
+			t.Errorf("declared sizes %v: asked the server for the size %d times", declareSizes, heads)
+		}
+	}
+}
+
+func TestAllowPrerelease(t *testing.T) {
+	s := newTestServer(t)
+	d := s.downloader()
+	majors := func() []string {
+		var majors []string
+		for _, entry := range listJSON(t, d, false) {
+			majors = append(majors, entry.Major)
+		}
+		return majors
+	}
+
+	// 120 is on Beta, Dev and Canary only.
+	if got, want := majors(), []string{"116", "115"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v by default, want %v", got, want)
+	}
+	if _, err := d.Resolve("120"); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("resolving 120 by default: got %v, want ErrVersionNotFound", err)
+	}
+	if release, err := d.ResolveLatest(); err != nil || release.Version != testStable {
+		t.Errorf("latest resolved to %v, %v; want %s", release, err, testStable)
+	}
+
+	d.AllowPrerelease = true
+	if got, want := majors(), []string{"120", "116", "115"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed %v with prereleases, want %v", got, want)
+	}
+	if release, err := d.Resolve("120"); err != nil || release.Version != testPrerelease {
+		t.Errorf("120 resolved to %v, %v; want %s", release, err, testPrerelease)
+	}
+	if release, err := d.ResolveLatest(); err != nil || release.Version != testPrerelease {
+		t.Errorf("latest resolved to %v, %v; want %s", release, err, testPrerelease)
+	}
+}
+
+func TestShowChannels(t *testing.T) {
+	versions := map[string]string{
+		"Stable": "116.0.5845.96",
+		"Beta":   "117.0.5938.22",
+		"Dev":    "118.0.5949.0",
+		"Canary": "118.0.5951.1",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sampleChannels("https://dl.invalid", versions)))
+	}))
+	defer srv.Close()
+	d := NewDownloader()
+	d.ChannelsURL = srv.URL
+
+	var table bytes.Buffer
+	if err := showChannels(d, &table, "text"); err != nil {
+		t.Fatal(err)
+	}
+	want := "Channel\tVersion\tRevision\n" +
+		"Stable\t116.0.5845.96\t1\n" +
+		"Beta\t117.0.5938.22\t1\n" +
+		"Dev\t118.0.5949.0\t1\n" +
+		"Canary\t118.0.5951.1\t1\n"
+	if table.String() != want {
+		t.Errorf("printed %q, want %q", table.String(), want)
+	}
+
+	var out bytes.Buffer
+	if err := showChannels(d, &out, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var entries []channelEntry
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+		t.Fatalf("parsing %s: %v", out.Bytes(), err)
+	}
+	if len(entries) != len(channels) {
+		t.Fatalf("listed %d channels, want %d", len(entries), len(channels))
+	}
+	for i, entry := range entries {
+		if entry.Channel != channels[i] || entry.Version != versions[channels[i]] {
+			t.Errorf("entry %d is %+v, want %s %s", i, entry, channels[i], versions[channels[i]])
+		}
+	}
+}
+
+func TestListSort(t *testing.T) {
+	d := NewDownloader()
+	d.AllowPrerelease = true
+	d.Sources = []VersionSource{stubSource{name: "feed", list: &VersionList{
+		Versions: map[string][]string{"99": {"99.0.4844.51"}, "115": {"115.0.5790.102"}, "9": {"9.0.1.2"}, "100": {"100.0.4896.20"}},
+	}}}
+	majors := func(ascending bool) []string {
+		t.Helper()
+		var out bytes.Buffer
+		if err := showList(d, &out, "json", false, ascending); err != nil {
+			t.Fatal(err)
+		}
+		var entries []listEntry
+		if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
+			t.Fatalf("parsing %s: %v", out.Bytes(), err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Major)
+		}
+		return got
+	}
+	if got, want := majors(false), []string{"115", "100", "99", "9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("descending listed %v, want %v", got, want)
+	}
+	if got, want := majors(true), []string{"9", "99", "100", "115"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ascending listed %v, want %v", got, want)
+	}
+
+	// The flag orders the table alike.
+	s := newTestServer(t)
+	for order, want := range map[string]string{
+		"desc": "Major\tLatest\n120\t" + testPrerelease + "\n116\t" + testStable + "\n115\t115.0.5790.102\n",
+		"asc":  "Major\tLatest\n115\t115.0.5790.102\n116\t" + testStable + "\n120\t" + testPrerelease + "\n",
+	} {
+		stdout, _, err := runCLI(t, s.args(t, t.TempDir(), "--list", "--sort", order)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(stdout, want) {
+			t.Errorf("--sort=%s printed %q, want %q", order, stdout, want)
+		}
+	}
+}
+
+func TestListMajorsOnly(t *testing.T) {
+	s := newTestServer(t)
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "120\n116\n115\n"},
+		{[]string{"--sort", "desc"}, "120\n116\n115\n"},
+		{[]string{"--sort", "asc"}, "115\n116\n120\n"},
+	} {
+		stdout, _, err := runCLI(t, s.args(t, t.TempDir(), append([]string{"--list-majors-only"}, test.args...)...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stdout != test.want {
+			t.Errorf("%v printed %q, want exactly %q", test.args, stdout, test.want)
+		}
+	}
+	for _, extra := range [][]string{{"--detailed"}, {"--format", "json"}} {
+		if _, _, err := runCLI(t, s.args(t, t.TempDir(), append([]string{"--list-majors-only"}, extra...)...)...); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+			t.Errorf("with %v: got %v, want it refused", extra, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// listCacheName is the file in CacheDir holding the last version list.
+const listCacheName = "versions.json"
+
+// cachedList is the on-disk form of a version list. Key is the memoKey of
+// the Downloader that fetched it, so a list from other sources is not
+// mistaken for the current one.
+type cachedList struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Key           string       `json:"key"`
+	Fetched       time.Time    `json:"fetched"`
+	List          *VersionList `json:"list"`
+}
+
+func (d *Downloader) listCachePath() string {
+	return filepath.Join(d.CacheDir, listCacheName)
+}
+
+// readListCache returns the cached version list if it was fetched from the
+// current sources.
+func (d *Downloader) readListCache() (*cachedList, bool) {
+	b, err := os.ReadFile(d.listCachePath())
+	if err != nil {
+		return nil, false
+	}
+	var c cachedList
+	if err := json.Unmarshal(b, &c); err != nil || c.Key != d.memoKey() || c.List == nil {
+		return nil, false
+	}
+	// The file may have been edited, or written by a release that did not
+	// order the list the same way.
+	c.List.sort()
+	return &c, true
+}
+
+// fetchListCached serves the version list from the cache in CacheDir while
+// it is younger than ListCacheTTL, and otherwise fetches and caches it. When
+// fetching fails a cached list of any age is used instead, with a warning,
+// so a warmed cache keeps working offline; under --no-network there is no
+// warning, since not fetching is the point.
+func (d *Downloader) fetchListCached(fetch func() (*VersionList, error)) (*VersionList, error) {
+	cached, ok := d.readListCache()
+	if ok && time.Since(cached.Fetched) < d.ListCacheTTL {
+		d.verbosef("using cached version list %s\n", d.listCachePath())
+		return cached.List, nil
+	}
+
+	list, err := fetch()
+	if err != nil {
+		if !ok {
+			return nil, err
+		}
+		if errors.Is(err, ErrNetworkDisabled) {
+			d.verbosef("using cached version list %s\n", d.listCachePath())
+			return cached.List, nil
+		}
+		if werr := d.warnf("using the cached version list from %s: %v", cached.Fetched.Format(time.RFC3339), err); werr != nil {
+			return nil, werr
+		}
+		return cached.List, nil
+	}
+
+	if err := os.MkdirAll(d.CacheDir, 0755); err == nil {
+		c := &cachedList{SchemaVersion: schemaVersion, Key: d.memoKey(), Fetched: time.Now().UTC(), List: list}
+		if err := writeJSONAtomic(d.listCachePath(), c); err != nil {
+			d.verbosef("not caching the version list: %v\n", err)
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockName is the file in the output directory that concurrent runs lock.
+const lockName = ".getchromedriver.lock"
+
+// errLocked is returned by tryLock when another process holds the lock.
+var errLocked = errors.New("locked")
+
+// lockDir takes the install lock of dir, waiting for it to be released when
+// wait is set and failing at once otherwise. The returned func releases it.
+func lockDir(dir string, wait bool) (func(), error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, describeWriteError(dir, err)
+	}
+	path := filepath.Join(dir, lockName)
+	unlock, err := tryLock(path, wait)
+	if errors.Is(err, errLocked) {
+		return nil, fmt.Errorf("another instance is installing to %s; use --wait-lock to wait for it", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("locking %s: %w", dir, err)
+	}
+	return unlock, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockDir(t *testing.T) {
+	dir := t.TempDir()
+	unlock, err := lockDir(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockDir(dir, false); err == nil || !strings.Contains(err.Error(), "another instance is installing to "+dir) {
+		t.Errorf("got %v, want the second lock refused", err)
+	}
+	unlock()
+	unlock, err = lockDir(dir, false)
+	if err != nil {
+		t.Fatalf("locking a released dir: %v", err)
+	}
+	unlock()
+}
+
+// lockHolderEnv, set in the environment of the test binary, has
+// TestLockHolder take the lock at the path it holds and exit without
+// releasing it, as a killed run would.
+const lockHolderEnv = "GET_CHROMEDRIVER_TEST_LOCK_HOLDER"
+
+func TestLockHolder(t *testing.T) {
+	path := os.Getenv(lockHolderEnv)
+	if path == "" {
+		t.Skip("only run as the child of TestLockReleasedOnExit")
+	}
+	if _, err := tryLock(path, false); err != nil {
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+func TestLockReleasedOnExit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), lockName)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHolder$")
+	cmd.Env = append(os.Environ(), lockHolderEnv+"="+path)
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("the child could not take the lock: %v", err)
+	}
+	// The lock died with the child, so neither waiting nor a later run is
+	// held up by the file it left.
+	unlock, err := tryLock(path, false)
+	if err != nil {
+		t.Fatalf("locking after the holder exited: %v", err)
+	}
+	if _, err := tryLock(path, false); !errors.Is(err, errLocked) {
+		t.Errorf("a second lock got %v, want errLocked", err)
+	}
+	unlock()
+}
+
+func TestConcurrentInstallsSerialized(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	// Each download is held for a while, so that two runs installing at
+	// once would overlap in it.
+	var mu sync.Mutex
+	active, most := 0, 0
+	for _, version := range []string{"115.0.5790.98", "115.0.5790.102"} {
+		version := version
+		s.mux.HandleFunc("/dl/"+version+"/linux64/", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			if active++; active > most {
+				most = active
+			}
+			mu.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			w.Write(testArchive(t, "chromedriver-linux64.zip", version, "linux64"))
+			mu.Lock()
+			active--
+			mu.Unlock()
+		})
+	}
+
+	out := t.TempDir()
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, version := range []string{"115.0.5790.98", "115.0.5790.102"} {
+		i, version := i, version
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, errs[i] = runCLI(t, s.args(t, out, "--wait-lock", "--force", "-v", version)...)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if most != 1 {
+		t.Errorf("%d installs ran at once, want them one after the other", most)
+	}
+	if _, err := InstalledVersion(out); err != nil {
+		t.Errorf("no driver left installed: %v", err)
+	}
+
+	// Without --wait-lock a run fails fast while another holds the lock.
+	unlock, err := lockDir(out, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	_, _, err = runCLI(t, s.args(t, out, "--force", "-v", "115")...)
+	if err == nil || !strings.Contains(err.Error(), "another instance is installing to") {
+		t.Errorf("got %v, want the run refused", err)
+	}
+}
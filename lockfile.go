@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const lockfileName = "chromedriver.lock"
+
+// Lockfile pins the driver a project expects, for committing next to its
+// sources and checking with the verify command.
+type Lockfile struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Version       string `json:"version"`
+	Platform      string `json:"platform"`
+	// SHA256 is the hash of the driver binary, not of its archive.
+	SHA256 string `json:"sha256"`
+}
+
+// newLockfile pins release installed as the binary at path.
+func newLockfile(release *Release, binary string) (*Lockfile, error) {
+	sum, err := fileSHA256(binary)
+	if err != nil {
+		return nil, err
+	}
+	return &Lockfile{SchemaVersion: schemaVersion, Version: release.Version, Platform: release.Platform, SHA256: sum}, nil
+}
+
+func readLockfile(path string) (*Lockfile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var lock Lockfile
+	if err := json.Unmarshal(b, &lock); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if lock.Version == "" {
+		return nil, fmt.Errorf("parsing %s: no version", path)
+	}
+	return &lock, nil
+}
+
+// verifyLock checks that dir holds the driver pinned by the lockfile at
+// path, reporting the driver it matched to w. Any difference is returned
+// as ErrDrift.
+func verifyLock(w io.Writer, path, dir string) error {
+	lock, err := readLockfile(path)
+	if err != nil {
+		return err
+	}
+	drivers, err := findInstalled(dir)
+	if err != nil {
+		return err
+	}
+
+	var found []string
+	for _, driver := range drivers {
+		if driver.Version != lock.Version {
+			found = append(found, driver.Version)
+			continue
+		}
+		if lock.SHA256 == "" {
+			fmt.Fprintf(w, "ok: %s (%s)\n", lock.Version, driver.Path)
+			return nil
+		}
+		sum, err := fileSHA256(driver.Path)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, lock.SHA256) {
+			return fmt.Errorf("%w: %s has sha256 %s, locked %s", ErrDrift, driver.Path, sum, lock.SHA256)
+		}
+		fmt.Fprintf(w, "ok: %s (%s)\n", lock.Version, driver.Path)
+		return nil
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("%w: locked %s, but no driver is installed in %s", ErrDrift, lock.Version, dir)
+	}
+	return fmt.Errorf("%w: locked %s, installed %s in %s", ErrDrift, lock.Version, strings.Join(found, ", "), dir)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyLock(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out := t.TempDir()
+	lock := filepath.Join(t.TempDir(), lockfileName)
+	if _, _, err := runCLI(t, s.args(t, out, "--write-lock", "--lockfile", lock, "-v", "115.0.5790.98")...); err != nil {
+		t.Fatal(err)
+	}
+	verify := func() (string, error) {
+		stdout, _, err := runCLI(t, append([]string{"verify"}, s.args(t, out, "--lockfile", lock)...)...)
+		return stdout, err
+	}
+	const archive = "/dl/115.0.5790.98/linux64/chromedriver-linux64.zip"
+
+	stdout, err := verify()
+	if err != nil {
+		t.Fatalf("verifying a matching install: %v", err)
+	}
+	if !strings.HasPrefix(stdout, "ok: 115.0.5790.98 (") {
+		t.Errorf("printed %q, want the match reported", stdout)
+	}
+	if n := s.hitCount(archive); n != 1 {
+		t.Errorf("verify downloaded the driver again")
+	}
+
+	// The same version, but a binary that is not the locked one.
+	binary := filepath.Join(out, "chromedriver")
+	if err := os.WriteFile(binary, []byte(testDriver("115.0.5790.98")+"# patched\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verify(); !errors.Is(err, ErrDrift) || !strings.Contains(err.Error(), "has sha256") {
+		t.Errorf("got %v, want a checksum drift", err)
+	}
+
+	// Another version installed over the locked one.
+	if _, _, err := runCLI(t, s.args(t, out, "--force", "-v", "115.0.5790.102")...); err != nil {
+		t.Fatal(err)
+	}
+	_, err = verify()
+	if !errors.Is(err, ErrDrift) || !strings.Contains(err.Error(), "locked 115.0.5790.98, installed 115.0.5790.102") {
+		t.Errorf("got %v, want a version drift", err)
+	}
+	if code := exitCode(err); code != exitDrift {
+		t.Errorf("exit code %d, want %d", code, exitDrift)
+	}
+}
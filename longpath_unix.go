@@ -0,0 +1,7 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+// longPath returns path unchanged; only Windows limits path length.
+func longPath(path string) string { return path }
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the path length beyond which Windows APIs need the \\?\ form,
+// less room for the name of a file created in a directory of that length.
+const maxPath = 248
+
+// longPath returns path in the \\?\ form when it is too long for the
+// classic Windows APIs, so deep archive entries can still be written.
+func longPath(path string) string {
+	if len(path) < maxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	deep := strings.Repeat(`nested\`, 40) + "chromedriver.exe"
+	for _, test := range []struct{ path, want string }{
+		{`C:\out\chromedriver.exe`, `C:\out\chromedriver.exe`},
+		{`C:\out\` + deep, `\\?\C:\out\` + deep},
+		{`\\server\share\` + deep, `\\?\UNC\server\share\` + deep},
+		{`\\?\C:\out\` + deep, `\\?\C:\out\` + deep},
+	} {
+		if got := longPath(test.path); got != test.want {
+			t.Errorf("longPath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
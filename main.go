@@ -1,215 +1,667 @@
 package main
 
 import (
-	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"github.com/PuerkitoBio/goquery"
+	"github.com/alecthomas/units"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
-	"sort"
+	"runtime"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
-const targetTemplate = "https://chromedriver.storage.googleapis.com/%s/chromedriver_win32.zip"
+// options holds the parsed command line, a field per flag that newApp
+// binds.
+type options struct {
+	specVersions []string
+	outputPath   string
+	isShowList   bool
+	toStdout     bool
+	platform     string
+	autoPlat     bool
+	timeout      time.Duration
+	checksum     string
+	sha256Sum    string
+	retries      int
+	verbose      bool
+	isInstalled  bool
+	connTimeout  time.Duration
+	mirrors      []string
+	region       string
+	ensure       bool
+	maxRate      units.Base2Bytes
+	listURL      string
+	authToken    string
+	authHeader   string
+	listFormat   string
+	detailed     bool
+	isLatest     bool
+	channel      string
+	quietOK      bool
+	mapAsGo      bool
+	failMissing  bool
+	manifest     bool
+	withChrome   bool
+	useTmpfs     bool
+	tmpfsDir     string
+	nest         bool
+	resumeBatch  bool
 
-var (
-	specVersion string
-	outputPath  string
-	isShowList  bool
-)
-
-func init() {
-	kingpin.Flag("version", "specify for major version. for example chrome version is '101.xxx...' then '--version=101'").Short('v').StringVar(&specVersion)
-	kingpin.Flag("out", "specify for unzip path.").Short('o').Default(".").StringVar(&outputPath)
-	kingpin.Flag("list", "show specifiable chrome driver versions.").Default("false").Short('l').BoolVar(&isShowList)
-	kingpin.Parse()
+	// command is the selected subcommand, "get" unless another is given.
+	command            string
+	ipVersion          string
+	useCache           bool
+	cacheDir           string
+	olderThan          string
+	caCert             string
+	pinSHA256          []string
+	dryRun             bool
+	platformSet        bool
+	openOut            bool
+	noTemp             bool
+	matrixFrom         int
+	matrixTo           int
+	matrixPlatforms    []string
+	platformList       string
+	errorFormat        string
+	waitLock           bool
+	maxIdleConns       int
+	checkExists        bool
+	normalizeNames     bool
+	lockfilePath       string
+	writeLock          bool
+	allowPrerelease    bool
+	sourceNames        string
+	onlyBinary         bool
+	strict             bool
+	excludes           []string
+	heartbeatInterval  time.Duration
+	writeChecksum      bool
+	maxTotalRetries    int
+	deadline           time.Duration
+	postInstall        string
+	trace              bool
+	tarStdout          bool
+	minMajor           int
+	versionsFile       string
+	insecure           bool
+	report             string
+	progressMinSize    units.Base2Bytes
+	fileMode           string
+	modeAllFiles       bool
+	addGitignore       bool
+	channelAll         bool
+	maxUncompressed    units.Base2Bytes
+	maxRatio           float64
+	printURLs          bool
+	expectChrome       string
+	listCacheTTL       time.Duration
+	arch               string
+	outputLayout       string
+	checksumDBPath     string
+	force              bool
+	dedupeStorage      bool
+	allowlistPath      string
+	validateTarget     string
+	tempDir            string
+	maxConnections     int
+	printCfg           bool
+	chromeBinary       string
+	summaryJSON        string
+	driverType         string
+	printDriverVersion bool
+	extractWorkers     string
+	noNetwork          bool
+	pinsPath           string
+	listSort           string
+	scanCmd            string
+	compareRemoteFlag  bool
+	preserveTimes      bool
+	checksumAlgo       string
+	retryOn            string
+	applyPlanPath      string
+	ipFallback         bool
+	sinceVersion       string
+	listMajorsOnly     bool
+	requireChecksum    bool
 }
 
-func main() {
-	if isShowList && strings.EqualFold(specVersion, "") {
-		showList()
-		return
-	}
+// cli is one run of the command: its options, where its messages go, and
+// the state the installs of the run share.
+type cli struct {
+	*options
+	// name is the program name usage messages show.
+	name string
 
-	_, versions := getChromeVersions(false)
-	if version, ok := versions[specVersion]; ok {
-		latestVersion := version[0]
-		zipFilePath, err, tempClose := downloadZipFile(latestVersion)
-		if err != nil {
-			panic(err)
-		}
-		defer tempClose()
+	// stdout and stderr receive the tool's own messages. They are swapped
+	// for a buffer under --quiet-on-success.
+	stdout io.Writer
+	stderr io.Writer
 
-		if err := unzip(zipFilePath, outputPath); err != nil {
-			panic(err)
-		}
-	} else {
-		panic(fmt.Errorf("can't specify version.\n"))
-	}
+	// permitted is the loaded --allowlist, or nil when every version may
+	// be installed.
+	permitted *allowlist
+	// pins is the loaded --pins file, or nil when majors resolve to their
+	// latest patch.
+	pins *pinFile
+	// outputFile is set when --out names the driver binary itself rather
+	// than a directory to extract into.
+	outputFile bool
+	// installedThisRun maps the archive URL and directory of each driver
+	// this run installed to its manifest, so a batch naming the same
+	// driver twice, for instance as "115" and "115.0.5790.102", only
+	// fetches it once.
+	installedThisRun map[string]*Manifest
+	// dedupeStore maps the content hash and mode of each file installed
+	// this run under --dedupe-storage to the first path holding it.
+	dedupeStore map[string]string
+	// batchPrefetcher is the prefetcher of the running batch, nil outside
+	// one or when prefetching is off.
+	batchPrefetcher *prefetcher
+	// record collects what the run did, for its result and reports.
+	record *runRecord
 }
 
-func downloadZipFile(version string) (string, error, func() error) {
-	target := fmt.Sprintf(targetTemplate, version)
-	baseName := filepath.Base(target)
-	resp, err := http.Get(target)
+// newCLI parses args, the command line without the program name, into a
+// run printing to stdout and stderr.
+func newCLI(args []string, stdout, stderr io.Writer) (*cli, error) {
+	o := &options{}
+	app := newApp(o)
+	command, err := app.Parse(args)
 	if err != nil {
-		return "", err, nil
+		return nil, err
 	}
-	defer resp.Body.Close()
+	o.command = command
+	return &cli{
+		options:          o,
+		name:             app.Name,
+		stdout:           stdout,
+		stderr:           stderr,
+		installedThisRun: make(map[string]*Manifest),
+		dedupeStore:      make(map[string]string),
+	}, nil
+}
+
+// envPrefix starts the environment variables that configure a flag. A
+// flag given on the command line wins over its variable, which wins over
+// the flag's default. Repeatable flags take one value per line.
+const envPrefix = "GETCHROMEDRIVER_"
+
+// newApp declares the flags and commands of the tool, bound to the fields
+// of o.
+func newApp(o *options) *kingpin.Application {
+	app := kingpin.New(filepath.Base(os.Args[0]), "")
+	app.Flag("version", "specify for major version. for example chrome version is '101.xxx...' then '--version=101'. repeat it to install several versions, each into --out/<version>.").Short('v').StringsVar(&o.specVersions)
+	app.Flag("latest", "download the newest driver instead of specifying --version.").Default("false").BoolVar(&o.isLatest)
+	app.Flag("channel", "resolve the driver currently on a release channel: Stable, Beta, Dev or Canary.").StringVar(&o.channel)
+	app.Flag("out", "specify for unzip path; '-' writes the file of a single-file archive to stdout.").Short('o').Default(".").StringVar(&o.outputPath)
+	app.Flag("list", "show specifiable chrome driver versions.").Default("false").Short('l').BoolVar(&o.isShowList)
+	app.Flag("channel-all", "show the current driver of every release channel; --format applies.").Default("false").BoolVar(&o.channelAll)
+	app.Flag("format", "specify for the output format of --list: text or json; shell prints an export line for the installed driver instead, for eval.").Default("text").EnumVar(&o.listFormat, "text", "json", "shell")
+	app.Flag("list-majors-only", "print only the available majors, one per line, for shell loops.").BoolVar(&o.listMajorsOnly)
+	app.Flag("sort", "with --list or --list-majors-only, order the majors descending (desc) or ascending (asc).").Default("desc").EnumVar(&o.listSort, "asc", "desc")
+	app.Flag("detailed", "with --list, add the revision, size and platforms of each latest version.").Default("false").BoolVar(&o.detailed)
+	app.Flag("compare-remote", "report how many newer patches and majors are published than the driver installed in --out; --format applies.").Default("false").BoolVar(&o.compareRemoteFlag)
+	app.Flag("installed", "with --list, show the chrome drivers found under --out instead.").Default("false").BoolVar(&o.isInstalled)
+	app.Flag("fail-if-missing", "when --version is not published, print 'version not found: <input>' to stderr and exit with status 3.").Default("false").BoolVar(&o.failMissing)
+	app.Flag("ensure", "skip the download when --out already holds a driver reporting the resolved version.").Default("false").BoolVar(&o.ensure)
+	app.Flag("driver-type", "specify for what to install next to the driver: chromedriver (only the driver) or chrome-headless-shell.").Default("chromedriver").EnumVar(&o.driverType, append([]string{"chromedriver"}, companionTypes...)...)
+	app.Flag("with-chrome", "also install the Chrome for Testing browser of the same version into --out.").Default("false").BoolVar(&o.withChrome)
+	app.Flag("tmpfs", "stage extraction in a memory-backed directory before moving the files into --out.").Default("false").BoolVar(&o.useTmpfs)
+	app.Flag("temp-dir", "specify for the directory downloads are staged in before extraction.").Default(".").StringVar(&o.tempDir)
+	app.Flag("tmpfs-dir", "specify for the staging directory of --tmpfs.").Default(defaultTmpfsDir).StringVar(&o.tmpfsDir)
+	app.Flag("output-layout", "specify for how drivers are laid out in --out: flat (the driver directly in --out, the default for one version), nested (as in the archive) or per-version (--out/<version>, the default for several).").EnumVar(&o.outputLayout, "flat", "nested", "per-version")
+	app.Flag("nest", "same as --output-layout=per-version.").Default("false").Hidden().BoolVar(&o.nest)
+	app.Flag("since-version", "install every published driver newer than this version, each into --out/<version>, skipping those already there.").PlaceHolder("VERSION").StringVar(&o.sinceVersion)
+	app.Flag("resume-batch", "with several --version values, skip versions already installed in their directory.").Default("false").BoolVar(&o.resumeBatch)
+	app.Flag("list-cache-ttl", "with --cache, use the cached version list for this long before fetching it again.").Default("1h").DurationVar(&o.listCacheTTL)
+	app.Flag("cache", "keep downloaded archives in --cache-dir and reuse them.").Default("false").BoolVar(&o.useCache)
+	app.Flag("cache-dir", "specify for the archive cache directory, also read from $GETCHROMEDRIVER_CACHE_DIR.").Default(defaultCacheDir()).Envar(envPrefix + "CACHE_DIR").StringVar(&o.cacheDir)
+	app.Flag("no-network", "fail any network request, so the run must be served entirely from --cache.").Default("false").BoolVar(&o.noNetwork)
+	app.Flag("manifest", "write a manifest.json describing the installed driver into --out.").Default("false").BoolVar(&o.manifest)
+	app.Flag("print-urls", "print the download URL of each requested driver, one per line, and download nothing.").Default("false").BoolVar(&o.printURLs)
+	app.Flag("print-driver-version", "print the full version each requested major resolves to, one per line, and download nothing.").Default("false").BoolVar(&o.printDriverVersion)
+	app.Flag("stdout", "write the raw zip archive to stdout instead of extracting it.").Default("false").BoolVar(&o.toStdout)
+	app.Flag("tar-stdout", "write the archive's files to stdout as a tar stream instead of extracting them to disk.").Default("false").BoolVar(&o.tarStdout)
+	app.Flag("platform", "specify for driver platform.").Default(defaultPlatform(runtime.GOOS, runtime.GOARCH)).Action(markSet(&o.platformSet)).EnumVar(&o.platform, platforms...)
+	app.Flag("open", "open the output directory in the file explorer after installing.").Default("false").BoolVar(&o.openOut)
+	app.Flag("no-temp", "extract small archives from memory without writing them to a temp file.").Default("false").BoolVar(&o.noTemp)
+	app.Flag("error-format", "specify for how failures are reported on stderr: text or json.").Default("text").EnumVar(&o.errorFormat, "text", "json")
+	app.Flag("wait-lock", "wait for another run installing to --out to finish instead of failing.").Default("false").BoolVar(&o.waitLock)
+	app.Flag("only-binary", "extract only the chromedriver binary.").Default("false").BoolVar(&o.onlyBinary)
+	app.Flag("exclude", "skip archive entries matching this glob, for example '*.txt'; repeatable.").StringsVar(&o.excludes)
+	app.Flag("write-checksum", "write the driver's SHA-256 to a .sha256 file next to it.").Default("false").BoolVar(&o.writeChecksum)
+	app.Flag("post-install", "run this shell command after installing, with CHROMEDRIVER_PATH set to the driver. It runs with your privileges, so only pass commands you trust.").StringVar(&o.postInstall)
+	app.Flag("scan-cmd", "run this shell command on each downloaded archive, named by CHROMEDRIVER_ARCHIVE, and extract it only if the command exits 0.").StringVar(&o.scanCmd)
+	app.Flag("add-gitignore", "when --out is in a git working tree, add the driver to its .gitignore instead of warning.").Default("false").BoolVar(&o.addGitignore)
+	app.Flag("mode", "set the permissions of the extracted driver to this octal mode, for example '0750'.").StringVar(&o.fileMode)
+	app.Flag("preserve-times", "give extracted files the modification times recorded in the archive; --no-preserve-times uses the time of extraction.").Default("true").BoolVar(&o.preserveTimes)
+	app.Flag("mode-all-files", "apply --mode to every extracted file, not only the driver.").Default("false").BoolVar(&o.modeAllFiles)
+	app.Flag("normalize-names", "rename the driver to chromedriver-<platform>-<arch>[.exe].").Default("false").BoolVar(&o.normalizeNames)
+	app.Flag("lockfile", "specify for the lockfile path written by --write-lock and read by verify.").Default(lockfileName).StringVar(&o.lockfilePath)
+	app.Flag("write-lock", "pin the installed driver's version and checksum in --lockfile.").Default("false").BoolVar(&o.writeLock)
+	app.Flag("allow-prerelease", "also list and resolve Beta, Dev and Canary drivers newer than Stable.").Default("false").BoolVar(&o.allowPrerelease)
+	app.Flag("summary-json", "write a JSON summary of each version and platform installed, with its status, duration, bytes and cache use, to this path.").StringVar(&o.summaryJSON)
+	app.Flag("report", "write a report of each version and platform installed, as junit=<path>.").StringVar(&o.report)
+	app.Flag("versions-file", "read more --version values from this file, one per line; '#' starts a comment.").ExistingFileVar(&o.versionsFile)
+	app.Flag("expect-chrome", "refuse a driver whose major differs from this Chrome version, such as the browser Selenium will drive.").StringVar(&o.expectChrome)
+	app.Flag("min-major", "refuse to install a driver older than this major version; 0 disables.").Default("0").IntVar(&o.minMajor)
+	app.Flag("strict", "fail on any warning, platform mismatch, prerelease or unverified download.").Default("false").BoolVar(&o.strict)
+	app.Flag("dry-run", "print what would be downloaded without downloading it.").Default("false").BoolVar(&o.dryRun)
+	app.Flag("check", "with --dry-run, confirm the archive is published and report its size.").Default("false").BoolVar(&o.checkExists)
+	app.Flag("platforms", "download for several platforms into <out>/<platform>: 'all' or a comma-separated list.").StringVar(&o.platformList)
+	app.Flag("arch", "specify for the CPU architecture, such as x64, x86 or arm64; without --platform it picks the build for the host OS.").StringVar(&o.arch)
+	app.Flag("auto-platform", "fall back to the other Windows build when the version lacks the requested one; implied without --platform.").Default("false").BoolVar(&o.autoPlat)
+	app.Flag("timeout", "specify for the time limit of each HTTP request, including the body download, also read from $GETCHROMEDRIVER_TIMEOUT.").Default("10m").Envar(envPrefix + "TIMEOUT").DurationVar(&o.timeout)
+	app.Flag("heartbeat-interval", "specify for how often a download reports progress when stderr is not a terminal; 0 disables.").Default("30s").DurationVar(&o.heartbeatInterval)
+	app.Flag("max-total-retries", "specify for how many retries the whole run may spend; -1 is unlimited.").Default("-1").IntVar(&o.maxTotalRetries)
+	app.Flag("deadline", "abort the whole run, downloads and extraction included, once it has taken this long, for example '10m'.").DurationVar(&o.deadline)
+	app.Flag("connect-timeout", "specify for the time limit to connect and receive response headers.").Default("30s").DurationVar(&o.connTimeout)
+	app.Flag("max-idle-conns", "specify for how many idle connections per host are kept for reuse.").Default("8").IntVar(&o.maxIdleConns)
+	app.Flag("ca-cert", "specify for a PEM CA bundle to trust for the --mirror and --list-url hosts instead of the system roots.").StringVar(&o.caCert)
+	app.Flag("insecure", "skip TLS certificate verification of the --mirror and --list-url hosts, for mirrors with broken certificates; prefer --ca-cert.").Default("false").BoolVar(&o.insecure)
+	app.Flag("pin-sha256", "only accept --mirror and --list-url hosts whose certificate public key has this SHA-256 hash (base64 or hex); repeatable.").StringsVar(&o.pinSHA256)
+	app.Flag("ip-version", "force connections over IPv4 or IPv6: auto, 4 or 6.").Default("auto").EnumVar(&o.ipVersion, "auto", "4", "6")
+	app.Flag("force-ipv-fallback", "when connecting over the chosen IP family fails, retry over the other one before counting it as a failed attempt.").BoolVar(&o.ipFallback)
+	app.Flag("mirror", "specify for a base URL to download drivers from instead of the Google hosts; repeat to fall back to further mirrors, tried fastest first with --cache. Also read from $GETCHROMEDRIVER_MIRROR, one per line.").Envar(envPrefix + "MIRROR").StringsVar(&o.mirrors)
+	app.Flag("source", "specify for where versions are looked up, most trusted first: a comma-separated list of json, html and bucket.").StringVar(&o.sourceNames)
+	app.Flag("list-url", "specify for a URL serving the Chrome for Testing version feed.").StringVar(&o.listURL)
+	app.Flag("auth-token", "send this bearer token to the --mirror and --list-url hosts.").StringVar(&o.authToken)
+	app.Flag("auth-header", "send this 'Name: value' header to the --mirror and --list-url hosts.").StringVar(&o.authHeader)
+	app.Flag("region", "pick a built-in mirror for the region, for example 'cn'. --mirror takes precedence.").StringVar(&o.region)
+	app.Flag("progress-min-size", "do not draw a download progress bar for archives smaller than this.").Default("1MB").BytesVar(&o.progressMinSize)
+	app.Flag("max-uncompressed-size", "refuse archives that unpack to more than this; 0 disables.").Default("2GB").BytesVar(&o.maxUncompressed)
+	app.Flag("max-compression-ratio", "refuse archives that unpack to more than this many times their compressed size; 0 disables.").Default("100").Float64Var(&o.maxRatio)
+	app.Flag("max-rate", "cap the download speed per second, for example '2MB'.").BytesVar(&o.maxRate)
+	app.Flag("chrome-binary", "install the driver for the Chrome at this path, going by its --version.").StringVar(&o.chromeBinary)
+	app.Flag("print-config", "print the settings the run would use, after flags, environment variables and defaults are combined, as JSON and exit.").BoolVar(&o.printCfg)
+	app.Flag("max-connections", "specify for how many archive downloads of a batch run at once; later versions are fetched while earlier ones extract.").Default("2").IntVar(&o.maxConnections)
+	app.Flag("extract-workers", "specify for how many archive entries to write at once, or auto to measure the output filesystem and choose.").Default(strconv.Itoa(runtime.NumCPU())).StringVar(&o.extractWorkers)
+	app.Flag("allowlist", "refuse driver versions not listed in this JSON file, as full versions or majors.").StringVar(&o.allowlistPath)
+	app.Flag("pins", "resolve a bare major --version to the full version this JSON file pins it to, instead of its latest patch.").StringVar(&o.pinsPath)
+	app.Flag("dedupe-storage", "hard-link files identical to ones installed earlier in the run instead of keeping copies.").BoolVar(&o.dedupeStorage)
+	app.Flag("force", "install even over a newer driver already in the output directory.").BoolVar(&o.force)
+	app.Flag("require-checksum", "refuse to download an archive no --checksum or --checksum-db entry is known for; the hash in a lockfile is of the binary and does not count.").BoolVar(&o.requireChecksum)
+	app.Flag("checksum-db", "verify archives against the checksums recorded in this JSON file, and record those of new downloads.").StringVar(&o.checksumDBPath)
+	app.Flag("sha256", "same as --checksum with --checksum-algo=sha256; deprecated.").StringVar(&o.sha256Sum)
+	app.Flag("checksum", "verify the downloaded archive against this checksum, of the kind --checksum-algo names.").StringVar(&o.checksum)
+	app.Flag("checksum-algo", "specify for the hash --checksum is of: sha256, sha1 or md5.").Default("sha256").EnumVar(&o.checksumAlgo, "sha256", "sha1", "md5")
+	app.Flag("retries", "specify for how many times a failed request is retried.").Default("3").IntVar(&o.retries)
+	app.Flag("retry-on", "retry requests answered with these HTTP statuses, comma-separated, instead of 429 and 5xx; for example '502,503,404'.").StringVar(&o.retryOn)
+	app.Flag("quiet-on-success", "print nothing unless the run fails, then print everything.").Default("false").BoolVar(&o.quietOK)
+	app.Flag("verbose", "print diagnostic messages to stderr.").Default("false").BoolVar(&o.verbose)
+	app.Flag("trace", "print DNS, connect, TLS and first-byte timings and response headers of each request to stderr.").Default("false").BoolVar(&o.trace)
 
-	finFunc, tempPath, err := createTemp(".", time.Now().Format(".2006010215030405"))
+	app.Command("get", "download and extract a chrome driver.").Default()
+	mapCmd := app.Command("map", "print each major's latest driver and its download URL per platform.")
+	mapCmd.Flag("go", "emit a Go source snippet instead of JSON.").Default("false").BoolVar(&o.mapAsGo)
+	matrixCmd := app.Command("compat-matrix", "print a CI strategy matrix of drivers across majors and platforms.")
+	matrixCmd.Flag("from", "specify for the oldest major to include.").IntVar(&o.matrixFrom)
+	matrixCmd.Flag("to", "specify for the newest major to include.").IntVar(&o.matrixTo)
+	matrixCmd.Flag("matrix-platform", "specify for a platform to include; repeatable, defaults to all.").EnumsVar(&o.matrixPlatforms, platforms...)
+	app.Command("list-platforms", "print the supported platforms, or with --version those it has a driver for.")
+	app.Command("verify", "check that the driver in --out matches --lockfile, without downloading.")
+	app.Command("repair", "reinstall the driver recorded in --out's manifest or --lockfile if it is missing or broken, from the cache when possible.")
+	validateCmd := app.Command("validate-zip", "list the entries of a driver archive and check it holds the driver, without extracting.")
+	validateCmd.Arg("archive", "a local zip or tar.gz, or a version whose cached archive to check.").Required().StringVar(&o.validateTarget)
+	app.Command("probe", "time fetching the driver archive, of --version or the latest, from the default host and each --mirror, and name the fastest.")
+	app.Command("plan", "resolve every --version on every --platforms entry and print, as JSON, what installing them into --out would take.")
+	applyCmd := app.Command("apply", "install the drivers of a plan written by the plan command.")
+	applyCmd.Arg("plan", "the plan file.").Required().StringVar(&o.applyPlanPath)
+	cacheCmd := app.Command("cache", "manage the archive cache.")
+	pruneCmd := cacheCmd.Command("prune", "remove cached archives not used recently.")
+	cacheCmd.Command("warm", "cache the version list and, with --version, driver archives, so later runs work offline.")
+	pruneCmd.Flag("older-than", "remove archives last used longer ago than this, for example '30d'.").Default("30d").StringVar(&o.olderThan)
+	return app
+}
+
+func main() {
+	c, err := newCLI(os.Args[1:], os.Stdout, os.Stderr)
 	if err != nil {
-		return "", err, nil
+		kingpin.Fatalf("%s, try --help", err)
+	}
+	var held bytes.Buffer
+	if c.quietOK {
+		c.stdout, c.stderr = &held, &held
+	}
+	if c.listFormat == "shell" {
+		// Only the export lines may reach stdout, or eval would run the
+		// tool's messages.
+		c.stdout = c.stderr
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	ctx, caught := interruptContext()
+	result, err := c.run(ctx)
 	if err != nil {
-		return "", err, finFunc
+		os.Stderr.Write(held.Bytes())
+		if sig := caught(); sig != nil {
+			fmt.Fprintf(os.Stderr, "interrupted (%s): %v\n", sig, err)
+			os.Exit(signalExitCode(sig))
+		}
+		if c.errorFormat == "json" {
+			writeJSONError(os.Stderr, err)
+		} else if c.failMissing && errors.Is(err, ErrVersionNotFound) {
+			fmt.Fprintln(os.Stderr, err)
+		} else {
+			kingpin.Errorf("%s", err)
+		}
+		os.Exit(exitCode(err))
+	}
+	if c.verbose {
+		printResult(c.stderr, result)
 	}
+}
 
-	zipFilePath := tempPath + string(os.PathSeparator) + baseName
-	z, err := os.Create(zipFilePath)
+// run carries out the command line and describes what it did.
+func (c *cli) run(ctx context.Context) (*RunResult, error) {
+	if err := c.expandPathFlags(); err != nil {
+		return nil, err
+	}
+	d, err := c.newDownloaderFromFlags()
 	if err != nil {
-		return "", err, finFunc
+		return nil, err
 	}
-	defer z.Close()
-
-	if _, err := z.Write(body); err != nil {
-		return "", err, finFunc
+	record := &runRecord{}
+	c.record = record
+	if c.printCfg {
+		return &record.result, c.printConfig(c.stdout, d)
 	}
-
-	return zipFilePath, nil, finFunc
+	// --deadline bounds the run as a whole: every request, wait and
+	// extraction stops once it passes, not just the retries.
+	if c.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.deadline)
+		defer cancel()
+	}
+	d.Context = ctx
+	d.Stats = &TransferStats{}
+	start := time.Now()
+	err = c.runCommand(d)
+	record.result.finish(d.Stats, start)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = c.deadlineError(err)
+	}
+	return &record.result, err
 }
 
-func showList() {
-	majors, versions := getChromeVersions(false)
-
-	fmt.Println("Specifiable chrome driver versions.")
-	fmt.Printf("Major\tLatest\n")
-	for _, major := range majors {
-		fmt.Printf("%s\t%s\n", major, versions[major][0])
+// deadlineError reports that err came of --deadline passing, listing the
+// installs that completed before it did.
+func (c *cli) deadlineError(err error) error {
+	var done []string
+	for _, rc := range c.record.cases {
+		if rc.Err == nil && !rc.Skipped && rc.Version != "" {
+			done = append(done, rc.Version+" ("+rc.Platform+")")
+		}
+	}
+	completed := "nothing was installed"
+	if len(done) > 0 {
+		completed = "installed before it: " + strings.Join(done, ", ")
 	}
-	return
+	msg := fmt.Sprintf("--deadline of %s passed; %s", c.deadline, completed)
+	if errors.Is(err, ErrBudgetExhausted) {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	return fmt.Errorf("%s: %w: %v", msg, ErrBudgetExhausted, err)
 }
 
-func getChromeVersions(isLatest bool) ([]string, map[string][]string) {
-	resp, err := http.Get("https://chromedriver.chromium.org/downloads")
-	if err != nil {
-		panic(err)
+func (c *cli) runCommand(d *Downloader) error {
+	switch c.command {
+	case "map":
+		return showMap(d, c.stdout, c.mapAsGo)
+	case "compat-matrix":
+		return showMatrix(d, c.stdout, c.matrixFrom, c.matrixTo, c.matrixPlatforms)
+	case "list-platforms":
+		spec := ""
+		if len(c.specVersions) > 0 {
+			spec = c.specVersions[0]
+		}
+		return showPlatforms(d, c.stdout, spec)
+	case "verify":
+		return verifyLock(c.stdout, c.lockfilePath, c.outputPath)
+	case "repair":
+		return c.repair(d, c.stdout, c.outputPath)
+	case "probe":
+		spec := ""
+		if len(c.specVersions) > 0 {
+			spec = c.specVersions[0]
+		}
+		return c.probe(d, c.stdout, spec)
+	case "plan":
+		return c.writePlan(d, c.stdout)
+	case "apply":
+		return c.applyPlan(d, c.stdout, c.applyPlanPath)
+	case "validate-zip":
+		return c.validateZip(d, c.stdout, c.validateTarget)
+	case "cache prune":
+		return c.prune(c.cacheDir, c.olderThan)
+	case "cache warm":
+		return c.warm(d)
 	}
-	defer resp.Body.Close()
+	return c.get(d)
+}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+// defaultTmpfsDir is the memory-backed directory most Linux systems mount.
+const defaultTmpfsDir = "/dev/shm"
+
+// newDownloaderFromFlags builds a Downloader configured by the command line.
+func (c *cli) newDownloaderFromFlags() (*Downloader, error) {
+	d := NewDownloader()
+	d.Platform = c.platform
+	d.TempDir = c.tempDir
+	if c.arch != "" {
+		// Without --platform the arch picks the build for the host's OS.
+		goos := platformOS[c.platform]
+		if !c.platformSet {
+			goos = runtime.GOOS
+		}
+		p, err := platformFor(goos, c.arch)
+		if err != nil {
+			return nil, fmt.Errorf("--arch: %w", err)
+		}
+		if c.platformSet && p != c.platform {
+			return nil, fmt.Errorf("--arch %s does not match --platform %s, which is built for %s", c.arch, c.platform, platformArch[c.platform])
+		}
+		c.platform, c.platformSet = p, true
+		d.Platform = p
+	}
+	// The default platform is only a guess, so it may fall back too.
+	d.AutoPlatform = c.autoPlat || !c.platformSet
+	d.Client.Timeout = c.timeout
+	if c.sha256Sum != "" {
+		if c.checksum != "" {
+			return nil, fmt.Errorf("--sha256 and --checksum cannot both be given; use --checksum")
+		}
+		if c.checksumAlgo != "sha256" {
+			return nil, fmt.Errorf("--sha256 is always a SHA-256 checksum, not %s; use --checksum with --checksum-algo=%s", c.checksumAlgo, c.checksumAlgo)
+		}
+		c.checksum = c.sha256Sum
+	}
+	if c.checksum != "" {
+		if err := validateChecksum(c.checksumAlgo, c.checksum); err != nil {
+			return nil, err
+		}
+	}
+	d.Checksum = c.checksum
+	d.ChecksumAlgo = c.checksumAlgo
+	d.Retries = c.retries
+	if c.retryOn != "" {
+		codes, err := parseRetryOn(c.retryOn)
+		if err != nil {
+			return nil, err
+		}
+		d.RetryStatuses = codes
+	}
+	if c.maxTotalRetries >= 0 || c.deadline > 0 {
+		d.Budget = newRetryBudget(c.maxTotalRetries, c.deadline)
+	}
+	d.Verbose = c.verbose
+	d.Trace = c.trace
+	d.Log = c.stderr
+	d.Strict = c.strict
+	if c.sourceNames != "" {
+		sources, err := parseSources(d, c.sourceNames)
+		if err != nil {
+			return nil, err
+		}
+		d.Sources = sources
+		d.MilestonesURL = ""
+	}
+	d.AllowPrerelease = c.allowPrerelease
+	d.OnlyBinary = c.onlyBinary
+	for _, pattern := range c.excludes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("--exclude %q: %w", pattern, err)
+		}
+	}
+	d.Exclude = c.excludes
+	d.PreserveTimes = c.preserveTimes
+	d.MaxUncompressedSize = int64(c.maxUncompressed)
+	d.MaxCompressionRatio = c.maxRatio
+	if c.fileMode != "" {
+		mode, err := parseFileMode(c.fileMode)
+		if err != nil {
+			return nil, err
+		}
+		d.Mode = mode
+		d.ModeAllFiles = c.modeAllFiles
+	}
+	if !c.quietOK && isTerminal(os.Stderr) {
+		d.Progress = os.Stderr
+		d.ProgressMinSize = int64(c.progressMinSize)
+	} else {
+		d.Heartbeat = c.heartbeatInterval
+	}
+	if c.useCache {
+		d.CacheDir = c.cacheDir
+		d.ListCacheTTL = c.listCacheTTL
+	}
+	if c.useTmpfs {
+		if info, err := os.Stat(c.tmpfsDir); err == nil && info.IsDir() {
+			d.StageDir = c.tmpfsDir
+		} else {
+			d.verbosef("%s is not available, staging in %s\n", c.tmpfsDir, d.TempDir)
+			d.StageDir = d.TempDir
+		}
+	}
+	workers, err := parseWorkers(c.extractWorkers)
 	if err != nil {
-		panic(err)
-	}
-
-	s := doc.Find(".XqQF9c")
-
-	versionMap := make(map[string][]string)
-	loopCnt := s.Size()
-	if isLatest {
-		loopCnt = 3
-	}
-	for i := 0; i < loopCnt; i++ {
-		for _, attr := range s.Get(i).Attr {
-			if strings.EqualFold(attr.Key, "href") {
-				if strings.Contains(attr.Val, "https://chromedriver.storage.googleapis.com/index.html?") {
-					versions := strings.Split(attr.Val, "=")
-					if len(versions) == 2 {
-						version := strings.Replace(versions[1], "/", "", -1)
-						reg, err := regexp.Compile(`^\d{1,3}`)
-						if err != nil {
-							panic(err)
-						}
-						majorVersion := reg.FindString(version)
-						versionMap[majorVersion] = append(versionMap[majorVersion], version)
-					}
-				}
+		return nil, err
+	}
+	d.ExtractWorkers = workers
+	d.MaxRate = int64(c.maxRate)
+	if len(c.mirrors) > 0 {
+		d.Mirror, d.Mirrors = c.mirrors[0], c.mirrors[1:]
+	}
+	if d.Mirror == "" && c.region != "" {
+		if m, ok := regionMirror(c.region); ok {
+			d.Mirror = m
+		} else {
+			if err := d.warnf("no mirror is known for region %q, using the default host", c.region); err != nil {
+				return nil, err
 			}
-			continue
 		}
 	}
-
-	var keysInt []int
-	for key, _ := range versionMap {
-		ki, err := strconv.Atoi(key)
-		if err != nil {
-			panic(err)
+	for _, m := range c.mirrors {
+		if _, err := normalizeBaseURL(m); err != nil {
+			return nil, fmt.Errorf("--mirror: %w", err)
 		}
-		keysInt = append(keysInt, ki)
-		sort.Sort(sort.Reverse(sort.StringSlice(versionMap[key])))
 	}
-	sort.Sort(sort.Reverse(sort.IntSlice(keysInt)))
+	if c.listURL != "" {
+		if _, err := normalizeBaseURL(c.listURL); err != nil {
+			return nil, fmt.Errorf("--list-url: %w", err)
+		}
+		d.FeedURL = c.listURL
+		d.MilestonesURL = ""
+	}
+	mirrorURLs := append([]string{d.Mirror, c.listURL}, d.Mirrors...)
+	transport, err := newTransport(transportOptions{
+		ConnectTimeout:      c.connTimeout,
+		IPVersion:           c.ipVersion,
+		IPFallback:          c.ipFallback,
+		Logf:                d.verbosef,
+		MaxIdleConnsPerHost: c.maxIdleConns,
+		CACert:              c.caCert,
+		PinSHA256:           c.pinSHA256,
+		Insecure:            c.insecure,
+		MirrorURLs:          mirrorURLs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.insecure {
+		if err := d.warnf("--insecure is set: TLS certificates of the --mirror and --list-url hosts are NOT verified, so downloads from them can be tampered with"); err != nil {
+			return nil, err
+		}
+	}
+	d.Client.CheckRedirect = redirectPolicy(c.authHeader)
+	d.Client.Transport = newAuthTransport(transport, c.authToken, c.authHeader, mirrorURLs...)
+	if c.noNetwork {
+		d.Client.Transport = noNetworkTransport{}
+	}
+	return d, nil
+}
 
-	var keys []string
-	for _, val := range keysInt {
-		keys = append(keys, strconv.Itoa(val))
+// printUsageHint shows w the common ways to run the tool, for a command
+// line that names no version and has no terminal to pick one on.
+func (c *cli) printUsageHint(w io.Writer) {
+	name := c.name
+	fmt.Fprintf(w, "usage: %s [--version=VERSION ...] [--latest] [--out=DIR] [<flags>]\n", name)
+	fmt.Fprintf(w, "  %s --latest         install the newest driver\n", name)
+	fmt.Fprintf(w, "  %s --version=120    install the newest driver of major 120\n", name)
+	fmt.Fprintf(w, "  %s --list           show the versions that can be installed\n", name)
+	fmt.Fprintf(w, "  %s --help           show every flag\n", name)
+}
+
+// markSet returns a flag action recording in set that the flag was given on
+// the command line rather than left at its default.
+func markSet(set *bool) kingpin.Action {
+	return func(*kingpin.ParseContext) error {
+		*set = true
+		return nil
 	}
-	return keys, versionMap
 }
 
-func createTemp(dir, patterns string) (func() error, string, error) {
-	tmp, err := os.MkdirTemp(dir, patterns)
-	if err != nil {
-		return nil, "", err
+// parseFileMode parses --mode, an octal permission string such as "0750".
+func parseFileMode(s string) (os.FileMode, error) {
+	n, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || n == 0 || n > 0777 {
+		return 0, fmt.Errorf("invalid --mode %q: want octal permissions between 0001 and 0777", s)
 	}
+	return os.FileMode(n), nil
+}
 
-	return func() error {
-		return os.RemoveAll(tmp)
-	}, tmp, nil
+// expandPath expands a leading "~" to the home directory and then $VAR and
+// ${VAR} references, so path flags work unquoted in a shell and quoted alike.
+func expandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("expanding %s: %w", path, err)
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return os.ExpandEnv(path), nil
 }
 
-func unzip(src, dest string) error {
-	zipped, err := zip.OpenReader(src)
-	if err != nil {
-		return err
-	}
-	defer zipped.Close()
-
-	wg := &sync.WaitGroup{}
-	for _, zippedFile := range zipped.File {
-		wg.Add(1)
-
-		go func() {
-			defer func() {
-				switch recover() {
-				default:
-					wg.Done()
-				}
-			}()
-			f, err := zippedFile.Open()
-			if err != nil {
-				panic(err)
-			}
-			defer f.Close()
-
-			if zippedFile.FileInfo().IsDir() {
-				path := filepath.Join(dest, zippedFile.Name)
-				os.MkdirAll(path, zippedFile.Mode())
-			} else {
-				buf := make([]byte, zippedFile.UncompressedSize64)
-				_, err = io.ReadFull(f, buf)
-				if err != nil {
-					panic(err)
-				}
-
-				path := filepath.Join(dest, zippedFile.Name)
-				err := ioutil.WriteFile(path, buf, zippedFile.Mode())
-				if err != nil {
-					panic(err)
-				}
-			}
-		}()
+// expandPathFlags applies expandPath to --out, --cache-dir, --temp-dir and
+// --tmpfs-dir.
+func (c *cli) expandPathFlags() error {
+	for _, p := range []*string{&c.outputPath, &c.cacheDir, &c.tempDir, &c.tmpfsDir} {
+		if *p == "-" {
+			continue
+		}
+		expanded, err := expandPath(*p)
+		if err != nil {
+			return err
+		}
+		*p = expanded
 	}
-	wg.Wait()
 	return nil
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuietOnSuccess(t *testing.T) {
+	s := newTestServer(t)
+	stdout, stderr, code := runMain(t, s.args(t, t.TempDir(), "--quiet-on-success", "-v", "115")...)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if stdout != "" || stderr != "" {
+		t.Errorf("a successful run printed %q and %q", stdout, stderr)
+	}
+
+	stdout, stderr, code = runMain(t, s.args(t, t.TempDir(), "--quiet-on-success", "-v", "999")...)
+	if code != exitVersionNotFound {
+		t.Errorf("exit code %d, want %d", code, exitVersionNotFound)
+	}
+	if stderr == "" {
+		t.Error("a failed run printed nothing")
+	}
+
+	// Without the flag the same successful run reports what it did.
+	stdout, stderr, _ = runMain(t, s.args(t, t.TempDir(), "-v", "115")...)
+	if stdout+stderr == "" {
+		t.Error("a run without --quiet-on-success printed nothing")
+	}
+}
+
+func TestFailIfMissing(t *testing.T) {
+	s := newTestServer(t)
+	for _, spec := range []string{"999", "115.0.5790.1"} {
+		stdout, stderr, code := runMain(t, s.args(t, t.TempDir(), "--fail-if-missing", "-v", spec)...)
+		if code != exitVersionNotFound {
+			t.Errorf("%s: exit code %d, want %d", spec, code, exitVersionNotFound)
+		}
+		if !strings.HasPrefix(stderr, "version not found: "+spec) || strings.Count(stderr, "\n") != 1 {
+			t.Errorf("%s: printed %q, want a single version not found line", spec, stderr)
+		}
+		if stdout != "" {
+			t.Errorf("%s: printed %q to stdout", spec, stdout)
+		}
+	}
+}
+
+func TestErrorFormatJSON(t *testing.T) {
+	s := newTestServer(t)
+	_, stderr, code := runMain(t, s.args(t, t.TempDir(), "--error-format", "json", "-v", "999")...)
+	if code != exitVersionNotFound {
+		t.Errorf("exit code %d, want %d", code, exitVersionNotFound)
+	}
+	if strings.Count(stderr, "\n") != 1 {
+		t.Fatalf("printed %q, want a single JSON line", stderr)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(stderr), &got); err != nil {
+		t.Fatalf("printed %q: %v", stderr, err)
+	}
+	want := map[string]interface{}{
+		"code":    float64(exitVersionNotFound),
+		"version": "999",
+		"phase":   "resolve",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if msg, _ := got["message"].(string); !strings.Contains(msg, "version not found") {
+		t.Errorf("message = %q, want the version not found error", msg)
+	}
+}
+
+func TestExpandPath(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("USERPROFILE", os.Getenv("HOME"))
+	t.Setenv("DRIVERS", "/opt/drivers")
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct{ path, want string }{
+		{"~", home},
+		{"~/drivers", filepath.Join(home, "drivers")},
+		{"$HOME/drivers", os.Getenv("HOME") + "/drivers"},
+		{"${DRIVERS}/115", "/opt/drivers/115"},
+		{"$DRIVERS", "/opt/drivers"},
+		{"drivers/~", "drivers/~"},
+		{"~other/drivers", "~other/drivers"},
+		{"./drivers", "./drivers"},
+	} {
+		got, err := expandPath(test.path)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s expanded to %s, want %s", test.path, got, test.want)
+		}
+	}
+}
+
+func TestOutExpanded(t *testing.T) {
+	skipOnWindows(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	s := newTestServer(t)
+	args := setFlag(s.args(t, t.TempDir(), "-v", "115"), "out", "~/drivers")
+	args = setFlag(args, "temp-dir", "$HOME/tmp")
+	if err := os.Mkdir(filepath.Join(home, "tmp"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runCLI(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	if !isInstalledIn(filepath.Join(home, "drivers"), "115.0.5790.102") {
+		t.Error("--out=~/drivers did not install into the home directory")
+	}
+	if _, err := os.Stat("~"); err == nil {
+		t.Error("made a literal ~ directory")
+	}
+}
+
+func TestEnvConfig(t *testing.T) {
+	parse := func(args ...string) *cli {
+		t.Helper()
+		c, err := newCLI(args, &bytes.Buffer{}, &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	t.Setenv(envPrefix+"MIRROR", "https://one.example/cd\nhttps://two.example/cd")
+	t.Setenv(envPrefix+"CACHE_DIR", "/env/cache")
+	t.Setenv(envPrefix+"TIMEOUT", "42s")
+
+	c := parse()
+	if want := []string{"https://one.example/cd", "https://two.example/cd"}; !reflect.DeepEqual(c.mirrors, want) {
+		t.Errorf("mirrors %q, want %q from the environment", c.mirrors, want)
+	}
+	if c.cacheDir != "/env/cache" {
+		t.Errorf("cache dir %q, want /env/cache from the environment", c.cacheDir)
+	}
+	if c.timeout != 42*time.Second {
+		t.Errorf("timeout %s, want 42s from the environment", c.timeout)
+	}
+
+	// Flags win over the environment.
+	c = parse("--mirror", "https://flag.example/cd", "--cache-dir", "/flag/cache", "--timeout", "5s")
+	if want := []string{"https://flag.example/cd"}; !reflect.DeepEqual(c.mirrors, want) {
+		t.Errorf("mirrors %q, want the flag's %q", c.mirrors, want)
+	}
+	if c.cacheDir != "/flag/cache" {
+		t.Errorf("cache dir %q, want the flag's /flag/cache", c.cacheDir)
+	}
+	if c.timeout != 5*time.Second {
+		t.Errorf("timeout %s, want the flag's 5s", c.timeout)
+	}
+
+	// And the environment over the defaults.
+	os.Unsetenv(envPrefix + "TIMEOUT")
+	if c = parse(); c.timeout != 10*time.Minute {
+		t.Errorf("timeout %s without the variable, want the default 10m", c.timeout)
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	t.Setenv(envPrefix+"TIMEOUT", "42s")
+	t.Setenv(envPrefix+"CACHE_DIR", "/env/cache")
+	print := func(args ...string) effectiveConfig {
+		t.Helper()
+		stdout, _, err := runCLI(t, append([]string{"--print-config"}, args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var cfg effectiveConfig
+		if err := json.Unmarshal([]byte(stdout), &cfg); err != nil {
+			t.Fatalf("printed %q: %v", stdout, err)
+		}
+		return cfg
+	}
+
+	cfg := print("--platform", "mac-arm64", "--out", "drivers", "--retries", "5", "-v", "115")
+	if cfg.Timeout != "42s" || cfg.CacheDir != absOr("/env/cache") {
+		t.Errorf("timeout %s and cache dir %s, want the environment's 42s and /env/cache", cfg.Timeout, cfg.CacheDir)
+	}
+	if cfg.Platform != "mac-arm64" || cfg.Arch != "arm64" || cfg.Retries != 5 || !reflect.DeepEqual(cfg.Versions, []string{"115"}) {
+		t.Errorf("printed %+v, want the flags' settings", cfg)
+	}
+	if wd, _ := os.Getwd(); cfg.Out != filepath.Join(wd, "drivers") {
+		t.Errorf("out %s, want drivers made absolute", cfg.Out)
+	}
+
+	// A flag wins over its environment variable.
+	if cfg = print("--timeout", "5s", "--cache-dir", "/flag/cache"); cfg.Timeout != "5s" || cfg.CacheDir != absOr("/flag/cache") {
+		t.Errorf("timeout %s and cache dir %s, want the flags' 5s and /flag/cache", cfg.Timeout, cfg.CacheDir)
+	}
+}
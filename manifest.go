@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const manifestName = "manifest.json"
+
+// schemaVersion is stamped into the JSON documents the tool emits. It is
+// bumped whenever a field changes meaning or goes away.
+const schemaVersion = 1
+
+// Manifest describes an installed driver for auditing.
+type Manifest struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	Version       string    `json:"version"`
+	Platform      string    `json:"platform"`
+	Arch          string    `json:"arch"`
+	Binary        string    `json:"binary"`
+	SHA256        string    `json:"sha256"`
+	ArchiveSHA256 string    `json:"archiveSha256"`
+	URL           string    `json:"url"`
+	InstalledAt   time.Time `json:"installedAt"`
+}
+
+// PlatformsManifest lists the drivers a --platforms run installed, one per
+// platform, each as described in its own directory's manifest.
+type PlatformsManifest struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	Version       string      `json:"version"`
+	Platforms     []*Manifest `json:"platforms"`
+}
+
+// writePlatformsManifest writes the manifest listing manifests into dir.
+func writePlatformsManifest(dir string, manifests []*Manifest) error {
+	pm := &PlatformsManifest{
+		SchemaVersion: schemaVersion,
+		Version:       manifests[0].Version,
+		Platforms:     manifests,
+	}
+	if err := writeJSONAtomic(filepath.Join(dir, manifestName), pm); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
+
+// newManifest describes release installed as the binary at path.
+func newManifest(release *Release, binary string) (*Manifest, error) {
+	sum, err := fileSHA256(binary)
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(binary)
+	if err != nil {
+		return nil, err
+	}
+	return &Manifest{
+		SchemaVersion: schemaVersion,
+		Version:       release.Version,
+		Platform:      release.Platform,
+		Arch:          platformArch[release.Platform],
+		Binary:        abs,
+		SHA256:        sum,
+		ArchiveSHA256: release.SHA256,
+		URL:           release.URL,
+		InstalledAt:   time.Now().UTC(),
+	}, nil
+}
+
+// readManifest reads the manifest of the driver installed in dir.
+func readManifest(dir string) (*Manifest, error) {
+	b, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// writeJSONAtomic writes v as indented JSON to path through a temporary
+// file of its own, so readers never see a half-written document and
+// concurrent writers never share one.
+func writeJSONAtomic(path string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
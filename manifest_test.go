@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestManifest(t *testing.T) {
+	s := newTestServer(t)
+	out := t.TempDir()
+	start := time.Now().UTC()
+	if _, _, err := runCLI(t, s.args(t, out, "--manifest", "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	m, err := readManifest(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := os.ReadFile(m.Binary)
+	if err != nil {
+		t.Fatalf("reading the manifest's binary: %v", err)
+	}
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	want := Manifest{
+		SchemaVersion: schemaVersion,
+		Version:       "115.0.5790.102",
+		Platform:      "linux64",
+		Arch:          "amd64",
+		Binary:        m.Binary,
+		SHA256:        sha256Hex(binary),
+		ArchiveSHA256: sha256Hex(archive),
+		URL:           s.archiveURL("115.0.5790.102", "linux64"),
+		InstalledAt:   m.InstalledAt,
+	}
+	if *m != want {
+		t.Errorf("manifest %+v, want %+v", *m, want)
+	}
+	if string(binary) != testDriver("115.0.5790.102") {
+		t.Errorf("manifest names %s, which is not the installed driver", m.Binary)
+	}
+	if m.InstalledAt.Before(start.Add(-time.Second)) || m.InstalledAt.After(time.Now().Add(time.Second)) {
+		t.Errorf("installed at %s, not during the run", m.InstalledAt)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	s := newTestServer(t)
+	out := t.TempDir()
+	lock := filepath.Join(t.TempDir(), lockfileName)
+	if _, _, err := runCLI(t, s.args(t, out, "--manifest", "--write-lock", "--lockfile", lock, "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	list, _, err := runCLI(t, s.args(t, t.TempDir(), "--list", "--format", "json")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errorJSON, _ := runMain(t, s.args(t, t.TempDir(), "--error-format", "json", "-v", "999")...)
+	manifest, _ := os.ReadFile(filepath.Join(out, manifestName))
+	lockfile, _ := os.ReadFile(lock)
+
+	var entries []map[string]interface{}
+	if err := json.Unmarshal([]byte(list), &entries); err != nil || len(entries) == 0 {
+		t.Fatalf("parsing the list %q: %v", list, err)
+	}
+	for name, doc := range map[string][]byte{
+		"manifest": manifest,
+		"lockfile": lockfile,
+		"error":    []byte(errorJSON),
+	} {
+		var v struct {
+			SchemaVersion *int `json:"schemaVersion"`
+		}
+		if err := json.Unmarshal(doc, &v); err != nil {
+			t.Errorf("%s: parsing %q: %v", name, doc, err)
+		} else if v.SchemaVersion == nil || *v.SchemaVersion != schemaVersion {
+			t.Errorf("%s %s has no schemaVersion %d", name, doc, schemaVersion)
+		}
+	}
+	for _, entry := range entries {
+		if entry["schemaVersion"] != float64(schemaVersion) {
+			t.Errorf("list entry %v has no schemaVersion", entry)
+		}
+	}
+}
+
+func TestPlatformsManifest(t *testing.T) {
+	s := newTestServer(t)
+	out := t.TempDir()
+	args := s.args(t, out, "--manifest", "--platforms", "linux64,mac-arm64", "-v", "115.0.5790.102")
+	if _, _, err := runCLI(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(out, manifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pm PlatformsManifest
+	if err := json.Unmarshal(b, &pm); err != nil {
+		t.Fatalf("parsing %s: %v", b, err)
+	}
+	if pm.Version != "115.0.5790.102" || len(pm.Platforms) != 2 {
+		t.Fatalf("manifest %s, want both platforms of 115.0.5790.102", b)
+	}
+	for i, platform := range []string{"linux64", "mac-arm64"} {
+		m := pm.Platforms[i]
+		if m.Platform != platform {
+			t.Errorf("platform %d is %s, want %s", i, m.Platform, platform)
+			continue
+		}
+		if want := filepath.Join(out, platform, "chromedriver"); m.Binary != want {
+			t.Errorf("%s binary %s, want %s", platform, m.Binary, want)
+		}
+		binary, err := os.ReadFile(m.Binary)
+		if err != nil {
+			t.Errorf("%s: %v", platform, err)
+			continue
+		}
+		if m.SHA256 != sha256Hex(binary) {
+			t.Errorf("%s sha256 %s, want that of %s", platform, m.SHA256, m.Binary)
+		}
+		archive := testArchive(t, "chromedriver-"+platform+".zip", "115.0.5790.102", platform)
+		if m.ArchiveSHA256 != sha256Hex(archive) || m.URL != s.archiveURL("115.0.5790.102", platform) {
+			t.Errorf("%s archive %s from %s, want that of %s", platform, m.ArchiveSHA256, m.URL, s.archiveURL("115.0.5790.102", platform))
+		}
+	}
+
+	// A run failing on its second platform leaves no combined manifest.
+	s.mux.HandleFunc("/dl/115.0.5790.102/mac-arm64/", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	if _, _, err := runCLI(t, append(args, "--force")...); err == nil {
+		t.Fatal("the failing platform did not fail the run")
+	}
+	if _, err := os.Stat(filepath.Join(out, manifestName)); !os.IsNotExist(err) {
+		t.Errorf("a failed run left the combined manifest: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+)
+
+// mapEntry pairs a major with its latest driver and that driver's download
+// URL on every platform it is published for.
+type mapEntry struct {
+	Version string            `json:"version"`
+	URLs    map[string]string `json:"urls"`
+}
+
+// versionMap builds the major to latest driver table across all platforms.
+func versionMap(d *Downloader) (map[string]mapEntry, error) {
+	list, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(map[string]mapEntry)
+	for _, major := range list.Majors {
+		version := list.Versions[major][0]
+		table[major] = mapEntry{Version: version, URLs: platformURLs(d, version, list)}
+	}
+	return table, nil
+}
+
+// platformURLs resolves version on every known platform, leaving out those
+// it has no driver for.
+func platformURLs(d *Downloader, version string, list *VersionList) map[string]string {
+	urls := make(map[string]string)
+	for _, p := range platforms {
+		pd := *d
+		pd.Platform = p
+		pd.AutoPlatform = false
+		if release, err := pd.release(version, list); err == nil {
+			urls[p] = release.URL
+		}
+	}
+	return urls
+}
+
+func showMap(d *Downloader, w io.Writer, asGo bool) error {
+	table, err := versionMap(d)
+	if err != nil {
+		return err
+	}
+
+	if !asGo {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(table)
+	}
+
+	src, err := goVersionMap(table)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// goVersionMap renders table as a gofmt'ed DriverVersions declaration for
+// embedding in another project.
+func goVersionMap(table map[string]mapEntry) ([]byte, error) {
+	var majors []string
+	for major := range table {
+		majors = append(majors, major)
+	}
+	sortVersions(majors)
+
+	var buf bytes.Buffer
+	fmt.Fprintln(&buf, "// DriverVersions maps a Chrome major version to its latest chromedriver")
+	fmt.Fprintln(&buf, "// and the driver's download URL per platform.")
+	fmt.Fprintln(&buf, "var DriverVersions = map[string]struct {")
+	fmt.Fprintln(&buf, "Version string")
+	fmt.Fprintln(&buf, "URLs map[string]string")
+	fmt.Fprintln(&buf, "}{")
+	for _, major := range majors {
+		entry := table[major]
+		fmt.Fprintf(&buf, "%q: {Version: %q, URLs: map[string]string{\n", major, entry.Version)
+
+		var plats []string
+		for p := range entry.URLs {
+			plats = append(plats, p)
+		}
+		sort.Strings(plats)
+		for _, p := range plats {
+			fmt.Fprintf(&buf, "%q: %q,\n", p, entry.URLs[p])
+		}
+		fmt.Fprintln(&buf, "}},")
+	}
+	fmt.Fprintln(&buf, "}")
+
+	return format.Source(buf.Bytes())
+}
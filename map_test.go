@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShowMapJSON(t *testing.T) {
+	s := newTestServer(t)
+	var out bytes.Buffer
+	if err := showMap(s.downloader(), &out, false); err != nil {
+		t.Fatal(err)
+	}
+	var table map[string]mapEntry
+	if err := json.Unmarshal(out.Bytes(), &table); err != nil {
+		t.Fatalf("parsing %s: %v", out.Bytes(), err)
+	}
+	if len(table) != 2 {
+		t.Errorf("mapped majors %v, want 115 and 116", table)
+	}
+	want := mapEntry{Version: testStable, URLs: map[string]string{}}
+	for _, p := range []string{"win64", "linux64", "mac-x64", "mac-arm64"} {
+		want.URLs[p] = s.archiveURL(testStable, p)
+	}
+	if !reflect.DeepEqual(table["116"], want) {
+		t.Errorf("116 mapped to %+v, want %+v", table["116"], want)
+	}
+	if got := table["115"]; got.Version != "115.0.5790.102" || len(got.URLs) != len(platforms) {
+		t.Errorf("115 mapped to %+v, want 115.0.5790.102 on every platform", got)
+	}
+}
+
+func TestShowMapGo(t *testing.T) {
+	s := newTestServer(t)
+	var out bytes.Buffer
+	if err := showMap(s.downloader(), &out, true); err != nil {
+		t.Fatal(err)
+	}
+	src := "package drivers\n\n" + out.String()
+	if formatted, err := format.Source([]byte(src)); err != nil || string(formatted) != src {
+		t.Errorf("the snippet is not gofmt'ed: %v\n%s", err, out.String())
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "drivers.go", src, 0)
+	if err != nil {
+		t.Fatalf("parsing the snippet: %v\n%s", err, out.String())
+	}
+	if len(f.Decls) != 1 {
+		t.Fatalf("the snippet declares %d things, want DriverVersions alone", len(f.Decls))
+	}
+	spec := f.Decls[0].(*ast.GenDecl).Specs[0].(*ast.ValueSpec)
+	if spec.Names[0].Name != "DriverVersions" {
+		t.Errorf("the snippet declares %s", spec.Names[0].Name)
+	}
+	if entries := spec.Values[0].(*ast.CompositeLit).Elts; len(entries) != 2 {
+		t.Errorf("the snippet maps %d majors, want 2", len(entries))
+	}
+	if !strings.Contains(out.String(), `"116": {Version: "`+testStable+`"`) {
+		t.Errorf("the snippet lacks 116:\n%s", out.String())
+	}
+}
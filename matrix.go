@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// matrixEntry is one include of a CI strategy matrix.
+type matrixEntry struct {
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+	Arch     string `json:"arch"`
+	URL      string `json:"url"`
+}
+
+// compatMatrix lists the latest driver of every major from from to to,
+// inclusive, on each of plats. Zero bounds are open. Majors without a driver
+// for a platform are left out for that platform.
+func compatMatrix(d *Downloader, from, to int, plats []string) ([]matrixEntry, error) {
+	list, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []matrixEntry
+	// Majors are newest first; walk them backwards for an ascending matrix.
+	for i := len(list.Majors) - 1; i >= 0; i-- {
+		major := list.Majors[i]
+		n, err := strconv.Atoi(major)
+		if err != nil || (from > 0 && n < from) || (to > 0 && n > to) {
+			continue
+		}
+		version := list.Versions[major][0]
+		for _, p := range plats {
+			pd := *d
+			pd.Platform = p
+			pd.AutoPlatform = false
+			release, err := pd.release(version, list)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, matrixEntry{
+				Version:  release.Version,
+				Platform: release.Platform,
+				Arch:     platformArch[release.Platform],
+				URL:      release.URL,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// showMatrix writes the matrix as {"include": [...]}, ready to be used as a
+// GitHub Actions strategy.matrix.
+func showMatrix(d *Downloader, w io.Writer, from, to int, plats []string) error {
+	if len(plats) == 0 {
+		plats = platforms
+	}
+	entries, err := compatMatrix(d, from, to, plats)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []matrixEntry{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Include []matrixEntry `json:"include"`
+	}{entries})
+}
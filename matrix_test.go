@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCompatMatrix(t *testing.T) {
+	s := newTestServer(t)
+	stdout, _, err := runCLI(t, s.args(t, t.TempDir(), "compat-matrix", "--from", "115", "--to", "116", "--matrix-platform", "win32", "--matrix-platform", "linux64")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var matrix struct {
+		Include []matrixEntry `json:"include"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &matrix); err != nil {
+		t.Fatalf("parsing %s: %v", stdout, err)
+	}
+	// 116 has no win32 driver and 120 is past --to.
+	want := []matrixEntry{
+		{"115.0.5790.102", "win32", "386", s.archiveURL("115.0.5790.102", "win32")},
+		{"115.0.5790.102", "linux64", "amd64", s.archiveURL("115.0.5790.102", "linux64")},
+		{testStable, "linux64", "amd64", s.archiveURL(testStable, "linux64")},
+	}
+	if !reflect.DeepEqual(matrix.Include, want) {
+		t.Errorf("matrix %+v, want %+v", matrix.Include, want)
+	}
+}
+
+func TestCompatMatrixAllPlatforms(t *testing.T) {
+	s := newTestServer(t)
+	entries, err := compatMatrix(s.downloader(), 0, 0, platforms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every platform of 115, all but win32 for 116; 120 is a prerelease.
+	if want := len(platforms) + len(platforms) - 1; len(entries) != want {
+		t.Errorf("matrix has %d entries, want %d: %+v", len(entries), want, entries)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// milestonesURL is the Chrome for Testing feed of the latest version of each
+// milestone, that is each major.
+const milestonesURL = "https://googlechromelabs.github.io/chrome-for-testing/latest-versions-per-milestone-with-downloads.json"
+
+// prereleaseMilestones is how many of the newest milestones can still be on
+// the Beta, Dev or Canary channel.
+const prereleaseMilestones = 3
+
+type latestPerMilestone struct {
+	Milestones map[string]struct {
+		Version   string `json:"version"`
+		Revision  string `json:"revision"`
+		Downloads struct {
+			Chromedriver []feedAsset `json:"chromedriver"`
+		} `json:"downloads"`
+	} `json:"milestones"`
+}
+
+// resolveMilestone resolves major through the milestone feed, which is much
+// smaller than the full version list. It reports false when the feed cannot
+// answer, so the caller falls back to List: the feed is unreachable, lacks
+// major, or major may be a prerelease that List would filter out.
+func (d *Downloader) resolveMilestone(major string) (*Release, bool) {
+	resp, err := d.get(d.MilestonesURL)
+	if err != nil {
+		d.verbosef("milestone feed unavailable: %v\n", err)
+		return nil, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		d.verbosef("milestone feed unavailable: %s\n", resp.Status)
+		return nil, false
+	}
+
+	var feed latestPerMilestone
+	if err := json.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		d.verbosef("milestone feed unreadable: %v\n", err)
+		return nil, false
+	}
+	m, ok := feed.Milestones[major]
+	if !ok || m.Version == "" || len(m.Downloads.Chromedriver) == 0 {
+		return nil, false
+	}
+	if !d.AllowPrerelease && newestMilestone(feed)-prereleaseMilestones < mustAtoi(major) {
+		return nil, false
+	}
+
+	list := &VersionList{
+		Downloads: map[string]map[string]string{m.Version: assetURLs(m.Downloads.Chromedriver)},
+		Sizes:     make(map[string]int64),
+	}
+	assetSizes(m.Downloads.Chromedriver, list.Sizes)
+	release, err := d.release(m.Version, list)
+	if err != nil {
+		return nil, false
+	}
+	return release, true
+}
+
+func newestMilestone(feed latestPerMilestone) int {
+	newest := 0
+	for key := range feed.Milestones {
+		if n := mustAtoi(key); n > newest {
+			newest = n
+		}
+	}
+	return newest
+}
+
+// mustAtoi parses a major, treating anything unparsable as 0.
+func mustAtoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// sampleMilestones is a per-milestone feed listing each major's latest
+// version with its linux64 driver.
+func sampleMilestones(baseURL string, latest map[string]string) []byte {
+	type milestone struct {
+		Milestone string `json:"milestone"`
+		Version   string `json:"version"`
+		Revision  string `json:"revision"`
+		Downloads struct {
+			Chromedriver []feedAsset `json:"chromedriver"`
+		} `json:"downloads"`
+	}
+	feed := struct {
+		Milestones map[string]milestone `json:"milestones"`
+	}{Milestones: make(map[string]milestone)}
+	for major, version := range latest {
+		m := milestone{Milestone: major, Version: version, Revision: testRevision(version)}
+		m.Downloads.Chromedriver = []feedAsset{{Platform: "linux64", URL: baseURL + "/dl/" + version + "/linux64/chromedriver-linux64.zip"}}
+		feed.Milestones[major] = m
+	}
+	b, _ := json.Marshal(feed)
+	return b
+}
+
+func TestResolveMilestone(t *testing.T) {
+	s := newTestServer(t)
+	s.mux.HandleFunc("/milestones.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(sampleMilestones(s.URL, map[string]string{
+			"113": "113.0.5672.63",
+			"114": "114.0.5735.90",
+			"115": "115.0.5790.170",
+			"116": testStable,
+		}))
+	})
+	resolve := func(allowPrerelease bool, spec string) string {
+		t.Helper()
+		d := s.downloader()
+		d.MilestonesURL = s.URL + "/milestones.json"
+		d.AllowPrerelease = allowPrerelease
+		release, err := d.Resolve(spec)
+		if err != nil {
+			t.Fatalf("%s: %v", spec, err)
+		}
+		return release.Version
+	}
+
+	// A major the milestone feed answers takes no full list.
+	if got := resolve(false, "113"); got != "113.0.5672.63" {
+		t.Errorf("113 resolved to %s, want the milestone feed's 113.0.5672.63", got)
+	}
+	if got := resolve(true, "115"); got != "115.0.5790.170" {
+		t.Errorf("115 resolved to %s, want the milestone feed's 115.0.5790.170", got)
+	}
+	if n := s.hitCount("/feed.json"); n != 0 {
+		t.Errorf("fetched the full feed %d times for majors the milestone feed has", n)
+	}
+
+	// An exact version, or a major that may be a prerelease while they
+	// are left out, goes through the full list.
+	if got := resolve(true, "115.0.5790.98"); got != "115.0.5790.98" {
+		t.Errorf("115.0.5790.98 resolved to %s", got)
+	}
+	if got := resolve(false, "115"); got != "115.0.5790.102" {
+		t.Errorf("115 resolved to %s without prereleases, want the full list's 115.0.5790.102", got)
+	}
+	if n := s.hitCount("/feed.json"); n != 2 {
+		t.Errorf("fetched the full feed %d times, want 2", n)
+	}
+	if n := s.hitCount("/milestones.json"); n != 3 {
+		t.Errorf("fetched the milestone feed %d times, want it tried for each major", n)
+	}
+}
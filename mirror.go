@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// regionMirrors maps a --region value to a mirror that is faster to reach
+// from there than the Google storage hosts.
+var regionMirrors = map[string]string{
+	"cn": "https://cdn.npmmirror.com/binaries/chromedriver",
+}
+
+// regionMirror returns the built-in mirror of region.
+func regionMirror(region string) (string, bool) {
+	mirror, ok := regionMirrors[strings.ToLower(region)]
+	return mirror, ok
+}
+
+// normalizeBaseURL parses a user supplied base URL, accepting it with or
+// without a trailing slash, and requires an http or https scheme.
+func normalizeBaseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL %q: %w", raw, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: missing host", raw)
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	u.Fragment = ""
+	return u, nil
+}
+
+// mirrorURL rewrites an upstream asset URL of version onto mirror, keeping
+// the path from the version segment on, e.g.
+// https://host/dir/115.0.5790.102/linux64/chromedriver-linux64.zip becomes
+// <mirror>/115.0.5790.102/linux64/chromedriver-linux64.zip. A query string
+// on the mirror is kept on the result.
+func mirrorURL(mirror, version, upstream string) (string, error) {
+	base, err := normalizeBaseURL(mirror)
+	if err != nil {
+		return "", err
+	}
+	up, err := url.Parse(upstream)
+	if err != nil {
+		return "", err
+	}
+
+	i := strings.Index(up.Path, "/"+version+"/")
+	if i < 0 {
+		return upstream, nil
+	}
+	base.Path += up.Path[i:]
+	return base.String(), nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flagDownloader builds the Downloader of the command line args, returning
+// it with what it logged.
+func flagDownloader(t testing.TB, args ...string) (*Downloader, string) {
+	t.Helper()
+	c, err := newCLI(args, &bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log bytes.Buffer
+	c.stderr = &log
+	d, err := c.newDownloaderFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, log.String()
+}
+
+func TestRegionMirror(t *testing.T) {
+	d, _ := flagDownloader(t, "--region", "CN")
+	if d.Mirror != regionMirrors["cn"] {
+		t.Errorf("--region=CN picked %q, want %q", d.Mirror, regionMirrors["cn"])
+	}
+
+	d, _ = flagDownloader(t, "--region", "cn", "--mirror", "https://mirror.example/chromedriver")
+	if d.Mirror != "https://mirror.example/chromedriver" {
+		t.Errorf("--mirror lost to --region: picked %q", d.Mirror)
+	}
+
+	d, log := flagDownloader(t, "--region", "atlantis")
+	if d.Mirror != "" {
+		t.Errorf("an unknown region picked %q, want the default host", d.Mirror)
+	}
+	if !strings.Contains(log, `no mirror is known for region "atlantis"`) {
+		t.Errorf("logged %q, want a warning about the region", log)
+	}
+}
+
+func TestMirrorURL(t *testing.T) {
+	const upstream = "https://storage.googleapis.com/chrome-for-testing-public/115.0.5790.102/linux64/chromedriver-linux64.zip"
+	for _, test := range []struct{ mirror, want string }{
+		{"https://mirror.example/cft", "https://mirror.example/cft/115.0.5790.102/linux64/chromedriver-linux64.zip"},
+		{"https://mirror.example/cft/", "https://mirror.example/cft/115.0.5790.102/linux64/chromedriver-linux64.zip"},
+		{"https://mirror.example/cft?token=1", "https://mirror.example/cft/115.0.5790.102/linux64/chromedriver-linux64.zip?token=1"},
+	} {
+		got, err := mirrorURL(test.mirror, "115.0.5790.102", upstream)
+		if err != nil || got != test.want {
+			t.Errorf("mirrorURL(%q) = %q, %v; want %q", test.mirror, got, err, test.want)
+		}
+	}
+}
+
+func TestMirrorBaseURLs(t *testing.T) {
+	s := newTestServer(t)
+	for _, test := range []struct{ mirror, want string }{
+		{"https://m.example", "https://m.example/115.0.5790.102/linux64/chromedriver-linux64.zip"},
+		{"https://m.example/", "https://m.example/115.0.5790.102/linux64/chromedriver-linux64.zip"},
+		{" https://m.example/cft// ", "https://m.example/cft/115.0.5790.102/linux64/chromedriver-linux64.zip"},
+		{"http://m.example:8080/cft/#top", "http://m.example:8080/cft/115.0.5790.102/linux64/chromedriver-linux64.zip"},
+		{"https://m.example/cft?sig=a%2Fb&exp=1", "https://m.example/cft/115.0.5790.102/linux64/chromedriver-linux64.zip?sig=a%2Fb&exp=1"},
+	} {
+		d := s.downloader()
+		d.Mirror = test.mirror
+		release, err := d.Resolve("115")
+		if err != nil {
+			t.Fatalf("%q: %v", test.mirror, err)
+		}
+		if release.URL != test.want {
+			t.Errorf("%q: download URL %s, want %s", test.mirror, release.URL, test.want)
+		}
+	}
+
+	for _, mirror := range []string{"ftp://m.example/cft", "m.example/cft", "https:///cft", "https://m.example/%zz"} {
+		c, err := newCLI([]string{"--mirror", mirror}, &bytes.Buffer{}, &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.newDownloaderFromFlags(); err == nil || !strings.Contains(err.Error(), "--mirror: invalid base URL") {
+			t.Errorf("--mirror=%s: got %v, want it refused", mirror, err)
+		}
+	}
+}
+
+func TestMirrorsFastestFirst(t *testing.T) {
+	s := newTestServer(t)
+	var mu sync.Mutex
+	var hits []string
+	mirror := func(name string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits = append(hits, name)
+			mu.Unlock()
+			w.Write(testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64"))
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	first, second := mirror("first"), mirror("second")
+	d := s.downloader()
+	d.Mirrors = []string{first.URL, second.URL}
+	d.CacheDir = t.TempDir()
+	release, err := d.Resolve("115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := func() []string {
+		var got []string
+		for _, u := range d.archiveURLs(release) {
+			got = append(got, urlHost(u))
+		}
+		return got
+	}
+
+	// Nothing measured yet: the release's own URL, then the mirrors as given.
+	if got, want := hosts(), []string{urlHost(s.URL), urlHost(first.URL), urlHost(second.URL)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tried %q, want %q", got, want)
+	}
+
+	// Stats from an earlier run favouring the second mirror put it first.
+	b, _ := json.Marshal(mirrorStats{SchemaVersion: schemaVersion, BytesPerSecond: map[string]float64{
+		urlHost(first.URL):  1 << 20,
+		urlHost(second.URL): 8 << 20,
+	}})
+	if err := os.WriteFile(filepath.Join(d.CacheDir, mirrorStatsName), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := hosts(), []string{urlHost(second.URL), urlHost(first.URL), urlHost(s.URL)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tried %q, want %q", got, want)
+	}
+	_, cleanup, err := d.Download(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup()
+	if !reflect.DeepEqual(hits, []string{"second"}) {
+		t.Errorf("the mirrors got %q, want only the second", hits)
+	}
+	if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"); n != 0 {
+		t.Errorf("fetched from the release's own URL %d times", n)
+	}
+	// The download was folded into the second mirror's average.
+	if bps := d.readMirrorStats().BytesPerSecond[urlHost(second.URL)]; bps == 8<<20 {
+		t.Error("the second mirror's throughput was not updated")
+	}
+
+	// Without a cache there are no stats to go by.
+	d.CacheDir = ""
+	if got, want := hosts(), []string{urlHost(s.URL), urlHost(first.URL), urlHost(second.URL)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tried %q without a cache, want %q", got, want)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	s := newTestServer(t)
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	delayed := func(delay time.Duration) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			w.Write(archive)
+		}
+	}
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", delayed(150*time.Millisecond))
+	slow := httptest.NewServer(delayed(300 * time.Millisecond))
+	defer slow.Close()
+	fast := httptest.NewServer(delayed(0))
+	defer fast.Close()
+
+	c, err := newCLI(nil, &bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := s.downloader()
+	d.Mirrors = []string{slow.URL, fast.URL}
+	var out bytes.Buffer
+	if err := c.probe(d, &out, "115"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 6 || lines[0] != "Probing 115.0.5790.102 of linux64." || lines[1] != "Mirror\tLatency\tThroughput" {
+		t.Fatalf("printed %q, want a header and a line per host", out.String())
+	}
+	for i, name := range []string{urlHost(s.URL), slow.URL, fast.URL} {
+		if !strings.HasPrefix(lines[2+i], name+"\t") || !strings.HasSuffix(lines[2+i], " MB/s") {
+			t.Errorf("line %q, want %s measured", lines[2+i], name)
+		}
+	}
+	if want := "fastest: " + fast.URL + "; give it as the first --mirror to use it first"; lines[5] != want {
+		t.Errorf("recommended %q, want %q", lines[5], want)
+	}
+
+	// A mirror that fails is reported and passed over.
+	fast.Close()
+	out.Reset()
+	if err := c.probe(d, &out, "115"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), fast.URL+"\t-\tfailed: ") || !strings.HasSuffix(out.String(), "fastest: "+urlHost(s.URL)+"\n") {
+		t.Errorf("printed %q, want the closed mirror failed and the default host fastest", out.String())
+	}
+}
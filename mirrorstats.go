@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// mirrorStatsName is the file in CacheDir holding the throughput observed
+// from each download host.
+const mirrorStatsName = "mirrors.json"
+
+// throughputWeight is how much a new observation moves a host's moving
+// average.
+const throughputWeight = 0.3
+
+// mirrorStatsMu serializes reading and rewriting the stats file within a
+// run, where parallel downloads finish together.
+var mirrorStatsMu sync.Mutex
+
+// mirrorStats is the on-disk form of the observed throughputs, in bytes per
+// second by host.
+type mirrorStats struct {
+	SchemaVersion  int                `json:"schemaVersion"`
+	BytesPerSecond map[string]float64 `json:"bytesPerSecond"`
+}
+
+func (d *Downloader) mirrorStatsPath() string {
+	return filepath.Join(d.CacheDir, mirrorStatsName)
+}
+
+func (d *Downloader) readMirrorStats() *mirrorStats {
+	stats := &mirrorStats{SchemaVersion: schemaVersion, BytesPerSecond: make(map[string]float64)}
+	b, err := os.ReadFile(d.mirrorStatsPath())
+	if err != nil {
+		return stats
+	}
+	if err := json.Unmarshal(b, stats); err != nil || stats.BytesPerSecond == nil {
+		stats.BytesPerSecond = make(map[string]float64)
+	}
+	return stats
+}
+
+// archiveURLs lists where the release archive can be fetched from: its own
+// URL, then the same path on each of Mirrors. With a CacheDir the hosts
+// seen to be fastest on earlier runs come first; those never measured keep
+// their order behind them.
+func (d *Downloader) archiveURLs(release *Release) []string {
+	urls := []string{release.URL}
+	for _, m := range d.Mirrors {
+		u, err := mirrorURL(m, release.Version, release.URL)
+		if err == nil && u != release.URL {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 1 || d.CacheDir == "" {
+		return urls
+	}
+	mirrorStatsMu.Lock()
+	stats := d.readMirrorStats()
+	mirrorStatsMu.Unlock()
+	sort.SliceStable(urls, func(i, j int) bool {
+		return stats.BytesPerSecond[urlHost(urls[i])] > stats.BytesPerSecond[urlHost(urls[j])]
+	})
+	return urls
+}
+
+// recordThroughput folds a download of n bytes from rawURL taking elapsed
+// into the host's moving average. Failing to save it only loses the hint.
+func (d *Downloader) recordThroughput(rawURL string, n int64, elapsed time.Duration) {
+	if d.CacheDir == "" || len(d.Mirrors) == 0 || elapsed <= 0 {
+		return
+	}
+	mirrorStatsMu.Lock()
+	defer mirrorStatsMu.Unlock()
+	stats := d.readMirrorStats()
+	host := urlHost(rawURL)
+	observed := float64(n) / elapsed.Seconds()
+	if avg, ok := stats.BytesPerSecond[host]; ok {
+		observed = avg + throughputWeight*(observed-avg)
+	}
+	stats.BytesPerSecond[host] = observed
+	if err := os.MkdirAll(d.CacheDir, 0755); err != nil {
+		return
+	}
+	if err := writeJSONAtomic(d.mirrorStatsPath(), stats); err != nil {
+		d.verbosef("not recording mirror throughput: %v\n", err)
+	}
+}
+
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
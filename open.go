@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// errHeadless is returned by openDir when there is no desktop to open a file
+// explorer on.
+var errHeadless = errors.New("no desktop session")
+
+// startOpener launches the file explorer command without waiting for it.
+var startOpener = func(name string, args ...string) error {
+	return exec.Command(name, args...).Start()
+}
+
+// openerCommand returns the command that shows a directory in the file
+// explorer of goos.
+func openerCommand(goos string) string {
+	switch goos {
+	case "windows":
+		return "explorer"
+	case "darwin":
+		return "open"
+	}
+	return "xdg-open"
+}
+
+// isHeadless reports whether the process runs without a desktop, such as in
+// CI or over a plain SSH session.
+func isHeadless() bool {
+	if os.Getenv("CI") != "" {
+		return true
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return false
+	}
+	return os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == ""
+}
+
+// openDir shows dir in the system file explorer.
+func openDir(dir string) error {
+	if isHeadless() {
+		return errHeadless
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	name := openerCommand(runtime.GOOS)
+	if err := startOpener(name, abs); err != nil {
+		return fmt.Errorf("running %s: %w", name, err)
+	}
+	return nil
+}
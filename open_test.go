@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// stubOpener records the commands openDir starts in place of running them.
+func stubOpener(t *testing.T) *[][]string {
+	var started [][]string
+	saved := startOpener
+	startOpener = func(name string, args ...string) error {
+		started = append(started, append([]string{name}, args...))
+		return nil
+	}
+	t.Cleanup(func() { startOpener = saved })
+	return &started
+}
+
+func TestOpen(t *testing.T) {
+	started := stubOpener(t)
+	t.Setenv("CI", "")
+	t.Setenv("DISPLAY", ":0")
+	s := newTestServer(t)
+	out := t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out, "--open", "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs(out)
+	want := [][]string{{openerCommand(runtime.GOOS), abs}}
+	if !reflect.DeepEqual(*started, want) {
+		t.Errorf("started %q, want %q", *started, want)
+	}
+}
+
+func TestOpenHeadless(t *testing.T) {
+	started := stubOpener(t)
+	t.Setenv("CI", "true")
+	s := newTestServer(t)
+	_, stderr, err := runCLI(t, s.args(t, t.TempDir(), "--open", "-v", "115")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*started) != 0 {
+		t.Errorf("started %q without a desktop", *started)
+	}
+	if !strings.Contains(stderr, "warning:") {
+		t.Errorf("printed %q, want a warning", stderr)
+	}
+}
+
+func TestOpenerCommand(t *testing.T) {
+	for goos, want := range map[string]string{"windows": "explorer", "darwin": "open", "linux": "xdg-open", "freebsd": "xdg-open"} {
+		if got := openerCommand(goos); got != want {
+			t.Errorf("opener on %s is %s, want %s", goos, got, want)
+		}
+	}
+}
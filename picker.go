@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pickerChoices is how many of the newest majors the picker offers.
+const pickerChoices = 10
+
+// promptVersion picks the version to install on the terminal, reporting
+// false when stdin or stderr is not one to ask on.
+var promptVersion = func(d *Downloader) (string, bool, error) {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stderr) {
+		return "", false, nil
+	}
+	picked, err := pickVersion(d, os.Stdin, os.Stderr)
+	return picked, true, err
+}
+
+// pickVersion asks on out which major to install, reading the answer from
+// in. The answer is either a menu number or a major.
+func pickVersion(d *Downloader, in io.Reader, out io.Writer) (string, error) {
+	list, err := d.List()
+	if err != nil {
+		return "", err
+	}
+	majors := list.Majors
+	if len(majors) > pickerChoices {
+		majors = majors[:pickerChoices]
+	}
+	if len(majors) == 0 {
+		return "", fmt.Errorf("%w: no versions are published", ErrVersionNotFound)
+	}
+
+	fmt.Fprintln(out, "No --version given. Pick a chrome driver to install:")
+	for i, major := range majors {
+		fmt.Fprintf(out, "  %d) %s (%s)\n", i+1, major, list.Versions[major][0])
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "Choice [1]: ")
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", errors.New("no version picked")
+		}
+		answer := strings.TrimSpace(scanner.Text())
+		if answer == "" {
+			return majors[0], nil
+		}
+		if _, ok := list.Versions[answer]; ok {
+			return answer, nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(majors) {
+			return majors[n-1], nil
+		}
+		fmt.Fprintf(out, "%q is not one of the choices.\n", answer)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPickVersion(t *testing.T) {
+	s := newTestServer(t)
+	d := s.downloader()
+	for _, test := range []struct{ answers, want string }{
+		{"\n", "116"},
+		{"2\n", "115"},
+		{"115\n", "115"},
+		{"9\nlatest\n1\n", "116"},
+	} {
+		var prompt bytes.Buffer
+		got, err := pickVersion(d, strings.NewReader(test.answers), &prompt)
+		if err != nil {
+			t.Errorf("%q: %v", test.answers, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q picked %s, want %s", test.answers, got, test.want)
+		}
+		if !strings.Contains(prompt.String(), "  1) 116 (116.0.5845.96)\n  2) 115 (115.0.5790.102)\n") {
+			t.Errorf("offered %q", prompt.String())
+		}
+	}
+	if _, err := pickVersion(d, strings.NewReader(""), &bytes.Buffer{}); err == nil || err.Error() != "no version picked" {
+		t.Errorf("with no answer: got %v", err)
+	}
+}
+
+func TestPickedVersionInstalled(t *testing.T) {
+	skipOnWindows(t)
+	saved := promptVersion
+	defer func() { promptVersion = saved }()
+	promptVersion = func(d *Downloader) (string, bool, error) {
+		picked, err := pickVersion(d, strings.NewReader("115\n"), &bytes.Buffer{})
+		return picked, true, err
+	}
+
+	s := newTestServer(t)
+	out := t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out)...); err != nil {
+		t.Fatal(err)
+	}
+	if !isInstalledIn(out, "115.0.5790.102") {
+		t.Error("the picked 115 was not installed")
+	}
+	if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"); n != 1 {
+		t.Errorf("downloaded the picked driver %d times, want once", n)
+	}
+
+	// Where there is no terminal to ask on, a missing version is an error.
+	promptVersion = func(d *Downloader) (string, bool, error) { return "", false, nil }
+	if _, _, err := runCLI(t, s.args(t, t.TempDir())...); err == nil || !strings.Contains(err.Error(), "no version given") {
+		t.Errorf("got %v, want no version given", err)
+	}
+}
+
+func TestNoArguments(t *testing.T) {
+	// The child's stdin is no terminal, so there is no picker to fall
+	// back on.
+	stdout, stderr, code := runMain(t)
+	if code != exitUsage {
+		t.Errorf("exit code %d, want %d", code, exitUsage)
+	}
+	if strings.Contains(stderr, "panic") || strings.Contains(stderr, "goroutine ") {
+		t.Fatalf("panicked:\n%s", stderr)
+	}
+	if !strings.HasPrefix(stderr, "usage: get-chromeDriver ") || !strings.Contains(stderr, "get-chromeDriver --latest ") || !strings.Contains(stderr, "get-chromeDriver --help ") {
+		t.Errorf("printed %q, want the usage hint", stderr)
+	}
+	if !strings.Contains(stderr, "no version given") {
+		t.Errorf("printed %q, want the error", stderr)
+	}
+	if stdout != "" {
+		t.Errorf("printed %q to stdout", stdout)
+	}
+}
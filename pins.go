@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// pinFile maps majors to the full version a --pins file holds them at.
+type pinFile struct {
+	Pins map[string]string `json:"pins"`
+
+	// logged holds the majors whose pin was reported, as a batch may
+	// resolve a spec both to prefetch and to install it.
+	mu     sync.Mutex
+	logged map[string]bool
+}
+
+// loadPins reads the pins at path, refusing keys that are no major and
+// versions that are not full versions of their key's major.
+func loadPins(path string) (*pinFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading pins: %w", err)
+	}
+	p := pinFile{logged: make(map[string]bool)}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("parsing pins %s: %w", path, err)
+	}
+	for major, version := range p.Pins {
+		if !isMajor(major) {
+			return nil, fmt.Errorf("pins %s: invalid major %q", path, major)
+		}
+		if !isVersionPrefix(version) || strings.Count(version, ".") != 3 || majorOf(version) != major {
+			return nil, fmt.Errorf("pins %s: %q is not a full version of major %s", path, version, major)
+		}
+	}
+	return &p, nil
+}
+
+// pinned returns the version spec resolves to under --pins: the pinned
+// full version when spec is a bare major with a pin, and spec otherwise.
+func (c *cli) pinned(d *Downloader, spec string) string {
+	if c.pins == nil || !isMajor(spec) {
+		return spec
+	}
+	version, ok := c.pins.Pins[spec]
+	if !ok {
+		return spec
+	}
+	c.pins.mu.Lock()
+	defer c.pins.mu.Unlock()
+	if !c.pins.logged[spec] {
+		c.pins.logged[spec] = true
+		fmt.Fprintf(d.Log, "major %s is pinned to %s\n", spec, version)
+	}
+	return version
+}
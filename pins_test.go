@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPins(t *testing.T) {
+	s := newTestServer(t)
+	pins := filepath.Join(t.TempDir(), "pins.json")
+	if err := os.WriteFile(pins, []byte(`{"pins": {"115": "115.0.5790.98"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	resolve := func(specs ...string) (string, string) {
+		t.Helper()
+		args := []string{"--pins", pins, "--print-driver-version"}
+		for _, spec := range specs {
+			args = append(args, "-v", spec)
+		}
+		stdout, stderr, err := runCLI(t, s.args(t, t.TempDir(), args...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stdout, stderr
+	}
+
+	// The latest 115 is 115.0.5790.102, but the pin holds it back.
+	stdout, stderr := resolve("115")
+	if stdout != "115.0.5790.98\n" {
+		t.Errorf("115 resolved to %q, want the pinned 115.0.5790.98", stdout)
+	}
+	if !strings.Contains(stderr, "major 115 is pinned to 115.0.5790.98\n") {
+		t.Errorf("logged %q, want the pin reported", stderr)
+	}
+	out := t.TempDir()
+	if _, _, err := runCLI(t, s.args(t, out, "--pins", pins, "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.hitCount("/dl/115.0.5790.98/linux64/chromedriver-linux64.zip"); n != 1 {
+		t.Errorf("downloaded the pinned driver %d times, want once", n)
+	}
+	// Full versions, and majors without a pin, resolve as ever.
+	if stdout, _ = resolve("115.0.5790.102", "116"); stdout != "115.0.5790.102\n"+testStable+"\n" {
+		t.Errorf("resolved %q, want the pin left out", stdout)
+	}
+
+	for _, bad := range []string{`{"pins": {"115": "116.0.5845.96"}}`, `{"pins": {"115": "115.0"}}`, `{"pins": {"latest": "115.0.5790.98"}}`, `{"pins": `} {
+		if err := os.WriteFile(pins, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--pins", pins, "-v", "115")...); err == nil || !strings.Contains(err.Error(), "pins") {
+			t.Errorf("%s: got %v, want the pins refused", bad, err)
+		}
+	}
+}
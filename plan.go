@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// installPlan is what the plan command resolved a batch to, and what apply
+// installs: one step per version and platform.
+type installPlan struct {
+	SchemaVersion int        `json:"schemaVersion"`
+	Out           string     `json:"out"`
+	Nested        bool       `json:"nested"`
+	PerPlatform   bool       `json:"perPlatform"`
+	Steps         []planStep `json:"steps"`
+}
+
+// planStep is one driver of a plan. Action is "download", "cached" when
+// the archive is in the cache, or "skip" with the reason in Reason.
+type planStep struct {
+	Spec     string `json:"spec"`
+	Version  string `json:"version,omitempty"`
+	Platform string `json:"platform"`
+	URL      string `json:"url,omitempty"`
+	Dir      string `json:"dir,omitempty"`
+	Action   string `json:"action"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// makePlan resolves every --version, or the latest, on every --platforms
+// entry and works out what installing it into --out would take, without
+// downloading anything.
+func (c *cli) makePlan(d *Downloader) (*installPlan, error) {
+	if err := c.loadPolicies(); err != nil {
+		return nil, err
+	}
+	specs := c.specVersions
+	if c.versionsFile != "" {
+		more, err := readVersionsFile(c.versionsFile)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, more...)
+	}
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+	plats := []string{d.Platform}
+	if c.platformList != "" {
+		var err error
+		if plats, err = parsePlatforms(c.platformList); err != nil {
+			return nil, err
+		}
+	}
+	layout := c.effectiveLayout(len(specs))
+	if len(specs) > 1 && layout != "per-version" {
+		return nil, fmt.Errorf("--output-layout=%s cannot hold several versions; use per-version", layout)
+	}
+
+	p := &installPlan{
+		SchemaVersion: schemaVersion,
+		Out:           c.outputPath,
+		Nested:        layout == "per-version",
+		PerPlatform:   c.platformList != "",
+	}
+	planned := map[string]bool{}
+	for _, spec := range specs {
+		for _, plat := range plats {
+			pd := *d
+			pd.Platform = plat
+			if p.PerPlatform {
+				pd.AutoPlatform = false
+			}
+			step, err := c.planOne(&pd, p, spec)
+			if err != nil {
+				return nil, err
+			}
+			key := step.URL + "\x00" + step.Dir
+			if step.Action != "skip" && planned[key] {
+				step.Action, step.Reason = "skip", "planned already"
+			}
+			planned[key] = true
+			p.Steps = append(p.Steps, step)
+		}
+	}
+	return p, nil
+}
+
+// planOne works out the step installing spec on d's platform under p.
+func (c *cli) planOne(d *Downloader, p *installPlan, spec string) (planStep, error) {
+	step := planStep{Spec: spec, Platform: d.Platform}
+	if spec == "" {
+		step.Spec = "latest"
+	}
+	release, err := c.resolve(d, spec)
+	if errors.Is(err, ErrAssetNotFound) && p.PerPlatform {
+		step.Action, step.Reason = "skip", err.Error()
+		return step, nil
+	}
+	if err != nil {
+		return step, inPhase("resolve", step.Spec, err)
+	}
+	if err := c.checkAllowlist(release); err != nil {
+		return step, inPhase("resolve", release.Version, err)
+	}
+	if err := c.checkMinMajor(release); err != nil {
+		return step, inPhase("resolve", release.Version, err)
+	}
+	step.Version = release.Version
+	step.Platform = release.Platform
+	step.URL = release.URL
+	step.Dir = p.Out
+	if p.Nested {
+		step.Dir = filepath.Join(step.Dir, release.Version)
+	}
+	if p.PerPlatform {
+		step.Dir = filepath.Join(step.Dir, release.Platform)
+	}
+
+	switch {
+	case isInstalledIn(step.Dir, release.Version):
+		step.Action, step.Reason = "skip", "installed already"
+	case cached(d, release):
+		step.Action = "cached"
+	default:
+		step.Action = "download"
+	}
+	return step, nil
+}
+
+// cached reports whether the archive of release is in d's cache.
+func cached(d *Downloader, release *Release) bool {
+	_, _, ok := d.lookupCached(release)
+	return ok
+}
+
+// writePlan prints the plan for the requested drivers to w as JSON, for
+// apply to carry out later.
+func (c *cli) writePlan(d *Downloader, w io.Writer) error {
+	p, err := c.makePlan(d)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// readPlan reads a plan written by the plan command.
+func readPlan(path string) (*installPlan, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading plan: %w", err)
+	}
+	var p installPlan
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("reading plan %s: %w", path, err)
+	}
+	if p.SchemaVersion != schemaVersion {
+		return nil, fmt.Errorf("plan %s has schema version %d, want %d; plan again", path, p.SchemaVersion, schemaVersion)
+	}
+	if p.Out == "" {
+		return nil, fmt.Errorf("plan %s names no output directory", path)
+	}
+	return &p, nil
+}
+
+// applyPlan installs the steps of the plan at path that are not skipped.
+// Each version is resolved again first, and the plan is refused as stale
+// when it no longer resolves to the archive planned.
+func (c *cli) applyPlan(d *Downloader, w io.Writer, path string) error {
+	p, err := readPlan(path)
+	if err != nil {
+		return err
+	}
+	if err := c.loadPolicies(); err != nil {
+		return err
+	}
+	c.outputPath = p.Out
+	unlock, err := lockDir(c.outputPath, c.waitLock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, step := range p.Steps {
+		if step.Action == "skip" {
+			fmt.Fprintf(w, "skipping %s for %s: %s\n", step.Spec, step.Platform, step.Reason)
+			continue
+		}
+		pd := *d
+		pd.Platform = step.Platform
+		pd.AutoPlatform = false
+		release, err := pd.Resolve(step.Version)
+		if err != nil {
+			return inPhase("resolve", step.Version, err)
+		}
+		if release.URL != step.URL {
+			return fmt.Errorf("plan %s is stale: %s for %s now resolves to %s, not %s; plan again", path, step.Version, step.Platform, release.URL, step.URL)
+		}
+		start := c.record.startCase()
+		_, err = c.getOne(&pd, step.Version, p.Nested, p.PerPlatform)
+		c.record.recordCase(d.Stats, step.Spec, step.Platform, start, err, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanThenApply(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out, cache := t.TempDir(), t.TempDir()
+	// 115.0.5790.98 for linux64 is cached and 116 for linux64 is installed
+	// already; 116 has no win32 driver.
+	if _, _, err := runCLI(t, append([]string{"cache", "warm"}, s.args(t, t.TempDir(), "--cache-dir", cache, "-v", "115.0.5790.98")...)...); err != nil {
+		t.Fatal(err)
+	}
+	installed := filepath.Join(out, testStable, "linux64")
+	if _, _, err := runCLI(t, s.args(t, installed, "-v", testStable)...); err != nil {
+		t.Fatal(err)
+	}
+	args := func(extra ...string) []string {
+		return s.args(t, out, append([]string{"--cache", "--cache-dir", cache, "--platforms", "linux64,win32", "-v", "115.0.5790.98", "-v", "116"}, extra...)...)
+	}
+
+	setup := downloads(s)
+	stdout, _, err := runCLI(t, append([]string{"plan"}, args()...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p installPlan
+	if err := json.Unmarshal([]byte(stdout), &p); err != nil {
+		t.Fatalf("parsing %s: %v", stdout, err)
+	}
+	var actions []string
+	for _, step := range p.Steps {
+		actions = append(actions, step.Version+"/"+step.Platform+" "+step.Action)
+	}
+	want := []string{
+		"115.0.5790.98/linux64 cached",
+		"115.0.5790.98/win32 download",
+		testStable + "/linux64 skip",
+		"/win32 skip",
+	}
+	if !reflect.DeepEqual(actions, want) {
+		t.Fatalf("planned %q, want %q", actions, want)
+	}
+	if n := downloads(s); n != setup {
+		t.Errorf("planning downloaded %d archives", n-setup)
+	}
+
+	// Apply does what the plan says: a download for each download step,
+	// the cache for each cached one, and nothing for the skipped.
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := os.WriteFile(planPath, []byte(stdout), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before := map[string]int{}
+	for _, step := range p.Steps {
+		if step.URL != "" {
+			before[step.URL] = s.hitCount(strings.TrimPrefix(step.URL, s.URL))
+		}
+	}
+	// The plan's --out is used whatever the command line's.
+	applied, _, err := runCLI(t, append([]string{"apply", planPath}, setFlag(args(), "out", t.TempDir())...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range p.Steps {
+		fetched := 0
+		if step.URL != "" {
+			fetched = s.hitCount(strings.TrimPrefix(step.URL, s.URL)) - before[step.URL]
+		}
+		switch step.Action {
+		case "download":
+			if fetched != 1 {
+				t.Errorf("%s/%s: downloaded %d times, want once", step.Version, step.Platform, fetched)
+			}
+			if !isInstalledIn(step.Dir, step.Version) {
+				t.Errorf("%s/%s: not installed in %s", step.Version, step.Platform, step.Dir)
+			}
+		case "cached":
+			if fetched != 0 {
+				t.Errorf("%s/%s: downloaded a cached archive", step.Version, step.Platform)
+			}
+			if !isInstalledIn(step.Dir, step.Version) {
+				t.Errorf("%s/%s: not installed in %s", step.Version, step.Platform, step.Dir)
+			}
+		case "skip":
+			if fetched != 0 {
+				t.Errorf("%s/%s: downloaded a skipped driver", step.Version, step.Platform)
+			}
+			if !strings.Contains(applied, "skipping "+step.Spec+" for "+step.Platform+": "+step.Reason+"\n") {
+				t.Errorf("printed %q, want the skipped %s/%s reported", applied, step.Spec, step.Platform)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, testStable, "win32")); !os.IsNotExist(err) {
+		t.Error("apply made a directory for a skipped step")
+	}
+}
+
+// downloads counts the archives s has served.
+func downloads(s *testServer) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for path, hits := range s.hits {
+		if strings.HasPrefix(path, "/dl/") {
+			n += hits
+		}
+	}
+	return n
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// showPlatforms prints every supported platform with its OS and arch. With
+// a spec it resolves spec's newest version and only prints the platforms
+// that version has a driver for.
+func showPlatforms(d *Downloader, w io.Writer, spec string) error {
+	if spec == "" {
+		fmt.Fprintf(w, "Platform\tOS\tArch\n")
+		for _, p := range platforms {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", p, platformOS[p], platformArch[p])
+		}
+		return nil
+	}
+
+	list, err := d.List()
+	if err != nil {
+		return err
+	}
+	major := spec
+	if m, ok := latestSpec(spec); ok {
+		major = m
+		if major == "" && len(list.Majors) > 0 {
+			major = list.Majors[0]
+		}
+	}
+	versions, ok := list.Versions[major]
+	if !ok {
+		if isMajor(major) {
+			return errMajorNotFound(major, list)
+		}
+		return fmt.Errorf("%w: %s", ErrVersionNotFound, spec)
+	}
+	version := versions[0]
+
+	fmt.Fprintf(w, "Platforms with a driver for %s.\n", version)
+	fmt.Fprintf(w, "Platform\tOS\tArch\tURL\n")
+	urls := platformURLs(d, version, list)
+	for _, p := range platforms {
+		if url, ok := urls[p]; ok {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p, platformOS[p], platformArch[p], url)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestListPlatforms(t *testing.T) {
+	s := newTestServer(t)
+	stdout, _, err := runCLI(t, "list-platforms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const all = "Platform\tOS\tArch\n" +
+		"win32\twindows\t386\n" +
+		"win64\twindows\tamd64\n" +
+		"linux64\tlinux\tamd64\n" +
+		"mac-x64\tdarwin\tamd64\n" +
+		"mac-arm64\tdarwin\tarm64\n"
+	if stdout != all {
+		t.Errorf("printed %q, want %q", stdout, all)
+	}
+	if n := s.hitCount("/feed.json"); n != 0 {
+		t.Errorf("the static list fetched the feed")
+	}
+
+	// 116 has no win32 driver.
+	stdout, _, err = runCLI(t, append([]string{"list-platforms"}, s.args(t, t.TempDir(), "-v", "116")...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Platforms with a driver for 116.0.5845.96.\n" +
+		"Platform\tOS\tArch\tURL\n" +
+		"win64\twindows\tamd64\t" + s.archiveURL(testStable, "win64") + "\n" +
+		"linux64\tlinux\tamd64\t" + s.archiveURL(testStable, "linux64") + "\n" +
+		"mac-x64\tdarwin\tamd64\t" + s.archiveURL(testStable, "mac-x64") + "\n" +
+		"mac-arm64\tdarwin\tarm64\t" + s.archiveURL(testStable, "mac-arm64") + "\n"
+	if stdout != want {
+		t.Errorf("printed %q, want %q", stdout, want)
+	}
+}
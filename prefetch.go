@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// prefetch is an archive download started ahead of its turn in a batch.
+type prefetch struct {
+	done    chan struct{}
+	release *Release
+	path    string
+	cleanup func() error
+	err     error
+}
+
+// prefetcher downloads the archives of upcoming batch entries while the
+// current one extracts. The install of an entry takes its archive over
+// through take instead of downloading it again.
+type prefetcher struct {
+	d *Downloader
+	// resolve picks the release of a spec as the install of its entry will.
+	resolve func(d *Downloader, spec string) (*Release, error)
+	mu      sync.Mutex
+	pending map[string]*prefetch
+	// taken holds the URLs an install has already asked for, which a
+	// later entry naming the same driver reuses rather than fetches.
+	taken map[string]bool
+	wg    sync.WaitGroup
+}
+
+func newPrefetcher(d *Downloader, resolve func(d *Downloader, spec string) (*Release, error)) *prefetcher {
+	// Several bars redrawing one line would garble each other; the batch
+	// line, when there is one, sums them instead.
+	pd := *d
+	pd.DownloadProgress = nil
+	pd.Progress = nil
+	pd.Heartbeat = 0
+	return &prefetcher{d: &pd, resolve: resolve, pending: make(map[string]*prefetch), taken: make(map[string]bool)}
+}
+
+// canPrefetch reports whether a batch may download ahead: every entry
+// must download exactly one driver archive through Download, which rules
+// out the modes that skip installs, write elsewhere or fan out by platform.
+func (c *cli) canPrefetch(d *Downloader) bool {
+	return c.maxConnections > 1 && !c.dryRun && !c.printURLs && !c.printDriverVersion && !c.toStdout && !c.tarStdout &&
+		!c.resumeBatch && !c.ensure && c.platformList == "" && (!c.noTemp || d.CacheDir != "")
+}
+
+// start resolves spec and begins downloading its archive in the
+// background. A spec that fails to resolve is left for its turn, which
+// reports the error.
+func (p *prefetcher) start(spec string) {
+	release, err := p.resolve(p.d, spec)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.pending[release.URL]; ok || p.taken[release.URL] {
+		return
+	}
+	f := &prefetch{done: make(chan struct{}), release: release}
+	p.pending[release.URL] = f
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(f.done)
+		p.d.verbosef("prefetching %s\n", release.URL)
+		f.path, f.cleanup, f.err = p.d.Download(release)
+	}()
+}
+
+// take waits for the prefetched archive of release, if there is one, and
+// hands it over: its path and the func removing it. A failed prefetch is
+// dropped so the caller downloads the archive itself.
+func (p *prefetcher) take(d *Downloader, release *Release) (string, func() error, bool) {
+	if p == nil {
+		return "", nil, false
+	}
+	p.mu.Lock()
+	f, ok := p.pending[release.URL]
+	delete(p.pending, release.URL)
+	p.taken[release.URL] = true
+	p.mu.Unlock()
+	if !ok {
+		return "", nil, false
+	}
+	<-f.done
+	if f.err == nil && d.Checksum != "" {
+		got := f.release.SHA256
+		if d.checksumAlgo() != "sha256" {
+			got, f.err = fileChecksum(f.path, d.checksumAlgo())
+		}
+		if f.err == nil && !strings.EqualFold(d.Checksum, got) {
+			f.err = errChecksumMismatch(release.URL, d.Checksum, got)
+		}
+	}
+	if f.err != nil {
+		d.verbosef("prefetch of %s failed (%v), downloading it now\n", release.URL, f.err)
+		if f.cleanup != nil {
+			f.cleanup()
+		}
+		return "", nil, false
+	}
+	release.SHA256 = f.release.SHA256
+	return f.path, f.cleanup, true
+}
+
+// wait blocks until every started download has finished, so the batch's
+// staging directory is not removed under one.
+func (p *prefetcher) wait() {
+	p.wg.Wait()
+}
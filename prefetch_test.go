@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// archiveDelay is how long slowBatchServer takes to serve each archive.
+const archiveDelay = 150 * time.Millisecond
+
+// slowBatchVersions is a batch of three drivers.
+var slowBatchVersions = []string{"115.0.5790.98", "115.0.5790.102", testStable}
+
+// slowBatchServer is a test server taking archiveDelay over each archive
+// of slowBatchVersions, standing in for a slow network.
+func slowBatchServer(t testing.TB) *testServer {
+	s := newTestServer(t)
+	for _, version := range slowBatchVersions {
+		version := version
+		archive := testArchive(t, "chromedriver-linux64.zip", version, "linux64")
+		s.mux.HandleFunc("/dl/"+version+"/linux64/", func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(archiveDelay)
+			w.Write(archive)
+		})
+	}
+	return s
+}
+
+// runSlowBatch installs slowBatchVersions with --max-connections set to
+// connections, returning how long it took.
+func runSlowBatch(t testing.TB, s *testServer, connections string) time.Duration {
+	var specs []string
+	for _, version := range slowBatchVersions {
+		specs = append(specs, "-v", version)
+	}
+	args := s.args(t, t.TempDir(), append([]string{"--max-connections", connections}, specs...)...)
+	start := time.Now()
+	if _, _, err := runCLI(t, args...); err != nil {
+		t.Fatal(err)
+	}
+	return time.Since(start)
+}
+
+func TestBatchPrefetchOverlaps(t *testing.T) {
+	skipOnWindows(t)
+	s := slowBatchServer(t)
+	serial := time.Duration(len(slowBatchVersions)) * archiveDelay
+	if took := runSlowBatch(t, s, "1"); took < serial {
+		t.Errorf("without prefetching the batch took %s, under the serial %s", took, serial)
+	}
+	// The later archives download while the first is fetched and
+	// extracted, so the whole takes about one archive's time, not three.
+	if took := runSlowBatch(t, s, "3"); took >= serial-archiveDelay {
+		t.Errorf("with prefetching the batch took %s, want well under the serial %s", took, serial)
+	}
+	for _, version := range slowBatchVersions {
+		if n := s.hitCount("/dl/" + version + "/linux64/chromedriver-linux64.zip"); n != 2 {
+			t.Errorf("fetched %s %d times over the two batches, want once each", version, n)
+		}
+	}
+}
+
+// BenchmarkBatchPrefetch times the slow batch of three with and without
+// downloading ahead.
+func BenchmarkBatchPrefetch(b *testing.B) {
+	s := slowBatchServer(b)
+	for _, test := range []struct{ name, connections string }{{"serial", "1"}, {"prefetch", "3"}} {
+		test := test
+		b.Run(test.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				runSlowBatch(b, s, test.connections)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// probeBytes is how much of the archive probe fetches from each mirror to
+// measure its throughput.
+const probeBytes = 256 << 10
+
+// mirrorProbe is what probe measured of one mirror.
+type mirrorProbe struct {
+	Name    string
+	URL     string
+	Latency time.Duration
+	// BytesPerSecond is the throughput of the ranged GET, headers included.
+	BytesPerSecond float64
+	Err            error
+}
+
+// probe implements the "probe" command: it times a ranged GET of the
+// driver archive for spec on the default host, or --mirror, and on
+// each further --mirror, prints what it measured and recommends the
+// fastest. Requests are not retried, so the numbers are of one attempt.
+func (c *cli) probe(d *Downloader, w io.Writer, spec string) error {
+	if spec == "" {
+		spec = "latest"
+	}
+	release, err := c.resolve(d, spec)
+	if err != nil {
+		return err
+	}
+	primary := d.Mirror
+	if primary == "" {
+		primary = urlHost(release.URL)
+	}
+	probes := []*mirrorProbe{{Name: primary, URL: release.URL}}
+	for _, m := range d.Mirrors {
+		u, err := mirrorURL(m, release.Version, release.URL)
+		if err != nil || u == release.URL {
+			continue
+		}
+		probes = append(probes, &mirrorProbe{Name: m, URL: u})
+	}
+
+	fmt.Fprintf(w, "Probing %s of %s.\n", release.Version, release.Platform)
+	fmt.Fprintf(w, "Mirror\tLatency\tThroughput\n")
+	var fastest *mirrorProbe
+	for _, p := range probes {
+		d.probeMirror(p)
+		if p.Err != nil {
+			fmt.Fprintf(w, "%s\t-\tfailed: %v\n", p.Name, p.Err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.2f MB/s\n", p.Name, p.Latency.Round(time.Millisecond), p.BytesPerSecond/(1<<20))
+		if fastest == nil || p.BytesPerSecond > fastest.BytesPerSecond {
+			fastest = p
+		}
+	}
+	if fastest == nil {
+		return fmt.Errorf("no mirror answered for %s", release.Version)
+	}
+	if fastest == probes[0] {
+		fmt.Fprintf(w, "fastest: %s\n", fastest.Name)
+		return nil
+	}
+	fmt.Fprintf(w, "fastest: %s; give it as the first --mirror to use it first\n", fastest.Name)
+	return nil
+}
+
+// probeMirror measures p with one GET of the first probeBytes of p.URL:
+// the latency is how long the response headers took and the throughput is
+// over the whole request, so a slow-to-answer mirror ranks below one that
+// starts sending at once.
+func (d *Downloader) probeMirror(p *mirrorProbe) {
+	req, err := http.NewRequestWithContext(d.context(), http.MethodGet, p.URL, nil)
+	if err != nil {
+		p.Err = err
+		return
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", probeBytes-1))
+	start := time.Now()
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		p.Err = err
+		return
+	}
+	defer resp.Body.Close()
+	p.Latency = time.Since(start)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		p.Err = fmt.Errorf("%s", resp.Status)
+		return
+	}
+
+	// A server ignoring Range sends the whole archive; stop early.
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, probeBytes))
+	if err != nil {
+		p.Err = err
+		return
+	}
+	if elapsed := time.Since(start); elapsed > 0 {
+		p.BytesPerSecond = float64(n) / elapsed.Seconds()
+	}
+}
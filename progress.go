@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// isTerminal reports whether f is an interactive terminal rather than a
+// pipe or file.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// extractionProgress returns an ExtractProgress callback that keeps an
+// "extracted X/Y files" line up to date on w. Archives that do not state
+// their entry count up front are not reported.
+func extractionProgress(w io.Writer) func(done, total int) {
+	return func(done, total int) {
+		if total == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\rextracted %d/%d files", done, total)
+		if done == total {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// downloadProgress returns a DownloadProgress callback that keeps a
+// "downloading name: X/Y MB (N%)" line up to date on w, redrawing at most
+// every 100ms. Without a known total only the bytes so far are shown. A
+// new attempt while a line is still open, as after a failed download,
+// ends that line as interrupted and starts a fresh one at 0%.
+func downloadProgress(w io.Writer) func(name string, done, total int64) {
+	var (
+		last time.Time
+		open bool
+	)
+	return func(name string, done, total int64) {
+		finished := total > 0 && done == total
+		if done == 0 {
+			if open {
+				fmt.Fprintln(w, " (interrupted, restarting)")
+			}
+		} else if !finished && time.Since(last) < 100*time.Millisecond {
+			return
+		}
+		last = time.Now()
+		open = !finished
+		if total > 0 {
+			fmt.Fprintf(w, "\rdownloading %s: %.1f/%.1f MB (%d%%)", name, float64(done)/(1<<20), float64(total)/(1<<20), done*100/total)
+		} else {
+			fmt.Fprintf(w, "\rdownloading %s: %.1f MB", name, float64(done)/(1<<20))
+		}
+		if finished {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// progressBars are the progress lines a Downloader draws on its Progress
+// writer.
+type progressBars struct {
+	download func(name string, done, total int64)
+	extract  func(done, total int)
+}
+
+func (d *Downloader) progressBars() *progressBars {
+	if d.bars == nil {
+		d.bars = &progressBars{download: downloadProgress(d.Progress), extract: extractionProgress(d.Progress)}
+	}
+	return d.bars
+}
+
+// downloadProgress is DownloadProgress, or else the batch line or the line
+// drawn on Progress, for the download of release.
+func (d *Downloader) downloadProgress(release *Release) func(name string, done, total int64) {
+	if d.batch != nil && d.DownloadProgress == nil {
+		return d.batch.track(release.URL)
+	}
+	if d.DownloadProgress != nil || d.Progress == nil {
+		return d.DownloadProgress
+	}
+	return d.progressBars().download
+}
+
+// extractProgress is ExtractProgress, or else the line drawn on Progress.
+func (d *Downloader) extractProgress() func(done, total int) {
+	if d.ExtractProgress != nil || d.Progress == nil {
+		return d.ExtractProgress
+	}
+	return d.progressBars().extract
+}
+
+// batchProgress sums the downloads of a batch that run at once into a
+// single "downloaded N/M files, X/Y MB" line, M being the downloads
+// started so far, so that they do not redraw over each other. On a
+// terminal the line is redrawn at most every interval; otherwise a plain
+// line is written every interval. It is safe for concurrent use.
+type batchProgress struct {
+	w        io.Writer
+	tty      bool
+	interval time.Duration
+
+	mu        sync.Mutex
+	last      time.Time
+	open      bool
+	downloads map[string]*fileProgress
+}
+
+// fileProgress is how far one download of a batch has got.
+type fileProgress struct {
+	done, total int64
+}
+
+func newBatchProgress(w io.Writer, tty bool, interval time.Duration) *batchProgress {
+	return &batchProgress{w: w, tty: tty, interval: interval, last: time.Now(), downloads: make(map[string]*fileProgress)}
+}
+
+// track returns the DownloadProgress callback of the download of url.
+func (b *batchProgress) track(url string) func(name string, done, total int64) {
+	return func(_ string, done, total int64) {
+		b.update(url, done, total)
+	}
+}
+
+func (b *batchProgress) update(url string, done, total int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f, ok := b.downloads[url]
+	if !ok {
+		f = &fileProgress{}
+		b.downloads[url] = f
+	}
+	f.done, f.total = done, total
+
+	finished, _, _ := b.totals()
+	all := finished == len(b.downloads)
+	if !(all && b.tty) && time.Since(b.last) < b.interval {
+		return
+	}
+	b.last = time.Now()
+	b.draw(all)
+}
+
+// totals returns how many downloads have finished and the bytes done so
+// far across all of them, with the bytes expected in total or -1 when a
+// download did not say.
+func (b *batchProgress) totals() (finished int, done, total int64) {
+	for _, f := range b.downloads {
+		if f.total > 0 && f.done == f.total {
+			finished++
+		}
+		done += f.done
+		if f.total <= 0 || total < 0 {
+			total = -1
+		} else {
+			total += f.total
+		}
+	}
+	return finished, done, total
+}
+
+func (b *batchProgress) draw(all bool) {
+	finished, done, total := b.totals()
+	line := fmt.Sprintf("downloaded %d/%d files, %.1f MB", finished, len(b.downloads), float64(done)/(1<<20))
+	if total > 0 {
+		line = fmt.Sprintf("downloaded %d/%d files, %.1f/%.1f MB", finished, len(b.downloads), float64(done)/(1<<20), float64(total)/(1<<20))
+	}
+	if !b.tty {
+		fmt.Fprintln(b.w, line)
+		return
+	}
+	fmt.Fprint(b.w, "\r"+line)
+	b.open = !all
+	if all {
+		fmt.Fprintln(b.w)
+	}
+}
+
+// close ends a line left open by a download that did not finish.
+func (b *batchProgress) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open {
+		fmt.Fprintln(b.w)
+		b.open = false
+	}
+}
+
+// progressReader reports the bytes read through it to a DownloadProgress
+// callback.
+type progressReader struct {
+	r        io.Reader
+	name     string
+	done     int64
+	total    int64
+	progress func(name string, done, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.progress(p.name, p.done, p.total)
+	}
+	return n, err
+}
+
+// countingReader counts the bytes read through it, safely for reading the
+// count from another goroutine.
+type countingReader struct {
+	n int64
+	r io.Reader
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func (c *countingReader) count() int64 { return atomic.LoadInt64(&c.n) }
+
+// heartbeat logs the bytes read through counter every d.Heartbeat until the
+// returned func is called.
+func (d *Downloader) heartbeat(counter *countingReader, name string) func() {
+	ticker := time.NewTicker(d.Heartbeat)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				fmt.Fprintf(d.Log, "%s: downloaded %.1f MB so far...\n", name, float64(counter.count())/(1<<20))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
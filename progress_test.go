@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedBuffer is a bytes.Buffer safe to log to from several goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestHeartbeat(t *testing.T) {
+	s := newTestServer(t)
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		// A slow download, a fifth of the archive at a time.
+		chunk := len(archive)/5 + 1
+		for len(archive) > 0 {
+			n := chunk
+			if n > len(archive) {
+				n = len(archive)
+			}
+			w.Write(archive[:n])
+			w.(http.Flusher).Flush()
+			archive = archive[n:]
+			time.Sleep(40 * time.Millisecond)
+		}
+	})
+	d := s.downloader()
+	var log lockedBuffer
+	d.Log = &log
+	d.Heartbeat = 30 * time.Millisecond
+	release, err := d.Resolve("115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DownloadTo(release, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	beats := regexp.MustCompile(`(?m)^chromedriver-linux64\.zip: downloaded \d+\.\d MB so far\.\.\.$`).FindAllString(log.String(), -1)
+	if len(beats) < 2 {
+		t.Errorf("logged %q, want periodic heartbeats", log.String())
+	}
+	// They stop with the download.
+	logged := log.String()
+	time.Sleep(100 * time.Millisecond)
+	if log.String() != logged {
+		t.Errorf("heartbeats went on after the download: %q", log.String())
+	}
+}
+
+func TestHeartbeatFlag(t *testing.T) {
+	if isTerminal(os.Stderr) {
+		t.Skip("stderr is a terminal, which gets a progress bar instead")
+	}
+	d, _ := flagDownloader(t, "--heartbeat-interval", "5s")
+	if d.Heartbeat != 5*time.Second {
+		t.Errorf("Heartbeat = %s, want 5s", d.Heartbeat)
+	}
+	if d, _ = flagDownloader(t, "--heartbeat-interval", "0"); d.Heartbeat != 0 {
+		t.Errorf("--heartbeat-interval=0 left Heartbeat %s", d.Heartbeat)
+	}
+}
+
+func TestProgressMinSize(t *testing.T) {
+	s := newTestServer(t)
+	download := func(minSize int64) string {
+		t.Helper()
+		d := s.downloader()
+		var bar bytes.Buffer
+		d.Progress = &bar
+		d.ProgressMinSize = minSize
+		release, err := d.Resolve("115")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.DownloadTo(release, ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+		return bar.String()
+	}
+	// The test archive is well under the default 1MB.
+	if bar := download(1 << 20); bar != "" {
+		t.Errorf("drew %q for an archive under --progress-min-size", bar)
+	}
+	if bar := download(0); !regexp.MustCompile(`\rdownloading chromedriver-linux64\.zip: 0\.0/0\.0 MB \(100%\)\n$`).MatchString(bar) {
+		t.Errorf("drew %q, want a finished bar without a minimum size", bar)
+	}
+}
+
+func TestProgressResetsOnRetry(t *testing.T) {
+	s := newTestServer(t)
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	attempts := 0
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+		if attempts == 1 {
+			// Half the archive, then the connection drops.
+			w.Write(archive[:len(archive)/2])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write(archive)
+	})
+	d := s.downloader()
+	d.Backoff = time.Millisecond
+	type event struct{ done, total int64 }
+	var events []event
+	d.DownloadProgress = func(name string, done, total int64) {
+		events = append(events, event{done, total})
+	}
+	release, err := d.Resolve("115.0.5790.102")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, cleanup, err := d.Download(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if attempts != 2 {
+		t.Fatalf("took %d attempts, want a retry", attempts)
+	}
+	if b, _ := ioutil.ReadFile(path); !bytes.Equal(b, archive) {
+		t.Fatal("the retried download is not the archive")
+	}
+
+	var starts []int
+	for i, e := range events {
+		if e.done == 0 {
+			starts = append(starts, i)
+		}
+	}
+	if len(starts) != 2 || starts[0] != 0 {
+		t.Fatalf("progress went %v, want each of the two attempts to start at 0", events)
+	}
+	if failed := events[starts[1]-1]; failed.done <= 0 || failed.done >= int64(len(archive)) {
+		t.Errorf("the first attempt got to %d of %d before failing, want part way", failed.done, len(archive))
+	}
+	if last := events[len(events)-1]; last.done != int64(len(archive)) || last.total != int64(len(archive)) {
+		t.Errorf("progress ended at %d/%d, want the whole %d", last.done, last.total, len(archive))
+	}
+
+	// Drawn, the failed attempt's line is closed and a new one reaches 100%.
+	var bar bytes.Buffer
+	draw := downloadProgress(&bar)
+	for _, e := range events {
+		draw("chromedriver-linux64.zip", e.done, e.total)
+	}
+	lines := strings.Split(strings.TrimSuffix(bar.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], " (interrupted, restarting)") || !strings.HasSuffix(lines[1], "(100%)") {
+		t.Errorf("drew %q, want an interrupted line and a finished one", bar.String())
+	}
+}
+
+func TestOutputWriters(t *testing.T) {
+	// Anything written to the process's own streams lands in these files
+	// instead, so the test can tell the Downloader kept off them.
+	savedOut, savedErr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = savedOut, savedErr }()
+	dir := t.TempDir()
+	for name, f := range map[string]**os.File{"stdout": &os.Stdout, "stderr": &os.Stderr} {
+		w, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		*f = w
+	}
+
+	s := newTestServer(t)
+	d := s.downloader()
+	var log, progress bytes.Buffer
+	d.Log = &log
+	d.Progress = &progress
+	d.Verbose = true
+	release, err := d.Resolve("115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, cleanup, err := d.Download(release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	if _, err := d.Extract(path, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`(?s)^\rdownloading chromedriver-linux64\.zip: .*\(100%\)\n.*\rextracted 3/3 files\n$`).MatchString(progress.String()) {
+		t.Errorf("Progress got %q, want a download and an extraction line", progress.String())
+	}
+	if log.String() == "" || strings.Contains(log.String(), "\r") {
+		t.Errorf("Log got %q, want the messages without progress lines", log.String())
+	}
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		if info, err := f.Stat(); err != nil || info.Size() != 0 {
+			t.Errorf("wrote to the process's own %s", f.Name())
+		}
+	}
+}
+
+func TestBatchProgress(t *testing.T) {
+	const files, size, chunk = 8, 1 << 20, 1 << 14
+	for _, tty := range []bool{true, false} {
+		var w lockedBuffer
+		b := newBatchProgress(&w, tty, time.Hour)
+		if !tty {
+			b.interval = 0
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < files; i++ {
+			report := b.track("https://dl.invalid/" + strconv.Itoa(i) + "/chromedriver-linux64.zip")
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for done := int64(0); done <= size; done += chunk {
+					report("chromedriver-linux64.zip", done, size)
+				}
+			}()
+		}
+		wg.Wait()
+		b.close()
+
+		finished, done, total := b.totals()
+		if finished != files || done != files*size || total != files*size {
+			t.Errorf("tty %v: summed %d files, %d/%d bytes, want %d files of %d bytes", tty, finished, done, total, files, size)
+		}
+		want := "downloaded 8/8 files, 8.0/8.0 MB\n"
+		if tty {
+			want = "\r" + want
+		}
+		if !strings.HasSuffix(w.String(), want) {
+			t.Errorf("tty %v: drew %q, want it to end %q", tty, w.String(), want)
+		}
+		// Every line is one of the sums, never a per-file bar.
+		for _, line := range strings.FieldsFunc(w.String(), func(r rune) bool { return r == '\r' || r == '\n' }) {
+			if !regexp.MustCompile(`^downloaded [0-8]/[1-8] files, \d+\.\d/\d+\.\d MB$`).MatchString(line) {
+				t.Errorf("tty %v: drew %q", tty, line)
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// rateLimitedReader caps reads from r at rate bytes per second with a token
+// bucket holding at most one second's worth of bytes. The bucket starts
+// empty so even short downloads respect the cap.
+type rateLimitedReader struct {
+	r      io.Reader
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimitedReader(r io.Reader, rate int64) *rateLimitedReader {
+	return &rateLimitedReader{r: r, rate: rate, last: time.Now()}
+}
+
+func (l *rateLimitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.rate {
+		p = p[:l.rate]
+	}
+
+	n, err := l.r.Read(p)
+
+	// Pay for the bytes after reading them, so a short final read only
+	// waits for what it actually returned.
+	l.refill()
+	l.tokens -= float64(n)
+	if l.tokens < 0 {
+		time.Sleep(time.Duration(-l.tokens / float64(l.rate) * float64(time.Second)))
+		l.refill()
+	}
+	return n, err
+}
+
+func (l *rateLimitedReader) refill() {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if max := float64(l.rate); l.tokens > max {
+		l.tokens = max
+	}
+	l.last = now
+}
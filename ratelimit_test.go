@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestMaxRate(t *testing.T) {
+	d, _ := flagDownloader(t, "--max-rate", "200KB")
+	if d.MaxRate != 200<<10 {
+		t.Fatalf("--max-rate=200KB set %d bytes per second", d.MaxRate)
+	}
+	body := bytes.Repeat([]byte("c"), 100<<10)
+	stub := stubDownloader(t, body)
+	stub.MaxRate = d.MaxRate
+
+	start := time.Now()
+	if err := stub.DownloadTo(&Release{URL: "https://dl.invalid/chromedriver-linux64.zip"}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	// 100KB at 200KB/s takes half a second; allow for the clock.
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("downloaded 100KB in %s at 200KB/s", elapsed)
+	}
+
+	stub.MaxRate = 0
+	start = time.Now()
+	if err := stub.DownloadTo(&Release{URL: "https://dl.invalid/chromedriver-linux64.zip"}, ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("an uncapped download took %s", elapsed)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expectedDriver is what the manifest in --out, or else the lockfile, says
+// is installed there.
+type expectedDriver struct {
+	Version  string
+	Platform string
+	// Binary is where the driver should be, empty when only the lockfile
+	// is known and the layout is not.
+	Binary string
+	SHA256 string
+	// fromManifest is set when the manifest described it and is to be
+	// rewritten after a repair.
+	fromManifest bool
+}
+
+func readExpectedDriver(dir, lockPath string) (*expectedDriver, error) {
+	if m, err := readManifest(dir); err == nil {
+		return &expectedDriver{Version: m.Version, Platform: m.Platform, Binary: m.Binary, SHA256: m.SHA256, fromManifest: true}, nil
+	}
+	lock, err := readLockfile(lockPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("nothing to repair: no %s in %s and no %s", manifestName, dir, lockPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &expectedDriver{Version: lock.Version, Platform: lock.Platform, SHA256: lock.SHA256}, nil
+}
+
+// broken reports why the driver at binary is not the expected one, or ""
+// when it is.
+func (e *expectedDriver) broken(binary string) string {
+	version, err := driverVersion(binary)
+	if err != nil {
+		return err.Error()
+	}
+	if version != e.Version {
+		return fmt.Sprintf("%s reports %s", binary, version)
+	}
+	if e.SHA256 == "" {
+		return ""
+	}
+	sum, err := fileSHA256(binary)
+	if err != nil {
+		return err.Error()
+	}
+	if !strings.EqualFold(sum, e.SHA256) {
+		return fmt.Sprintf("%s has sha256 %s, expected %s", binary, sum, e.SHA256)
+	}
+	return ""
+}
+
+// repair implements the repair command: when the driver that the manifest
+// or lockfile says dir holds is missing or broken it is extracted again,
+// from the cached archive when there is one and downloaded otherwise.
+func (c *cli) repair(d *Downloader, w io.Writer, dir string) error {
+	want, err := readExpectedDriver(dir, c.lockfilePath)
+	if err != nil {
+		return err
+	}
+	binary := want.Binary
+	if binary == "" {
+		if path, ok := findInstalledVersion(dir, want.Version); ok {
+			binary = path
+		}
+	}
+	if binary != "" {
+		problem := want.broken(binary)
+		if problem == "" {
+			fmt.Fprintf(w, "ok: %s (%s)\n", want.Version, binary)
+			return nil
+		}
+		fmt.Fprintf(w, "repairing %s: %s\n", want.Version, problem)
+	} else {
+		fmt.Fprintf(w, "repairing %s: no driver in %s\n", want.Version, dir)
+	}
+
+	if want.Platform != "" {
+		d.Platform = want.Platform
+		d.AutoPlatform = false
+	}
+	release, err := d.Resolve(want.Version)
+	if err != nil {
+		return inPhase("resolve", want.Version, err)
+	}
+	d.CacheDir = ""
+	if _, _, ok := (&Downloader{CacheDir: c.cacheDir, Log: d.Log}).lookupCached(release); ok {
+		d.CacheDir = c.cacheDir
+	}
+	files, err := c.install(d, release, dir)
+	if err != nil {
+		return err
+	}
+	// A binary that lived directly in dir was installed flat.
+	if binary == "" || sameDir(filepath.Dir(binary), dir) {
+		if files, err = flattenFiles(dir, files); err != nil {
+			return inPhase("extract", release.Version, err)
+		}
+	}
+	restored, ok := driverBinary(files)
+	if !ok {
+		return fmt.Errorf("repairing %s: no chromedriver binary in %s", want.Version, filepath.Base(release.URL))
+	}
+	if problem := want.broken(restored); problem != "" {
+		return fmt.Errorf("repairing %s: %s", want.Version, problem)
+	}
+	if want.fromManifest {
+		if _, err := writeManifest(release, files, dir); err != nil {
+			return inPhase("manifest", release.Version, err)
+		}
+	}
+	fmt.Fprintf(w, "repaired %s (%s)\n", release.Version, restored)
+	return nil
+}
+
+func sameDir(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
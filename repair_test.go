@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out, cache := t.TempDir(), t.TempDir()
+	const archive = "/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"
+	if _, _, err := runCLI(t, s.args(t, out, "--cache", "--cache-dir", cache, "--manifest", "-v", "115")...); err != nil {
+		t.Fatal(err)
+	}
+	repair := func() string {
+		t.Helper()
+		stdout, _, err := runCLI(t, append([]string{"repair"}, s.args(t, out, "--cache-dir", cache)...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stdout
+	}
+	binary := filepath.Join(out, "chromedriver")
+
+	if stdout := repair(); stdout != "ok: 115.0.5790.102 ("+binary+")\n" {
+		t.Errorf("printed %q for an intact install", stdout)
+	}
+
+	// A deleted binary comes back from the cached archive.
+	if err := os.Remove(binary); err != nil {
+		t.Fatal(err)
+	}
+	stdout := repair()
+	if !strings.Contains(stdout, "repairing 115.0.5790.102: ") || !strings.HasSuffix(stdout, "repaired 115.0.5790.102 ("+binary+")\n") {
+		t.Errorf("printed %q, want the repair reported", stdout)
+	}
+	if !isInstalledIn(out, "115.0.5790.102") {
+		t.Error("the deleted driver was not restored")
+	}
+	if n := s.hitCount(archive); n != 1 {
+		t.Errorf("downloaded the driver %d times, want it restored from the cache", n)
+	}
+
+	// So does one that no longer reports its version, downloaded again
+	// once the cache is gone.
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(cache); err != nil {
+		t.Fatal(err)
+	}
+	if stdout := repair(); !strings.HasSuffix(stdout, "repaired 115.0.5790.102 ("+binary+")\n") {
+		t.Errorf("printed %q, want the broken driver repaired", stdout)
+	}
+	if !isInstalledIn(out, "115.0.5790.102") {
+		t.Error("the broken driver was not restored")
+	}
+	if n := s.hitCount(archive); n != 2 {
+		t.Errorf("downloaded the driver %d times, want it fetched again without a cache", n)
+	}
+
+	// Without a manifest or lockfile there is nothing to go by.
+	_, _, err := runCLI(t, append([]string{"repair"}, s.args(t, t.TempDir(), "--lockfile", filepath.Join(t.TempDir(), lockfileName))...)...)
+	if err == nil || !strings.Contains(err.Error(), "nothing to repair") {
+		t.Errorf("got %v, want nothing to repair", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// reportCase is the outcome of installing one version for one platform,
+// collected for --report and --summary-json.
+type reportCase struct {
+	Spec     string
+	Platform string
+	Duration time.Duration
+	Err      error
+	Skipped  bool
+	// Version and Transfer describe the driver installed, when one was.
+	Version  string
+	Transfer transfer
+}
+
+// startCase prepares for installing the next case, so that one failing
+// is not credited with the driver of the case before.
+func (r *runRecord) startCase() time.Time {
+	r.result.url = ""
+	return time.Now()
+}
+
+// recordCase notes the outcome of installing spec for platform, which took
+// since start, with the transfers of its archive from stats.
+func (r *runRecord) recordCase(stats *TransferStats, spec, platform string, start time.Time, err error, skipped bool) {
+	if spec == "" {
+		spec = "latest"
+	}
+	c := reportCase{
+		Spec:     spec,
+		Platform: platform,
+		Duration: time.Since(start),
+		Err:      err,
+		Skipped:  skipped,
+	}
+	if err == nil && r.result.url != "" {
+		c.Version = r.result.Version
+		c.Transfer = stats.of(r.result.url)
+	}
+	r.cases = append(r.cases, c)
+}
+
+// parseReport splits a --report value of the form "junit=<path>".
+func parseReport(s string) (string, error) {
+	i := strings.Index(s, "=")
+	if i < 0 || s[:i] != "junit" || s[i+1:] == "" {
+		return "", fmt.Errorf("invalid --report %q: want junit=<path>", s)
+	}
+	return s[i+1:], nil
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// writeJUnitReport writes cases to path as a JUnit XML report with one
+// test case per version and platform.
+func writeJUnitReport(path string, cases []reportCase) error {
+	suite := junitSuite{Name: "get-chromedriver", Tests: len(cases)}
+	var total time.Duration
+	for _, c := range cases {
+		jc := junitCase{
+			Name:      c.Spec,
+			Classname: "chromedriver." + c.Platform,
+			Time:      junitSeconds(c.Duration),
+		}
+		switch {
+		case c.Skipped:
+			jc.Skipped = &junitSkipped{Message: c.Err.Error()}
+			suite.Skipped++
+		case c.Err != nil:
+			jc.Failure = &junitFailure{Message: c.Err.Error(), Text: c.Err.Error()}
+			suite.Failures++
+		}
+		total += c.Duration
+		suite.Cases = append(suite.Cases, jc)
+	}
+	suite.Time = junitSeconds(total)
+
+	b, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append([]byte(xml.Header), b...)
+	if err := os.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
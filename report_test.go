@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readJUnitReport parses the only suite of the JUnit report at path.
+func readJUnitReport(t *testing.T, path string) junitSuite {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report junitSuites
+	if err := xml.Unmarshal(b, &report); err != nil {
+		t.Fatalf("parsing %s: %v", b, err)
+	}
+	if len(report.Suites) != 1 {
+		t.Fatalf("report %s, want one suite", b)
+	}
+	return report.Suites[0]
+}
+
+func TestJUnitReport(t *testing.T) {
+	s := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "report.xml")
+
+	// 116 has no win32 driver, which skips that platform.
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--report", "junit="+path, "--platforms", "linux64,win32", "-v", "116")...); err != nil {
+		t.Fatal(err)
+	}
+	suite := readJUnitReport(t, path)
+	if suite.Tests != 2 || suite.Failures != 0 || suite.Skipped != 1 || len(suite.Cases) != 2 {
+		t.Fatalf("suite %+v, want a pass and a skip", suite)
+	}
+	if c := suite.Cases[0]; c.Name != "116" || c.Classname != "chromedriver.linux64" || c.Failure != nil || c.Skipped != nil {
+		t.Errorf("first case %+v, want linux64 passed", c)
+	}
+	if c := suite.Cases[1]; c.Classname != "chromedriver.win32" || c.Skipped == nil || !strings.Contains(c.Skipped.Message, "win32") {
+		t.Errorf("second case %+v, want win32 skipped", c)
+	}
+
+	// A batch failing on its second version.
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--report", "junit="+path, "-v", "115", "-v", "999")...); err == nil {
+		t.Fatal("999 did not fail the batch")
+	}
+	suite = readJUnitReport(t, path)
+	if suite.Tests != 2 || suite.Failures != 1 || suite.Skipped != 0 || len(suite.Cases) != 2 {
+		t.Fatalf("suite %+v, want a pass and a failure", suite)
+	}
+	if c := suite.Cases[0]; c.Name != "115" || c.Failure != nil {
+		t.Errorf("first case %+v, want 115 passed", c)
+	}
+	c := suite.Cases[1]
+	if c.Name != "999" || c.Failure == nil || !strings.Contains(c.Failure.Message, "999") || c.Failure.Text != c.Failure.Message {
+		t.Errorf("second case %+v, want 999 failed with its error", c)
+	}
+	for _, c := range suite.Cases {
+		if !strings.Contains(c.Time, ".") {
+			t.Errorf("case %s timed %q, want seconds", c.Name, c.Time)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// RunResult describes what a run did. With several drivers installed the
+// version, platform and paths are those of the last; the byte count and
+// cache hit cover the whole run.
+type RunResult struct {
+	Version    string
+	Platform   string
+	OutputPath string
+	Binary     string
+	// BytesDownloaded counts archive bytes fetched over the network.
+	BytesDownloaded int64
+	// CacheHit is set when every archive the run needed came from the
+	// cache.
+	CacheHit bool
+	Duration time.Duration
+
+	// url is the archive of the driver last installed.
+	url string
+}
+
+// TransferStats counts archive transfers, in total and by archive URL,
+// safely across the goroutines and Downloader copies sharing it.
+type TransferStats struct {
+	mu    sync.Mutex
+	total transfer
+	byURL map[string]transfer
+}
+
+// transfer counts the downloads of one archive, or of all.
+type transfer struct {
+	bytes     int64
+	downloads int
+	cacheHits int
+}
+
+func (t transfer) cacheHit() bool { return t.cacheHits > 0 && t.downloads == 0 }
+
+func (s *TransferStats) add(url string, t transfer) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byURL == nil {
+		s.byURL = make(map[string]transfer)
+	}
+	u := s.byURL[url]
+	for _, c := range []*transfer{&s.total, &u} {
+		c.bytes += t.bytes
+		c.downloads += t.downloads
+		c.cacheHits += t.cacheHits
+	}
+	s.byURL[url] = u
+}
+
+func (s *TransferStats) addDownload(url string, n int64) {
+	s.add(url, transfer{bytes: n, downloads: 1})
+}
+
+func (s *TransferStats) addCacheHit(url string) {
+	s.add(url, transfer{cacheHits: 1})
+}
+
+// of returns the transfers of the archive at url.
+func (s *TransferStats) of(url string) transfer {
+	if s == nil {
+		return transfer{}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.byURL[url]
+}
+
+// runRecord collects the outcome of a run as drivers are installed: its
+// result, and the cases --report and --summary-json describe.
+type runRecord struct {
+	result RunResult
+	// cases are those of the run in the order they finished.
+	cases []reportCase
+}
+
+// noteInstall records that release is installed in dir with binary, also
+// when an earlier run installed it.
+func (r *runRecord) noteInstall(release *Release, dir, binary string) {
+	r.result.Version = release.Version
+	r.result.Platform = release.Platform
+	r.result.OutputPath = dir
+	r.result.Binary = binary
+	r.result.url = release.URL
+}
+
+// finish fills in the run-wide fields of the result from stats.
+func (r *RunResult) finish(stats *TransferStats, start time.Time) {
+	stats.mu.Lock()
+	total := stats.total
+	stats.mu.Unlock()
+	r.BytesDownloaded = total.bytes
+	r.CacheHit = total.cacheHit()
+	r.Duration = time.Since(start)
+}
+
+// printResult writes the --verbose summary of r.
+func printResult(w io.Writer, r *RunResult) {
+	if r.Version == "" {
+		return
+	}
+	source := fmt.Sprintf("downloaded %d bytes", r.BytesDownloaded)
+	if r.CacheHit {
+		source = "from cache"
+	}
+	fmt.Fprintf(w, "%s (%s) in %s: %s, %s, took %s\n", r.Version, r.Platform, r.OutputPath, r.Binary, source, r.Duration.Round(time.Millisecond))
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunResult(t *testing.T) {
+	s := newTestServer(t)
+	cacheDir := t.TempDir()
+	archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	run := func() *RunResult {
+		t.Helper()
+		out := t.TempDir()
+		c, err := newCLI(s.args(t, out, "--cache", "--cache-dir", cacheDir, "-v", "115"), &bytes.Buffer{}, &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := c.run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := RunResult{
+			Version:    "115.0.5790.102",
+			Platform:   "linux64",
+			OutputPath: out,
+			Binary:     filepath.Join(out, "chromedriver"),
+		}
+		got := *result
+		got.BytesDownloaded, got.CacheHit, got.Duration, got.url = 0, false, 0, ""
+		if got != want {
+			t.Errorf("result %+v, want %+v", got, want)
+		}
+		if result.Duration <= 0 {
+			t.Errorf("took %s", result.Duration)
+		}
+		return result
+	}
+
+	first := run()
+	if first.CacheHit || first.BytesDownloaded != int64(len(archive)) {
+		t.Errorf("first run: cache hit %v, downloaded %d bytes, want a miss and %d", first.CacheHit, first.BytesDownloaded, len(archive))
+	}
+	second := run()
+	if !second.CacheHit || second.BytesDownloaded != 0 {
+		t.Errorf("second run: cache hit %v, downloaded %d bytes, want a hit and none", second.CacheHit, second.BytesDownloaded)
+	}
+}
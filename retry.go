@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// get issues a GET for url through request.
+func (d *Downloader) get(url string) (*http.Response, error) {
+	return d.request(http.MethodGet, url)
+}
+
+// head issues a HEAD for url through request.
+func (d *Downloader) head(url string) (*http.Response, error) {
+	return d.request(http.MethodHead, url)
+}
+
+// request sends a body-less request, retrying up to d.Retries more times
+// when it fails or the server answers 429 or 5xx. The delay between
+// attempts starts at d.Backoff and doubles each time.
+func (d *Downloader) request(method, url string) (*http.Response, error) {
+	delay := d.Backoff
+	for attempt := 0; ; attempt++ {
+		if err := d.Budget.check(); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", method, url, err)
+		}
+		req, err := http.NewRequestWithContext(d.context(), method, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+
+		var tracer *requestTracer
+		if d.Trace {
+			tracer = newRequestTracer(d.Log, req.URL.Host)
+			tracer.logf("%s %s", method, url)
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), tracer.clientTrace()))
+		}
+		resp, err := d.Client.Do(req)
+		if tracer != nil {
+			if err != nil {
+				tracer.logf("failed: %v", err)
+			} else {
+				tracer.response(resp)
+			}
+		}
+		if err == nil && method != http.MethodHead {
+			if derr := decodeBody(resp); derr != nil {
+				resp.Body.Close()
+				resp, err = nil, fmt.Errorf("decoding %s: %w", url, derr)
+			}
+		}
+		if err == nil && !d.retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt >= d.Retries || err != nil && !retryableError(err) {
+			if err != nil {
+				err = d.explainCertTime(url, err)
+			}
+			return resp, err
+		}
+
+		if err == nil {
+			err = fmt.Errorf("%s: %s", url, resp.Status)
+			resp.Body.Close()
+		}
+		if berr := d.Budget.take(delay); berr != nil {
+			return nil, fmt.Errorf("%v; %w", err, berr)
+		}
+		d.verbosef("attempt %d/%d failed: %v; retrying in %s\n", attempt+1, d.Retries+1, err, delay)
+		if err := d.sleep(delay); err != nil {
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// context returns d.Context, or the background context when it is unset.
+func (d *Downloader) context() context.Context {
+	if d.Context != nil {
+		return d.Context
+	}
+	return context.Background()
+}
+
+// sleep waits for delay, returning early with the context's error when the
+// run is cancelled.
+func (d *Downloader) sleep(delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-d.context().Done():
+		return d.context().Err()
+	}
+}
+
+// retry calls fn until it succeeds or reports its error as not retryable,
+// at most Retries more times, with the same backoff as request. It is for
+// steps that can fail after the request itself went through, such as
+// reading a truncated body.
+func (d *Downloader) retry(fn func() (bool, error)) error {
+	delay := d.Backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := fn()
+		if err == nil || !retryable || attempt >= d.Retries {
+			return err
+		}
+		if berr := d.Budget.take(delay); berr != nil {
+			return fmt.Errorf("%v; %w", err, berr)
+		}
+		d.verbosef("attempt %d/%d failed: %v; retrying in %s\n", attempt+1, d.Retries+1, err, delay)
+		if err := d.sleep(delay); err != nil {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// retryBudget caps the retries of a whole run, across every request and
+// every copy of the Downloader sharing it. A nil budget is unlimited.
+type retryBudget struct {
+	mu sync.Mutex
+	// remaining is how many retries are left; negative means no limit.
+	remaining int
+	// deadline, when set, is when the run gives up.
+	deadline time.Time
+}
+
+func newRetryBudget(maxRetries int, deadline time.Duration) *retryBudget {
+	b := &retryBudget{remaining: maxRetries}
+	if deadline > 0 {
+		b.deadline = time.Now().Add(deadline)
+	}
+	return b
+}
+
+// check fails once the deadline has passed.
+func (b *retryBudget) check() error {
+	if b == nil || b.deadline.IsZero() || time.Now().Before(b.deadline) {
+		return nil
+	}
+	return fmt.Errorf("%w: deadline passed", ErrBudgetExhausted)
+}
+
+// take spends one retry that first waits delay, failing when no retries
+// are left or the wait would run past the deadline.
+func (b *retryBudget) take(delay time.Duration) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.remaining == 0 {
+		return fmt.Errorf("%w: no retries left", ErrBudgetExhausted)
+	}
+	if !b.deadline.IsZero() && time.Now().Add(delay).After(b.deadline) {
+		return fmt.Errorf("%w: deadline passed", ErrBudgetExhausted)
+	}
+	if b.remaining > 0 {
+		b.remaining--
+	}
+	return nil
+}
+
+// retryableError reports whether a failed request is worth repeating.
+// Lookups that fail right after a container starts, before its resolver is
+// up, are retried like any network error, timeouts and "no such host"
+// included. Certificate failures, cancellation and --no-network will not
+// change on a second try.
+func retryableError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var (
+		invalid    x509.CertificateInvalidError
+		unknown    x509.UnknownAuthorityError
+		hostname   x509.HostnameError
+		recordHead tls.RecordHeaderError
+	)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrNetworkDisabled),
+		errors.As(err, &invalid), errors.As(err, &unknown), errors.As(err, &hostname), errors.As(err, &recordHead):
+		return false
+	}
+	return true
+}
+
+// retryableStatus reports whether a response with the status code is worth
+// repeating the request for: one of RetryStatuses when set, and otherwise
+// 429 or a 5xx.
+func (d *Downloader) retryableStatus(code int) bool {
+	if d.RetryStatuses != nil {
+		for _, c := range d.RetryStatuses {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// parseRetryOn parses --retry-on, a comma-separated list of HTTP statuses.
+func parseRetryOn(s string) ([]int, error) {
+	var codes []int
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		code, err := strconv.Atoi(field)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid --retry-on status %q: want HTTP statuses such as 502,503", field)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// verbosef prints diagnostics to d.Log when d.Verbose is set.
+func (d *Downloader) verbosef(format string, args ...interface{}) {
+	if d.Verbose {
+		fmt.Fprintf(d.Log, format, args...)
+	}
+}
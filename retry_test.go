@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetriesAttempts(t *testing.T) {
+	for _, retries := range []string{"0", "1", "3"} {
+		c, err := newCLI([]string{"--retries", retries}, &bytes.Buffer{}, &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := c.newDownloaderFromFlags()
+		if err != nil {
+			t.Fatal(err)
+		}
+		attempts := 0
+		d.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return stubResponse(req, http.StatusServiceUnavailable, nil), nil
+		})}
+		var log bytes.Buffer
+		d.Log = &log
+		d.Verbose = true
+		d.Backoff = time.Millisecond
+
+		resp, err := d.get("https://dl.invalid/chromedriver-linux64.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("--retries=%s: got %s", retries, resp.Status)
+		}
+		if want := d.Retries + 1; attempts != want {
+			t.Errorf("--retries=%s: made %d attempts, want %d", retries, attempts, want)
+		}
+		if logged := strings.Count(log.String(), "retrying in"); logged != d.Retries {
+			t.Errorf("--retries=%s: logged %d retries, want %d:\n%s", retries, logged, d.Retries, log.String())
+		}
+		if d.Retries > 0 && !strings.Contains(log.String(), "503 Service Unavailable; retrying in 1ms") {
+			t.Errorf("--retries=%s: logged %q, want the error and delay", retries, log.String())
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	s := newTestServer(t)
+	// The first version downloads at once, the second after two failures
+	// and the third never.
+	failures := map[string]int{"115.0.5790.102": 2, testStable: 100}
+	var mu sync.Mutex
+	for version, n := range failures {
+		version, n := version, n
+		s.mux.HandleFunc("/dl/"+version+"/linux64/", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			if n > 0 {
+				n--
+				http.Error(w, "busy", http.StatusServiceUnavailable)
+				return
+			}
+			w.Write(testArchive(t, "chromedriver-linux64.zip", version, "linux64"))
+		})
+	}
+	specs := []string{"115.0.5790.98", "115.0.5790.102", testStable}
+	var stdout, stderr bytes.Buffer
+	args := s.args(t, t.TempDir(), "--max-total-retries", "3", "--max-connections", "1",
+		"-v", specs[0], "-v", specs[1], "-v", specs[2])
+	c, err := newCLI(setFlag(args, "retries", "5"), &stdout, &stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := c.newDownloaderFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As run does, but with retries left quick.
+	d.Backoff = time.Millisecond
+	d.Log = ioutil.Discard
+	d.Stats = &TransferStats{}
+	c.record = &runRecord{}
+
+	err = c.runCommand(d)
+	if !errors.Is(err, ErrBudgetExhausted) {
+		t.Fatalf("got %v, want the retry budget exhausted", err)
+	}
+	// Two of the three retries went to the second version, leaving one for
+	// the third rather than its own five.
+	if n := s.hitCount("/dl/" + testStable + "/linux64/chromedriver-linux64.zip"); n != 2 {
+		t.Errorf("fetched %s %d times, want 2", testStable, n)
+	}
+	if want := "completed 115.0.5790.98, 115.0.5790.102 before the failure\n"; !strings.Contains(stderr.String(), want) {
+		t.Errorf("printed %q, want %q", stderr.String(), want)
+	}
+}
+
+func TestRetryBudgetDeadline(t *testing.T) {
+	b := newRetryBudget(-1, time.Hour)
+	if err := b.take(time.Minute); err != nil {
+		t.Errorf("a retry well within the deadline: %v", err)
+	}
+	if err := b.take(2 * time.Hour); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("a retry waiting past the deadline: got %v", err)
+	}
+	b = newRetryBudget(-1, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if err := b.check(); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("after the deadline: got %v", err)
+	}
+	var unlimited *retryBudget
+	if err := unlimited.take(time.Hour); err != nil {
+		t.Errorf("a nil budget: %v", err)
+	}
+}
+
+func TestRetryDNSFailure(t *testing.T) {
+	s := newTestServer(t)
+	// The resolver is not up for the first two attempts, as right after a
+	// container starts.
+	var mu sync.Mutex
+	lookups := 0
+	var dialer net.Dialer
+	d := s.downloader()
+	d.Client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lookups++
+			if lookups <= 2 {
+				return nil, &net.DNSError{Err: "server misbehaving", Name: "storage.googleapis.com", IsTemporary: true}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}}
+	d.Retries = 3
+	d.Backoff = time.Millisecond
+	d.Log = ioutil.Discard
+	resp, err := d.get(s.URL + "/feed.json")
+	if err != nil {
+		t.Fatalf("the retries did not recover: %v", err)
+	}
+	resp.Body.Close()
+	if lookups != 3 {
+		t.Errorf("dialed %d times, want 3", lookups)
+	}
+
+	for _, test := range []struct {
+		err       error
+		retryable bool
+	}{
+		{&net.DNSError{Err: "server misbehaving", IsTemporary: true}, true},
+		{&net.DNSError{Err: "no such host", IsNotFound: true}, true},
+		{x509.CertificateInvalidError{Reason: x509.Expired}, false},
+		{x509.UnknownAuthorityError{}, false},
+		{context.Canceled, false},
+		{ErrNetworkDisabled, false},
+	} {
+		wrapped := &url.Error{Op: "Get", URL: "https://storage.googleapis.com/", Err: test.err}
+		if got := retryableError(wrapped); got != test.retryable {
+			t.Errorf("retryableError(%v) = %v, want %v", wrapped, got, test.retryable)
+		}
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	// The second version's archive never comes.
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	out, temp := t.TempDir(), t.TempDir()
+	args := setFlag(s.args(t, out, "--deadline", "300ms", "--max-connections", "1", "-v", "115.0.5790.98", "-v", "115.0.5790.102"), "temp-dir", temp)
+	start := time.Now()
+	_, _, err := runCLI(t, args...)
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("the run went on for %s past a 300ms deadline", took)
+	}
+	if !errors.Is(err, ErrBudgetExhausted) || !strings.HasPrefix(err.Error(), "--deadline of 300ms passed; installed before it: 115.0.5790.98 (linux64): ") {
+		t.Errorf("got %v, want the deadline and what completed before it", err)
+	}
+	if !isInstalledIn(filepath.Join(out, "115.0.5790.98"), "115.0.5790.98") {
+		t.Error("the version finished before the deadline was not kept")
+	}
+	if _, err := os.Stat(filepath.Join(out, "115.0.5790.102")); !os.IsNotExist(err) {
+		t.Errorf("the version cut off by the deadline left its directory: %v", err)
+	}
+	if entries, _ := os.ReadDir(temp); len(entries) != 0 {
+		t.Errorf("left %s in the temp dir", entries[0].Name())
+	}
+}
+
+func TestRetryOn(t *testing.T) {
+	attempts := func(status int, args ...string) int {
+		t.Helper()
+		d, _ := flagDownloader(t, append([]string{"--retries", "2"}, args...)...)
+		n := 0
+		d.Client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			n++
+			return stubResponse(req, status, nil), nil
+		})}
+		d.Backoff = time.Millisecond
+		resp, err := d.get("https://dl.invalid/chromedriver-linux64.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return n
+	}
+	for _, test := range []struct {
+		status  int
+		retryOn string
+		want    int
+	}{
+		{http.StatusNotFound, "", 1},
+		{http.StatusServiceUnavailable, "", 3},
+		{http.StatusNotFound, "503,502,404", 3},
+		{http.StatusNotFound, "503,502", 1},
+		// The override replaces the defaults rather than adding to them.
+		{http.StatusServiceUnavailable, "404", 1},
+	} {
+		var args []string
+		if test.retryOn != "" {
+			args = []string{"--retry-on", test.retryOn}
+		}
+		if got := attempts(test.status, args...); got != test.want {
+			t.Errorf("%d with --retry-on=%q: made %d attempts, want %d", test.status, test.retryOn, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"404,", "abc", "503,99", "600"} {
+		c, err := newCLI([]string{"--retry-on", bad}, &bytes.Buffer{}, &bytes.Buffer{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.newDownloaderFromFlags(); err == nil || !strings.Contains(err.Error(), "invalid --retry-on status") {
+			t.Errorf("--retry-on=%s: got %v, want it refused", bad, err)
+		}
+	}
+}
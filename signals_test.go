@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSIGTERM(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	started := make(chan struct{}, 1)
+	s.mux.HandleFunc("/dl/115.0.5790.102/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		// Half the archive, of no stated size so that it goes to a temp
+		// file, then nothing until the client goes away.
+		archive := testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+		w.Write(archive[:len(archive)/2])
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		<-r.Context().Done()
+	})
+	out, temp := t.TempDir(), t.TempDir()
+	args := setFlag(s.args(t, out, "-v", "115"), "temp-dir", temp)
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), mainArgsEnv+"="+strings.Join(args, "\n"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("the download never started")
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if entries, _ := os.ReadDir(temp); len(entries) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			t.Fatal("the download made no temp file")
+		}
+	}
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+
+	if code := cmd.ProcessState.ExitCode(); code != 143 {
+		t.Errorf("exit code %d, want 143", code)
+	}
+	if !strings.Contains(stderr.String(), "interrupted (terminated)") {
+		t.Errorf("printed %q, want the interruption reported", stderr.String())
+	}
+	if entries, _ := os.ReadDir(temp); len(entries) != 0 {
+		t.Errorf("left %s in the temp dir", entries[0].Name())
+	}
+	if _, err := InstalledVersion(out); err == nil {
+		t.Error("an interrupted run installed a driver")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// versionsSince returns every published version newer than since, oldest
+// first, that has a driver for d's platform. A partial since such as 115
+// stands for all of its versions, so only those after them are returned.
+// Versions the list knows no downloads for, as from the downloads page,
+// are kept and left to the install to check.
+func versionsSince(d *Downloader, since string) ([]string, error) {
+	for _, part := range strings.Split(since, ".") {
+		if !isMajor(part) {
+			return nil, fmt.Errorf("invalid --since-version %q: want a version such as 115 or 115.0.5790.102", since)
+		}
+	}
+	list, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+	var newer []string
+	for _, major := range list.Majors {
+		for _, version := range list.Versions[major] {
+			if compareVersions(version, since) <= 0 || strings.HasPrefix(version, since+".") {
+				continue
+			}
+			if downloads, ok := list.Downloads[version]; ok && downloads[d.Platform] == "" {
+				d.verbosef("skipping %s: it has no %s driver\n", version, d.Platform)
+				continue
+			}
+			newer = append(newer, version)
+		}
+	}
+	// The list is newest first; installing oldest first leaves the mirror
+	// complete up to where an interrupted run stopped.
+	for i, j := 0, len(newer)-1; i < j; i, j = i+1, j-1 {
+		newer[i], newer[j] = newer[j], newer[i]
+	}
+	return newer, nil
+}
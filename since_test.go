@@ -0,0 +1,56 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSinceVersion(t *testing.T) {
+	skipOnWindows(t)
+	s := newTestServer(t)
+	out := t.TempDir()
+	// 116 is in the mirror already.
+	if _, _, err := runCLI(t, s.args(t, filepath.Join(out, testStable), "-v", testStable)...); err != nil {
+		t.Fatal(err)
+	}
+	stdout, _, err := runCLI(t, s.args(t, out, "--since-version", "115.0.5790.98")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for version, fetches := range map[string]int{
+		"115.0.5790.98":  0,
+		"115.0.5790.102": 1,
+		testStable:       1,
+		testPrerelease:   1,
+	} {
+		if n := s.hitCount("/dl/" + version + "/linux64/chromedriver-linux64.zip"); n != fetches {
+			t.Errorf("fetched %s %d times, want %d", version, n, fetches)
+		}
+		if installed := isInstalledIn(filepath.Join(out, version), version); installed != (fetches > 0) {
+			t.Errorf("%s installed in its directory: %v", version, installed)
+		}
+	}
+	if !strings.Contains(stdout, "skipped "+testStable+": already installed") {
+		t.Errorf("printed %q, want the installed 116 skipped", stdout)
+	}
+
+	// A major stands for all its versions.
+	d := s.downloader()
+	d.AllowPrerelease = true
+	versions, err := versionsSince(d, "115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(versions, " "); got != testStable+" "+testPrerelease {
+		t.Errorf("since 115: got %s, want 116 and 120, oldest first", got)
+	}
+
+	stdout, _, err = runCLI(t, s.args(t, out, "--since-version", testPrerelease)...)
+	if err != nil || !strings.Contains(stdout, "no drivers newer than "+testPrerelease) {
+		t.Errorf("since the newest: printed %q, %v", stdout, err)
+	}
+	if _, _, err := runCLI(t, s.args(t, out, "--since-version", "115.x")...); err == nil || !strings.Contains(err.Error(), "invalid --since-version") {
+		t.Errorf("got %v, want 115.x refused", err)
+	}
+}
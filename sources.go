@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// maxSourceFetches bounds how many version sources are fetched at once.
+const maxSourceFetches = 3
+
+// VersionSource is one place published driver versions can be read from.
+// List returns the versions grouped by major, plus whatever download and
+// revision data the source carries.
+type VersionSource interface {
+	Name() string
+	List(ctx context.Context) (*VersionList, error)
+}
+
+// versionSources maps the --source names to their implementations.
+var versionSources = map[string]func(d *Downloader) VersionSource{
+	"json":   func(d *Downloader) VersionSource { return feedSource{d} },
+	"html":   func(d *Downloader) VersionSource { return pageSource{d} },
+	"bucket": func(d *Downloader) VersionSource { return bucketSource{d} },
+}
+
+// defaultSources is the --source order used when none is given. The bucket
+// listing is left out as it is consulted anyway once these fail.
+var defaultSources = []string{"json", "html"}
+
+// parseSources resolves the comma-separated --source names for d.
+func parseSources(d *Downloader, names string) ([]VersionSource, error) {
+	var sources []VersionSource
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		newSource, ok := versionSources[name]
+		if !ok {
+			var known []string
+			for k := range versionSources {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown version source %q, expected one of %s", name, strings.Join(known, ", "))
+		}
+		sources = append(sources, newSource(d))
+	}
+	return sources, nil
+}
+
+// sources returns d.Sources, or the default ones when it is empty.
+func (d *Downloader) sources() []VersionSource {
+	if len(d.Sources) > 0 {
+		return d.Sources
+	}
+	sources, _ := parseSources(d, strings.Join(defaultSources, ","))
+	return sources
+}
+
+type feedSource struct{ d *Downloader }
+
+func (s feedSource) Name() string { return "chrome for testing feed" }
+
+func (s feedSource) List(ctx context.Context) (*VersionList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.d.fetchKnownGoodVersions()
+}
+
+type pageSource struct{ d *Downloader }
+
+func (s pageSource) Name() string { return "downloads page" }
+
+func (s pageSource) List(ctx context.Context) (*VersionList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	versionMap, err := s.d.scrapeVersions(false)
+	return &VersionList{Versions: versionMap}, err
+}
+
+type bucketSource struct{ d *Downloader }
+
+func (s bucketSource) Name() string { return "bucket listing" }
+
+func (s bucketSource) List(ctx context.Context) (*VersionList, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	versionMap, err := s.d.listBucket()
+	return &VersionList{Versions: versionMap}, err
+}
+
+// fetchSources reads every source concurrently. A failing source is logged
+// and left out, so the result holds whatever could be read, in the order
+// of sources, along with the errors of the rest in the same order however
+// the fetches finished.
+func (d *Downloader) fetchSources(ctx context.Context, sources []VersionSource) ([]*VersionList, []error) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make([]*VersionList, len(sources))
+		errs    = make([]error, len(sources))
+		slots   = make(chan struct{}, maxSourceFetches)
+	)
+	for i, src := range sources {
+		i, src := i, src
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			list, err := src.List(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				d.verbosef("version source %s failed: %v; continuing\n", src.Name(), err)
+				errs[i] = err
+				return
+			}
+			results[i] = list
+		}()
+	}
+	wg.Wait()
+
+	var (
+		lists  []*VersionList
+		failed []error
+	)
+	for i, list := range results {
+		if list != nil {
+			lists = append(lists, list)
+		}
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		}
+	}
+	return lists, failed
+}
+
+// mergeVersionLists unions the versions, downloads and revisions of lists,
+// dropping duplicate versions. Where lists disagree about a version's
+// downloads or revision the earliest list wins. Majors is left for the
+// caller to compute.
+func mergeVersionLists(lists ...*VersionList) *VersionList {
+	merged := &VersionList{
+		Versions:           make(map[string][]string),
+		Downloads:          make(map[string]map[string]string),
+		Revisions:          make(map[string]string),
+		ChromeDownloads:    make(map[string]map[string]string),
+		CompanionDownloads: make(map[string]map[string]map[string]string),
+		Sizes:              make(map[string]int64),
+	}
+	for i := len(lists) - 1; i >= 0; i-- {
+		list := lists[i]
+		for major, versions := range list.Versions {
+			for _, version := range versions {
+				if !containsString(merged.Versions[major], version) {
+					merged.Versions[major] = append(merged.Versions[major], version)
+				}
+			}
+		}
+		for version, assets := range list.Downloads {
+			merged.Downloads[version] = assets
+		}
+		for version, revision := range list.Revisions {
+			merged.Revisions[version] = revision
+		}
+		for version, assets := range list.ChromeDownloads {
+			merged.ChromeDownloads[version] = assets
+		}
+		for kind, downloads := range list.CompanionDownloads {
+			if merged.CompanionDownloads[kind] == nil {
+				merged.CompanionDownloads[kind] = make(map[string]map[string]string)
+			}
+			for version, assets := range downloads {
+				merged.CompanionDownloads[kind][version] = assets
+			}
+		}
+		for url, size := range list.Sizes {
+			merged.Sizes[url] = size
+		}
+	}
+	return merged
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubSource is a VersionSource returning list or err, after waiting for
+// ready when it is set and then for delay.
+type stubSource struct {
+	name  string
+	list  *VersionList
+	err   error
+	ready *sync.WaitGroup
+	delay time.Duration
+}
+
+func (s stubSource) Name() string { return s.name }
+
+func (s stubSource) List(ctx context.Context) (*VersionList, error) {
+	if s.ready != nil {
+		s.ready.Done()
+		done := make(chan struct{})
+		go func() { s.ready.Wait(); close(done) }()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("the other sources were not fetched alongside")
+		}
+	}
+	time.Sleep(s.delay)
+	return s.list, s.err
+}
+
+func TestMergeSources(t *testing.T) {
+	// Each source waits until all have started, which only happens when
+	// they are fetched at once.
+	var ready sync.WaitGroup
+	ready.Add(3)
+	feed := stubSource{name: "feed", ready: &ready, list: &VersionList{
+		Versions:  map[string][]string{"115": {"115.0.5790.102", "115.0.5790.98"}, "116": {"116.0.5845.96"}},
+		Downloads: map[string]map[string]string{"116.0.5845.96": {"linux64": "https://feed.invalid/116.zip"}},
+	}}
+	page := stubSource{name: "page", ready: &ready, list: &VersionList{
+		Versions:  map[string][]string{"114": {"114.0.5735.90"}, "115": {"115.0.5790.98"}, "116": {"116.0.5845.96"}},
+		Downloads: map[string]map[string]string{"116.0.5845.96": {"linux64": "https://page.invalid/116.zip"}},
+	}}
+	broken := stubSource{name: "broken", ready: &ready, err: errors.New("503 Service Unavailable")}
+
+	var log bytes.Buffer
+	d := NewDownloader()
+	d.Sources = []VersionSource{feed, page, broken}
+	d.AllowPrerelease = true
+	d.Verbose = true
+	d.Log = &log
+	list, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"114": {"114.0.5735.90"},
+		"115": {"115.0.5790.102", "115.0.5790.98"},
+		"116": {"116.0.5845.96"},
+	}
+	if !reflect.DeepEqual(list.Versions, want) {
+		t.Errorf("merged %v, want %v", list.Versions, want)
+	}
+	if !reflect.DeepEqual(list.Majors, []string{"116", "115", "114"}) {
+		t.Errorf("majors %v, want 116, 115, 114", list.Majors)
+	}
+	// The first source wins where they disagree.
+	if got := list.Downloads["116.0.5845.96"]["linux64"]; got != "https://feed.invalid/116.zip" {
+		t.Errorf("116 downloads from %s, want the feed's URL", got)
+	}
+	if !strings.Contains(log.String(), "version source broken failed: 503 Service Unavailable; continuing") {
+		t.Errorf("logged %q, want the failed source", log.String())
+	}
+}
+
+func sourceNames(sources []VersionSource) []string {
+	var names []string
+	for _, src := range sources {
+		names = append(names, src.Name())
+	}
+	return names
+}
+
+func TestSourceOrder(t *testing.T) {
+	d := NewDownloader()
+	sources, err := parseSources(d, "bucket, html,json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sourceNames(sources), []string{"bucket listing", "downloads page", "chrome for testing feed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("--source=bucket,html,json gave %v, want %v", got, want)
+	}
+	if got, want := sourceNames(d.sources()), []string{"chrome for testing feed", "downloads page"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("default sources %v, want %v", got, want)
+	}
+	if _, err := parseSources(d, "json,ftp"); err == nil || !strings.Contains(err.Error(), `unknown version source "ftp", expected one of bucket, html, json`) {
+		t.Errorf("got %v, want ftp refused", err)
+	}
+	fd, _ := flagDownloader(t, "--source", "html,json")
+	if got, want := sourceNames(fd.Sources), []string{"downloads page", "chrome for testing feed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("--source html,json gave %v, want %v", got, want)
+	}
+
+	// A fake source alone is all List reads, and the first of several
+	// that has a driver's download is the one used.
+	first := stubSource{name: "first", list: &VersionList{
+		Versions:  map[string][]string{"115": {"115.0.5790.102"}},
+		Downloads: map[string]map[string]string{"115.0.5790.102": {"linux64": "https://first.invalid/115.zip"}},
+	}}
+	second := stubSource{name: "second", list: &VersionList{
+		Versions:  map[string][]string{"115": {"115.0.5790.102"}},
+		Downloads: map[string]map[string]string{"115.0.5790.102": {"linux64": "https://second.invalid/115.zip"}},
+	}}
+	broken := stubSource{name: "broken", err: errors.New("connection refused")}
+	for _, test := range []struct {
+		sources []VersionSource
+		want    string
+	}{
+		{[]VersionSource{first}, "https://first.invalid/115.zip"},
+		{[]VersionSource{broken, second, first}, "https://second.invalid/115.zip"},
+		{[]VersionSource{first, second}, "https://first.invalid/115.zip"},
+	} {
+		d := NewDownloader()
+		d.Sources = test.sources
+		d.MilestonesURL = ""
+		d.AllowPrerelease = true
+		d.Platform = "linux64"
+		d.Log = &bytes.Buffer{}
+		release, err := d.Resolve("115")
+		if err != nil {
+			t.Errorf("%v: %v", sourceNames(test.sources), err)
+		} else if release.URL != test.want {
+			t.Errorf("%v: resolved %s, want %s", sourceNames(test.sources), release.URL, test.want)
+		}
+	}
+}
+
+func TestSourcesSortedAlike(t *testing.T) {
+	// Neither source lists its versions in order, nor the same ones. They
+	// are made afresh for each run, in case merging sorts them in place.
+	feed := func() VersionSource {
+		return stubSource{name: "feed", list: &VersionList{
+			Majors:   []string{"99", "115", "100"},
+			Versions: map[string][]string{"115": {"115.0.5790.98", "115.0.5790.102", "115.0.5790.170"}, "99": {"99.0.4844.51"}, "100": {"100.0.4896.20"}},
+		}}
+	}
+	page := func() VersionSource {
+		return stubSource{name: "page", list: &VersionList{
+			Majors:   []string{"115", "116", "99"},
+			Versions: map[string][]string{"116": {"116.0.5845.96"}, "115": {"115.0.5790.170", "115.0.5790.9", "115.0.5790.102"}, "99": {"99.0.4844.17", "99.0.4844.51"}},
+		}}
+	}
+	want := &VersionList{
+		Majors: []string{"116", "115", "100", "99"},
+		Versions: map[string][]string{
+			"116": {"116.0.5845.96"},
+			"115": {"115.0.5790.170", "115.0.5790.102", "115.0.5790.98", "115.0.5790.9"},
+			"100": {"100.0.4896.20"},
+			"99":  {"99.0.4844.51", "99.0.4844.17"},
+		},
+	}
+	for _, sources := range [][]VersionSource{{feed(), page()}, {page(), feed()}} {
+		d := NewDownloader()
+		d.Sources = sources
+		d.AllowPrerelease = true
+		list, err := d.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(list.Majors, want.Majors) || !reflect.DeepEqual(list.Versions, want.Versions) {
+			t.Errorf("%v: listed %v %v, want %v %v", sourceNames(sources), list.Majors, list.Versions, want.Majors, want.Versions)
+		}
+	}
+}
+
+func TestSourceErrorsInOrder(t *testing.T) {
+	// The first source fails last.
+	slow := stubSource{name: "feed", err: errors.New("feed: 503 Service Unavailable"), delay: 50 * time.Millisecond}
+	fast := stubSource{name: "page", err: errors.New("page: challenge page")}
+	good := stubSource{name: "bucket", list: &VersionList{Versions: map[string][]string{"115": {"115.0.5790.102"}}}}
+	d := NewDownloader()
+	d.Log = ioutil.Discard
+	lists, errs := d.fetchSources(context.Background(), []VersionSource{slow, good, fast})
+	if len(lists) != 1 || len(errs) != 2 || errs[0] != slow.err || errs[1] != fast.err {
+		t.Errorf("got %d lists and errors %v, want one list and the errors in source order", len(lists), errs)
+	}
+
+	// With every source failing, List reports the first source's error.
+	bucket := httptest.NewServer(http.NotFoundHandler())
+	defer bucket.Close()
+	d.BucketURL = bucket.URL
+	d.Retries = 0
+	d.Sources = []VersionSource{slow, fast}
+	if _, err := d.List(); err != slow.err {
+		t.Errorf("List failed with %v, want the first source's %v", err, slow.err)
+	}
+}
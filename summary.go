@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// runSummary is the --summary-json document.
+type runSummary struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	Seconds       float64        `json:"seconds"`
+	Entries       []summaryEntry `json:"entries"`
+}
+
+// summaryEntry is the outcome of one version and platform. Status is ok,
+// failed or skipped, the last for platforms without a driver.
+type summaryEntry struct {
+	Spec     string  `json:"spec"`
+	Version  string  `json:"version,omitempty"`
+	Platform string  `json:"platform"`
+	Status   string  `json:"status"`
+	Seconds  float64 `json:"seconds"`
+	Bytes    int64   `json:"bytes"`
+	CacheHit bool    `json:"cacheHit"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// writeSummary writes cases, from a run that took elapsed, to path as the
+// --summary-json document.
+func writeSummary(path string, cases []reportCase, elapsed time.Duration) error {
+	s := runSummary{SchemaVersion: schemaVersion, Seconds: elapsed.Seconds(), Entries: []summaryEntry{}}
+	for _, c := range cases {
+		e := summaryEntry{
+			Spec:     c.Spec,
+			Version:  c.Version,
+			Platform: c.Platform,
+			Status:   "ok",
+			Seconds:  c.Duration.Seconds(),
+			Bytes:    c.Transfer.bytes,
+			CacheHit: c.Transfer.cacheHit(),
+		}
+		switch {
+		case c.Skipped:
+			e.Status = "skipped"
+			e.Error = c.Err.Error()
+		case c.Err != nil:
+			e.Status = "failed"
+			e.Error = c.Err.Error()
+		}
+		s.Entries = append(s.Entries, e)
+	}
+	if err := writeJSONAtomic(path, s); err != nil {
+		return fmt.Errorf("writing summary: %w", err)
+	}
+	return nil
+}
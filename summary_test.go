@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readSummary parses the --summary-json document at path.
+func readSummary(t *testing.T, path string) runSummary {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s runSummary
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatalf("parsing %s: %v", b, err)
+	}
+	return s
+}
+
+func TestSummaryJSON(t *testing.T) {
+	s := newTestServer(t)
+	path := filepath.Join(t.TempDir(), "summary.json")
+	cache := t.TempDir()
+	batch := func(out string) runSummary {
+		t.Helper()
+		args := s.args(t, out, "--summary-json", path, "--cache", "--cache-dir", cache, "--platforms", "linux64,win32", "-v", "115", "-v", "116")
+		if _, _, err := runCLI(t, args...); err != nil {
+			t.Fatal(err)
+		}
+		return readSummary(t, path)
+	}
+
+	// 116 has no win32 driver, which skips that entry.
+	summary := batch(t.TempDir())
+	want := []summaryEntry{
+		{Spec: "115", Version: "115.0.5790.102", Platform: "linux64", Status: "ok"},
+		{Spec: "115", Version: "115.0.5790.102", Platform: "win32", Status: "ok"},
+		{Spec: "116", Version: testStable, Platform: "linux64", Status: "ok"},
+		{Spec: "116", Platform: "win32", Status: "skipped"},
+	}
+	if len(summary.Entries) != len(want) {
+		t.Fatalf("summarized %+v, want %d entries", summary.Entries, len(want))
+	}
+	for i, e := range summary.Entries {
+		w := want[i]
+		if e.Spec != w.Spec || e.Version != w.Version || e.Platform != w.Platform || e.Status != w.Status {
+			t.Errorf("entry %d is %+v, want %+v", i, e, w)
+		}
+		if e.Status == "ok" && (e.Bytes <= 0 || e.CacheHit) {
+			t.Errorf("entry %d downloaded %d bytes, cache hit %t, want a fresh download", i, e.Bytes, e.CacheHit)
+		}
+		if e.Status == "skipped" && !strings.Contains(e.Error, "win32") {
+			t.Errorf("entry %d skipped for %q, want the missing platform", i, e.Error)
+		}
+	}
+	if summary.SchemaVersion != schemaVersion || summary.Seconds <= 0 {
+		t.Errorf("summary %d, %g seconds", summary.SchemaVersion, summary.Seconds)
+	}
+
+	// Again, the archives come from the cache.
+	for i, e := range batch(t.TempDir()).Entries {
+		if e.Status == "ok" && (e.Bytes != 0 || !e.CacheHit) {
+			t.Errorf("entry %d downloaded %d bytes, cache hit %t, want a cache hit", i, e.Bytes, e.CacheHit)
+		}
+	}
+
+	// A failed entry ends the batch, and still gets its summary.
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--summary-json", path, "-v", "115", "-v", "999")...); err == nil {
+		t.Fatal("999 did not fail the batch")
+	}
+	entries := readSummary(t, path).Entries
+	if len(entries) != 2 || entries[0].Status != "ok" || entries[1].Status != "failed" || entries[1].Version != "" || !strings.Contains(entries[1].Error, "999") {
+		t.Errorf("summarized %+v, want 115 ok and 999 failed", entries)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DownloadTar downloads the release archive and writes its entries to w as
+// an uncompressed tar stream, applying OnlyBinary and Exclude as Extract
+// would. Nothing is written to disk.
+func (d *Downloader) DownloadTar(release *Release, w io.Writer) error {
+	var buf bytes.Buffer
+	if err := d.DownloadTo(release, &buf); err != nil {
+		return inPhase("download", release.Version, err)
+	}
+	keep := func(string) bool { return true }
+	if d.OnlyBinary || len(d.Exclude) > 0 {
+		keep = d.keepEntry
+	}
+	n, err := retar(buf.Bytes(), w, keep, d.archiveLimits())
+	if err != nil {
+		return inPhase("extract", release.Version, fmt.Errorf("re-streaming %s: %w", filepath.Base(release.URL), err))
+	}
+	d.verbosef("streamed %d files as tar\n", n)
+	return nil
+}
+
+// retar copies the regular files of the zip or tar.gz archive in data that
+// keep selects into a tar stream on w, keeping their names and modes, and
+// returns how many it wrote. Directories are left implicit. The archive is
+// refused once it breaks the limits of opts.
+func retar(data []byte, w io.Writer, keep func(name string) bool, opts *extractOptions) (int, error) {
+	tw := tar.NewWriter(w)
+	n, err := eachArchiveEntry(data, keep, opts, func(e archiveEntry, r io.Reader) error {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     e.Name,
+			Mode:     int64(e.Mode.Perm()),
+			Size:     e.Size,
+			ModTime:  e.ModTime,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, tw.Close()
+}
+
+// DownloadSingle downloads the release archive and writes its one file to
+// w, failing before anything is written when the archive, after OnlyBinary
+// and Exclude, holds more or fewer than one file.
+func (d *Downloader) DownloadSingle(release *Release, w io.Writer) error {
+	var buf bytes.Buffer
+	if err := d.DownloadTo(release, &buf); err != nil {
+		return inPhase("download", release.Version, err)
+	}
+	keep := func(string) bool { return true }
+	if d.OnlyBinary || len(d.Exclude) > 0 {
+		keep = d.keepEntry
+	}
+	n, err := eachArchiveEntry(buf.Bytes(), keep, d.archiveLimits(), func(archiveEntry, io.Reader) error { return nil })
+	if err != nil {
+		return inPhase("extract", release.Version, fmt.Errorf("reading %s: %w", filepath.Base(release.URL), err))
+	}
+	if n != 1 {
+		return fmt.Errorf("%s holds %d files, but only one can be written to a single file; add --only-binary to keep just the driver", filepath.Base(release.URL), n)
+	}
+	_, err = eachArchiveEntry(buf.Bytes(), keep, d.archiveLimits(), func(_ archiveEntry, r io.Reader) error {
+		_, err := io.Copy(w, r)
+		return err
+	})
+	return err
+}
+
+// archiveLimits returns the options holding d's archive limits, for
+// reading archives outside Extract.
+func (d *Downloader) archiveLimits() *extractOptions {
+	return &extractOptions{MaxSize: d.MaxUncompressedSize, MaxRatio: d.MaxCompressionRatio}
+}
+
+// archiveEntry describes a regular file of an archive.
+type archiveEntry struct {
+	Name    string
+	Mode    os.FileMode
+	Size    int64
+	ModTime time.Time
+}
+
+// eachArchiveEntry calls fn with each regular file of the zip or tar.gz
+// archive in data that keep selects, and returns how many there were. With
+// limits set, the archive is refused once it breaks them, as Extract would
+// refuse it.
+func eachArchiveEntry(data []byte, keep func(name string) bool, limits *extractOptions, fn func(e archiveEntry, r io.Reader) error) (int, error) {
+	if limits == nil {
+		limits = &extractOptions{}
+	}
+	if bytes.HasPrefix(data, gzipMagic) {
+		compressed := &countingReader{r: bytes.NewReader(data)}
+		gz, err := gzip.NewReader(compressed)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		tr := tar.NewReader(gz)
+		var unpacked int64
+		n := 0
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return n, nil
+			}
+			if err != nil {
+				return n, err
+			}
+			if hdr.Typeflag != tar.TypeReg || !keep(hdr.Name) {
+				continue
+			}
+			e := archiveEntry{Name: hdr.Name, Mode: hdr.FileInfo().Mode(), Size: hdr.Size, ModTime: hdr.ModTime}
+			if err := fn(e, &limitedEntry{r: tr, opts: limits, unpacked: &unpacked, compressed: compressed}); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+
+	zipped, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	var unpacked, compressed int64
+	for _, f := range zipped.File {
+		unpacked += int64(f.UncompressedSize64)
+		compressed += int64(f.CompressedSize64)
+	}
+	if err := limits.checkLimits(unpacked, compressed); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, f := range zipped.File {
+		if f.FileInfo().IsDir() || !keep(f.Name) {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return n, err
+		}
+		e := archiveEntry{Name: f.Name, Mode: f.Mode(), Size: int64(f.UncompressedSize64), ModTime: f.Modified}
+		err = fn(e, r)
+		r.Close()
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// untar reads the tar stream in data into its file contents and modes by
+// name.
+func untar(t *testing.T, data string) (map[string]string, map[string]os.FileMode) {
+	t.Helper()
+	files, modes := make(map[string]string), make(map[string]os.FileMode)
+	tr := tar.NewReader(strings.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, modes
+		}
+		if err != nil {
+			t.Fatalf("reading the tar stream: %v", err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name], modes[hdr.Name] = string(b), hdr.FileInfo().Mode()
+	}
+}
+
+func TestTarStdout(t *testing.T) {
+	s := newTestServer(t)
+	out := t.TempDir()
+	stdout, stderr, code := runMain(t, s.args(t, out, "--tar-stdout", "--verbose", "-v", "115.0.5790.102")...)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	files, modes := untar(t, stdout)
+	const driver = "chromedriver-linux64/chromedriver"
+	if got := files[driver]; got != testDriver("115.0.5790.102") {
+		t.Errorf("streamed driver %q, want the 115.0.5790.102 one", got)
+	}
+	if modes[driver]&0111 == 0 {
+		t.Errorf("streamed the driver with mode %s, want it executable", modes[driver])
+	}
+	if len(files) != 3 {
+		t.Errorf("streamed %d files, want the archive's 3", len(files))
+	}
+	if !strings.Contains(stderr, "streamed 3 files as tar") {
+		t.Errorf("printed %q to stderr, want the status there", stderr)
+	}
+	if entries, _ := os.ReadDir(out); len(entries) != 0 {
+		t.Errorf("wrote %s to --out", entries[0].Name())
+	}
+}
+
+func TestRetar(t *testing.T) {
+	files := map[string]string{
+		"chromedriver-linux64/chromedriver":                     testDriver(testStable),
+		"chromedriver-linux64/LICENSE.chromedriver":             "license\n",
+		"chromedriver-linux64/THIRD_PARTY_NOTICES.chromedriver": "notices\n",
+	}
+	onlyDriver := func(name string) bool { return strings.HasSuffix(name, "/chromedriver") }
+	for _, archive := range []struct {
+		name string
+		data []byte
+	}{
+		{"zip", testZip(t, files)},
+		{"tar.gz", testTarGz(t, files)},
+	} {
+		var buf bytes.Buffer
+		n, err := retar(archive.data, &buf, onlyDriver, &extractOptions{})
+		if err != nil {
+			t.Errorf("%s: %v", archive.name, err)
+			continue
+		}
+		got, _ := untar(t, buf.String())
+		var names []string
+		for name := range got {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if n != 1 || strings.Join(names, ",") != "chromedriver-linux64/chromedriver" {
+			t.Errorf("%s: streamed %d files %q, want only the driver", archive.name, n, names)
+		}
+	}
+}
+
+func TestOutStdout(t *testing.T) {
+	s := newTestServer(t)
+	s.mux.HandleFunc("/dl/115.0.5790.98/linux64/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testZip(t, map[string]string{"chromedriver": testDriver("115.0.5790.98")}))
+	})
+	// A "-" apart from --out would parse as a flag, so it is joined on.
+	args := s.args(t, "", "-v", "115.0.5790.98")
+	for i := range args {
+		if args[i] == "--out" {
+			args = append(append(args[:i:i], "--out=-"), args[i+2:]...)
+			break
+		}
+	}
+	stdout, stderr, code := runMain(t, args...)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	if stdout != testDriver("115.0.5790.98") {
+		t.Errorf("wrote %q to stdout, want the archive's one file", stdout)
+	}
+
+	// The usual archive holds a license too, unless --only-binary drops it.
+	d := s.downloader()
+	release, err := d.Resolve("115.0.5790.102")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := d.DownloadSingle(release, &out); err == nil || !strings.Contains(err.Error(), "holds 3 files, but only one can be written") {
+		t.Errorf("got %v, want the extra files refused", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("wrote %d bytes of a refused archive", out.Len())
+	}
+	d.OnlyBinary = true
+	if err := d.DownloadSingle(release, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != testDriver("115.0.5790.102") {
+		t.Errorf("wrote %q with --only-binary, want the driver", out.String())
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// newTLSConfig builds a client TLS config for --ca-cert, --pin-sha256 and
+// --insecure. It returns nil when none is set so the transport keeps its
+// defaults. Pins are still checked when insecure skips chain verification.
+func newTLSConfig(caCert string, pins []string, insecure bool) (*tls.Config, error) {
+	if caCert == "" && len(pins) == 0 && !insecure {
+		return nil, nil
+	}
+	config := &tls.Config{InsecureSkipVerify: insecure}
+
+	if caCert != "" {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(pins) > 0 {
+		accepted := make(map[string]bool, len(pins))
+		for _, pin := range pins {
+			sum, err := parsePin(pin)
+			if err != nil {
+				return nil, err
+			}
+			accepted[string(sum)] = true
+		}
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			if !accepted[string(sum[:])] {
+				return fmt.Errorf("server certificate does not match --pin-sha256 (got %s)",
+					base64.StdEncoding.EncodeToString(sum[:]))
+			}
+			return nil
+		}
+	}
+	return config, nil
+}
+
+// parsePin decodes a public-key pin given as base64, optionally prefixed
+// with "sha256/", or as hex.
+func parsePin(pin string) ([]byte, error) {
+	s := strings.TrimPrefix(pin, "sha256/")
+	if sum, err := hex.DecodeString(s); err == nil && len(sum) == sha256.Size {
+		return sum, nil
+	}
+	if sum, err := base64.StdEncoding.DecodeString(s); err == nil && len(sum) == sha256.Size {
+		return sum, nil
+	}
+	return nil, fmt.Errorf("invalid --pin-sha256 %q: want a base64 or hex SHA-256 hash", pin)
+}
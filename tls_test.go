@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTLSTestServer starts a TLS server answering 200 to everything, whose
+// log of refused handshakes is kept out of the test output.
+func newTLSTestServer(t testing.TB) *httptest.Server {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// writeServerCA saves the certificate of srv as a PEM bundle.
+func writeServerCA(t testing.TB, srv *httptest.Server) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPinSHA256(t *testing.T) {
+	mirror := newTLSTestServer(t)
+	ca := writeServerCA(t, mirror)
+	sum := sha256.Sum256(mirror.Certificate().RawSubjectPublicKeyInfo)
+	wrong := sha256.Sum256([]byte("another key"))
+
+	for _, test := range []struct {
+		pin     string
+		reaches bool
+	}{
+		{hex.EncodeToString(sum[:]), true},
+		{base64.StdEncoding.EncodeToString(sum[:]), true},
+		{hex.EncodeToString(wrong[:]), false},
+	} {
+		d, _ := flagDownloader(t, "--mirror", mirror.URL, "--ca-cert", ca, "--pin-sha256", test.pin)
+		resp, err := d.Client.Get(mirror.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if reached := err == nil; reached != test.reaches {
+			t.Errorf("--pin-sha256=%s: connected %v: %v", test.pin, reached, err)
+		}
+		if !test.reaches && err != nil && !strings.Contains(err.Error(), "does not match --pin-sha256") {
+			t.Errorf("--pin-sha256=%s: got %v, want a pin mismatch", test.pin, err)
+		}
+	}
+}
+
+func TestCACertOnlyForMirrorHosts(t *testing.T) {
+	srv := newTLSTestServer(t)
+	ca := writeServerCA(t, srv)
+
+	d, _ := flagDownloader(t, "--mirror", srv.URL, "--ca-cert", ca)
+	resp, err := d.Client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("the mirror's CA was not trusted: %v", err)
+	}
+	resp.Body.Close()
+
+	// With the mirror elsewhere the server is verified against the system
+	// roots, which do not know its CA.
+	d, _ = flagDownloader(t, "--mirror", "https://mirror.invalid", "--ca-cert", ca)
+	resp, err = d.Client.Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	var unknown x509.UnknownAuthorityError
+	if !errors.As(err, &unknown) {
+		t.Errorf("got %v, want the CA unknown outside the mirror host", err)
+	}
+}
+
+func TestInsecure(t *testing.T) {
+	// A mirror with a self-signed certificate, serving a feed of its own
+	// archives.
+	mirror := newTLSTestServer(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"versions": [{"version": "115.0.5790.102", "downloads": {"chromedriver": [{"platform": "linux64", "url": %q}]}}]}`,
+			mirror.URL+"/dl/chromedriver-linux64.zip")
+	})
+	mux.HandleFunc("/dl/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testArchive(t, "chromedriver-linux64.zip", "115.0.5790.102", "linux64"))
+	})
+	mirror.Config.Handler = mux
+	s := newTestServer(t)
+	install := func(extra ...string) (string, error) {
+		out := t.TempDir()
+		args := setFlag(s.args(t, out, extra...), "list-url", mirror.URL+"/feed.json")
+		_, stderr, err := runCLI(t, append(args, "-v", "115")...)
+		if err == nil && !isInstalledIn(out, "115.0.5790.102") {
+			t.Errorf("%q reported success but installed nothing", extra)
+		}
+		return stderr, err
+	}
+
+	stderr, err := install()
+	var unknown x509.UnknownAuthorityError
+	if !errors.As(err, &unknown) {
+		t.Errorf("without --insecure: got %v, want the certificate refused", err)
+	}
+	if strings.Contains(stderr, "--insecure") {
+		t.Errorf("warned %q without --insecure", stderr)
+	}
+
+	stderr, err = install("--insecure")
+	if err != nil {
+		t.Fatalf("with --insecure: %v", err)
+	}
+	if !strings.Contains(stderr, "--insecure is set: TLS certificates of the --mirror and --list-url hosts are NOT verified") {
+		t.Errorf("printed %q, want a warning about --insecure", stderr)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTracer logs the phases of one request, tagged with its host and
+// the time since the request started, so the lines of concurrent requests
+// can be told apart. The hooks may fire from the transport's goroutines.
+type requestTracer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	host  string
+	start time.Time
+	dns   time.Time
+	conn  time.Time
+	tls   time.Time
+}
+
+func newRequestTracer(w io.Writer, host string) *requestTracer {
+	return &requestTracer{w: w, host: host, start: time.Now()}
+}
+
+// logf writes one line in a single call, keeping it whole when several
+// requests trace at once.
+func (t *requestTracer) logf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	elapsed := time.Since(t.start).Round(time.Microsecond)
+	fmt.Fprintf(t.w, "trace: %s %8s %s\n", t.host, elapsed, fmt.Sprintf(format, args...))
+}
+
+// mark records the current time in *at.
+func (t *requestTracer) mark(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*at = time.Now()
+}
+
+// since returns the time elapsed from *at.
+func (t *requestTracer) since(at *time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return time.Since(*at)
+}
+
+// clientTrace returns the httptrace hooks reporting DNS, connect, TLS and
+// first-byte timings.
+func (t *requestTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			t.logf("get conn %s", hostPort)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.logf("got conn %s (reused=%t, idle=%s)", info.Conn.RemoteAddr(), info.Reused, info.IdleTime)
+		},
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			t.mark(&t.dns)
+			t.logf("dns start %s", info.Host)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err != nil {
+				t.logf("dns failed after %s: %v", t.since(&t.dns), info.Err)
+				return
+			}
+			t.logf("dns done after %s: %v", t.since(&t.dns), info.Addrs)
+		},
+		ConnectStart: func(network, addr string) {
+			t.mark(&t.conn)
+			t.logf("connect start %s %s", network, addr)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			if err != nil {
+				t.logf("connect %s failed after %s: %v", addr, t.since(&t.conn), err)
+				return
+			}
+			t.logf("connect done %s after %s", addr, t.since(&t.conn))
+		},
+		TLSHandshakeStart: func() {
+			t.mark(&t.tls)
+			t.logf("tls handshake start")
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				t.logf("tls handshake failed after %s: %v", t.since(&t.tls), err)
+				return
+			}
+			t.logf("tls handshake done after %s (%s, %s)", t.since(&t.tls), tls.CipherSuiteName(state.CipherSuite), state.NegotiatedProtocol)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			if info.Err != nil {
+				t.logf("write request failed: %v", info.Err)
+				return
+			}
+			t.logf("wrote request")
+		},
+		GotFirstResponseByte: func() {
+			t.logf("first byte")
+		},
+	}
+}
+
+// response logs the status and headers of resp, sorted by name.
+func (t *requestTracer) response(resp *http.Response) {
+	t.logf("%s %s", resp.Proto, resp.Status)
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t.logf("  %s: %s", name, strings.Join(resp.Header[name], ", "))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	secure := newTLSTestServer(t)
+	secure.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Mirror", "eu-1")
+	})
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	// localhost, unlike 127.0.0.1, takes a DNS lookup.
+	u, _ := url.Parse(plain.URL)
+	byName := "http://localhost:" + u.Port()
+
+	d, _ := flagDownloader(t, "--trace", "--ca-cert", writeServerCA(t, secure), "--mirror", secure.URL)
+	if !d.Trace {
+		t.Fatal("--trace left Trace off")
+	}
+	var log bytes.Buffer
+	d.Log = &log
+	for _, target := range []string{secure.URL, byName} {
+		resp, err := d.get(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	secureHost := strings.TrimPrefix(secure.URL, "https://")
+	for _, want := range []string{
+		"trace: " + secureHost + " ",
+		"get conn " + secureHost,
+		"connect start tcp " + secureHost,
+		"connect done " + secureHost + " after ",
+		"tls handshake start",
+		"tls handshake done after ",
+		"wrote request",
+		"first byte",
+		"HTTP/1.1 200 OK",
+		"  X-Mirror: eu-1\n",
+		"dns start localhost",
+		"dns done after ",
+	} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("traced %q, want %q in it", log.String(), want)
+		}
+	}
+
+	d.Trace = false
+	log.Reset()
+	resp, err := d.get(secure.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if strings.Contains(log.String(), "trace:") {
+		t.Errorf("traced %q without --trace", log.String())
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// transportOptions configures the connection handling of the shared
+// transport. Zero values keep the http.DefaultTransport behaviour.
+type transportOptions struct {
+	// ConnectTimeout bounds the TCP connect, the TLS handshake and the wait
+	// for response headers separately, so a stalled connection fails fast
+	// while a slow but progressing body is left to the overall timeout.
+	ConnectTimeout time.Duration
+	// IPVersion forces connections over IPv4 ("4") or IPv6 ("6"). Empty or
+	// "auto" lets the dialer pick.
+	IPVersion string
+	// IPFallback retries a failed dial over the other IP family, or over
+	// IPv4 when IPVersion lets the dialer pick, before the request fails.
+	IPFallback bool
+	// Logf, when set, is told about dials that fell back.
+	Logf func(format string, args ...interface{})
+	// MaxIdleConnsPerHost is how many keep-alive connections are kept per
+	// host for reuse by later requests of a batch. Zero keeps Go's default
+	// of two.
+	MaxIdleConnsPerHost int
+	// CACert is a PEM bundle the hosts of MirrorURLs are trusted by
+	// instead of the system roots.
+	CACert string
+	// PinSHA256 lists the accepted SHA-256 hashes of the certificate's
+	// public key of the hosts of MirrorURLs. Empty disables pinning.
+	PinSHA256 []string
+	// Insecure skips verification of the server certificate chain of the
+	// hosts of MirrorURLs.
+	Insecure bool
+	// MirrorURLs are the mirror and list URLs the user configured. The
+	// default hosts are never among their hosts.
+	MirrorURLs []string
+}
+
+// dialNetwork returns the network name the dialer uses for tcp.
+func (o transportOptions) dialNetwork(network string) string {
+	if network != "tcp" {
+		return network
+	}
+	switch o.IPVersion {
+	case "4":
+		return "tcp4"
+	case "6":
+		return "tcp6"
+	}
+	return network
+}
+
+// otherFamily is the network a dial over network falls back to.
+func otherFamily(network string) string {
+	switch network {
+	case "tcp4":
+		return "tcp6"
+	case "tcp6", "tcp":
+		return "tcp4"
+	}
+	return ""
+}
+
+// dialWithFallback dials addr over network and, when that fails and the
+// context is still live, once more over the other IP family. The error of
+// the first dial is kept when the second fails too.
+func dialWithFallback(ctx context.Context, dial func(ctx context.Context, network, addr string) (net.Conn, error), network, addr string, logf func(string, ...interface{})) (net.Conn, error) {
+	conn, err := dial(ctx, network, addr)
+	other := otherFamily(network)
+	if err == nil || other == "" || ctx.Err() != nil {
+		return conn, err
+	}
+	if logf != nil {
+		logf("dialing %s over %s failed (%v); retrying over %s\n", addr, network, err, other)
+	}
+	conn, ferr := dial(ctx, other, addr)
+	if ferr != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// newTransport builds the shared transport. With CACert, PinSHA256 or
+// Insecure, requests to the mirror hosts go through a transport of their
+// own verifying as those say, so the upstream feeds and archives are still
+// verified against the system roots.
+func newTransport(opts transportOptions) (http.RoundTripper, error) {
+	base := opts.httpTransport(nil)
+	mirrorConfig, err := newTLSConfig(opts.CACert, opts.PinSHA256, opts.Insecure)
+	if err != nil {
+		return nil, err
+	}
+	if mirrorConfig == nil {
+		return base, nil
+	}
+	return &mirrorTransport{
+		base:   base,
+		mirror: opts.httpTransport(mirrorConfig),
+		hosts:  mirrorHosts(opts.MirrorURLs),
+	}, nil
+}
+
+// httpTransport returns a transport connecting as opts says, with
+// tlsConfig.
+func (opts transportOptions) httpTransport(tlsConfig *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	// A custom TLS config or dialer turns off HTTP/2 unless asked for.
+	t.ForceAttemptHTTP2 = true
+	t.IdleConnTimeout = 90 * time.Second
+	if opts.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		if t.MaxIdleConns < opts.MaxIdleConnsPerHost {
+			t.MaxIdleConns = opts.MaxIdleConnsPerHost
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if opts.ConnectTimeout > 0 {
+		dialer.Timeout = opts.ConnectTimeout
+		t.TLSHandshakeTimeout = opts.ConnectTimeout
+		t.ResponseHeaderTimeout = opts.ConnectTimeout
+	}
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if opts.IPFallback {
+			return dialWithFallback(ctx, dialer.DialContext, opts.dialNetwork(network), addr, opts.Logf)
+		}
+		return dialer.DialContext(ctx, opts.dialNetwork(network), addr)
+	}
+	return t
+}
+
+// mirrorTransport sends requests for the mirror hosts through mirror and
+// all others through base.
+type mirrorTransport struct {
+	base   http.RoundTripper
+	mirror http.RoundTripper
+	hosts  map[string]bool
+}
+
+func (t *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.hosts[req.URL.Host] {
+		return t.mirror.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// noNetworkTransport fails every request, so that a run under --no-network
+// is proven to be served from the cache alone.
+type noNetworkTransport struct{}
+
+func (noNetworkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%w: refusing %s %s", ErrNetworkDisabled, req.Method, req.URL.Redacted())
+}
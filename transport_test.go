@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConnectTimeout(t *testing.T) {
+	release := make(chan struct{})
+	slowHeaders := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer slowHeaders.Close()
+	defer close(release)
+	slowBody := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 5; i++ {
+			w.Write([]byte("chromedriver"))
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer slowBody.Close()
+
+	transport, err := newTransport(transportOptions{ConnectTimeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+
+	start := time.Now()
+	if _, err := client.Get(slowHeaders.URL); err == nil {
+		t.Error("a server withholding its headers was waited for")
+	} else if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("gave up on the headers after %s, want about the connect timeout", elapsed)
+	}
+
+	resp, err := client.Get(slowBody.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil || len(b) != 5*len("chromedriver") {
+		t.Errorf("a slow but progressing body was cut off after %d bytes: %v", len(b), err)
+	}
+}
+
+func TestDialNetwork(t *testing.T) {
+	for _, test := range []struct{ ipVersion, network, want string }{
+		{"", "tcp", "tcp"},
+		{"auto", "tcp", "tcp"},
+		{"4", "tcp", "tcp4"},
+		{"6", "tcp", "tcp6"},
+		{"4", "udp", "udp"},
+	} {
+		if got := (transportOptions{IPVersion: test.ipVersion}).dialNetwork(test.network); got != test.want {
+			t.Errorf("--ip-version=%q dials %s over %s, want %s", test.ipVersion, test.network, got, test.want)
+		}
+	}
+}
+
+func TestIPVersionFlag(t *testing.T) {
+	// The server listens on 127.0.0.1 alone, so only IPv4 reaches it.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	for _, test := range []struct {
+		ipVersion string
+		reaches   bool
+	}{{"auto", true}, {"4", true}, {"6", false}} {
+		d, _ := flagDownloader(t, "--ip-version", test.ipVersion)
+		resp, err := d.Client.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if reached := err == nil; reached != test.reaches {
+			t.Errorf("--ip-version=%s: reached the IPv4 server %v: %v", test.ipVersion, reached, err)
+		}
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		want int
+	}{{nil, 8}, {[]string{"--max-idle-conns", "16"}, 16}} {
+		d, _ := flagDownloader(t, test.args...)
+		transport := d.Client.Transport.(*authTransport).base.(*http.Transport)
+		if transport.MaxIdleConnsPerHost != test.want {
+			t.Errorf("%v: MaxIdleConnsPerHost = %d, want %d", test.args, transport.MaxIdleConnsPerHost, test.want)
+		}
+		if transport.MaxIdleConns < test.want {
+			t.Errorf("%v: MaxIdleConns = %d, below the per-host limit", test.args, transport.MaxIdleConns)
+		}
+		if !transport.ForceAttemptHTTP2 {
+			t.Errorf("%v: HTTP/2 is not attempted", test.args)
+		}
+		if transport.IdleConnTimeout != 90*time.Second {
+			t.Errorf("%v: IdleConnTimeout = %s, want 90s", test.args, transport.IdleConnTimeout)
+		}
+	}
+}
+
+// BenchmarkBatchConnections downloads a batch of ten archives from a TLS
+// mirror, reporting how many connections, each a TLS handshake, it opened.
+func BenchmarkBatchConnections(b *testing.B) {
+	archive := testArchive(b, "chromedriver-linux64.zip", "115.0.5790.102", "linux64")
+	var conns int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	srv.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	ca := writeServerCA(b, srv)
+
+	var batch []*Release
+	for i := 0; i < 10; i++ {
+		batch = append(batch, &Release{
+			Version:  fmt.Sprintf("115.0.5790.%d", i),
+			Platform: "linux64",
+			URL:      fmt.Sprintf("%s/dl/%d/chromedriver-linux64.zip", srv.URL, i),
+		})
+	}
+	for _, keepAlive := range []bool{false, true} {
+		keepAlive := keepAlive
+		name := "pooled"
+		if !keepAlive {
+			name = "no-reuse"
+		}
+		b.Run(name, func(b *testing.B) {
+			transport, err := newTransport(transportOptions{MaxIdleConnsPerHost: 8, CACert: ca, MirrorURLs: []string{srv.URL}})
+			if err != nil {
+				b.Fatal(err)
+			}
+			transport.(*mirrorTransport).mirror.(*http.Transport).DisableKeepAlives = !keepAlive
+			d := NewDownloader()
+			d.Client = &http.Client{Transport: transport}
+			d.Log = ioutil.Discard
+			atomic.StoreInt64(&conns, 0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, release := range batch {
+					if err := d.DownloadTo(release, ioutil.Discard); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&conns))/float64(b.N), "conns/op")
+		})
+	}
+}
+
+func TestIPFallback(t *testing.T) {
+	// The server listens on 127.0.0.1 alone, so IPv6 cannot reach it.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	d, _ := flagDownloader(t, "--ip-version", "6", "--force-ipv-fallback")
+	var log bytes.Buffer
+	d.Log = &log
+	d.Verbose = true
+	resp, err := d.Client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("the IPv4 fallback did not reach the server: %v", err)
+	}
+	resp.Body.Close()
+	if !strings.Contains(log.String(), "over tcp6 failed") || !strings.Contains(log.String(), "retrying over tcp4") {
+		t.Errorf("logged %q, want the fallback reported", log.String())
+	}
+
+	// A simulated broken IPv6: the dial is tried over it first, then IPv4.
+	var networks []string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		networks = append(networks, network)
+		if network == "tcp6" {
+			return nil, errors.New("network is unreachable")
+		}
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+	conn, err := dialWithFallback(context.Background(), dial, "tcp6", srv.Listener.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if want := []string{"tcp6", "tcp4"}; !reflect.DeepEqual(networks, want) {
+		t.Errorf("dialed over %v, want %v", networks, want)
+	}
+	// When both fail, the error is the preferred family's.
+	broken := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if network == "tcp6" {
+			return nil, errors.New("network is unreachable")
+		}
+		return nil, errors.New("connection refused")
+	}
+	_, err = dialWithFallback(context.Background(), broken, "tcp6", srv.Listener.Addr().String(), nil)
+	if err == nil || err.Error() != "network is unreachable" {
+		t.Errorf("got %v, want the IPv6 error", err)
+	}
+}
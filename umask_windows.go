@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// umask is zero: Windows has no file mode creation mask.
+var umask os.FileMode
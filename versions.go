@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const downloadsPageURL = "https://chromedriver.chromium.org/downloads"
+
+// VersionList is the set of published drivers.
+type VersionList struct {
+	// Majors holds the major versions, newest first.
+	Majors []string
+	// Versions maps a major to its full versions, newest first.
+	Versions map[string][]string
+	// Downloads maps a full version to its driver URL per platform, and
+	// Revisions to its Chromium revision. Only versions from the Chrome for
+	// Testing feed have an entry.
+	Downloads map[string]map[string]string
+	Revisions map[string]string
+	// ChromeDownloads maps a full version to its Chrome for Testing browser
+	// URL per platform. The feed also lists browsers without a driver.
+	ChromeDownloads map[string]map[string]string
+	// CompanionDownloads maps a companion type, one of companionTypes, to
+	// the URLs of its builds like ChromeDownloads.
+	CompanionDownloads map[string]map[string]map[string]string
+	// Sizes maps a driver URL to the archive size the feed declares for it.
+	Sizes map[string]int64
+}
+
+// List merges the versions of the legacy downloads page and the Chrome for
+// Testing feed, fetched concurrently. When neither can be read it falls
+// back to the legacy bucket listing, and only fails if that is unreachable
+// too. A list fetched less than ListTTL ago is returned again as is, and
+// with a CacheDir the list is also kept on disk as fetchListCached
+// describes. Unless
+// AllowPrerelease is set, versions newer than the Stable channel are left
+// out.
+func (d *Downloader) List() (*VersionList, error) {
+	fetch := d.fetchList
+	if !d.AllowPrerelease {
+		fetch = func() (*VersionList, error) {
+			list, err := d.fetchList()
+			if err != nil {
+				return nil, err
+			}
+			return d.withoutPrereleases(list), nil
+		}
+	}
+	if d.CacheDir != "" {
+		fetchFresh := fetch
+		fetch = func() (*VersionList, error) { return d.fetchListCached(fetchFresh) }
+	}
+	if d.memo == nil || d.ListTTL <= 0 {
+		return fetch()
+	}
+	return d.memo.get(d.memoKey(), d.ListTTL, fetch)
+}
+
+// withoutPrereleases returns list without the versions newer than the
+// current Stable channel release, which are Beta, Dev or Canary builds. If
+// the channel data cannot be read, list is returned as is.
+func (d *Downloader) withoutPrereleases(list *VersionList) *VersionList {
+	all, err := d.Channels()
+	if err != nil {
+		d.verbosef("not filtering prereleases: %v\n", err)
+		return list
+	}
+	stable, ok := all["Stable"]
+	if !ok || stable.Version == "" {
+		return list
+	}
+
+	filtered := *list
+	filtered.Versions = make(map[string][]string)
+	filtered.Majors = nil
+	for _, major := range list.Majors {
+		var kept []string
+		for _, v := range list.Versions[major] {
+			if compareVersions(v, stable.Version) <= 0 {
+				kept = append(kept, v)
+			}
+		}
+		if len(kept) > 0 {
+			filtered.Versions[major] = kept
+			filtered.Majors = append(filtered.Majors, major)
+		}
+	}
+	return &filtered
+}
+
+// memoKey identifies the sources and filtering of List, so a Downloader
+// pointed at other sources, or reading them in another order, does not see
+// a list memoized for the old ones.
+func (d *Downloader) memoKey() string {
+	var names []string
+	for _, src := range d.sources() {
+		names = append(names, src.Name())
+	}
+	return fmt.Sprintf("%s\n%s\n%s\n%s\n%t\n%s", d.PageURL, d.FeedURL, d.BucketURL, d.ChannelsURL, d.AllowPrerelease, strings.Join(names, ","))
+}
+
+// listMemo keeps the last version list for a while so repeated lookups in
+// one process, such as the steps of a batch, skip the network. It is shared
+// by copies of a Downloader and safe for concurrent use.
+type listMemo struct {
+	mu      sync.Mutex
+	key     string
+	list    *VersionList
+	fetched time.Time
+}
+
+// get returns the memoized list for key if it is younger than ttl and
+// otherwise calls fetch, memoizing a successful result. Callers must treat
+// the list as read-only.
+func (m *listMemo) get(key string, ttl time.Duration, fetch func() (*VersionList, error)) (*VersionList, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.list != nil && m.key == key && time.Since(m.fetched) < ttl {
+		return m.list, nil
+	}
+	list, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	m.key, m.list, m.fetched = key, list, time.Now()
+	return list, nil
+}
+
+// fetchList reads the version list from its sources.
+func (d *Downloader) fetchList() (*VersionList, error) {
+	lists, errs := d.fetchSources(d.context(), d.sources())
+	if len(lists) == 0 {
+		versionMap, err := d.listBucket()
+		if err != nil {
+			return nil, errs[0]
+		}
+		lists = append(lists, &VersionList{Versions: versionMap})
+	}
+
+	merged := mergeVersionLists(lists...)
+	for key := range merged.Versions {
+		if !isMajor(key) {
+			return nil, fmt.Errorf("parsing major version %q: not a number", key)
+		}
+	}
+	merged.sort()
+	return merged, nil
+}
+
+// sort orders the list the one way every caller sees it, whatever order its
+// sources gave: Majors newest first, and each major's versions newest first
+// by sortVersions.
+func (l *VersionList) sort() {
+	l.Majors = l.Majors[:0]
+	for major, versions := range l.Versions {
+		sortVersions(versions)
+		l.Majors = append(l.Majors, major)
+	}
+	sortVersions(l.Majors)
+}
+
+// scrapeVersions collects the versions linked from the legacy downloads page.
+func (d *Downloader) scrapeVersions(isLatest bool) (map[string][]string, error) {
+	var doc *goquery.Document
+	err := d.retry(func() (bool, error) {
+		var err error
+		doc, err = d.fetchPage()
+		// request has already retried failed requests and error statuses;
+		// only a body that could not be read in full is worth another go.
+		return errors.As(err, new(*bodyError)), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s, selector := findVersionLinks(doc)
+	if selector != "" {
+		d.verbosef("downloads page links matched %q\n", selector)
+	}
+
+	versionMap := make(map[string][]string)
+	loopCnt := s.Size()
+	if isLatest {
+		loopCnt = 3
+	}
+	if loopCnt > s.Size() {
+		loopCnt = s.Size()
+	}
+	for i := 0; i < loopCnt; i++ {
+		for _, attr := range s.Get(i).Attr {
+			if strings.EqualFold(attr.Key, "href") {
+				if version, major, ok := versionFromHref(attr.Val); ok {
+					versionMap[major] = append(versionMap[major], version)
+				}
+			}
+		}
+	}
+	return versionMap, nil
+}
+
+// versionLinkSelectors find the version links of the downloads page,
+// tried in order: the class the page uses now, then classes of earlier and
+// later Google Sites themes, then any link to the storage index.
+var versionLinkSelectors = []string{
+	".XqQF9c",
+	".aw5Odc a",
+	".dhtgD a",
+	`a[href*="chromedriver.storage.googleapis.com/index.html?"]`,
+}
+
+// findVersionLinks returns the links of doc matched by the first of
+// versionLinkSelectors under which at least one is a version link, and
+// that selector. When none matches an empty selection is returned.
+func findVersionLinks(doc *goquery.Document) (*goquery.Selection, string) {
+	for _, selector := range versionLinkSelectors {
+		s := doc.Find(selector)
+		found := false
+		s.EachWithBreak(func(_ int, link *goquery.Selection) bool {
+			href, _ := link.Attr("href")
+			_, _, found = versionFromHref(href)
+			return !found
+		})
+		if found {
+			return s, selector
+		}
+	}
+	return doc.Find(versionLinkSelectors[0]), ""
+}
+
+// fetchPage downloads and parses the downloads page. The body is read in
+// full first so that a connection cut short fails here, where it can be
+// retried, instead of yielding a partial document.
+func (d *Downloader) fetchPage() (*goquery.Document, error) {
+	resp, err := d.get(d.PageURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", d.PageURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Enough of the body to recognise a challenge page by.
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if isChallengePage(resp, body) {
+			return nil, errChallenge(d.PageURL)
+		}
+		return nil, fmt.Errorf("fetching %s: %s", d.PageURL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, &bodyError{URL: d.PageURL, Err: err}
+	}
+	if isChallengePage(resp, body) {
+		return nil, errChallenge(d.PageURL)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", d.PageURL, err)
+	}
+	return doc, nil
+}
+
+// challengeMarkers appear in the interstitial pages Cloudflare serves to
+// clients it wants to run a JavaScript or CAPTCHA check on.
+var challengeMarkers = []string{
+	"challenge-platform",
+	"cf-chl-",
+	"cf-browser-verification",
+	"<title>Just a moment...</title>",
+}
+
+// isChallengePage reports whether resp, with body, is a bot challenge
+// rather than the downloads page, which no amount of retrying gets past.
+func isChallengePage(resp *http.Response, body []byte) bool {
+	if resp.Header.Get("Cf-Mitigated") == "challenge" {
+		return true
+	}
+	for _, marker := range challengeMarkers {
+		if bytes.Contains(body, []byte(marker)) {
+			return true
+		}
+	}
+	return false
+}
+
+func errChallenge(url string) error {
+	return fmt.Errorf("fetching %s: the server answered with a Cloudflare challenge page instead of the downloads page; use the JSON feed with --list-url or a --mirror instead", url)
+}
+
+// bodyError reports a response body that broke off while being read.
+type bodyError struct {
+	URL string
+	Err error
+}
+
+func (e *bodyError) Error() string { return fmt.Sprintf("reading %s: %v", e.URL, e.Err) }
+
+func (e *bodyError) Unwrap() error { return e.Err }
+
+// brokenBody records the error a response body broke off with, telling a
+// download cut short apart from one that could not be written.
+type brokenBody struct {
+	r   io.Reader
+	err error
+}
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// pageVersionPattern matches the dotted versions linked from the downloads
+// page, capturing the major.
+var pageVersionPattern = regexp.MustCompile(`^(\d{1,3})(\.\d+)*$`)
+
+// versionFromHref extracts the version and its major from a downloads page
+// link such as
+// https://chromedriver.storage.googleapis.com/index.html?path=114.0.5735.90/.
+// Links of any other shape are rejected.
+func versionFromHref(href string) (version, major string, ok bool) {
+	if !strings.Contains(href, "https://chromedriver.storage.googleapis.com/index.html?") {
+		return "", "", false
+	}
+	parts := strings.Split(href, "=")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	version = strings.Replace(parts[1], "/", "", -1)
+	m := pageVersionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return "", "", false
+	}
+	return version, m[1], true
+}
+
+// majorOf returns the major component of a dotted version.
+func majorOf(version string) string {
+	return strings.SplitN(version, ".", 2)[0]
+}
+
+// sortVersions sorts dotted versions newest first, comparing each component
+// numerically so that 115.0.5790.102 sorts above 115.0.5790.98. Spellings of
+// the same version, such as 115.0 and 115.00, fall back to comparing as
+// strings, so the order never depends on the input's.
+func sortVersions(versions []string) {
+	sort.Slice(versions, func(i, j int) bool {
+		if c := compareVersions(versions[i], versions[j]); c != 0 {
+			return c > 0
+		}
+		return versions[i] > versions[j]
+	})
+}
+
+// compareVersions compares dotted versions component by component,
+// returning -1, 0 or 1 as a is older than, the same as or newer than b.
+func compareVersions(a, b string) int {
+	x, y := strings.Split(a, "."), strings.Split(b, ".")
+	for k := 0; k < len(x) && k < len(y); k++ {
+		m, _ := strconv.Atoi(x[k])
+		n, _ := strconv.Atoi(y[k])
+		if m != n {
+			if m > n {
+				return 1
+			}
+			return -1
+		}
+	}
+	switch {
+	case len(x) > len(y):
+		return 1
+	case len(x) < len(y):
+		return -1
+	}
+	return 0
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
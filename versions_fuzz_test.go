@@ -0,0 +1,40 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func FuzzVersionFromHref(f *testing.F) {
+	for _, seed := range []string{
+		"https://chromedriver.storage.googleapis.com/index.html?path=114.0.5735.90/",
+		"https://chromedriver.storage.googleapis.com/index.html?path=2.46/",
+		"https://chromedriver.storage.googleapis.com/index.html?path=/",
+		"https://chromedriver.storage.googleapis.com/index.html?path==1",
+		"https://chromedriver.chromium.org/downloads",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, href string) {
+		version, major, ok := versionFromHref(href)
+		if !ok {
+			if version != "" || major != "" {
+				t.Errorf("rejected %q but returned %q, %q", href, version, major)
+			}
+			return
+		}
+		if !isMajor(major) || len(major) > 3 {
+			t.Errorf("%q gave the major %q", href, major)
+		}
+		if majorOf(version) != major {
+			t.Errorf("%q gave %q, whose major is not %q", href, version, major)
+		}
+		if strings.ContainsAny(version, "/=?") {
+			t.Errorf("%q gave the version %q", href, version)
+		}
+	})
+}
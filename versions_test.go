@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVersionFromHref(t *testing.T) {
+	const base = "https://chromedriver.storage.googleapis.com/index.html?path="
+	for _, test := range []struct {
+		href           string
+		version, major string
+		ok             bool
+	}{
+		{base + "114.0.5735.90/", "114.0.5735.90", "114", true},
+		{base + "2.46/", "2.46", "2", true},
+		{base + "114", "114", "114", true},
+		{base + "/", "", "", false},
+		{base + "latest/", "", "", false},
+		{base + "1234.0/", "", "", false},
+		{base + ".114/", "", "", false},
+		{base + "114..90/", "", "", false},
+		{base + "114.0=5/", "", "", false},
+		{"https://example.com/index.html?path=114.0.5735.90/", "", "", false},
+		{"https://chromedriver.chromium.org/downloads", "", "", false},
+		{"", "", "", false},
+	} {
+		version, major, ok := versionFromHref(test.href)
+		if version != test.version || major != test.major || ok != test.ok {
+			t.Errorf("versionFromHref(%q) = %q, %q, %v; want %q, %q, %v", test.href, version, major, ok, test.version, test.major, test.ok)
+		}
+	}
+}
+
+func TestScrapeMalformedLinks(t *testing.T) {
+	s := newTestServer(t)
+	s.mux.HandleFunc("/downloads", func(w http.ResponseWriter, r *http.Request) {
+		const link = `<a href="https://chromedriver.storage.googleapis.com/index.html?path=%s">ChromeDriver</a>`
+		fmt.Fprintf(w, "<html><body>")
+		for _, path := range []string{"114.0.5735.90/", "113.0.5672.63/", "/", "x.1/", "114.0.5735.16/=a", ""} {
+			fmt.Fprintf(w, link+"\n", path)
+		}
+		fmt.Fprintf(w, `<a href="https://example.com/">elsewhere</a></body></html>`)
+	})
+	d := s.downloader()
+	d.PageURL = s.URL + "/downloads"
+	versions, err := d.scrapeVersions(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"113": {"113.0.5672.63"}, "114": {"114.0.5735.90"}}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("scraped %v, want %v", versions, want)
+	}
+}
+
+func TestListMemoized(t *testing.T) {
+	s := newTestServer(t)
+	s.mux.HandleFunc("/downloads", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><a href="https://chromedriver.storage.googleapis.com/index.html?path=114.0.5735.90/">ChromeDriver</a></body></html>`)
+	})
+	d := s.downloader()
+	d.PageURL = s.URL + "/downloads"
+	d.Sources = []VersionSource{pageSource{d}, feedSource{d}}
+	d.ListTTL = time.Minute
+
+	// Concurrent callers share a single fetch.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.List(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	list, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Versions["114"]) != 1 || len(list.Versions["115"]) != 2 {
+		t.Errorf("listed %v, want both sources merged", list.Versions)
+	}
+	for _, path := range []string{"/downloads", "/feed.json"} {
+		if n := s.hitCount(path); n != 1 {
+			t.Errorf("fetched %s %d times within the TTL, want once", path, n)
+		}
+	}
+
+	// Once the TTL is over, or with none, the list is fetched again.
+	d.ListTTL = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	d.List()
+	d.ListTTL = 0
+	d.List()
+	if n := s.hitCount("/feed.json"); n != 3 {
+		t.Errorf("fetched the feed %d times, want it refetched after the TTL and without one", n)
+	}
+
+	// Other sources within the TTL get their own list.
+	d.ListTTL = time.Minute
+	if _, err := d.List(); err != nil {
+		t.Fatal(err)
+	}
+	fetched := s.hitCount("/downloads")
+	d.Sources = []VersionSource{pageSource{d}}
+	list, err = d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Versions) != 1 || len(list.Versions["114"]) != 1 {
+		t.Errorf("with the page alone, listed %v, want its 114 only", list.Versions)
+	}
+	if n := s.hitCount("/downloads"); n != fetched+1 {
+		t.Errorf("fetched the page %d times, want it fetched for the new sources", n)
+	}
+}
+
+func TestScrapeRetriesTruncatedPage(t *testing.T) {
+	const page = `<html><body><a href="https://chromedriver.storage.googleapis.com/index.html?path=114.0.5735.90/">ChromeDriver</a></body></html>`
+	for _, test := range []struct {
+		truncated int
+		ok        bool
+	}{{1, true}, {3, false}} {
+		s := newTestServer(t)
+		served := 0
+		s.mux.HandleFunc("/downloads", func(w http.ResponseWriter, r *http.Request) {
+			if served++; served <= test.truncated {
+				// The connection breaks off half way through the page.
+				w.Header().Set("Content-Length", fmt.Sprint(len(page)))
+				fmt.Fprint(w, page[:len(page)/2])
+				return
+			}
+			fmt.Fprint(w, page)
+		})
+		d := s.downloader()
+		d.PageURL = s.URL + "/downloads"
+		d.Retries = 2
+		versions, err := d.scrapeVersions(false)
+		if !test.ok {
+			if !errors.As(err, new(*bodyError)) {
+				t.Errorf("%d truncated pages: got %v, want the read error once retries ran out", test.truncated, err)
+			}
+			if served != 3 {
+				t.Errorf("%d truncated pages: fetched %d times, want 3", test.truncated, served)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string][]string{"114": {"114.0.5735.90"}}; !reflect.DeepEqual(versions, want) {
+			t.Errorf("scraped %v after a retry, want %v", versions, want)
+		}
+		if served != 2 {
+			t.Errorf("fetched the page %d times, want 2", served)
+		}
+	}
+}
+
+func TestScrapeChallengePage(t *testing.T) {
+	const challenge = `<!DOCTYPE html><html><head><title>Just a moment...</title></head>` +
+		`<body><script src="/cdn-cgi/challenge-platform/h/g/orchestrate/chl_page/v1"></script></body></html>`
+	s := newTestServer(t)
+	s.mux.HandleFunc("/challenged", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, challenge)
+	})
+	s.mux.HandleFunc("/challenged-ok", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, challenge)
+	})
+	s.mux.HandleFunc("/mitigated", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cf-Mitigated", "challenge")
+		w.WriteHeader(http.StatusForbidden)
+	})
+	s.mux.HandleFunc("/forbidden", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	scrape := func(path string) error {
+		d := s.downloader()
+		d.PageURL = s.URL + path
+		_, err := d.scrapeVersions(false)
+		return err
+	}
+	for _, path := range []string{"/challenged", "/challenged-ok", "/mitigated"} {
+		want := "fetching " + s.URL + path + ": the server answered with a Cloudflare challenge page instead of the downloads page; use the JSON feed with --list-url or a --mirror instead"
+		if err := scrape(path); err == nil || err.Error() != want {
+			t.Errorf("%s: got %v, want the challenge reported", path, err)
+		}
+	}
+	// A plain refusal is not mistaken for one.
+	if err := scrape("/forbidden"); err == nil || err.Error() != "fetching "+s.URL+"/forbidden: 403 Forbidden" {
+		t.Errorf("/forbidden: got %v, want the status", err)
+	}
+}
+
+func TestScrapeFallbackSelectors(t *testing.T) {
+	s := newTestServer(t)
+	const link = `<a href="https://chromedriver.storage.googleapis.com/index.html?path=%s/">ChromeDriver %[1]s</a>`
+	// A redesign dropped the old link class: it is left on a link to
+	// something else, and the versions sit in a block of a newer theme.
+	s.mux.HandleFunc("/downloads", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><a class="XqQF9c" href="https://chromedriver.chromium.org/home">Home</a><div class="aw5Odc">`)
+		for _, version := range []string{"114.0.5735.90", "113.0.5672.63", "114.0.5735.16"} {
+			fmt.Fprintf(w, link, version)
+		}
+		fmt.Fprintf(w, `</div><p>`+link+`</p></body></html>`, "2.46")
+	})
+	var log bytes.Buffer
+	d := s.downloader()
+	d.PageURL = s.URL + "/downloads"
+	d.Verbose = true
+	d.Log = &log
+	versions, err := d.scrapeVersions(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{"113": {"113.0.5672.63"}, "114": {"114.0.5735.90", "114.0.5735.16"}}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("scraped %v, want %v from the newer theme's block only", versions, want)
+	}
+	if !strings.Contains(log.String(), `downloads page links matched ".aw5Odc a"`) {
+		t.Errorf("logged %q, want the fallback selector named", log.String())
+	}
+}
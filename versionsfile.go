@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readVersionsFile reads the version specs listed one per line in path.
+// Blank lines are skipped and '#' starts a comment. Every malformed line is
+// reported together, so a long list can be fixed in one go.
+func readVersionsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var specs, bad []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !isVersionSpec(line) {
+			bad = append(bad, fmt.Sprintf("line %d: %q", n, line))
+			continue
+		}
+		specs = append(specs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if len(bad) > 0 {
+		return nil, fmt.Errorf("%s: malformed versions: %s", path, strings.Join(bad, "; "))
+	}
+	return specs, nil
+}
+
+// isVersionSpec reports whether spec is something --version accepts: a
+// major, a dotted version, "latest" or "<major>.latest".
+func isVersionSpec(spec string) bool {
+	if major, ok := latestSpec(spec); ok {
+		return major == "" || isMajor(major)
+	}
+	for _, part := range strings.Split(spec, ".") {
+		if !isMajor(part) || strings.HasPrefix(part, "-") || strings.HasPrefix(part, "+") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersionsFile(t *testing.T) {
+	s := newTestServer(t)
+	list := filepath.Join(t.TempDir(), "versions.txt")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(list, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# the versions CI tests against\n\n115.0.5790.98\n   \n  116  # stable\n#120\n")
+	if _, _, err := runCLI(t, s.args(t, t.TempDir(), "--versions-file", list)...); err != nil {
+		t.Fatal(err)
+	}
+	for version, want := range map[string]int{
+		"115.0.5790.98":  1,
+		testStable:       1,
+		"115.0.5790.102": 0,
+		testPrerelease:   0,
+	} {
+		if n := s.hitCount("/dl/" + version + "/linux64/chromedriver-linux64.zip"); n != want {
+			t.Errorf("downloaded %s %d times, want %d", version, n, want)
+		}
+	}
+
+	write("115\nnot-a-version\n# fine\n116.x\n")
+	_, _, err := runCLI(t, s.args(t, t.TempDir(), "--versions-file", list)...)
+	if err == nil || !strings.Contains(err.Error(), `line 2: "not-a-version"; line 4: "116.x"`) {
+		t.Errorf("got %v, want both malformed lines reported", err)
+	}
+	if n := s.hitCount("/dl/115.0.5790.102/linux64/chromedriver-linux64.zip"); n != 0 {
+		t.Errorf("a malformed file still downloaded 115")
+	}
+}
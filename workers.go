@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AutoWorkers as Downloader.ExtractWorkers picks the number of extraction
+// workers by measuring the filesystem being extracted to.
+const AutoWorkers = -1
+
+// probeSize is the size of each file written while measuring a filesystem.
+// It is synced to disk, so caching does not hide a slow device.
+const probeSize = 128 << 10
+
+// tunedWorkers remembers the worker count measured for each directory, so
+// a batch measures its filesystem once.
+var tunedWorkers = struct {
+	sync.Mutex
+	byDir map[string]int
+}{byDir: map[string]int{}}
+
+// parseWorkers parses --extract-workers, a positive count or "auto".
+func parseWorkers(s string) (int, error) {
+	if s == "auto" {
+		return AutoWorkers, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid --extract-workers %q: want a positive number or auto", s)
+	}
+	return n, nil
+}
+
+// extractWorkers returns how many archive entries to write at once into
+// dir. The automatic count is measured on the nearest existing directory
+// at or above dir, since dir itself may not be created yet.
+func (d *Downloader) extractWorkers(dir string) int {
+	if d.ExtractWorkers != AutoWorkers {
+		return d.ExtractWorkers
+	}
+	probeDir := existingDir(dir)
+	tunedWorkers.Lock()
+	defer tunedWorkers.Unlock()
+	if n, ok := tunedWorkers.byDir[probeDir]; ok {
+		return n
+	}
+	start := time.Now()
+	n := tuneWorkers(runtime.NumCPU(), func(workers int) (time.Duration, error) {
+		return probeWrites(probeDir, workers)
+	})
+	d.verbosef("using %d extraction workers for %s, measured in %s\n", n, probeDir, time.Since(start).Round(time.Millisecond))
+	tunedWorkers.byDir[probeDir] = n
+	return n
+}
+
+// tuneWorkers doubles the worker count from 1 up to max for as long as
+// each step raises the throughput measure reports by at least a tenth, and
+// returns the last count that did. measure writes one probe file per
+// worker, all at once, and returns how long they took. When measuring
+// fails, max is used.
+func tuneWorkers(max int, measure func(workers int) (time.Duration, error)) int {
+	if max < 1 {
+		return 1
+	}
+	best, bestRate := 0, 0.0
+	for workers := 1; ; workers *= 2 {
+		if workers > max {
+			workers = max
+		}
+		took, err := measure(workers)
+		if err != nil {
+			return max
+		}
+		if took <= 0 {
+			took = time.Nanosecond
+		}
+		rate := float64(workers) / took.Seconds()
+		if best > 0 && rate < bestRate*1.1 {
+			break
+		}
+		best, bestRate = workers, rate
+		if workers == max {
+			break
+		}
+	}
+	return best
+}
+
+// probeWrites writes and syncs workers files of probeSize at once in a
+// temporary directory under dir, removed afterwards, and returns how long
+// the writes took.
+func probeWrites(dir string, workers int) (time.Duration, error) {
+	tmp, cleanup, err := createTemp(dir, ".getchromedriver-probe-*")
+	if err != nil {
+		return 0, err
+	}
+	defer cleanup()
+
+	data := make([]byte, probeSize)
+	errs := make(chan error, workers)
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		path := filepath.Join(tmp, strconv.Itoa(i))
+		go func() {
+			errs <- writeSynced(path, data)
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return time.Since(start), err
+}
+
+func writeSynced(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// existingDir returns dir, or its nearest ancestor that exists.
+func existingDir(dir string) string {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
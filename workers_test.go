@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestTuneWorkers(t *testing.T) {
+	const write = 10 * time.Millisecond
+	for _, test := range []struct {
+		name string
+		max  int
+		// took is how long the simulated filesystem takes to write one
+		// probe file per worker, all at once.
+		took func(workers int) time.Duration
+		want int
+		// tried are the worker counts measured, in order.
+		tried []int
+	}{
+		// A spinning disk writes one file at a time, so more workers only
+		// queue up.
+		{"serial", 16, func(w int) time.Duration { return time.Duration(w) * write }, 1, []int{1, 2}},
+		// An SSD with four queues writes four files in the time of one.
+		{"four queues", 16, func(w int) time.Duration { return time.Duration((w+3)/4) * write }, 4, []int{1, 2, 4, 8}},
+		// A fast one keeps up with every worker allowed.
+		{"parallel", 8, func(w int) time.Duration { return write }, 8, []int{1, 2, 4, 8}},
+		// The last step is capped at max.
+		{"capped", 6, func(w int) time.Duration { return write }, 6, []int{1, 2, 4, 6}},
+		// A gain of under a tenth is not worth the extra worker.
+		{"marginal", 16, func(w int) time.Duration {
+			if w == 1 {
+				return write
+			}
+			return time.Duration(float64(w) * float64(write) / 1.05)
+		}, 1, []int{1, 2}},
+	} {
+		var tried []int
+		got := tuneWorkers(test.max, func(workers int) (time.Duration, error) {
+			tried = append(tried, workers)
+			return test.took(workers), nil
+		})
+		if got != test.want {
+			t.Errorf("%s: chose %d workers, want %d", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(tried, test.tried) {
+			t.Errorf("%s: measured %v, want %v", test.name, tried, test.tried)
+		}
+	}
+
+	// Measuring that fails falls back to max.
+	failing := func(workers int) (time.Duration, error) {
+		if workers > 1 {
+			return 0, errors.New("no space left on device")
+		}
+		return write, nil
+	}
+	if got := tuneWorkers(8, failing); got != 8 {
+		t.Errorf("with measuring failing: chose %d workers, want 8", got)
+	}
+	if got := tuneWorkers(0, failing); got != 1 {
+		t.Errorf("with a max of 0: chose %d workers, want 1", got)
+	}
+}
+
+func TestExtractWorkersAuto(t *testing.T) {
+	d := NewDownloader()
+	var log bytes.Buffer
+	d.Log = &log
+	d.Verbose = true
+	d.ExtractWorkers = AutoWorkers
+	dir := t.TempDir()
+	// The output directory is made by the install; its parent is measured.
+	n := d.extractWorkers(filepath.Join(dir, "116.0.5845.96", "chromedriver-linux64"))
+	if n < 1 || n > runtime.NumCPU() {
+		t.Errorf("chose %d workers, want 1 to %d", n, runtime.NumCPU())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("measuring left %s behind", entries[0].Name())
+	}
+	want := fmt.Sprintf("using %d extraction workers for %s, measured in ", n, dir)
+	if !bytes.Contains(log.Bytes(), []byte(want)) {
+		t.Errorf("logged %q, want %q", log.String(), want)
+	}
+	// A batch measures its filesystem once.
+	log.Reset()
+	if again := d.extractWorkers(filepath.Join(dir, "115.0.5790.102")); again != n || log.Len() != 0 {
+		t.Errorf("measured %s again: %d workers, logged %q", dir, again, log.String())
+	}
+
+	d.ExtractWorkers = 3
+	if n := d.extractWorkers(dir); n != 3 {
+		t.Errorf("a fixed count of 3 gave %d workers", n)
+	}
+}
+
+func TestParseWorkers(t *testing.T) {
+	for s, want := range map[string]int{"auto": AutoWorkers, "1": 1, "8": 8} {
+		if got, err := parseWorkers(s); err != nil || got != want {
+			t.Errorf("parseWorkers(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"0", "-1", "-8", "", "four", "2x", "auto2", "1.5"} {
+		if _, err := parseWorkers(s); err == nil {
+			t.Errorf("parseWorkers(%q) accepted it", s)
+		}
+	}
+	c, err := newCLI([]string{"--extract-workers", "0"}, &bytes.Buffer{}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.newDownloaderFromFlags(); err == nil {
+		t.Error("--extract-workers=0 was accepted")
+	}
+}
+
+// BenchmarkExtractWorkers extracts a browser-sized archive of many small
+// files with one worker, one per CPU and the automatic count, measuring
+// included, into a fresh directory each time as separate runs would.
+func BenchmarkExtractWorkers(b *testing.B) {
+	// Random content, which does not compress past the archive limits.
+	rnd := rand.New(rand.NewSource(1))
+	files := map[string]string{}
+	for i := 0; i < 400; i++ {
+		content := make([]byte, 16<<10)
+		rnd.Read(content)
+		files[fmt.Sprintf("chrome-linux64/locales/%03d.pak", i)] = string(content)
+	}
+	src := filepath.Join(b.TempDir(), "chrome-linux64.zip")
+	if err := os.WriteFile(src, testZip(b, files), 0644); err != nil {
+		b.Fatal(err)
+	}
+	for _, run := range []struct {
+		name    string
+		workers int
+	}{{"fixed-1", 1}, {"fixed-numcpu", runtime.NumCPU()}, {"auto", AutoWorkers}} {
+		workers := run.workers
+		b.Run(run.name, func(b *testing.B) {
+			d := NewDownloader()
+			d.Log = ioutil.Discard
+			d.ExtractWorkers = workers
+			for i := 0; i < b.N; i++ {
+				if _, err := d.Extract(src, b.TempDir()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}